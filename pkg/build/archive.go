@@ -15,10 +15,12 @@
 package build
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	"istio.io/istio/pkg/log"
 
@@ -26,103 +28,78 @@ import (
 	"github.com/alauda-mesh/release-builder/pkg/util"
 )
 
+// istioctlMakeTimeout limits how long building istioctl for every platform may run
+var istioctlMakeTimeout = time.Hour
+
+// strippedLdflags are the linker flags istioctl is built with if the manifest strips it, dropping the symbol table and
+// DWARF debug info. The istio build appends the -X flags stamping the version to LDFLAGS, so stamping is unaffected.
+const strippedLdflags = "-extldflags -static -s -w"
+
 // Archive creates the release archive that users will download. This includes the installation templates,
 // istioctl, and various tools.
-func Archive(manifest model.Manifest) error {
+func Archive(ctx context.Context, manifest model.Manifest) error {
+	// Reject unknown architectures before spending time building istioctl for them
+	for _, arch := range manifest.GetArchiveArchitectures() {
+		if _, err := util.ToDockerArch(arch); err != nil {
+			return err
+		}
+	}
+
 	// First, build all variants of istioctl (linux, osx, windows).
-	if err := util.RunMake(manifest, "istio", nil, "istioctl-all", "istioctl.completion"); err != nil {
+	var env []string
+	if manifest.StripIstioctl {
+		env = append(env, "LDFLAGS="+strippedLdflags)
+	}
+	if err := util.RunMakeContext(ctx, manifest, "istio", env, istioctlMakeTimeout, "istioctl-all", "istioctl.completion"); err != nil {
 		return fmt.Errorf("failed to make istioctl: %v", err)
 	}
-
-	// We build archives for each arch. These contain the same thing except arch specific istioctl
-	for _, arch := range []string{"linux-amd64", "linux-armv7", "linux-arm64", "osx-amd64", "osx-arm64", "win-amd64"} {
-		out := path.Join(manifest.Directory, "work", "archive", arch, fmt.Sprintf("istio-%s", manifest.Version))
-		if err := os.MkdirAll(out, 0o750); err != nil {
-			return err
+	if manifest.AdditionalCompletions {
+		if err := generateCompletions(manifest); err != nil {
+			return fmt.Errorf("failed to generate istioctl completions: %v", err)
 		}
+	}
 
-		// Some files we just directly copy into the release archive
-		directCopies := []string{
-			"LICENSE",
-			"README.md",
-		}
-		for _, file := range directCopies {
-			if err := util.CopyFile(path.Join(manifest.RepoDir("istio"), file), path.Join(out, file)); err != nil {
-				return err
-			}
-		}
+	// Every archive shares the same build info, so it is only captured once
+	buildInfo := newBuildInfo(manifest)
 
-		// Set up tools/certs. We filter down to only some file patterns
-		includePatterns := []string{"README.md", "Makefile*", "common.mk"}
-		if err := util.CopyDirFiltered(path.Join(manifest.RepoDir("istio"), "tools", "certs"), path.Join(out, "tools", "certs"), includePatterns); err != nil {
-			return err
+	var notices []byte
+	if manifest.ThirdPartyNotices {
+		var err error
+		if notices, err = thirdPartyNotices(manifest); err != nil {
+			return fmt.Errorf("failed to generate third party notices: %v", err)
 		}
+	}
 
-		// Set up samples. We filter down to only some file patterns
-		// TODO - clean this up. We probably include files we don't want and exclude files we do want.
-		includePatterns = []string{"*.yaml", "*.md", "*.sh", "*.txt", "*.pem", "*.conf", "*.tpl", "*.json", "Makefile"}
-		if err := util.CopyDirFiltered(path.Join(manifest.RepoDir("istio"), "samples"), path.Join(out, "samples"), includePatterns); err != nil {
+	// We build archives for each arch. These contain the same thing except arch specific istioctl, so everything
+	// else is staged once and linked into the directory of each arch.
+	staged, err := stageArchive(manifest, buildInfo, notices)
+	if err != nil {
+		return err
+	}
+	for _, arch := range manifest.GetArchiveArchitectures() {
+		out, err := archiveDir(manifest, arch, staged)
+		if err != nil {
 			return err
 		}
 
-		manifestsDir := path.Join(out, "manifests")
-		if err := os.MkdirAll(manifestsDir, 0o755); err != nil {
-			return err
-		}
-		if err := util.CopyDir(path.Join(manifest.RepoDir("istio"), "manifests", "charts"), manifestsDir); err != nil {
-			return err
-		}
-		if err := util.CopyDir(path.Join(manifest.RepoDir("istio"), "manifests", "profiles"), manifestsDir); err != nil {
+		if err := createArchive(arch, manifest, out); err != nil {
 			return err
 		}
 
-		if err := updateValues(manifest, path.Join(out, "manifests/profiles/default.yaml")); err != nil {
-			return fmt.Errorf("failed to sanitize istioctl profiles: %v", err)
-		}
-
-		// Write manifest
-		if err := writeManifest(manifest, out); err != nil {
-			return fmt.Errorf("failed to write manifest: %v", err)
-		}
-
-		// Copy the istioctl binary over
-		istioctlBinary := fmt.Sprintf("istioctl-%s", arch)
-		istioctlDest := "istioctl"
-		// The istioctl binaries for MacOS and Windows do not have the `-amd64` so remove from name.
-		// Windows also needs the `.exe` added.
-		if arch == "osx-amd64" {
-			istioctlBinary = istioctlBinary[:strings.LastIndexByte(istioctlBinary, '-')]
-		}
-		if arch == "win-amd64" {
-			istioctlBinary = istioctlBinary[:strings.LastIndexByte(istioctlBinary, '-')] + ".exe"
-			istioctlDest += ".exe"
-		}
-		if err := util.CopyFile(path.Join(manifest.RepoOutDir("istio"), istioctlBinary), path.Join(out, "bin", istioctlDest)); err != nil {
-			return err
-		}
-		if err := os.Chmod(path.Join(out, "bin", istioctlDest), 0o755); err != nil {
+		if err := createStandaloneIstioctl(arch, manifest, out); err != nil {
 			return err
 		}
 
-		// Copy the istioctl completions files to the tools directory
-		completionFiles := []string{"istioctl.bash", "_istioctl"}
-		for _, file := range completionFiles {
-			if err := util.CopyFile(path.Join(manifest.RepoOutDir("istio"), file), path.Join(out, "tools", file)); err != nil {
+		if manifest.ToolsArchive {
+			if err := createToolsArchive(arch, manifest, out); err != nil {
 				return err
 			}
 		}
 
-		if err := createArchive(arch, manifest, out); err != nil {
-			return err
-		}
-
-		if err := createStandaloneIstioctl(arch, manifest, out); err != nil {
-			return err
-		}
-
 		// Handle creating additional archives of the older deprecated names.
 		// This is slower than simply copying the files, but keeps the change in one location.
 		// TODO - When we no longer need the older archives we can remove this creation.
+		// As these are copies of the osx-amd64 and win-amd64 archives, they are skipped along with them.
 		if arch == "osx-amd64" || arch == "win-amd64" {
 			additionalArch := arch[:strings.IndexByte(arch, '-')]
 			if err := createArchive(additionalArch, manifest, out); err != nil {
@@ -134,6 +111,150 @@ func Archive(manifest model.Manifest) error {
 			}
 		}
 	}
+
+	if manifest.CosignSigning != nil {
+		if err := signArchives(manifest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stageArchive writes the content shared by the archives of every arch to a staging directory, returning its path
+func stageArchive(manifest model.Manifest, buildInfo model.BuildInfo, notices []byte) (string, error) {
+	out := path.Join(manifest.WorkDir(), "archive", "staging", fmt.Sprintf("istio-%s", manifest.Version))
+	// Files left by an earlier build would otherwise end up in the archives
+	if err := os.RemoveAll(out); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(out, 0o750); err != nil {
+		return "", err
+	}
+
+	// Some files we just directly copy into the release archive
+	directCopies := []string{
+		"LICENSE",
+		"README.md",
+	}
+	for _, file := range directCopies {
+		if err := util.CopyFile(path.Join(manifest.RepoDir("istio"), file), path.Join(out, file)); err != nil {
+			return "", err
+		}
+	}
+
+	// Set up tools/certs. We filter down to only some file patterns
+	includePatterns := []string{"README.md", "Makefile*", "common.mk"}
+	if err := util.CopyDirFiltered(path.Join(manifest.RepoDir("istio"), "tools", "certs"), path.Join(out, "tools", "certs"), includePatterns); err != nil {
+		return "", err
+	}
+
+	// Set up samples. We filter down to only some file patterns
+	// TODO - clean this up. We probably include files we don't want and exclude files we do want.
+	includePatterns = []string{"*.yaml", "*.md", "*.sh", "*.txt", "*.pem", "*.conf", "*.tpl", "*.json", "Makefile"}
+	if err := util.CopyDirFiltered(path.Join(manifest.RepoDir("istio"), "samples"), path.Join(out, "samples"), includePatterns); err != nil {
+		return "", err
+	}
+
+	manifestsDir := path.Join(out, model.ArchiveManifestsDir)
+	if err := os.MkdirAll(manifestsDir, 0o755); err != nil {
+		return "", err
+	}
+	if err := util.CopyDir(path.Join(manifest.RepoDir("istio"), model.ArchiveChartsDir), manifestsDir); err != nil {
+		return "", err
+	}
+	if err := util.CopyDir(path.Join(manifest.RepoDir("istio"), model.ArchiveProfilesDir), manifestsDir); err != nil {
+		return "", err
+	}
+
+	if err := updateValues(manifest, path.Join(out, model.ArchiveDefaultProfile)); err != nil {
+		return "", fmt.Errorf("failed to sanitize istioctl profiles: %v", err)
+	}
+
+	// Write manifest
+	if err := writeManifest(manifest, out); err != nil {
+		return "", fmt.Errorf("failed to write manifest: %v", err)
+	}
+
+	if manifest.EmbedBuildInfo {
+		if err := writeBuildInfo(buildInfo, out); err != nil {
+			return "", err
+		}
+	}
+
+	if notices != nil {
+		if err := os.WriteFile(path.Join(out, "THIRD_PARTY_NOTICES.txt"), notices, 0o644); err != nil {
+			return "", err
+		}
+	}
+
+	// Copy the istioctl completions files to the tools directory
+	completionFiles := []string{"istioctl.bash", "_istioctl"}
+	if manifest.AdditionalCompletions {
+		completionFiles = append(completionFiles, "istioctl.fish", "istioctl.ps1")
+	}
+	for _, file := range completionFiles {
+		if err := util.CopyFile(path.Join(manifest.RepoOutDir("istio"), file), path.Join(out, "tools", file)); err != nil {
+			return "", err
+		}
+	}
+	return out, nil
+}
+
+// archiveDir creates the directory to archive for an arch, linking the staged content and adding the istioctl binary
+func archiveDir(manifest model.Manifest, arch string, staged string) (string, error) {
+	out := path.Join(manifest.WorkDir(), "archive", arch, fmt.Sprintf("istio-%s", manifest.Version))
+	if err := os.RemoveAll(out); err != nil {
+		return "", err
+	}
+	if err := util.LinkDir(staged, out); err != nil {
+		return "", fmt.Errorf("failed to link archive content for %v: %v", arch, err)
+	}
+
+	// Copy the istioctl binary over
+	istioctlBinary := fmt.Sprintf("istioctl-%s", arch)
+	istioctlDest := "istioctl"
+	// The istioctl binaries for MacOS and Windows do not have the `-amd64` so remove from name.
+	// Windows also needs the `.exe` added.
+	if arch == "osx-amd64" {
+		istioctlBinary = istioctlBinary[:strings.LastIndexByte(istioctlBinary, '-')]
+	}
+	if arch == "win-amd64" {
+		istioctlBinary = istioctlBinary[:strings.LastIndexByte(istioctlBinary, '-')] + ".exe"
+		istioctlDest += ".exe"
+	}
+	if err := util.CopyFile(path.Join(manifest.RepoOutDir("istio"), istioctlBinary), path.Join(out, "bin", istioctlDest)); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(path.Join(out, "bin", istioctlDest), 0o755); err != nil {
+		return "", err
+	}
+	// Record a checksum of the binary, for users extracting only istioctl from the archive
+	if err := createSha(manifest, path.Join(out, "bin", istioctlDest)); err != nil {
+		return "", fmt.Errorf("failed to create istioctl checksum: %v", err)
+	}
+	return out, nil
+}
+
+// generateCompletions writes the completions not produced by the istioctl.completion make target next to the others
+func generateCompletions(manifest model.Manifest) error {
+	istioctl := path.Join(manifest.RepoOutDir("istio"), "istioctl-linux-amd64")
+	completions := map[string]string{
+		"fish":       "istioctl.fish",
+		"powershell": "istioctl.ps1",
+	}
+	for shell, file := range completions {
+		f, err := os.Create(path.Join(manifest.RepoOutDir("istio"), file))
+		if err != nil {
+			return err
+		}
+		cmd := util.VerboseCommand(istioctl, "completion", shell)
+		cmd.Stdout = f
+		err = util.RunSummarized(cmd)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%v completion: %v", shell, err)
+		}
+	}
 	return nil
 }
 
@@ -148,11 +269,14 @@ func createStandaloneIstioctl(arch string, manifest model.Manifest, out string)
 		}
 	} else {
 		istioctlArchive = fmt.Sprintf("istioctl-%s-%s.tar.gz", manifest.Version, arch)
-		icmd := util.VerboseCommand("tar", "-czf", istioctlArchive, "istioctl")
-		icmd.Dir = path.Join(out, "bin")
-		if err := icmd.Run(); err != nil {
+		if err := util.TarGz(path.Join(out, "bin"), istioctlArchive, manifest.GetGzipLevel(), "istioctl"); err != nil {
 			return fmt.Errorf("failed to tar istioctl: %v", err)
 		}
+		if manifest.UncompressedArchives {
+			if err := createUncompressedArchive(manifest, path.Join(out, "bin"), strings.TrimSuffix(istioctlArchive, ".gz"), "istioctl"); err != nil {
+				return err
+			}
+		}
 	}
 	// Move file over to the output directory. We move the file because we may reuse the directory for
 	// another archive (in the case of created a non-arch named archive). Also add a log message.
@@ -164,28 +288,59 @@ func createStandaloneIstioctl(arch string, manifest model.Manifest, out string)
 	}
 
 	// Create a SHA of the archive
-	if err := util.CreateSha(dest); err != nil {
+	if err := createSha(manifest, dest); err != nil {
 		return fmt.Errorf("failed to package %v: %v", dest, err)
 	}
 	return nil
 }
 
+// createToolsArchive creates the istio-tools archive for an arch, containing only model.ToolsArchiveDirs of the release
+// archive directory out
+func createToolsArchive(arch string, manifest model.Manifest, out string) error {
+	tools := path.Join(manifest.WorkDir(), "archive", arch, "tools", fmt.Sprintf("istio-%s", manifest.Version))
+	if err := os.RemoveAll(tools); err != nil {
+		return err
+	}
+	for _, dir := range model.ToolsArchiveDirs {
+		if err := util.LinkDir(path.Join(out, dir), path.Join(tools, dir)); err != nil {
+			return fmt.Errorf("failed to link tools archive content for %v: %v", arch, err)
+		}
+	}
+	return packageArchive("istio-tools", arch, manifest, tools)
+}
+
+// archiveName returns the file name of the archive of an arch. Windows should use zip, linux and osx tar.
+func archiveName(name, version, arch string) string {
+	if strings.HasPrefix(arch, "win") {
+		return fmt.Sprintf("%s-%s-%s.zip", name, version, arch)
+	}
+	return fmt.Sprintf("%s-%s-%s.tar.gz", name, version, arch)
+}
+
 func createArchive(arch string, manifest model.Manifest, out string) error {
-	var archive string
+	return packageArchive("istio", arch, manifest, out)
+}
+
+// packageArchive archives the directory out as the archive name of an arch, writing it and its checksums to the
+// output directory
+func packageArchive(name string, arch string, manifest model.Manifest, out string) error {
+	archive := archiveName(name, manifest.Version, arch)
+	dir := path.Base(out)
 	// Create the archive from all the above files
-	// Windows should use zip, linux and osx tar
 	if strings.HasPrefix(arch, "win") {
-		archive = fmt.Sprintf("istio-%s-%s.zip", manifest.Version, arch)
-		if err := util.ZipFolder(path.Join(out, "..", fmt.Sprintf("istio-%s", manifest.Version)), path.Join(out, "..", archive)); err != nil {
-			return fmt.Errorf("failed to zip istioctl: %v", err)
+		if err := util.ZipFolder(out, path.Join(out, "..", archive)); err != nil {
+			return fmt.Errorf("failed to zip %v: %v", archive, err)
 		}
 	} else {
-		archive = fmt.Sprintf("istio-%s-%s.tar.gz", manifest.Version, arch)
-		cmd := util.VerboseCommand("tar", "-czf", archive, fmt.Sprintf("istio-%s", manifest.Version))
-		cmd.Dir = path.Join(out, "..")
-		if err := cmd.Run(); err != nil {
+		if err := util.TarGz(path.Join(out, ".."), archive, manifest.GetGzipLevel(), dir); err != nil {
 			return err
 		}
+		if manifest.UncompressedArchives {
+			err := createUncompressedArchive(manifest, path.Join(out, ".."), strings.TrimSuffix(archive, ".gz"), dir)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	// Copy files over to the output directory
@@ -195,7 +350,19 @@ func createArchive(arch string, manifest model.Manifest, out string) error {
 		return fmt.Errorf("failed to package %v release archive: %v", arch, err)
 	}
 	// Create a SHA of the archive
-	if err := util.CreateSha(dest); err != nil {
+	if err := createSha(manifest, dest); err != nil {
+		return fmt.Errorf("failed to package %v: %v", dest, err)
+	}
+	return nil
+}
+
+// createUncompressedArchive writes an uncompressed tar of src, relative to dir, to the output directory with its checksums
+func createUncompressedArchive(manifest model.Manifest, dir string, archive string, src string) error {
+	dest := path.Join(manifest.OutDir(), archive)
+	if _, err := util.Run(util.RunOptions{Dir: dir}, "tar", "-cf", dest, src); err != nil {
+		return fmt.Errorf("failed to create %v: %v", archive, err)
+	}
+	if err := createSha(manifest, dest); err != nil {
 		return fmt.Errorf("failed to package %v: %v", dest, err)
 	}
 	return nil
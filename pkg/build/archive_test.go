@@ -0,0 +1,180 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+	"github.com/alauda-mesh/release-builder/pkg/testutil"
+)
+
+func TestArchiveDirs(t *testing.T) {
+	manifest := writeArchiveSources(t)
+	staged, err := stageArchive(manifest, model.BuildInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected map[string]string
+	for _, arch := range []string{"linux-amd64", "linux-arm64", "osx-amd64"} {
+		out, err := archiveDir(manifest, arch, staged)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content := readTree(t, out)
+		if !strings.HasPrefix(content["bin/istioctl"], "istioctl-"+strings.TrimSuffix(arch, "-amd64")) {
+			t.Fatalf("%v: expected istioctl for the arch, got %q", arch, content["bin/istioctl"])
+		}
+		for name := range content {
+			if strings.HasPrefix(name, "bin/") {
+				delete(content, name)
+			}
+		}
+		if expected == nil {
+			expected = content
+			continue
+		}
+		if !reflect.DeepEqual(content, expected) {
+			t.Fatalf("%v: expected the same content as the other archives:\n%v\ngot:\n%v", arch, expected, content)
+		}
+	}
+	for _, name := range []string{"tools/certs/cert.go", "samples/hello/main.go"} {
+		if _, f := expected[name]; f {
+			t.Fatalf("expected %v to be excluded from the archive", name)
+		}
+	}
+	for _, name := range []string{"manifest.yaml", "tools/istioctl.bash", "samples/hello/hello.yaml", "manifests/charts/base/Chart.yaml"} {
+		if _, f := expected[name]; !f {
+			t.Fatalf("expected %v in the archive, got %v", name, expected)
+		}
+	}
+	if got := expected["manifests/profiles/default.yaml"]; !strings.Contains(got, "hub: gcr.io/istio-release") {
+		t.Fatalf("expected profile hub to be updated, got %q", got)
+	}
+}
+
+func TestToolsArchive(t *testing.T) {
+	manifest := writeArchiveSources(t)
+	if err := os.MkdirAll(manifest.OutDir(), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	staged, err := stageArchive(manifest, model.BuildInfo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := archiveDir(manifest, "linux-amd64", staged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := createToolsArchive("linux-amd64", manifest, out); err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(manifest.OutDir(), "istio-tools-1.2.3-linux-amd64.tar.gz")
+	if _, err := os.Stat(archive + ".sha256"); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := map[string]struct{}{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			entries[hdr.Name] = struct{}{}
+		}
+	}
+	for _, name := range []string{"bin/istioctl", "tools/istioctl.bash", "tools/certs/Makefile.selfsigned.mk", "samples/hello/hello.yaml"} {
+		if _, f := entries["istio-1.2.3/"+name]; !f {
+			t.Fatalf("expected %v in the tools archive, got %v", name, entries)
+		}
+	}
+	for _, name := range []string{"manifest.yaml", "LICENSE", "manifests/charts/base/Chart.yaml"} {
+		if _, f := entries["istio-1.2.3/"+name]; f {
+			t.Fatalf("expected %v to be excluded from the tools archive", name)
+		}
+	}
+}
+
+// writeArchiveSources writes the istio sources and build outputs the archive is created from
+func writeArchiveSources(t *testing.T) model.Manifest {
+	t.Helper()
+	manifest := model.Manifest{
+		Directory: t.TempDir(),
+		Version:   "1.2.3",
+		Docker:    "gcr.io/istio-release",
+	}
+	files := map[string]string{
+		"LICENSE":                            "license",
+		"README.md":                          "readme",
+		"tools/certs/Makefile.selfsigned.mk": "certs",
+		"tools/certs/cert.go":                "excluded",
+		"samples/hello/hello.yaml":           "kind: Service",
+		"samples/hello/main.go":              "excluded",
+		"manifests/charts/base/Chart.yaml":   "name: base",
+		"manifests/profiles/default.yaml":    "spec:\n  hub: gcr.io/istio-testing\n",
+	}
+	for name, content := range files {
+		testutil.WriteFile(t, filepath.Join(manifest.RepoDir("istio"), name), content)
+	}
+	for _, name := range []string{"istioctl.bash", "_istioctl", "istioctl-linux-amd64", "istioctl-linux-arm64", "istioctl-osx"} {
+		testutil.WriteFile(t, filepath.Join(manifest.RepoOutDir("istio"), name), name)
+	}
+	return manifest
+}
+
+// readTree returns the content of each file below dir, keyed by its relative path
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	content := map[string]string{}
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		by, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		content[rel] = string(by)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
@@ -15,10 +15,15 @@
 package build
 
 import (
+	"context"
 	"fmt"
+	"maps"
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 
 	"istio.io/istio/pkg/log"
 	"sigs.k8s.io/yaml"
@@ -27,109 +32,294 @@ import (
 	"github.com/alauda-mesh/release-builder/pkg/util"
 )
 
-// Build will create all artifacts required by the manifest
-// This assumes the working directory has been setup and sources resolved.
-func Build(manifest model.Manifest) error {
-	if _, f := manifest.BuildOutputs[model.Docker]; f {
-		if err := Docker(manifest); err != nil {
-			return fmt.Errorf("failed to build Docker: %v", err)
+// buildStepPrerequisites defines the steps whose output another step consumes
+var buildStepPrerequisites = map[model.BuildStep][]model.BuildStep{
+	model.StepSbom: {model.StepDocker, model.StepHelm, model.StepArchive},
+}
+
+// BuildSelector selects which steps of the build to run. An empty selector runs all steps.
+type BuildSelector map[model.BuildStep]struct{}
+
+// ParseBuildSelector creates a BuildSelector from a list of step names
+func ParseBuildSelector(steps []string) (BuildSelector, error) {
+	selector := BuildSelector{}
+	for _, s := range steps {
+		step := model.BuildStep(strings.ToLower(s))
+		switch step {
+		case model.StepDocker, model.StepHelm, model.StepPackages, model.StepArchive, model.StepGrafana, model.StepMetadata, model.StepLicenses, model.StepSbom, model.StepIndex:
+			selector[step] = struct{}{}
+		default:
+			return nil, fmt.Errorf("unknown build step: %v", s)
 		}
 	}
+	if err := selector.Validate(); err != nil {
+		return nil, err
+	}
+	return selector, nil
+}
+
+// Has returns true if the step should run
+func (s BuildSelector) Has(step model.BuildStep) bool {
+	if len(s) == 0 {
+		return true
+	}
+	_, f := s[step]
+	return f
+}
 
-	if err := SanitizeAllCharts(manifest); err != nil {
-		return fmt.Errorf("failed to sanitize charts: %v", err)
+// Steps returns the selected steps, sorted, or nil if all steps are selected
+func (s BuildSelector) Steps() []model.BuildStep {
+	if len(s) == 0 {
+		return nil
 	}
-	if util.IsValidSemver(manifest.Version) {
-		if _, f := manifest.BuildOutputs[model.Helm]; f {
-			if err := HelmCharts(manifest); err != nil {
-				return fmt.Errorf("failed to build HelmCharts: %v", err)
+	return slices.Sorted(maps.Keys(s))
+}
+
+// Validate ensures every selected step also has its prerequisite steps selected
+func (s BuildSelector) Validate() error {
+	for step := range s {
+		for _, prereq := range buildStepPrerequisites[step] {
+			if !s.Has(prereq) {
+				return fmt.Errorf("build step %v requires step %v", step, prereq)
 			}
 		}
-	} else {
-		log.Warnf("Invalid Semantic Version. Skipping Charts build")
 	}
+	return nil
+}
 
-	if _, f := manifest.BuildOutputs[model.Debian]; f {
-		if err := Debian(manifest); err != nil {
-			return fmt.Errorf("failed to build Debian: %v", err)
-		}
+// Build will create all artifacts required by the manifest, limited to the steps chosen by the selector.
+// The docker and archive steps are skipped if unchanged since the last build in the same directory, unless force is set.
+// This assumes the working directory has been setup and sources resolved.
+func Build(manifest model.Manifest, selector BuildSelector, force bool) error {
+	return BuildWithProgress(context.Background(), manifest, selector, force, nil)
+}
+
+// BuildWithProgress builds like Build, reporting the start and end of each step to progress, which may be nil.
+// Cancelling the context stops the build, killing any running make, and returns an error wrapping the context's error.
+func BuildWithProgress(ctx context.Context, manifest model.Manifest, selector BuildSelector, force bool, progress ProgressFunc) error {
+	if err := selector.Validate(); err != nil {
+		return err
 	}
+	// Recorded in the manifest of the release, so validation only checks the outputs of the steps that ran
+	manifest.BuildSteps = selector.Steps()
+	return runPipeline(ctx, buildPipeline(manifest, selector, force), progress)
+}
 
-	if _, f := manifest.BuildOutputs[model.Rpm]; f {
-		if err := Rpm(manifest); err != nil {
-			return fmt.Errorf("failed to build Rpm: %v", err)
+// buildPipeline returns the steps the build runs for the manifest and selector, in order
+func buildPipeline(manifest model.Manifest, selector BuildSelector, force bool) []pipelineStep {
+	has := func(output model.BuildOutput) bool {
+		_, f := manifest.BuildOutputs[output]
+		return f
+	}
+	// Charts are consumed by both the helm and archive steps, but only need sanitizing once
+	sanitizeCharts := sync.OnceValue(func() error {
+		if err := SanitizeAllCharts(manifest); err != nil {
+			return fmt.Errorf("failed to sanitize charts: %v", err)
 		}
+		return nil
+	})
+
+	steps := []pipelineStep{}
+	if has(model.Docker) && selector.Has(model.StepDocker) {
+		steps = append(steps, pipelineStep{model.StepDocker, func(ctx context.Context) error {
+			if err := runStep(manifest, model.StepDocker, force, func() error { return Docker(ctx, manifest) }); err != nil {
+				return fmt.Errorf("failed to build Docker: %v", err)
+			}
+			return nil
+		}})
 	}
 
-	if _, f := manifest.BuildOutputs[model.Archive]; f {
-		if err := Archive(manifest); err != nil {
-			return fmt.Errorf("failed to build Archive: %v", err)
-		}
+	if selector.Has(model.StepHelm) {
+		steps = append(steps, pipelineStep{model.StepHelm, func(ctx context.Context) error {
+			if err := sanitizeCharts(); err != nil {
+				return err
+			}
+			if !util.IsValidSemver(manifest.Version) {
+				log.Warnf("Invalid Semantic Version. Skipping Charts build")
+				return nil
+			}
+			if has(model.Helm) {
+				if err := HelmCharts(manifest); err != nil {
+					return fmt.Errorf("failed to build HelmCharts: %v", err)
+				}
+			}
+			return nil
+		}})
 	}
 
-	if _, f := manifest.BuildOutputs[model.Grafana]; f {
-		if err := Grafana(manifest); err != nil {
-			return fmt.Errorf("failed to build Grafana: %v", err)
-		}
+	if (has(model.Debian) || has(model.Rpm)) && selector.Has(model.StepPackages) {
+		steps = append(steps, pipelineStep{model.StepPackages, func(ctx context.Context) error {
+			if has(model.Debian) {
+				if err := Debian(ctx, manifest); err != nil {
+					return fmt.Errorf("failed to build Debian: %v", err)
+				}
+			}
+			if has(model.Rpm) {
+				if err := Rpm(ctx, manifest); err != nil {
+					return fmt.Errorf("failed to build Rpm: %v", err)
+				}
+			}
+			return nil
+		}})
 	}
 
-	// Bundle all sources used in the build
-	cmd := util.VerboseCommand("tar", "-czf", "out/sources.tar.gz", "sources")
-	cmd.Dir = path.Join(manifest.Directory)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to bundle sources: %v", err)
+	if has(model.Archive) && selector.Has(model.StepArchive) {
+		steps = append(steps, pipelineStep{model.StepArchive, func(ctx context.Context) error {
+			if err := sanitizeCharts(); err != nil {
+				return err
+			}
+			if err := runStep(manifest, model.StepArchive, force, func() error { return Archive(ctx, manifest) }); err != nil {
+				return fmt.Errorf("failed to build Archive: %v", err)
+			}
+			return nil
+		}})
 	}
 
-	if err := writeManifest(manifest, manifest.OutDir()); err != nil {
-		return fmt.Errorf("failed to write manifest: %v", err)
+	if has(model.Grafana) && selector.Has(model.StepGrafana) {
+		steps = append(steps, pipelineStep{model.StepGrafana, func(ctx context.Context) error {
+			if err := Grafana(ctx, manifest); err != nil {
+				return fmt.Errorf("failed to build Grafana: %v", err)
+			}
+			return nil
+		}})
 	}
 
-	if err := writeLicense(manifest); err != nil {
-		return fmt.Errorf("failed to package license file: %v", err)
+	if selector.Has(model.StepMetadata) {
+		steps = append(steps, pipelineStep{model.StepMetadata, func(ctx context.Context) error {
+			// Bundle all sources used in the build
+			if err := util.TarGz(manifest.Directory, "out/sources.tar.gz", manifest.GetGzipLevel(), "sources"); err != nil {
+				return fmt.Errorf("failed to bundle sources: %v", err)
+			}
+
+			if err := writeManifest(manifest, manifest.OutDir()); err != nil {
+				return fmt.Errorf("failed to write manifest: %v", err)
+			}
+
+			if err := GenerateReleaseNotes(manifest); err != nil {
+				return fmt.Errorf("failed to generate release notes: %v", err)
+			}
+
+			if err := WriteDownloadScript(manifest); err != nil {
+				return fmt.Errorf("failed to write download script: %v", err)
+			}
+			return nil
+		}})
 	}
 
-	if manifest.DockerOutput == model.DockerOutputContext {
-		log.Warnf("Docker output in 'context' mode; will not produce SBOM.")
-	} else if manifest.SkipGenerateBillOfMaterials {
-		log.Warnf("Input manifest set SkipGenerateBillOfMaterials; will not produce SBOM.")
-	} else {
-		if err := GenerateBillOfMaterials(manifest); err != nil {
-			return fmt.Errorf("failed to generate sbom: %v", err)
-		}
+	if selector.Has(model.StepLicenses) {
+		steps = append(steps, pipelineStep{model.StepLicenses, func(ctx context.Context) error {
+			if err := writeLicense(manifest); err != nil {
+				return fmt.Errorf("failed to package license file: %v", err)
+			}
+			return nil
+		}})
 	}
 
-	return nil
+	if selector.Has(model.StepSbom) {
+		steps = append(steps, pipelineStep{model.StepSbom, func(ctx context.Context) error {
+			if manifest.DockerOutput == model.DockerOutputContext {
+				log.Warnf("Docker output in 'context' mode; will not produce SBOM.")
+			} else if manifest.SkipGenerateBillOfMaterials {
+				log.Warnf("Input manifest set SkipGenerateBillOfMaterials; will not produce SBOM.")
+				if manifest.LicensePolicy != nil {
+					log.Warnf("License policy is not checked without the SBOM.")
+				}
+			} else {
+				if err := GenerateBillOfMaterials(manifest); err != nil {
+					return fmt.Errorf("failed to generate sbom: %v", err)
+				}
+			}
+			return nil
+		}})
+	}
+
+	if selector.Has(model.StepIndex) {
+		steps = append(steps, pipelineStep{model.StepIndex, func(ctx context.Context) error {
+			if err := GenerateReleaseIndex(manifest); err != nil {
+				return fmt.Errorf("failed to generate release index: %v", err)
+			}
+			return nil
+		}})
+	}
+
+	return steps
 }
 
 // writeLicense copies the complete list of licenses for all dependant repos
 func writeLicense(manifest model.Manifest) error {
-	if err := os.MkdirAll(filepath.Join(manifest.OutDir(), "licenses"), 0o750); err != nil {
+	if err := os.MkdirAll(filepath.Join(manifest.OutDir(), manifest.ArtifactDir(model.LicenseArtifacts)), 0o750); err != nil {
 		return fmt.Errorf("failed to create license dir: %v", err)
 	}
+	required := map[string]struct{}{}
+	for _, repo := range manifest.LicenseRepos {
+		if _, f := manifest.Dependencies.Get()[repo]; !f {
+			return fmt.Errorf("license repo %v is not a known dependency", repo)
+		}
+		required[repo] = struct{}{}
+	}
 	for repo := range manifest.Dependencies.Get() {
 		src := filepath.Join(manifest.RepoDir(repo), "licenses")
-		// Just skip these, we can fail in the validation tests afterwards for repos we expect license for
 		if _, err := os.Stat(src); os.IsNotExist(err) {
+			if _, f := required[repo]; f {
+				return fmt.Errorf("missing licenses for %v", repo)
+			}
+			// Licenses are optional for repos not listed in the manifest
 			log.Warnf("skipping license for %v", repo)
 			continue
 		}
 		// Package as a tar.gz since there are hundreds of files
-		cmd := util.VerboseCommand("tar", "-czf", filepath.Join(manifest.OutDir(), "licenses", repo+".tar.gz"), ".")
-		cmd.Dir = src
-		if err := cmd.Run(); err != nil {
+		dest := filepath.Join(manifest.OutDir(), manifest.ArtifactDir(model.LicenseArtifacts), repo+".tar.gz")
+		if err := util.TarGz(src, dest, manifest.GetGzipLevel(), "."); err != nil {
 			return fmt.Errorf("failed to compress license: %v", err)
 		}
 	}
 	return nil
 }
 
+// createSha writes a checksum file of src for each of the manifest's checksum algorithms
+func createSha(manifest model.Manifest, src string) error {
+	algorithms := manifest.ShaAlgorithms
+	if len(algorithms) == 0 {
+		algorithms = []string{string(util.Sha256)}
+	}
+	for _, algo := range algorithms {
+		if err := util.CreateShaAlgo(src, util.ShaAlgorithm(algo)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scrubManifest clears fields that only make sense on the host that built the release, so they never
+// leak into the published manifest. These are:
+//   - Directory, the working directory of the build
+//   - PreviousManifest, the local path to the previous release manifest
+//   - LocalPath of each dependency, the local checkout the source was copied from
+//
+// Dependencies are copied rather than modified, as they are shared with the caller.
+func scrubManifest(manifest model.Manifest) model.Manifest {
+	manifest.Directory = ""
+	manifest.PreviousManifest = ""
+	deps := model.IstioDependencies{}
+	for repo, dep := range manifest.Dependencies.Get() {
+		if dep == nil {
+			continue
+		}
+		d := *dep
+		d.LocalPath = ""
+		_ = deps.Set(repo, &d)
+	}
+	manifest.Dependencies = deps
+	return manifest
+}
+
 // writeManifest will output the manifest to yaml
 func writeManifest(manifest model.Manifest, dir string) error {
-	yml, err := yaml.Marshal(manifest)
+	yml, err := yaml.Marshal(scrubManifest(manifest))
 	if err != nil {
 		return fmt.Errorf("failed to marshal manifest: %v", err)
 	}
-	if err := os.WriteFile(path.Join(dir, "manifest.yaml"), yml, 0o640); err != nil {
+	if err := util.WriteFileAtomic(path.Join(dir, "manifest.yaml"), yml, 0o640); err != nil {
 		return fmt.Errorf("failed to write manifest: %v", err)
 	}
 	return nil
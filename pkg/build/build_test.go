@@ -0,0 +1,125 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/alauda-mesh/release-builder/pkg"
+	"github.com/alauda-mesh/release-builder/pkg/model"
+	"github.com/alauda-mesh/release-builder/pkg/util"
+)
+
+func TestWriteLicenseLayout(t *testing.T) {
+	cases := []struct {
+		name   string
+		layout map[model.ArtifactCategory]string
+		dir    string
+	}{
+		{"default", nil, "licenses"},
+		{"custom", map[model.ArtifactCategory]string{model.LicenseArtifacts: "meta/licenses"}, "meta/licenses"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest := model.Manifest{
+				Directory:    t.TempDir(),
+				Dependencies: model.IstioDependencies{Istio: &model.Dependency{Sha: "1111"}},
+				LicenseRepos: []string{"istio"},
+				Layout:       tt.layout,
+			}
+			licenses := path.Join(manifest.RepoDir("istio"), "licenses")
+			if err := os.MkdirAll(licenses, 0o750); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path.Join(licenses, "LICENSE"), []byte("license"), 0o640); err != nil {
+				t.Fatal(err)
+			}
+			if err := writeLicense(manifest); err != nil {
+				t.Fatal(err)
+			}
+			if f := path.Join(manifest.OutDir(), tt.dir, "istio.tar.gz"); !util.FileExists(f) {
+				t.Fatalf("expected license archive at %v", f)
+			}
+		})
+	}
+}
+
+func TestWriteManifestScrubsLocalFields(t *testing.T) {
+	istio := &model.Dependency{Sha: "1111", LocalPath: "/home/user/istio"}
+	manifest := model.Manifest{
+		Version:          "1.2.3",
+		Directory:        "/tmp/release",
+		PreviousManifest: "/tmp/previous/manifest.yaml",
+		Dependencies: model.IstioDependencies{
+			Istio: istio,
+			Proxy: &model.Dependency{Sha: "2222"},
+		},
+	}
+	dir := t.TempDir()
+	if err := writeManifest(manifest, dir); err != nil {
+		t.Fatal(err)
+	}
+	got, err := pkg.ReadManifest(path.Join(dir, "manifest.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Directory != "" || got.PreviousManifest != "" {
+		t.Fatalf("expected local fields to be scrubbed, got directory %q previous manifest %q", got.Directory, got.PreviousManifest)
+	}
+	for repo, d := range got.Dependencies.Get() {
+		if d != nil && d.LocalPath != "" {
+			t.Fatalf("expected local path of %v to be scrubbed, got %v", repo, d.LocalPath)
+		}
+	}
+	if got.Version != manifest.Version || got.Dependencies.Istio.Sha != "1111" || got.Dependencies.Proxy.Sha != "2222" {
+		t.Fatalf("expected manifest to round trip, got %+v", got)
+	}
+	if istio.LocalPath != "/home/user/istio" || manifest.Directory != "/tmp/release" {
+		t.Fatalf("expected the input manifest to be left unmodified")
+	}
+}
+
+func TestReleaseIndexScrubsLocalFields(t *testing.T) {
+	manifest := model.Manifest{
+		Version:   "1.2.3",
+		Directory: t.TempDir(),
+		Dependencies: model.IstioDependencies{
+			Istio: &model.Dependency{Sha: "1111", LocalPath: "/home/user/istio"},
+		},
+	}
+	if err := os.MkdirAll(manifest.OutDir(), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := GenerateReleaseIndex(manifest); err != nil {
+		t.Fatal(err)
+	}
+	by, err := os.ReadFile(path.Join(manifest.OutDir(), ReleaseIndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index model.ReleaseIndex
+	if err := json.Unmarshal(by, &index); err != nil {
+		t.Fatal(err)
+	}
+	if index.Manifest.Directory != "" {
+		t.Fatalf("expected the directory to be scrubbed, got %q", index.Manifest.Directory)
+	}
+	if istio := index.Manifest.Dependencies.Istio; istio == nil || istio.LocalPath != "" || istio.Sha != "1111" {
+		t.Fatalf("expected the local path to be scrubbed, got %+v", istio)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"runtime/debug"
+	"time"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+	"github.com/alauda-mesh/release-builder/pkg/util"
+)
+
+// newBuildInfo describes the current build of the manifest
+func newBuildInfo(manifest model.Manifest) model.BuildInfo {
+	deps := map[string]string{}
+	for repo, dep := range manifest.Dependencies.Get() {
+		if dep != nil {
+			deps[repo] = dep.Sha
+		}
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	info := model.BuildInfo{
+		BuilderVersion: builderVersion(),
+		Host:           host,
+		Dependencies:   deps,
+	}
+	if !manifest.SkipBuildTimestamp {
+		info.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	}
+	return info
+}
+
+// builderVersion reports the version of the release builder binary, preferring the VCS revision it was built from
+func builderVersion() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	for _, s := range bi.Settings {
+		if s.Key == "vcs.revision" {
+			return s.Value
+		}
+	}
+	return bi.Main.Version
+}
+
+// writeBuildInfo writes build-info.json to dir
+func writeBuildInfo(info model.BuildInfo, dir string) error {
+	js, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal build info: %v", err)
+	}
+	if err := util.WriteFileAtomic(path.Join(dir, "build-info.json"), append(js, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write build info: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"istio.io/istio/pkg/log"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+)
+
+// CleanOutput removes everything in the output directory, so artifacts left by an earlier build in the same
+// directory are not released. The output directory must resolve to a path within the manifest directory.
+func CleanOutput(manifest model.Manifest) error {
+	out := manifest.OutDir()
+	if _, err := os.Lstat(out); os.IsNotExist(err) {
+		return nil
+	}
+	if err := checkWithinDirectory(manifest.Directory, out); err != nil {
+		return fmt.Errorf("refusing to clean %v: %v", out, err)
+	}
+	entries, err := os.ReadDir(out)
+	if err != nil {
+		return fmt.Errorf("failed to read output directory: %v", err)
+	}
+	for _, e := range entries {
+		log.Infof("Removing %v", path.Join(out, e.Name()))
+		if err := os.RemoveAll(path.Join(out, e.Name())); err != nil {
+			return fmt.Errorf("failed to clean output directory: %v", err)
+		}
+	}
+	return nil
+}
+
+// checkWithinDirectory ensures dir, after resolving symlinks, is strictly within root
+func checkWithinDirectory(root, dir string) error {
+	if root == "" {
+		return fmt.Errorf("no manifest directory set")
+	}
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	resolvedRoot, err = filepath.Abs(resolvedRoot)
+	if err != nil {
+		return err
+	}
+	if resolvedRoot == string(filepath.Separator) {
+		return fmt.Errorf("manifest directory is the filesystem root")
+	}
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	resolved, err = filepath.Abs(resolved)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(resolvedRoot, resolved)
+	if err != nil {
+		return err
+	}
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("not within %v", root)
+	}
+	return nil
+}
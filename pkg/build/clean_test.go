@@ -0,0 +1,75 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+	"github.com/alauda-mesh/release-builder/pkg/testutil"
+	"github.com/alauda-mesh/release-builder/pkg/util"
+)
+
+func TestCleanOutput(t *testing.T) {
+	t.Run("removes stale artifacts", func(t *testing.T) {
+		manifest := model.Manifest{Directory: t.TempDir()}
+		stale := path.Join(manifest.OutDir(), "helm", "istiod-1.19.0.tgz")
+		source := path.Join(manifest.SourceDir(), "istio", "go.mod")
+		testutil.WriteFile(t, stale, "test")
+		testutil.WriteFile(t, source, "test")
+		if err := CleanOutput(manifest); err != nil {
+			t.Fatal(err)
+		}
+		if util.FileExists(stale) {
+			t.Fatalf("expected %v to be removed", stale)
+		}
+		if !util.FileExists(manifest.OutDir()) {
+			t.Fatalf("expected output directory to be kept")
+		}
+		if !util.FileExists(source) {
+			t.Fatalf("expected files outside the output directory to be kept")
+		}
+	})
+
+	t.Run("missing output", func(t *testing.T) {
+		if err := CleanOutput(model.Manifest{Directory: t.TempDir()}); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("output outside directory", func(t *testing.T) {
+		manifest := model.Manifest{Directory: t.TempDir()}
+		outside := t.TempDir()
+		kept := path.Join(outside, "keep")
+		testutil.WriteFile(t, kept, "test")
+		if err := os.Symlink(outside, manifest.OutDir()); err != nil {
+			t.Fatal(err)
+		}
+		if err := CleanOutput(manifest); err == nil {
+			t.Fatalf("expected cleaning a directory outside the manifest directory to fail")
+		}
+		if !util.FileExists(kept) {
+			t.Fatalf("expected %v to be kept", kept)
+		}
+	})
+
+	t.Run("no directory", func(t *testing.T) {
+		if err := checkWithinDirectory("", "out"); err == nil {
+			t.Fatalf("expected error without a manifest directory")
+		}
+	})
+}
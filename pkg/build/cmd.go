@@ -15,7 +15,13 @@
 package build
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 	"istio.io/istio/pkg/log"
@@ -29,6 +35,13 @@ var (
 		manifest        string
 		githubTokenFile string
 		buildBaseImages bool
+		pinDependencies bool
+		steps           []string
+		force           bool
+		clean           bool
+		overwrite       bool
+		watch           bool
+		watchSources    bool
 	}{
 		manifest: "example/manifest.yaml",
 	}
@@ -38,52 +51,17 @@ var (
 		SilenceUsage: true,
 		Args:         cobra.ExactArgs(0),
 		RunE: func(c *cobra.Command, _ []string) error {
-			inManifest, err := pkg.ReadInManifest(flags.manifest)
+			selector, err := ParseBuildSelector(flags.steps)
 			if err != nil {
-				return fmt.Errorf("failed to unmarshal manifest: %v", err)
+				return fmt.Errorf("invalid build steps: %v", err)
 			}
-
-			manifest, err := pkg.InputManifestToManifest(inManifest)
-			if err != nil {
-				return fmt.Errorf("failed to setup manifest: %v", err)
-			}
-
-			// Save these values as they are needed for git commits and PRs
-			savedIstioGit := inManifest.Dependencies.Get()["istio"].Git
-			savedIstioBranch := inManifest.Dependencies.Get()["istio"].Branch
-			log.Infof("Saved Istio git:\n%+v", savedIstioGit)
-			log.Infof("Saved Istio branch:\n%+v", savedIstioBranch)
-
-			if err := pkg.SetupWorkDir(manifest.Directory); err != nil {
-				return fmt.Errorf("failed to setup work dir: %v", err)
-			}
-
-			if err := pkg.Sources(manifest); err != nil {
-				return fmt.Errorf("failed to fetch sources: %v", err)
-			}
-			log.Infof("Fetched all sources and setup working directory at %v", manifest.WorkDir())
-
-			if err := pkg.StandardizeManifest(&manifest); err != nil {
-				return fmt.Errorf("failed to standardize manifest: %v", err)
-			}
-
-			if flags.buildBaseImages {
-				token, err := util.GetGithubToken(flags.githubTokenFile)
-				if err != nil {
-					return err
-				}
-				if err := Scanner(manifest, token, savedIstioGit, savedIstioBranch); err != nil {
-					return fmt.Errorf("failed image scan: %v", err)
-				}
-				return nil
-			}
-
-			if err := Build(manifest); err != nil {
-				return fmt.Errorf("failed to build: %v", err)
+			// Interrupting the build cancels it, killing any running make rather than leaving it running
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			if flags.watch {
+				return watch(ctx, selector)
 			}
-
-			log.Infof("Built release at %v", manifest.OutDir())
-			return nil
+			return runBuild(ctx, selector, false, flags.force)
 		},
 	}
 )
@@ -95,6 +73,159 @@ func init() {
 		"The file containing a github token.")
 	buildCmd.PersistentFlags().BoolVar(&flags.buildBaseImages, "build-base-images", flags.buildBaseImages,
 		"When set scan base images for vulnerabilities and build new ones if needed.")
+	buildCmd.PersistentFlags().BoolVar(&flags.pinDependencies, "pin-dependencies", flags.pinDependencies,
+		"When set resolve dependencies referencing a branch or tag to the commit SHA they currently point to.")
+	buildCmd.PersistentFlags().StringSliceVar(&flags.steps, "steps", flags.steps,
+		"The build steps to run; all steps are run if unset. "+
+			"One or more of docker, helm, packages, archive, grafana, metadata, licenses, sbom, index.")
+	buildCmd.PersistentFlags().BoolVar(&flags.force, "force", flags.force,
+		"When set rebuild all steps, even if their inputs are unchanged since the last build in the same directory.")
+	buildCmd.PersistentFlags().BoolVar(&flags.clean, "clean", flags.clean,
+		"When set remove all artifacts from earlier builds in the output directory before building. "+
+			"As nothing is left to reuse, every step is rebuilt.")
+	buildCmd.PersistentFlags().BoolVar(&flags.overwrite, "overwrite", flags.overwrite,
+		"When set build the release even if its version is already published to the manifest releaseURL.")
+	buildCmd.PersistentFlags().BoolVar(&flags.watch, "watch", flags.watch,
+		"When set keep running after the build, rebuilding each time the manifest changes. "+
+			"Steps whose inputs are unchanged are skipped.")
+	buildCmd.PersistentFlags().BoolVar(&flags.watchSources, "watch-sources", flags.watchSources,
+		"When set with --watch also rebuild when a dependency with a localpath changes. "+
+			"As the step cache only tracks committed changes, such rebuilds run every selected step.")
+}
+
+const (
+	// watchInterval is how often --watch checks for changes
+	watchInterval = time.Second
+	// watchDebounce is how long --watch waits for further changes before rebuilding, as editors often write a file
+	// several times when saving it
+	watchDebounce = 2 * time.Second
+)
+
+// watch builds the release, and rebuilds it each time the manifest, or with --watch-sources a local dependency, changes
+func watch(ctx context.Context, selector BuildSelector) error {
+	if flags.buildBaseImages {
+		return fmt.Errorf("--watch cannot be used with --build-base-images")
+	}
+	paths := []string{flags.manifest}
+	if flags.watchSources {
+		inManifest, err := pkg.ReadInManifest(flags.manifest)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal manifest: %v", err)
+		}
+		for _, dep := range inManifest.Dependencies.Get() {
+			if dep != nil && dep.LocalPath != "" {
+				paths = append(paths, dep.LocalPath)
+			}
+		}
+	}
+	notifier := NewPollNotifier(paths, watchInterval)
+	defer notifier.Close()
+	log.Infof("Watching %v for changes", strings.Join(paths, ", "))
+	first := true
+	return WatchBuild(notifier, watchDebounce, ctx.Done(), func(changed []string) error {
+		rebuild := !first
+		first = false
+		return runBuild(ctx, selector, rebuild, flags.force || sourcesChanged(changed))
+	})
+}
+
+// sourcesChanged returns true if any of the changed paths is not the manifest
+func sourcesChanged(changed []string) bool {
+	for _, p := range changed {
+		if p != flags.manifest {
+			return true
+		}
+	}
+	return false
+}
+
+// runBuild builds the release described by the manifest. A rebuild replaces the sources fetched by the last build,
+// and skips the checks and cleanup that only apply before the first build.
+func runBuild(ctx context.Context, selector BuildSelector, rebuild bool, force bool) error {
+	inManifest, err := pkg.ReadInManifest(flags.manifest)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal manifest: %v", err)
+	}
+
+	manifest, err := pkg.InputManifestToManifest(inManifest)
+	if err != nil {
+		return fmt.Errorf("failed to setup manifest: %v", err)
+	}
+	if err := manifest.Validate(); err != nil {
+		return fmt.Errorf("invalid manifest: %v", err)
+	}
+
+	// Save these values as they are needed for git commits and PRs
+	savedIstioGit := inManifest.Dependencies.Get()["istio"].Git
+	savedIstioBranch := inManifest.Dependencies.Get()["istio"].Branch
+	log.Infof("Saved Istio git:\n%+v", savedIstioGit)
+	log.Infof("Saved Istio branch:\n%+v", savedIstioBranch)
+
+	if flags.pinDependencies {
+		if err := pkg.PinDependencies(&manifest.Dependencies, pkg.NewCachingResolver(pkg.LsRemoteResolver{})); err != nil {
+			return fmt.Errorf("failed to pin dependencies: %v", err)
+		}
+	}
+
+	if rebuild {
+		if err := removeSources(manifest); err != nil {
+			return fmt.Errorf("failed to remove sources of the last build: %v", err)
+		}
+	}
+	if err := pkg.SetupWorkDir(manifest.Directory); err != nil {
+		return fmt.Errorf("failed to setup work dir: %v", err)
+	}
+
+	if err := pkg.Sources(manifest); err != nil {
+		return fmt.Errorf("failed to fetch sources: %v", err)
+	}
+	log.Infof("Fetched all sources and setup working directory at %v", manifest.WorkDir())
+
+	if err := pkg.StandardizeManifest(&manifest); err != nil {
+		return fmt.Errorf("failed to standardize manifest: %v", err)
+	}
+
+	if flags.buildBaseImages {
+		token, err := util.GetGithubToken(flags.githubTokenFile)
+		if err != nil {
+			return err
+		}
+		if err := Scanner(manifest, token, savedIstioGit, savedIstioBranch); err != nil {
+			return fmt.Errorf("failed image scan: %v", err)
+		}
+		return nil
+	}
+
+	if !flags.overwrite && !rebuild {
+		if err := CheckNotPublished(manifest); err != nil {
+			return fmt.Errorf("%v; set --overwrite to build it anyway", err)
+		}
+	}
+
+	if flags.clean && !rebuild {
+		if err := CleanOutput(manifest); err != nil {
+			return fmt.Errorf("failed to clean output: %v", err)
+		}
+	}
+
+	if err := BuildWithProgress(ctx, manifest, selector, force, logProgress); err != nil {
+		return fmt.Errorf("failed to build: %v", err)
+	}
+
+	log.Infof("Built release at %v", manifest.OutDir())
+	return nil
+}
+
+// logProgress logs the progress events of the build
+func logProgress(e ProgressEvent) {
+	switch e.Type {
+	case StepStarted:
+		log.Infof("Starting build step %v (%d/%d)", e.Step, e.Completed+1, e.Total)
+	case StepFinished:
+		log.Infof("Finished build step %v in %v (%d%% complete)", e.Step, e.Elapsed.Round(time.Second), e.Percent())
+	case StepFailed:
+		log.Errorf("Build step %v failed after %v", e.Step, e.Elapsed.Round(time.Second))
+	}
 }
 
 func GetBuildCommand() *cobra.Command {
@@ -0,0 +1,88 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+	"github.com/alauda-mesh/release-builder/pkg/util"
+)
+
+// runCosign runs cosign with the given arguments
+var runCosign = func(args ...string) error {
+	_, err := util.Run(util.RunOptions{}, "cosign", args...)
+	return err
+}
+
+// blobSigner signs files with cosign, using one backend for the signing key
+type blobSigner interface {
+	// Sign writes the signature of file to file.sig, and any certificate to file.pem
+	Sign(file string) error
+	// WritePublicKey writes the public key signatures are verified with to dir, if the backend has one
+	WritePublicKey(dir string) error
+}
+
+// keySigner signs with a cosign key. The key may be a file, or any KMS URI supported by cosign.
+type keySigner struct {
+	key string
+}
+
+func (s keySigner) Sign(file string) error {
+	return runCosign("sign-blob", "--yes", "--key", s.key, "--output-signature", file+".sig", file)
+}
+
+func (s keySigner) WritePublicKey(dir string) error {
+	return runCosign("public-key", "--key", s.key, "--outfile", path.Join(dir, model.CosignPublicKeyFile))
+}
+
+// keylessSigner signs with a short-lived certificate, issued for the OIDC identity of the build
+type keylessSigner struct{}
+
+func (keylessSigner) Sign(file string) error {
+	return runCosign("sign-blob", "--yes", "--output-signature", file+".sig", "--output-certificate", file+".pem", file)
+}
+
+func (keylessSigner) WritePublicKey(string) error {
+	// The certificate of each signature holds its public key
+	return nil
+}
+
+// newBlobSigner returns the signer for the manifest cosign configuration
+var newBlobSigner = func(c model.CosignSigning) blobSigner {
+	if c.Keyless() {
+		return keylessSigner{}
+	}
+	return keySigner{key: c.Key}
+}
+
+// signArchives signs each release archive, matching model.SignedArchivePatterns, and its checksum files with cosign
+func signArchives(manifest model.Manifest) error {
+	signer := newBlobSigner(*manifest.CosignSigning)
+	files, err := util.SignedFiles(manifest.OutDir())
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := signer.Sign(file); err != nil {
+			return fmt.Errorf("failed to sign %v: %v", file, err)
+		}
+	}
+	if err := signer.WritePublicKey(manifest.OutDir()); err != nil {
+		return fmt.Errorf("failed to write cosign public key: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+	"github.com/alauda-mesh/release-builder/pkg/testutil"
+)
+
+func TestSignArchives(t *testing.T) {
+	cases := []struct {
+		name     string
+		signing  model.CosignSigning
+		expected []string
+	}{
+		{
+			name:    "key",
+			signing: model.CosignSigning{Key: "gcpkms://key"},
+			expected: []string{
+				"sign-blob --yes --key gcpkms://key --output-signature out/istio-1.2.3-linux-amd64.tar.gz.sig out/istio-1.2.3-linux-amd64.tar.gz",
+				"sign-blob --yes --key gcpkms://key --output-signature out/istio-1.2.3-linux-amd64.tar.gz.sha256.sig out/istio-1.2.3-linux-amd64.tar.gz.sha256",
+				"sign-blob --yes --key gcpkms://key --output-signature out/istio-1.2.3-win-amd64.zip.sig out/istio-1.2.3-win-amd64.zip",
+				"sign-blob --yes --key gcpkms://key --output-signature out/istioctl-1.2.3-linux-amd64.tar.gz.sig out/istioctl-1.2.3-linux-amd64.tar.gz",
+				"public-key --key gcpkms://key --outfile out/cosign.pub",
+			},
+		},
+		{
+			name:    "keyless",
+			signing: model.CosignSigning{Identity: "release@example.com", Issuer: "https://accounts.example.com"},
+			expected: []string{
+				"sign-blob --yes --output-signature out/istio-1.2.3-linux-amd64.tar.gz.sig --output-certificate out/istio-1.2.3-linux-amd64.tar.gz.pem out/istio-1.2.3-linux-amd64.tar.gz",
+				"sign-blob --yes --output-signature out/istio-1.2.3-linux-amd64.tar.gz.sha256.sig --output-certificate out/istio-1.2.3-linux-amd64.tar.gz.sha256.pem out/istio-1.2.3-linux-amd64.tar.gz.sha256",
+				"sign-blob --yes --output-signature out/istio-1.2.3-win-amd64.zip.sig --output-certificate out/istio-1.2.3-win-amd64.zip.pem out/istio-1.2.3-win-amd64.zip",
+				"sign-blob --yes --output-signature out/istioctl-1.2.3-linux-amd64.tar.gz.sig --output-certificate out/istioctl-1.2.3-linux-amd64.tar.gz.pem out/istioctl-1.2.3-linux-amd64.tar.gz",
+			},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest := model.Manifest{Directory: t.TempDir(), CosignSigning: &tt.signing}
+			for _, f := range []string{
+				"istio-1.2.3-linux-amd64.tar.gz", "istio-1.2.3-linux-amd64.tar.gz.sha256", "istio-1.2.3-win-amd64.zip",
+				"istioctl-1.2.3-linux-amd64.tar.gz", "sources.tar.gz",
+			} {
+				testutil.WriteFile(t, filepath.Join(manifest.OutDir(), f), "")
+			}
+			got := []string{}
+			orig := runCosign
+			runCosign = func(args ...string) error {
+				got = append(got, strings.ReplaceAll(strings.Join(args, " "), manifest.Directory+"/", ""))
+				return nil
+			}
+			t.Cleanup(func() { runCosign = orig })
+			if err := signArchives(manifest); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Fatalf("expected cosign runs\n%v\ngot\n%v", strings.Join(tt.expected, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
+
+func TestSignArchivesWithKey(t *testing.T) {
+	if _, err := exec.LookPath("cosign"); err != nil {
+		t.Skip("cosign is not installed")
+	}
+	t.Setenv("COSIGN_PASSWORD", "")
+	keys := t.TempDir()
+	cmd := exec.Command("cosign", "generate-key-pair")
+	cmd.Dir = keys
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("failed to generate key: %v: %s", err, out)
+	}
+	manifest := model.Manifest{Directory: t.TempDir(), CosignSigning: &model.CosignSigning{Key: filepath.Join(keys, "cosign.key")}}
+	archive := filepath.Join(manifest.OutDir(), "istio-1.2.3-linux-amd64.tar.gz")
+	testutil.WriteFile(t, archive, "archive")
+	if err := signArchives(manifest); err != nil {
+		t.Fatal(err)
+	}
+	verify := func() error {
+		return exec.Command("cosign", "verify-blob", "--key", filepath.Join(manifest.OutDir(), model.CosignPublicKeyFile),
+			"--signature", archive+".sig", archive).Run()
+	}
+	if err := verify(); err != nil {
+		t.Fatalf("failed to verify signature: %v", err)
+	}
+	if err := os.WriteFile(archive, []byte("tampered"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(); err == nil {
+		t.Fatalf("expected signature of a modified archive to fail verification")
+	}
+}
@@ -15,6 +15,7 @@
 package build
 
 import (
+	"context"
 	"fmt"
 	"path"
 	"strings"
@@ -24,16 +25,16 @@ import (
 )
 
 // Debian produces a debian package just for the sidecar
-func Debian(manifest model.Manifest) error {
+func Debian(ctx context.Context, manifest model.Manifest) error {
 	for _, plat := range manifest.Architectures {
 		_, arch, _ := strings.Cut(plat, "/")
 		envs := []string{"TARGET_ARCH=" + arch}
-		output := "istio-sidecar.deb"
-		if arch != "amd64" {
-			output = fmt.Sprintf("istio-sidecar-%s.deb", arch)
+		output, err := util.SidecarPackageName(plat, "deb")
+		if err != nil {
+			return err
 		}
 
-		if err := runDeb(manifest, envs, arch, output); err != nil {
+		if err := runDeb(ctx, manifest, envs, arch, output); err != nil {
 			return fmt.Errorf("failed to run deb for arch %s: %v", arch, err)
 		}
 	}
@@ -41,15 +42,15 @@ func Debian(manifest model.Manifest) error {
 	return nil
 }
 
-func runDeb(manifest model.Manifest, envs []string, arch, output string) error {
-	if err := util.RunMake(manifest, "istio", envs, "deb/fpm"); err != nil {
+func runDeb(ctx context.Context, manifest model.Manifest, envs []string, arch, output string) error {
+	if err := util.RunMakeContext(ctx, manifest, "istio", envs, util.DefaultMakeTimeout, "deb/fpm"); err != nil {
 		return fmt.Errorf("failed to build sidecar.deb: %v", err)
 	}
 
-	if err := util.CopyFile(path.Join(manifest.RepoArchOutDir("istio", arch), "istio-sidecar.deb"), path.Join(manifest.OutDir(), "deb", output)); err != nil {
+	if err := util.CopyFile(path.Join(manifest.RepoArchOutDir("istio", arch), "istio-sidecar.deb"), path.Join(manifest.OutDir(), manifest.ArtifactDir(model.DebianArtifacts), output)); err != nil {
 		return fmt.Errorf("failed to package istio-sidecar.deb: %v", err)
 	}
-	if err := util.CreateSha(path.Join(manifest.OutDir(), "deb", output)); err != nil {
+	if err := createSha(manifest, path.Join(manifest.OutDir(), manifest.ArtifactDir(model.DebianArtifacts), output)); err != nil {
 		return fmt.Errorf("failed to package istio-sidecar.deb: %v", err)
 	}
 	return nil
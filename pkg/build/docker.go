@@ -15,8 +15,11 @@
 package build
 
 import (
+	"context"
 	"fmt"
+	"os"
 	"path"
+	"strings"
 
 	"github.com/alauda-mesh/release-builder/pkg/model"
 	"github.com/alauda-mesh/release-builder/pkg/util"
@@ -24,28 +27,181 @@ import (
 
 // Docker builds all docker images and outputs them as tar.gz files
 // docker.save in the repos does most of the work, we just need to call this and copy the files over
-func Docker(manifest model.Manifest) error {
-	// Build both default and distroless variants
-	env := []string{"DOCKER_BUILD_VARIANTS=debug distroless"}
+func Docker(ctx context.Context, manifest model.Manifest) error {
+	env, err := dockerEnv(manifest)
+	if err != nil {
+		return err
+	}
 
 	if manifest.ProxyOverride != "" {
+		base, err := resolveProxyOverride(ctx, manifest)
+		if err != nil {
+			return err
+		}
 		// Add the vars to tell Istio to use our own Envoy binary
-		env = append(env, "ISTIO_ENVOY_BASE_URL="+manifest.ProxyOverride)
+		env = append(env, "ISTIO_ENVOY_BASE_URL="+base)
 	}
 
-	target := "docker.save"
-	if manifest.DockerOutput == model.DockerOutputContext {
-		target = "docker"
+	if err := buildDockerImages(ctx, manifest, env); err != nil {
+		return err
 	}
-	if err := util.RunMake(manifest, "istio", env, target); err != nil {
+
+	if manifest.DockerOutput == model.DockerOutputTar {
+		if err := checkDockerImages(manifest); err != nil {
+			return err
+		}
+		if manifest.VerifyImageReproducibility {
+			if err := verifyImageReproducibility(ctx, manifest, env); err != nil {
+				return err
+			}
+		}
+		if manifest.ImageLock {
+			if err := writeImageLock(manifest); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// dockerEnv returns the environment of the docker build. The make targets are only limited to the images of the
+// manifest if it lists them, or excludes the ambient images; otherwise the istio repo builds its default targets.
+// Limiting the targets to none is an error, as make treats an empty DOCKER_TARGETS as every image.
+func dockerEnv(manifest model.Manifest) ([]string, error) {
+	env := []string{"DOCKER_BUILD_VARIANTS=" + strings.Join(manifest.GetDockerVariants(), " ")}
+	if !manifest.CustomDockerImages && !manifest.SkipAmbient {
+		return env, nil
+	}
+	images := istioDockerImages(manifest)
+	if len(images) == 0 {
+		return nil, fmt.Errorf("no docker images are left for the istio docker build, as every image is built by an " +
+			"extra target; an empty DOCKER_TARGETS would build every image")
+	}
+	return append(env, "DOCKER_TARGETS="+strings.Join(dockerTargets(images, manifest.GetDockerVariants()), " ")), nil
+}
+
+// buildDockerImages runs the docker build, copying the images to the release
+func buildDockerImages(ctx context.Context, manifest model.Manifest, env []string) error {
+	if err := util.RunMakeContext(ctx, manifest, "istio", env, util.DefaultMakeTimeout, dockerMakeTargets(manifest)...); err != nil {
 		return fmt.Errorf("failed to create %v docker archives: %v", "istio", err)
 	}
 	if util.FileExists(path.Join(manifest.RepoOutDir("istio"), "docker")) {
-		// Some repos output docker files to the source repo
-		if err := util.CopyFilesToDir(path.Join(manifest.RepoOutDir("istio"), "docker"), path.Join(manifest.OutDir(), "docker")); err != nil {
+		// Some repos output docker files to the source repo. Publishing and validation expect the images directly in
+		// the docker directory, so images in a subdirectory per architecture are flattened; as the image names carry
+		// the architecture suffix, images of the same name in different subdirectories are an error.
+		if err := util.CopyFilesToDir(path.Join(manifest.RepoOutDir("istio"), "docker"), path.Join(manifest.OutDir(), manifest.ArtifactDir(model.DockerArtifacts)),
+			util.CopyOptions{}); err != nil {
 			return fmt.Errorf("failed to package docker images: %v", err)
 		}
 	}
+	if manifest.DockerOutput == model.DockerOutputTar {
+		if err := renameDockerImages(manifest); err != nil {
+			return fmt.Errorf("failed to rename docker images: %v", err)
+		}
+	}
+	return nil
+}
 
+// renameDockerImages renames the image archives of the release, and the repositories the images are tagged with, as
+// configured by the manifest ImageRenames
+func renameDockerImages(manifest model.Manifest) error {
+	dir := path.Join(manifest.OutDir(), manifest.ArtifactDir(model.DockerArtifacts))
+	for _, image := range manifest.DockerImages {
+		shipped := manifest.ShippedImage(image)
+		if shipped == image {
+			continue
+		}
+		name, _ := manifest.SplitImage(image)
+		renamed := manifest.ImageRenames[name]
+		rename := func(repository string) string {
+			if hub, repo := path.Split(repository); repo == name {
+				return hub + renamed
+			}
+			return repository
+		}
+		for _, plat := range manifest.GetDockerArchitectures() {
+			suffix, err := util.ImageArchSuffix(plat)
+			if err != nil {
+				return err
+			}
+			src := path.Join(dir, image+suffix+".tar.gz")
+			if !util.FileExists(src) {
+				// Reported by checkDockerImages
+				continue
+			}
+			if err := util.RenameImageTarball(src, path.Join(dir, shipped+suffix+".tar.gz"), rename); err != nil {
+				return fmt.Errorf("%v: %v", image+suffix, err)
+			}
+			if err := os.Remove(src); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// dockerMakeTargets returns the make targets building the docker images, followed by any extra targets
+func dockerMakeTargets(manifest model.Manifest) []string {
+	target := "docker.save"
+	if manifest.DockerOutput == model.DockerOutputContext {
+		target = "docker"
+	}
+	targets := []string{target}
+	for _, t := range manifest.DockerExtraTargets {
+		targets = append(targets, t.Target)
+	}
+	return targets
+}
+
+// istioDockerImages returns the images built by the istio docker targets, excluding those built by extra targets
+func istioDockerImages(manifest model.Manifest) []string {
+	extra := map[string]struct{}{}
+	for _, t := range manifest.DockerExtraTargets {
+		for _, image := range t.Images {
+			extra[image] = struct{}{}
+		}
+	}
+	images := []string{}
+	for _, image := range manifest.DockerImages {
+		if _, f := extra[image]; !f {
+			images = append(images, image)
+		}
+	}
+	return images
+}
+
+// dockerTargets converts image names, which may include a variant, into the make targets to build them.
+// For example, pilot-distroless and pilot-debug both result in docker.pilot.
+func dockerTargets(images []string, variants []string) []string {
+	variants = append(append([]string{}, model.DefaultDockerVariants...), variants...)
+	targets := []string{}
+	seen := map[string]struct{}{}
+	for _, image := range images {
+		image, _ = model.SplitImageVariant(image, variants)
+		if _, f := seen[image]; f {
+			continue
+		}
+		seen[image] = struct{}{}
+		targets = append(targets, "docker."+image)
+	}
+	return targets
+}
+
+// checkDockerImages ensures every image listed in the manifest was produced for every architecture, with the name it
+// is shipped with
+func checkDockerImages(manifest model.Manifest) error {
+	for _, plat := range manifest.GetDockerArchitectures() {
+		suffix, err := util.ImageArchSuffix(plat)
+		if err != nil {
+			return err
+		}
+		for _, image := range manifest.DockerImages {
+			archive := path.Join(manifest.OutDir(), manifest.ArtifactDir(model.DockerArtifacts), manifest.ShippedImage(image)+suffix+".tar.gz")
+			if !util.FileExists(archive) {
+				return fmt.Errorf("manifest lists docker image %v, but the build did not produce %v", image, archive)
+			}
+		}
+	}
 	return nil
 }
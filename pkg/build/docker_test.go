@@ -0,0 +1,165 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+	"github.com/alauda-mesh/release-builder/pkg/testutil"
+	"github.com/alauda-mesh/release-builder/pkg/util"
+)
+
+func TestDockerTargets(t *testing.T) {
+	images := []string{"pilot-debug", "pilot-distroless", "pilot-ubi", "proxyv2-ubi", "install-cni"}
+	got := dockerTargets(images, []string{"debug", "ubi"})
+	expected := []string{"docker.pilot", "docker.proxyv2", "docker.install-cni"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestDockerEnv(t *testing.T) {
+	images := []string{"pilot-debug", "pilot-distroless", "proxyv2-distroless"}
+	cases := []struct {
+		name     string
+		manifest model.Manifest
+		expected []string
+		wantErr  string
+	}{
+		{
+			name:     "default images",
+			manifest: model.Manifest{DockerImages: images},
+			expected: []string{"DOCKER_BUILD_VARIANTS=debug distroless"},
+		},
+		{
+			name:     "listed images",
+			manifest: model.Manifest{DockerImages: images, CustomDockerImages: true},
+			expected: []string{"DOCKER_BUILD_VARIANTS=debug distroless", "DOCKER_TARGETS=docker.pilot docker.proxyv2"},
+		},
+		{
+			name:     "ambient images skipped",
+			manifest: model.Manifest{DockerImages: images, SkipAmbient: true},
+			expected: []string{"DOCKER_BUILD_VARIANTS=debug distroless", "DOCKER_TARGETS=docker.pilot docker.proxyv2"},
+		},
+		{
+			name: "every image built by an extra target",
+			manifest: model.Manifest{
+				DockerImages:       []string{"wasm-plugin-distroless"},
+				CustomDockerImages: true,
+				DockerExtraTargets: []model.DockerTarget{{Target: "docker.wasm-plugin", Images: []string{"wasm-plugin-distroless"}}},
+			},
+			wantErr: "empty DOCKER_TARGETS",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := dockerEnv(tt.manifest)
+			testutil.AssertError(t, err, tt.wantErr)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestDockerExtraTargets(t *testing.T) {
+	manifest := model.Manifest{
+		DockerOutput: model.DockerOutputTar,
+		DockerImages: []string{"pilot-distroless", "wasm-plugin-distroless"},
+		DockerExtraTargets: []model.DockerTarget{
+			{Target: "docker.wasm-plugin", Images: []string{"wasm-plugin-distroless"}},
+		},
+	}
+	if got, expected := dockerMakeTargets(manifest), []string{"docker.save", "docker.wasm-plugin"}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected make targets %v, got %v", expected, got)
+	}
+	if got, expected := istioDockerImages(manifest), []string{"pilot-distroless"}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected istio images %v, got %v", expected, got)
+	}
+
+	manifest.DockerExtraTargets = nil
+	manifest.DockerOutput = model.DockerOutputContext
+	if got, expected := dockerMakeTargets(manifest), []string{"docker"}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected make targets %v, got %v", expected, got)
+	}
+}
+
+func TestRenameDockerImages(t *testing.T) {
+	manifest := model.Manifest{
+		Directory:      t.TempDir(),
+		Version:        "1.2.3",
+		Docker:         "docker.io/istio",
+		DockerOutput:   model.DockerOutputTar,
+		DockerVariants: []string{"distroless"},
+		Architectures:  []string{"linux/amd64", "linux/arm64"},
+		DockerImages:   []string{"pilot-distroless", "proxyv2-distroless"},
+		ImageRenames:   map[string]string{"pilot": "istiod"},
+	}
+	dir := filepath.Join(manifest.OutDir(), manifest.ArtifactDir(model.DockerArtifacts))
+	for _, name := range []string{"pilot-distroless", "pilot-distroless-arm64", "proxyv2-distroless", "proxyv2-distroless-arm64"} {
+		testutil.WriteImage(t, filepath.Join(dir, name+".tar.gz"), `{"config":{}}`, nil)
+	}
+	if err := renameDockerImages(manifest); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	expected := []string{
+		"istiod-distroless-arm64.tar.gz", "istiod-distroless.tar.gz",
+		"proxyv2-distroless-arm64.tar.gz", "proxyv2-distroless.tar.gz",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	if err := checkDockerImages(manifest); err != nil {
+		t.Fatal(err)
+	}
+	if ref := manifest.ImageReference(manifest.Docker, manifest.Version, manifest.ShippedImage("pilot-distroless")); ref != "docker.io/istio/istiod:1.2.3-distroless" {
+		t.Fatalf("expected renamed image reference, got %v", ref)
+	}
+}
+
+func TestCheckDockerImagesArchitectures(t *testing.T) {
+	manifest := model.Manifest{
+		Directory:           t.TempDir(),
+		DockerOutput:        model.DockerOutputTar,
+		Architectures:       []string{"linux/amd64", "linux/arm64"},
+		DockerArchitectures: []string{"linux/arm64"},
+		DockerImages:        []string{"pilot-distroless"},
+	}
+	if err := checkDockerImages(manifest); err == nil {
+		t.Fatalf("expected error with no images")
+	}
+	dir := filepath.Join(manifest.OutDir(), manifest.ArtifactDir(model.DockerArtifacts))
+	testutil.WriteImage(t, filepath.Join(dir, "pilot-distroless-arm64.tar.gz"), `{"config":{}}`, nil)
+	// Only the docker architectures are built, so no linux/amd64 image is expected
+	if err := checkDockerImages(manifest); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(util.StandardEnv(manifest), "DOCKER_ARCHITECTURES=linux/arm64") {
+		t.Fatalf("expected only docker architectures in the build environment")
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"text/template"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+	"github.com/alauda-mesh/release-builder/pkg/util"
+)
+
+// downloadScript installs the istioctl of a release. The download URL defaults to where the release is published, and
+// can be overridden when running the script, such as to download from a mirror.
+var downloadScript = template.Must(template.New(model.DownloadScriptFile).Parse(`#!/bin/sh
+#
+# Downloads istioctl {{ .Version }}, which installs images from {{ .Hub }}, to $HOME/.istioctl/bin.
+#
+# Set DOWNLOAD_URL to download from a mirror of {{ .URL }},
+# and TARGET_ARCH to override the detected architecture: amd64, arm64 or armv7.
+
+set -e
+
+VERSION="{{ .Version }}"
+HUB="{{ .Hub }}"
+DOWNLOAD_URL="${DOWNLOAD_URL:-{{ .URL }}}"
+
+case "$(uname)" in
+  Darwin) OS=osx ;;
+  Linux) OS=linux ;;
+  *) echo "Unsupported OS $(uname)" >&2; exit 1 ;;
+esac
+
+if [ -z "${TARGET_ARCH}" ]; then
+  case "$(uname -m)" in
+    x86_64|amd64) TARGET_ARCH=amd64 ;;
+    aarch64|arm64) TARGET_ARCH=arm64 ;;
+    armv7*) TARGET_ARCH=armv7 ;;
+    *) echo "Unsupported architecture $(uname -m)" >&2; exit 1 ;;
+  esac
+fi
+
+ARCHIVE="istioctl-${VERSION}-${OS}-${TARGET_ARCH}.tar.gz"
+TMP="$(mktemp -d)"
+trap 'rm -rf "${TMP}"' EXIT
+
+echo "Downloading ${DOWNLOAD_URL}/${ARCHIVE}"
+curl -fsSL -o "${TMP}/${ARCHIVE}" "${DOWNLOAD_URL}/${ARCHIVE}"
+mkdir -p "${HOME}/.istioctl/bin"
+tar -xzf "${TMP}/${ARCHIVE}" -C "${HOME}/.istioctl/bin"
+chmod +x "${HOME}/.istioctl/bin/istioctl"
+
+echo "istioctl ${VERSION} is installed to ${HOME}/.istioctl/bin, and installs images from ${HUB}."
+echo "Add it to your PATH with: export PATH=\"\${HOME}/.istioctl/bin:\${PATH}\""
+`))
+
+// WriteDownloadScript writes the script installing the istioctl of the release, pinned to the release version and hub,
+// to the release root
+func WriteDownloadScript(manifest model.Manifest) error {
+	buf := &bytes.Buffer{}
+	if err := downloadScript.Execute(buf, struct {
+		Version string
+		Hub     string
+		URL     string
+	}{manifest.Version, manifest.Docker, manifest.GetReleaseURL()}); err != nil {
+		return fmt.Errorf("failed to render %v: %v", model.DownloadScriptFile, err)
+	}
+	return util.WriteFileAtomic(filepath.Join(manifest.OutDir(), model.DownloadScriptFile), buf.Bytes(), 0o755)
+}
@@ -0,0 +1,74 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+)
+
+func TestWriteDownloadScript(t *testing.T) {
+	cases := []struct {
+		name    string
+		storage *model.ArtifactStorage
+		url     string
+	}{
+		{"default", nil, model.DefaultReleaseURL + "/1.20.0"},
+		{"storage", &model.ArtifactStorage{Type: model.StorageS3, Bucket: "mesh-releases/istio"}, "https://mesh-releases.s3.amazonaws.com/istio/1.20.0"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.MkdirAll(filepath.Join(dir, "out"), 0o750); err != nil {
+				t.Fatal(err)
+			}
+			manifest := model.Manifest{Version: "1.20.0", Docker: "registry.example.com/istio", Directory: dir, Storage: tt.storage}
+			if err := WriteDownloadScript(manifest); err != nil {
+				t.Fatal(err)
+			}
+			file := filepath.Join(manifest.OutDir(), model.DownloadScriptFile)
+			info, err := os.Stat(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode()&0o111 == 0 {
+				t.Fatalf("expected script to be executable, got mode %v", info.Mode())
+			}
+			by, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			script := string(by)
+			for _, want := range []string{
+				`VERSION="1.20.0"`,
+				`HUB="registry.example.com/istio"`,
+				`DOWNLOAD_URL="${DOWNLOAD_URL:-` + tt.url + `}"`,
+				`ARCHIVE="istioctl-${VERSION}-${OS}-${TARGET_ARCH}.tar.gz"`,
+			} {
+				if !strings.Contains(script, want) {
+					t.Fatalf("expected script to contain %v, got:\n%v", want, script)
+				}
+			}
+			if out, err := exec.Command("sh", "-n", file).CombinedOutput(); err != nil {
+				t.Fatalf("script is not valid: %v: %s", err, out)
+			}
+		})
+	}
+}
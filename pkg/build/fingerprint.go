@@ -0,0 +1,125 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+
+	"istio.io/istio/pkg/log"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+	"github.com/alauda-mesh/release-builder/pkg/util"
+)
+
+// A step is skipped when the fingerprint of its inputs matches the one recorded by its last successful run, and its
+// outputs still exist. Only steps listed in stepInputs are ever skipped.
+
+// stepInputs selects the manifest fields each cacheable step depends on. The SHAs of all dependencies are always
+// included.
+var stepInputs = map[model.BuildStep]func(manifest model.Manifest) interface{}{
+	model.StepDocker: func(m model.Manifest) interface{} {
+		return []interface{}{m.Version, m.Docker, m.DockerOutput, m.DockerImages, m.CustomDockerImages, m.SkipAmbient, m.DockerVariants, m.DockerExtraTargets, m.Architectures, m.DockerArchitectures, m.ProxyOverride, m.ImageLock, m.VerifyImageReproducibility, m.ImageRenames}
+	},
+	model.StepArchive: func(m model.Manifest) interface{} {
+		return []interface{}{
+			m.Version, m.Docker, m.EmbedBuildInfo, m.SkipBuildTimestamp, m.AdditionalCompletions, m.ShaAlgorithms,
+			m.UncompressedArchives, m.ArchiveArchitectures, m.ThirdPartyNotices, m.ToolsArchive,
+			m.GzipLevel, m.CosignSigning, m.StripIstioctl,
+		}
+	},
+}
+
+// stepOutputsExist checks the outputs of a cacheable step are still present
+var stepOutputsExist = map[model.BuildStep]func(manifest model.Manifest) bool{
+	model.StepDocker: func(m model.Manifest) bool {
+		// Images in the docker context may have been removed since, so are always rebuilt
+		return m.DockerOutput == model.DockerOutputTar && checkDockerImages(m) == nil &&
+			(!m.ImageLock || util.FileExists(path.Join(m.OutDir(), model.ImageLockFile)))
+	},
+	model.StepArchive: func(m model.Manifest) bool {
+		for _, arch := range m.GetArchiveArchitectures() {
+			archives := []string{archiveName("istio", m.Version, arch)}
+			if m.ToolsArchive {
+				archives = append(archives, archiveName("istio-tools", m.Version, arch))
+			}
+			for _, archive := range archives {
+				if !util.FileExists(path.Join(m.OutDir(), archive)) {
+					return false
+				}
+			}
+		}
+		return true
+	},
+}
+
+// stepFingerprint hashes the inputs of a step
+func stepFingerprint(manifest model.Manifest, step model.BuildStep) (string, error) {
+	deps := map[string]string{}
+	for repo, dep := range manifest.Dependencies.Get() {
+		if dep != nil {
+			deps[repo] = dep.Sha
+		}
+	}
+	js, err := json.Marshal(struct {
+		Step         model.BuildStep
+		Inputs       interface{}
+		Dependencies map[string]string
+	}{step, stepInputs[step](manifest), deps})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal %v inputs: %v", step, err)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(js)), nil
+}
+
+func fingerprintFile(manifest model.Manifest, step model.BuildStep) string {
+	return path.Join(manifest.Directory, "fingerprints", string(step))
+}
+
+// runStep runs a build step, unless it is cacheable and unchanged since its last successful run.
+// If force is set, the step is always run.
+func runStep(manifest model.Manifest, step model.BuildStep, force bool, run func() error) error {
+	if _, f := stepInputs[step]; !f {
+		return run()
+	}
+	fingerprint, err := stepFingerprint(manifest, step)
+	if err != nil {
+		return err
+	}
+	marker := fingerprintFile(manifest, step)
+	if !force {
+		if last, err := os.ReadFile(marker); err == nil && string(last) == fingerprint && stepOutputsExist[step](manifest) {
+			log.Infof("Skipping %v step; inputs are unchanged since the last build", step)
+			return nil
+		}
+	}
+	// Remove the marker first, so a failed run is never mistaken for a successful one
+	if err := os.Remove(marker); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %v fingerprint: %v", step, err)
+	}
+	if err := run(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(marker), 0o750); err != nil {
+		return err
+	}
+	if err := os.WriteFile(marker, []byte(fingerprint), 0o640); err != nil {
+		return fmt.Errorf("failed to write %v fingerprint: %v", step, err)
+	}
+	return nil
+}
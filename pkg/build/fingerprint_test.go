@@ -0,0 +1,124 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+)
+
+func TestRunStepCache(t *testing.T) {
+	manifest := model.Manifest{
+		Version:   "1.20.0",
+		Directory: t.TempDir(),
+		Dependencies: model.IstioDependencies{
+			Istio: &model.Dependency{Sha: "1111"},
+			Proxy: &model.Dependency{Sha: "2222"},
+		},
+	}
+	writeArchives := func() error {
+		if err := os.MkdirAll(manifest.OutDir(), 0o750); err != nil {
+			return err
+		}
+		for _, arch := range model.ArchiveArchitectures {
+			archive := fmt.Sprintf("istio-%s-%s.tar.gz", manifest.Version, arch)
+			if strings.HasPrefix(arch, "win") {
+				archive = fmt.Sprintf("istio-%s-%s.zip", manifest.Version, arch)
+			}
+			if err := os.WriteFile(path.Join(manifest.OutDir(), archive), []byte("test"), 0o640); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	runs := 0
+	run := func(force bool) {
+		t.Helper()
+		err := runStep(manifest, model.StepArchive, force, func() error {
+			runs++
+			return writeArchives()
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectRuns := func(want int) {
+		t.Helper()
+		if runs != want {
+			t.Fatalf("expected step to have run %d times, ran %d times", want, runs)
+		}
+	}
+
+	// Miss: no previous build
+	run(false)
+	expectRuns(1)
+
+	// Hit: nothing changed
+	run(false)
+	expectRuns(1)
+
+	// Miss: forced
+	run(true)
+	expectRuns(2)
+
+	// Miss: a dependency changed
+	manifest.Dependencies.Proxy = &model.Dependency{Sha: "3333"}
+	run(false)
+	expectRuns(3)
+	run(false)
+	expectRuns(3)
+
+	// Miss: an input field changed
+	manifest.EmbedBuildInfo = true
+	run(false)
+	expectRuns(4)
+
+	// Miss: an output was removed
+	if err := os.Remove(path.Join(manifest.OutDir(), "istio-1.20.0-win-amd64.zip")); err != nil {
+		t.Fatal(err)
+	}
+	run(false)
+	expectRuns(5)
+
+	// A failed run must not be cached
+	failing := fmt.Errorf("failed")
+	manifest.Version = "1.20.1"
+	if err := runStep(manifest, model.StepArchive, false, func() error { return failing }); err != failing {
+		t.Fatalf("expected failure, got %v", err)
+	}
+	run(false)
+	expectRuns(6)
+}
+
+func TestRunStepUncached(t *testing.T) {
+	manifest := model.Manifest{Directory: t.TempDir()}
+	runs := 0
+	for i := 0; i < 2; i++ {
+		if err := runStep(manifest, model.StepHelm, false, func() error {
+			runs++
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if runs != 2 {
+		t.Fatalf("expected uncached step to always run, ran %d times", runs)
+	}
+}
@@ -16,11 +16,18 @@ package build
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
+	"net/http"
 	"os"
 	"path"
+	"slices"
 	"strings"
+	"time"
 
 	"istio.io/istio/pkg/log"
 
@@ -29,7 +36,10 @@ import (
 )
 
 // Grafana packages Istio dashboards in a form that is ready to be published to grafana.com
-func Grafana(manifest model.Manifest) error {
+func Grafana(ctx context.Context, manifest model.Manifest) error {
+	if manifest.FetchGrafanaDashboards {
+		return GenerateGrafanaDashboards(ctx, manifest)
+	}
 	if err := util.CopyDir(
 		path.Join(manifest.RepoDir("istio"), "manifests/addons/dashboards"),
 		path.Join(manifest.WorkDir(), "grafana"),
@@ -53,7 +63,7 @@ func Grafana(manifest model.Manifest) error {
 		sanitized := strings.ReplaceAll(dashboard.Name(), ".gen.json", ".json")
 		if err := util.CopyFile(
 			path.Join(manifest.WorkDir(), "grafana", dashboard.Name()),
-			path.Join(manifest.OutDir(), "grafana", sanitized),
+			path.Join(manifest.OutDir(), manifest.ArtifactDir(model.GrafanaArtifacts), sanitized),
 		); err != nil {
 			return err
 		}
@@ -61,6 +71,23 @@ func Grafana(manifest model.Manifest) error {
 	return nil
 }
 
+// dashboardInputs are the __inputs of an external dashboard, asking for the Prometheus datasource on import
+const dashboardInputs = `[
+    {
+      "name": "DS_PROMETHEUS",
+      "label": "Prometheus",
+      "description": "",
+      "type": "datasource",
+      "pluginId": "prometheus",
+      "pluginName": "Prometheus"
+    }
+  ]`
+
+// templateDatasource substitutes the hardcoded Prometheus datasource of a dashboard with the DS_PROMETHEUS input
+func templateDatasource(dashboard []byte) []byte {
+	return bytes.ReplaceAll(dashboard, []byte(`"datasource": "Prometheus"`), []byte(`"datasource": "${DS_PROMETHEUS}"`))
+}
+
 // externalizeDashboard converts a grafana dashboard from the "internal" representation, which is used
 // in the charts, to the "external" representation. This is the form needed to publish to grafana.com
 // This has two fields added, __inputs and __requires, and the datasource is not hardcoded.
@@ -75,16 +102,7 @@ func externalizeDashboard(version, file string) error {
 	}
 
 	var inputMsg json.RawMessage
-	if err := json.Unmarshal([]byte(`[
-    {
-      "name": "DS_PROMETHEUS",
-      "label": "Prometheus",
-      "description": "",
-      "type": "datasource",
-      "pluginId": "prometheus",
-      "pluginName": "Prometheus"
-    }
-  ]`), &inputMsg); err != nil {
+	if err := json.Unmarshal([]byte(dashboardInputs), &inputMsg); err != nil {
 		return fmt.Errorf("failed to construct __inputs: %v", err)
 	}
 	msg["__inputs"] = inputMsg
@@ -138,9 +156,110 @@ func externalizeDashboard(version, file string) error {
 		return fmt.Errorf("failed to marshal%v", err)
 	}
 	// Substitute the datasource with the variable placeholder
-	result = bytes.ReplaceAll(result, []byte(`"datasource": "Prometheus"`), []byte(`"datasource": "${DS_PROMETHEUS}"`))
+	result = templateDatasource(result)
 	if err := os.WriteFile(file, result, 0o644); err != nil {
 		return fmt.Errorf("failed to write: %v", err)
 	}
 	return nil
 }
+
+var (
+	// dashboardFetchAttempts is how many times each dashboard is requested before giving up
+	dashboardFetchAttempts = 4
+	// dashboardFetchBackoff is the delay before the first retry, doubling for each further retry
+	dashboardFetchBackoff = 2 * time.Second
+)
+
+// errDashboardNotFound is returned by fetchDashboard for a dashboard that does not exist, which is not retried
+var errDashboardNotFound = errors.New("dashboard not found")
+
+// fetchDashboard downloads a dashboard
+var fetchDashboard = func(url string) ([]byte, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errDashboardNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %v", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// grafanaDashboardURL returns the URL a dashboard is downloaded from: its URL in the manifest, or otherwise the latest
+// revision of its ID on grafana.com
+func grafanaDashboardURL(manifest model.Manifest, name string) string {
+	if url, f := manifest.GrafanaDashboardURLs[name]; f {
+		return url
+	}
+	return fmt.Sprintf("https://grafana.com/api/dashboards/%d/revisions/latest/download", manifest.GrafanaDashboards[name])
+}
+
+// GenerateGrafanaDashboards downloads each dashboard of the manifest, rather than taking the dashboards from the istio
+// repo. Each dashboard is templated to use the DS_PROMETHEUS datasource input, and written to the grafana directory
+// of the release as <name>.json. Retries stop early if ctx is cancelled.
+func GenerateGrafanaDashboards(ctx context.Context, manifest model.Manifest) error {
+	out := path.Join(manifest.OutDir(), manifest.ArtifactDir(model.GrafanaArtifacts))
+	if err := os.MkdirAll(out, 0o750); err != nil {
+		return err
+	}
+	names := slices.Sorted(maps.Keys(manifest.GrafanaDashboards))
+	for _, name := range names {
+		url := grafanaDashboardURL(manifest, name)
+		by, err := fetchDashboardWithRetry(ctx, url)
+		if err != nil {
+			return fmt.Errorf("failed to fetch dashboard %v from %v: %v", name, url, err)
+		}
+		dashboard, err := templateFetchedDashboard(by)
+		if err != nil {
+			return fmt.Errorf("invalid dashboard %v from %v: %v", name, url, err)
+		}
+		if err := os.WriteFile(path.Join(out, name+".json"), dashboard, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchDashboardWithRetry downloads a dashboard, retrying failures other than a missing dashboard until ctx is cancelled
+func fetchDashboardWithRetry(ctx context.Context, url string) ([]byte, error) {
+	backoff := dashboardFetchBackoff
+	for attempt := 1; ; attempt++ {
+		by, err := fetchDashboard(url)
+		if err == nil || errors.Is(err, errDashboardNotFound) {
+			return by, err
+		}
+		if attempt == dashboardFetchAttempts {
+			return nil, fmt.Errorf("failed after %d attempts: %v", attempt, err)
+		}
+		log.Warnf("failed to fetch dashboard %v, retrying in %v: %v", url, backoff, err)
+		if err := util.Sleep(ctx, backoff); err != nil {
+			return nil, fmt.Errorf("cancelled after %d attempts: %v", attempt, err)
+		}
+		backoff *= 2
+	}
+}
+
+// templateFetchedDashboard checks a downloaded dashboard is a JSON object with a title, and templates its datasource.
+// Dashboards exported for sharing already have __inputs; others are given the DS_PROMETHEUS input.
+func templateFetchedDashboard(by []byte) ([]byte, error) {
+	var msg map[string]json.RawMessage
+	if err := json.Unmarshal(by, &msg); err != nil {
+		return nil, fmt.Errorf("not a JSON object: %v", err)
+	}
+	var title string
+	if err := json.Unmarshal(msg["title"], &title); err != nil || title == "" {
+		return nil, fmt.Errorf("no title")
+	}
+	if _, f := msg["__inputs"]; !f {
+		msg["__inputs"] = json.RawMessage(dashboardInputs)
+	}
+	result, err := json.MarshalIndent(msg, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return templateDatasource(result), nil
+}
@@ -0,0 +1,127 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+)
+
+func TestGenerateGrafanaDashboards(t *testing.T) {
+	origBackoff := dashboardFetchBackoff
+	dashboardFetchBackoff = time.Millisecond
+	t.Cleanup(func() { dashboardFetchBackoff = origBackoff })
+
+	manifest := model.Manifest{
+		Directory:              t.TempDir(),
+		FetchGrafanaDashboards: true,
+		GrafanaDashboards:      map[string]int{"pilot-dashboard": 7645, "mesh-dashboard": 7639},
+		GrafanaDashboardURLs:   map[string]string{"mesh-dashboard": "https://example.com/mesh.json"},
+	}
+	dashboards := map[string]string{
+		"https://grafana.com/api/dashboards/7645/revisions/latest/download": `{"title":"Pilot","panels":[{"datasource": "Prometheus"}]}`,
+		"https://example.com/mesh.json":                                     `{"title":"Mesh","__inputs":[{"name":"DS_CUSTOM"}]}`,
+	}
+	failures := 2
+	requested := []string{}
+	orig := fetchDashboard
+	fetchDashboard = func(url string) ([]byte, error) {
+		requested = append(requested, url)
+		if failures > 0 {
+			failures--
+			return nil, errors.New("connection reset")
+		}
+		by, f := dashboards[url]
+		if !f {
+			return nil, errDashboardNotFound
+		}
+		return []byte(by), nil
+	}
+	t.Cleanup(func() { fetchDashboard = orig })
+
+	if err := GenerateGrafanaDashboards(context.Background(), manifest); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"https://example.com/mesh.json", "https://example.com/mesh.json", "https://example.com/mesh.json",
+		"https://grafana.com/api/dashboards/7645/revisions/latest/download",
+	}
+	if !reflect.DeepEqual(requested, expected) {
+		t.Fatalf("expected requests %v, got %v", expected, requested)
+	}
+	dir := filepath.Join(manifest.OutDir(), manifest.ArtifactDir(model.GrafanaArtifacts))
+	pilot, err := os.ReadFile(filepath.Join(dir, "pilot-dashboard.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(pilot), `"datasource": "${DS_PROMETHEUS}"`) || !strings.Contains(string(pilot), `"DS_PROMETHEUS"`) {
+		t.Fatalf("expected templated datasource, got %s", pilot)
+	}
+	mesh, err := os.ReadFile(filepath.Join(dir, "mesh-dashboard.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(mesh), "DS_CUSTOM") || strings.Contains(string(mesh), "DS_PROMETHEUS") {
+		t.Fatalf("expected the inputs of the dashboard to be kept, got %s", mesh)
+	}
+
+	cases := []struct {
+		name    string
+		body    string
+		err     error
+		wantErr string
+		fetches int
+		cancel  bool
+	}{
+		{name: "not found", err: errDashboardNotFound, wantErr: "dashboard not found", fetches: 1},
+		{name: "unavailable", err: errors.New("connection refused"), wantErr: "after 4 attempts", fetches: 4},
+		{name: "cancelled", err: errors.New("connection refused"), wantErr: "cancelled after 1 attempts", fetches: 1, cancel: true},
+		{name: "not json", body: "<html>", wantErr: "not a JSON object", fetches: 1},
+		{name: "no title", body: `{"panels":[]}`, wantErr: "no title", fetches: 1},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			fetches := 0
+			fetchDashboard = func(string) ([]byte, error) {
+				fetches++
+				return []byte(tt.body), tt.err
+			}
+			m := manifest
+			m.Directory = t.TempDir()
+			m.GrafanaDashboardURLs = nil
+			m.GrafanaDashboards = map[string]int{"pilot-dashboard": 7645}
+			ctx, cancel := context.WithCancel(context.Background())
+			if tt.cancel {
+				cancel()
+			}
+			defer cancel()
+			err := GenerateGrafanaDashboards(ctx, m)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+			}
+			if fetches != tt.fetches {
+				t.Fatalf("expected %d fetches, got %d", tt.fetches, fetches)
+			}
+		})
+	}
+}
@@ -161,7 +161,7 @@ func stampChartForRelease(manifest model.Manifest, s string) error {
 }
 
 func HelmCharts(manifest model.Manifest) error {
-	dst := path.Join(manifest.OutDir(), "helm")
+	dst := path.Join(manifest.OutDir(), manifest.ArtifactDir(model.HelmArtifacts))
 	samplesDst := path.Join(dst, "samples")
 
 	if err := os.MkdirAll(path.Join(dst), 0o750); err != nil {
@@ -182,7 +182,7 @@ func HelmCharts(manifest model.Manifest) error {
 
 		c := util.VerboseCommand("helm", "package", outDir)
 		c.Dir = samplesDst
-		if err := c.Run(); err != nil {
+		if err := util.RunSummarized(c); err != nil {
 			return fmt.Errorf("package %v: %v", chart, err)
 		}
 	}
@@ -197,10 +197,16 @@ func HelmCharts(manifest model.Manifest) error {
 
 		c := util.VerboseCommand("helm", "package", outDir)
 		c.Dir = dst
-		if err := c.Run(); err != nil {
+		if err := util.RunSummarized(c); err != nil {
 			return fmt.Errorf("package %v: %v", chart, err)
 		}
 	}
+
+	if manifest.HelmRepoIndex {
+		if err := writeHelmRepoIndex(manifest, dst); err != nil {
+			return fmt.Errorf("failed to write helm repo index: %v", err)
+		}
+	}
 	return nil
 }
 
@@ -209,7 +215,7 @@ func prepChartForPackaging(inDir, outDir string) error {
 	// Helm will skip for us if the chart has no deps
 	depCmd := util.VerboseCommand("helm", "dep", "update")
 	depCmd.Dir = inDir
-	if err := depCmd.Run(); err != nil {
+	if err := util.RunSummarized(depCmd); err != nil {
 		return fmt.Errorf("dep update %v: %v", inDir, err)
 	}
 
@@ -26,6 +26,8 @@ import (
 	"sigs.k8s.io/yaml"
 
 	"github.com/alauda-mesh/release-builder/pkg/model"
+	"github.com/alauda-mesh/release-builder/pkg/testutil"
+	"github.com/alauda-mesh/release-builder/pkg/util"
 )
 
 func TestHelmUpdate(t *testing.T) {
@@ -100,3 +102,60 @@ func createWritableTempVersion(t *testing.T, tmpDir, destFileName, sourceFilePat
 
 	return file
 }
+
+func TestWriteHelmRepoIndex(t *testing.T) {
+	dir := t.TempDir()
+	charts := map[string]string{
+		"base-1.2.3.tgz":            "base",
+		"istiod-1.2.3.tgz":          "istiod",
+		"samples/ambient-1.2.3.tgz": "ambient",
+	}
+	for file, name := range charts {
+		testutil.WriteArchive(t, filepath.Join(dir, file), testutil.Files(map[string]string{
+			name + "/Chart.yaml":                "apiVersion: v2\nname: " + name + "\nversion: 1.2.3\nappVersion: 1.2.3\n",
+			name + "/charts/sub/Chart.yaml":     "apiVersion: v2\nname: sub\nversion: 0.0.1\n",
+			name + "/templates/deployment.yaml": "kind: Deployment\n",
+		})...)
+	}
+	manifest := model.Manifest{SkipBuildTimestamp: true}
+	if err := writeHelmRepoIndex(manifest, dir); err != nil {
+		t.Fatal(err)
+	}
+	by, err := os.ReadFile(filepath.Join(dir, model.HelmRepoIndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index helmRepoIndex
+	if err := yaml.Unmarshal(by, &index); err != nil {
+		t.Fatal(err)
+	}
+	if index.APIVersion != "v1" || len(index.Entries) != len(charts) {
+		t.Fatalf("expected an entry for each chart, got %s", by)
+	}
+	for file, name := range charts {
+		versions := index.Entries[name]
+		if len(versions) != 1 {
+			t.Fatalf("expected one version of %v, got %v", name, len(versions))
+		}
+		v := versions[0]
+		pkg, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		digest, _ := util.ShaSum(util.Sha256, pkg)
+		if v.Version != "1.2.3" || v.AppVersion != "1.2.3" || len(v.URLs) != 1 || v.URLs[0] != file || v.Digest != digest {
+			t.Fatalf("unexpected entry for %v: %+v %v", name, v.Metadata, v.URLs)
+		}
+	}
+	// The index is reproducible with SkipBuildTimestamp
+	if err := writeHelmRepoIndex(manifest, dir); err != nil {
+		t.Fatal(err)
+	}
+	again, err := os.ReadFile(filepath.Join(dir, model.HelmRepoIndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(by, again) {
+		t.Fatalf("expected the same index, got:\n%s\nthen:\n%s", by, again)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"sigs.k8s.io/yaml"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+	"github.com/alauda-mesh/release-builder/pkg/util"
+)
+
+// helmRepoIndex is the index.yaml of a classic helm repo, in the format written by `helm repo index`
+type helmRepoIndex struct {
+	APIVersion string                         `json:"apiVersion"`
+	Generated  time.Time                      `json:"generated"`
+	Entries    map[string][]*helmChartVersion `json:"entries"`
+}
+
+// helmChartVersion is an entry of a helm repo index, describing one packaged chart
+type helmChartVersion struct {
+	*chart.Metadata
+	URLs    []string  `json:"urls"`
+	Created time.Time `json:"created,omitempty"`
+	Digest  string    `json:"digest,omitempty"`
+}
+
+// writeHelmRepoIndex writes the index of a classic helm repo serving the packaged charts in dir, including the
+// charts one directory below it, such as the sample charts. Chart URLs are relative, so the repo can be served
+// from wherever the release is mirrored.
+func writeHelmRepoIndex(manifest model.Manifest, dir string) error {
+	index, err := helmIndex(manifest, dir)
+	if err != nil {
+		return err
+	}
+	by, err := yaml.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(path.Join(dir, model.HelmRepoIndexFile), by, 0o644)
+}
+
+// helmIndex returns the helm repo index of the packaged charts in dir
+func helmIndex(manifest model.Manifest, dir string) (helmRepoIndex, error) {
+	created := time.Now()
+	if manifest.SkipBuildTimestamp {
+		// Keep the index reproducible, as for build-info.json
+		created = time.Unix(0, 0).UTC()
+	}
+	index := helmRepoIndex{APIVersion: "v1", Generated: created, Entries: map[string][]*helmChartVersion{}}
+	var charts []string
+	for _, pattern := range []string{"*.tgz", "*/*.tgz"} {
+		m, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return helmRepoIndex{}, err
+		}
+		charts = append(charts, m...)
+	}
+	for _, c := range charts {
+		metadata, err := packagedChartMetadata(c)
+		if err != nil {
+			return helmRepoIndex{}, fmt.Errorf("%v: %v", c, err)
+		}
+		by, err := os.ReadFile(c)
+		if err != nil {
+			return helmRepoIndex{}, err
+		}
+		digest, err := util.ShaSum(util.Sha256, by)
+		if err != nil {
+			return helmRepoIndex{}, err
+		}
+		rel, err := filepath.Rel(dir, c)
+		if err != nil {
+			return helmRepoIndex{}, err
+		}
+		index.Entries[metadata.Name] = append(index.Entries[metadata.Name], &helmChartVersion{
+			Metadata: metadata,
+			URLs:     []string{filepath.ToSlash(rel)},
+			Created:  created,
+			Digest:   digest,
+		})
+	}
+	for _, versions := range index.Entries {
+		sort.Slice(versions, func(i, j int) bool { return versions[i].URLs[0] < versions[j].URLs[0] })
+	}
+	return index, nil
+}
+
+// packagedChartMetadata reads the Chart.yaml of a chart packaged by `helm package`
+func packagedChartMetadata(file string) (*chart.Metadata, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no Chart.yaml found")
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Subcharts have their own Chart.yaml, deeper in the package
+		if strings.Count(hdr.Name, "/") != 1 || path.Base(hdr.Name) != "Chart.yaml" {
+			continue
+		}
+		by, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		metadata := &chart.Metadata{}
+		if err := yaml.Unmarshal(by, metadata); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal Chart.yaml: %v", err)
+		}
+		return metadata, nil
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+	"github.com/alauda-mesh/release-builder/pkg/util"
+)
+
+// writeImageLock writes the image lock, pinning every image saved by the docker step to its image ID
+func writeImageLock(manifest model.Manifest) error {
+	lock, err := imageLock(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to generate image lock: %v", err)
+	}
+	by, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := util.WriteFileAtomic(path.Join(manifest.OutDir(), model.ImageLockFile), append(by, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write image lock: %v", err)
+	}
+	return nil
+}
+
+// imageLock returns the image lock, with one entry per image and architecture sorted by reference
+func imageLock(manifest model.Manifest) (model.ImageLock, error) {
+	lock := model.ImageLock{Images: []model.LockedImage{}}
+	for _, plat := range manifest.GetDockerArchitectures() {
+		suffix, err := util.ImageArchSuffix(plat)
+		if err != nil {
+			return lock, err
+		}
+		for _, image := range manifest.DockerImages {
+			image = manifest.ShippedImage(image)
+			archive := path.Join(manifest.OutDir(), manifest.ArtifactDir(model.DockerArtifacts), image+suffix+".tar.gz")
+			config, err := util.ImageConfig(archive)
+			if err != nil {
+				return lock, fmt.Errorf("%v: %v", archive, err)
+			}
+			lock.Images = append(lock.Images, model.LockedImage{
+				Image:   manifest.ImageReference(manifest.Docker, manifest.Version, image) + suffix,
+				ImageID: fmt.Sprintf("sha256:%x", sha256.Sum256(config)),
+			})
+		}
+	}
+	sort.Slice(lock.Images, func(i, j int) bool { return lock.Images[i].Image < lock.Images[j].Image })
+	return lock, nil
+}
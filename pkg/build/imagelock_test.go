@@ -0,0 +1,74 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+	"github.com/alauda-mesh/release-builder/pkg/testutil"
+)
+
+func TestWriteImageLock(t *testing.T) {
+	manifest := model.Manifest{
+		Directory:     t.TempDir(),
+		Version:       "1.2.3",
+		Docker:        "docker.io/istio",
+		Architectures: []string{"linux/amd64", "linux/arm64"},
+		DockerImages:  []string{"pilot-distroless", "proxyv2-debug"},
+	}
+	digests := map[string]string{}
+	for _, suffix := range []string{"", "-arm64"} {
+		for _, image := range manifest.DockerImages {
+			config := fmt.Sprintf(`{"architecture":%q,"image":%q}`, suffix, image)
+			testutil.WriteImage(t, filepath.Join(manifest.OutDir(), "docker", image+suffix+".tar.gz"), config, nil)
+			digests[image+suffix] = fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(config)))
+		}
+	}
+
+	if err := writeImageLock(manifest); err != nil {
+		t.Fatal(err)
+	}
+	by, err := os.ReadFile(filepath.Join(manifest.OutDir(), model.ImageLockFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := model.ImageLock{}
+	if err := json.Unmarshal(by, &got); err != nil {
+		t.Fatal(err)
+	}
+	expected := model.ImageLock{Images: []model.LockedImage{
+		{Image: "docker.io/istio/pilot:1.2.3-distroless", ImageID: digests["pilot-distroless"]},
+		{Image: "docker.io/istio/pilot:1.2.3-distroless-arm64", ImageID: digests["pilot-distroless-arm64"]},
+		{Image: "docker.io/istio/proxyv2:1.2.3", ImageID: digests["proxyv2-debug"]},
+		{Image: "docker.io/istio/proxyv2:1.2.3-arm64", ImageID: digests["proxyv2-debug-arm64"]},
+	}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected lock:\n%+v\ngot:\n%+v", expected, got)
+	}
+
+	if err := os.Remove(filepath.Join(manifest.OutDir(), "docker", "proxyv2-debug-arm64.tar.gz")); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeImageLock(manifest); err == nil {
+		t.Fatalf("expected error for missing image tarball")
+	}
+}
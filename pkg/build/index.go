@@ -0,0 +1,56 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+	"github.com/alauda-mesh/release-builder/pkg/util"
+)
+
+// ReleaseIndexFile is the name of the release index in the release
+const ReleaseIndexFile = "release-index.json"
+
+// GenerateReleaseIndex writes release-index.json, describing every artifact in the release. As it covers the output
+// of all other steps, it must run last.
+func GenerateReleaseIndex(manifest model.Manifest) error {
+	artifacts, err := util.ListArtifacts(manifest.OutDir(), ReleaseIndexFile)
+	if err != nil {
+		return fmt.Errorf("failed to list release artifacts: %v", err)
+	}
+	deps := map[string]string{}
+	for repo, dep := range manifest.Dependencies.Get() {
+		if dep != nil {
+			deps[repo] = dep.Sha
+		}
+	}
+	index := model.ReleaseIndex{
+		SchemaVersion: model.ReleaseIndexSchemaVersion,
+		Manifest:      scrubManifest(manifest),
+		Dependencies:  deps,
+		Artifacts:     artifacts,
+	}
+	js, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal release index: %v", err)
+	}
+	if err := util.WriteFileAtomic(path.Join(manifest.OutDir(), ReleaseIndexFile), append(js, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write release index: %v", err)
+	}
+	return nil
+}
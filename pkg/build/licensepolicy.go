@@ -0,0 +1,199 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+)
+
+// checkLicensePolicy fails if any package in the source SBOM has a license the manifest license policy does not allow
+func checkLicensePolicy(manifest model.Manifest) error {
+	sbom := path.Join(manifest.OutDir(), "istio-source.spdx")
+	by, err := os.ReadFile(sbom)
+	if err != nil {
+		return fmt.Errorf("failed to read source sbom: %v", err)
+	}
+	var violations []string
+	for _, p := range parseSpdxPackages(by) {
+		if reason := licenseViolation(*manifest.LicensePolicy, p.License); reason != "" {
+			violations = append(violations, fmt.Sprintf("%s %s (%s)", p.Name, p.Version, reason))
+		}
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("dependencies violate the license policy:\n%v", strings.Join(violations, "\n"))
+	}
+	return nil
+}
+
+// licenseViolation returns why a license expression is not allowed by the policy, or an empty string if it is.
+// The expression is parsed following SPDX precedence, where AND binds tighter than OR: an OR is allowed if any of its
+// operands is, and an AND only if all of its operands are. License exceptions, such as
+// "WITH Classpath-exception-2.0", are ignored.
+func licenseViolation(policy model.LicensePolicy, expression string) string {
+	if isNoAssertion(expression) || expression == "NONE" {
+		if policy.AllowUnknown {
+			return ""
+		}
+		return "unknown license"
+	}
+	expr, err := parseLicenseExpression(expression)
+	if err != nil {
+		return err.Error()
+	}
+	return expr.violation(policy)
+}
+
+// licenseExpression is a node of a parsed SPDX license expression. Leaves are a single license, while other nodes
+// combine their operands with op, AND or OR.
+type licenseExpression struct {
+	license  string
+	op       string
+	operands []*licenseExpression
+}
+
+// violation returns why the expression is not allowed by the policy, or an empty string if it is
+func (e *licenseExpression) violation(policy model.LicensePolicy) string {
+	switch e.op {
+	case "AND":
+		for _, o := range e.operands {
+			if reason := o.violation(policy); reason != "" {
+				return reason
+			}
+		}
+		return ""
+	case "OR":
+		reason := ""
+		for _, o := range e.operands {
+			if reason = o.violation(policy); reason == "" {
+				return ""
+			}
+		}
+		return reason
+	}
+	if matchesLicense(policy.Denied, e.license) {
+		return "denied license " + e.license
+	}
+	if len(policy.Allowed) > 0 && !matchesLicense(policy.Allowed, e.license) {
+		return "license " + e.license + " is not allowed"
+	}
+	return ""
+}
+
+// parseLicenseExpression parses an SPDX license expression, such as "(MIT OR Apache-2.0) AND BSD-3-Clause"
+func parseLicenseExpression(expression string) (*licenseExpression, error) {
+	p := &licenseParser{tokens: strings.Fields(strings.NewReplacer("(", " ( ", ")", " ) ").Replace(expression))}
+	expr, err := p.parseOr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid license expression %q: %v", expression, err)
+	}
+	return expr, nil
+}
+
+// licenseParser is a recursive descent parser of SPDX license expressions
+type licenseParser struct {
+	tokens []string
+	pos    int
+}
+
+// next returns the next token, or an empty string at the end of the expression
+func (p *licenseParser) next() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+// isOperator reports whether the next token is the operator, which SPDX matches case-insensitively
+func (p *licenseParser) isOperator(op string) bool {
+	return strings.EqualFold(p.next(), op)
+}
+
+func (p *licenseParser) parseOr() (*licenseExpression, error) {
+	return p.parseBinary("OR", p.parseAnd)
+}
+
+func (p *licenseParser) parseAnd() (*licenseExpression, error) {
+	return p.parseBinary("AND", p.parseTerm)
+}
+
+// parseBinary parses operands joined by op, each parsed by operand
+func (p *licenseParser) parseBinary(op string, operand func() (*licenseExpression, error)) (*licenseExpression, error) {
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	operands := []*licenseExpression{first}
+	for p.isOperator(op) {
+		p.pos++
+		o, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, o)
+	}
+	if len(operands) == 1 {
+		return first, nil
+	}
+	return &licenseExpression{op: op, operands: operands}, nil
+}
+
+// parseTerm parses a parenthesized expression, or a single license with an optional exception
+func (p *licenseParser) parseTerm() (*licenseExpression, error) {
+	tok := p.next()
+	switch {
+	case tok == "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case tok == "(":
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return expr, nil
+	case tok == ")" || p.isOperator("AND") || p.isOperator("OR") || p.isOperator("WITH"):
+		return nil, fmt.Errorf("unexpected %q", tok)
+	}
+	p.pos++
+	if p.isOperator("WITH") {
+		p.pos++
+		if exception := p.next(); exception == "" || exception == "(" || exception == ")" {
+			return nil, fmt.Errorf("missing license exception after %v WITH", tok)
+		}
+		p.pos++
+	}
+	return &licenseExpression{license: tok}, nil
+}
+
+// matchesLicense reports whether the license matches any of the patterns
+func matchesLicense(patterns []string, license string) bool {
+	for _, pattern := range patterns {
+		if m, _ := path.Match(pattern, license); m {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+)
+
+func TestLicenseViolation(t *testing.T) {
+	policy := model.LicensePolicy{Allowed: []string{"Apache-2.0", "MIT", "BSD-*"}, Denied: []string{"AGPL-*"}}
+	cases := []struct {
+		license string
+		policy  model.LicensePolicy
+		reason  string
+	}{
+		{"Apache-2.0", policy, ""},
+		{"BSD-3-Clause", policy, ""},
+		{"AGPL-3.0-only", policy, "denied license AGPL-3.0-only"},
+		{"MPL-2.0", policy, "license MPL-2.0 is not allowed"},
+		{"MIT OR AGPL-3.0-only", policy, ""},
+		{"(MIT AND MPL-2.0)", policy, "license MPL-2.0 is not allowed"},
+		{"Apache-2.0 WITH LLVM-exception", policy, ""},
+		{"NOASSERTION", policy, "unknown license"},
+		{"NOASSERTION", model.LicensePolicy{AllowUnknown: true}, ""},
+		{"MPL-2.0", model.LicensePolicy{Denied: []string{"AGPL-*"}}, ""},
+		{"(MIT OR Apache-2.0) AND AGPL-3.0-only", policy, "denied license AGPL-3.0-only"},
+		{"MIT OR Apache-2.0 AND AGPL-3.0-only", policy, ""},
+		{"MPL-2.0 OR Apache-2.0 AND AGPL-3.0-only", policy, "denied license AGPL-3.0-only"},
+		{"MPL-2.0 AND (MIT OR Apache-2.0)", policy, "license MPL-2.0 is not allowed"},
+		{"(MPL-2.0 OR MIT) AND (BSD-2-Clause OR AGPL-3.0-only)", policy, ""},
+		{"((MIT))", policy, ""},
+		{"GPL-2.0-only WITH Classpath-exception-2.0 OR MIT", policy, ""},
+		{"mit or AGPL-3.0-only", model.LicensePolicy{Denied: []string{"AGPL-*"}}, ""},
+		{"(MIT OR Apache-2.0", policy, `invalid license expression "(MIT OR Apache-2.0": missing closing parenthesis`},
+		{"MIT AND", policy, `invalid license expression "MIT AND": unexpected end of expression`},
+	}
+	for _, tt := range cases {
+		t.Run(tt.license, func(t *testing.T) {
+			if got := licenseViolation(tt.policy, tt.license); got != tt.reason {
+				t.Fatalf("expected %q, got %q", tt.reason, got)
+			}
+		})
+	}
+}
+
+func TestCheckLicensePolicy(t *testing.T) {
+	sbom := `SPDXVersion: SPDX-2.3
+
+PackageName: k8s.io/client-go
+PackageVersion: v0.28.3
+PackageLicenseConcluded: Apache-2.0
+
+PackageName: github.com/example/copyleft
+PackageVersion: v1.2.0
+PackageLicenseConcluded: AGPL-3.0-only
+`
+	manifest := model.Manifest{
+		Directory:     t.TempDir(),
+		LicensePolicy: &model.LicensePolicy{Denied: []string{"AGPL-*"}},
+	}
+	if err := os.MkdirAll(manifest.OutDir(), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(manifest.OutDir(), "istio-source.spdx"), []byte(sbom), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	err := checkLicensePolicy(manifest)
+	if err == nil || !strings.Contains(err.Error(), "github.com/example/copyleft v1.2.0 (denied license AGPL-3.0-only)") {
+		t.Fatalf("expected copyleft dependency to be reported, got %v", err)
+	}
+	if strings.Contains(err.Error(), "client-go") {
+		t.Fatalf("expected allowed dependency not to be reported, got %v", err)
+	}
+
+	manifest.LicensePolicy.Denied = nil
+	if err := checkLicensePolicy(manifest); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+)
+
+// spdxPackage is a package described by an SPDX document
+type spdxPackage struct {
+	Name    string
+	Version string
+	License string
+}
+
+// thirdPartyNotices renders THIRD_PARTY_NOTICES.txt from the source SBOM. The SBOM is always generated again, as the
+// archives are built before the sbom step, and one left by an earlier build may describe other sources.
+func thirdPartyNotices(manifest model.Manifest) ([]byte, error) {
+	sbom := path.Join(manifest.OutDir(), "istio-source.spdx")
+	if err := checkBomVersion(); err != nil {
+		return nil, err
+	}
+	if err := sourceBillOfMaterials(manifest); err != nil {
+		return nil, err
+	}
+	by, err := os.ReadFile(sbom)
+	if err != nil {
+		return nil, err
+	}
+	packages := parseSpdxPackages(by)
+	if len(packages) == 0 {
+		return nil, fmt.Errorf("no packages found in %v", sbom)
+	}
+	return renderThirdPartyNotices(manifest.Version, packages), nil
+}
+
+// parseSpdxPackages reads the packages from an SPDX document in the tag-value format. The concluded license is used,
+// falling back to the declared license if it was not concluded.
+func parseSpdxPackages(spdx []byte) []spdxPackage {
+	var packages []spdxPackage
+	var declared []string
+	seen := map[spdxPackage]struct{}{}
+	flush := func() {
+		if len(packages) == 0 {
+			return
+		}
+		last := &packages[len(packages)-1]
+		if isNoAssertion(last.License) {
+			last.License = declared[len(declared)-1]
+		}
+		if isNoAssertion(last.License) {
+			last.License = "NOASSERTION"
+		}
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(spdx))
+	for scanner.Scan() {
+		tag, value, f := strings.Cut(scanner.Text(), ":")
+		if !f {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch tag {
+		case "PackageName":
+			flush()
+			packages = append(packages, spdxPackage{Name: value})
+			declared = append(declared, "")
+		case "PackageVersion":
+			if len(packages) > 0 {
+				packages[len(packages)-1].Version = value
+			}
+		case "PackageLicenseConcluded":
+			if len(packages) > 0 {
+				packages[len(packages)-1].License = value
+			}
+		case "PackageLicenseDeclared":
+			if len(declared) > 0 {
+				declared[len(declared)-1] = value
+			}
+		}
+	}
+	flush()
+
+	result := []spdxPackage{}
+	for _, p := range packages {
+		if _, f := seen[p]; f {
+			continue
+		}
+		seen[p] = struct{}{}
+		result = append(result, p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Name != result[j].Name {
+			return result[i].Name < result[j].Name
+		}
+		return result[i].Version < result[j].Version
+	})
+	return result
+}
+
+func isNoAssertion(license string) bool {
+	return license == "" || license == "NOASSERTION"
+}
+
+// renderThirdPartyNotices lists each package with its version and license
+func renderThirdPartyNotices(version string, packages []spdxPackage) []byte {
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "Third party notices for Istio %s\n", version)
+	fmt.Fprintf(sb, "This file is generated from the software bill of materials, istio-source.spdx.\n")
+	for _, p := range packages {
+		name := p.Name
+		if p.Version != "" {
+			name += " " + p.Version
+		}
+		fmt.Fprintf(sb, "\n%s\n\tLicense: %s\n", name, p.License)
+	}
+	return []byte(sb.String())
+}
@@ -0,0 +1,101 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+	"github.com/alauda-mesh/release-builder/pkg/testutil"
+)
+
+const testSpdx = `SPDXVersion: SPDX-2.3
+DataLicense: CC0-1.0
+DocumentName: Istio Source 1.20.0
+
+PackageName: k8s.io/client-go
+SPDXID: SPDXRef-Package-client-go
+PackageVersion: v0.28.3
+PackageLicenseConcluded: Apache-2.0
+PackageLicenseDeclared: NOASSERTION
+
+PackageName: google.golang.org/grpc
+PackageVersion: v1.59.0
+PackageLicenseConcluded: NOASSERTION
+PackageLicenseDeclared: Apache-2.0
+
+PackageName: github.com/example/unlicensed
+PackageVersion: v1.0.0
+
+PackageName: k8s.io/client-go
+PackageVersion: v0.28.3
+PackageLicenseConcluded: Apache-2.0
+`
+
+func TestParseSpdxPackages(t *testing.T) {
+	got := parseSpdxPackages([]byte(testSpdx))
+	expected := []spdxPackage{
+		{Name: "github.com/example/unlicensed", Version: "v1.0.0", License: "NOASSERTION"},
+		{Name: "google.golang.org/grpc", Version: "v1.59.0", License: "Apache-2.0"},
+		{Name: "k8s.io/client-go", Version: "v0.28.3", License: "Apache-2.0"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestThirdPartyNotices(t *testing.T) {
+	manifest := model.Manifest{Directory: t.TempDir(), Version: "1.20.0"}
+	origVersion, origBom := bomVersion, runBom
+	t.Cleanup(func() { bomVersion, runBom = origVersion, origBom })
+	bomVersion = func() (string, error) { return "GitVersion: v" + minBomVersion, nil }
+	spdx := testSpdx
+	runBom = func(a ...string) error {
+		for i, arg := range a {
+			if arg == "--output" {
+				return os.WriteFile(a[i+1], []byte(spdx), 0o640)
+			}
+		}
+		return fmt.Errorf("no --output")
+	}
+	// An SBOM left by an earlier build is generated again
+	testutil.WriteFile(t, path.Join(manifest.OutDir(), "istio-source.spdx"), "PackageName: stale\n")
+	notices, err := thirdPartyNotices(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Third party notices for Istio 1.20.0",
+		"k8s.io/client-go v0.28.3\n\tLicense: Apache-2.0\n",
+		"google.golang.org/grpc v1.59.0\n\tLicense: Apache-2.0\n",
+	} {
+		if !strings.Contains(string(notices), want) {
+			t.Fatalf("expected notices to contain %q, got:\n%s", want, notices)
+		}
+	}
+	if strings.Contains(string(notices), "stale") {
+		t.Fatalf("expected notices from the regenerated sbom, got:\n%s", notices)
+	}
+
+	spdx = "SPDXVersion: SPDX-2.3\n"
+	if _, err := thirdPartyNotices(manifest); err == nil {
+		t.Fatalf("expected error for sbom without packages")
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+)
+
+// ProgressEventType identifies what happened to a build step
+type ProgressEventType string
+
+const (
+	// StepStarted is emitted before a step runs
+	StepStarted ProgressEventType = "started"
+	// StepFinished is emitted after a step completed successfully
+	StepFinished ProgressEventType = "finished"
+	// StepFailed is emitted after a step returned an error, or the build was cancelled before it could run
+	StepFailed ProgressEventType = "failed"
+)
+
+// ProgressEvent describes the progress of a build
+type ProgressEvent struct {
+	// Step is the step the event is for
+	Step model.BuildStep
+	// Type is what happened to the step
+	Type ProgressEventType
+	// Completed is how many of the steps the build runs have finished
+	Completed int
+	// Total is how many steps the build runs
+	Total int
+	// Elapsed is how long the step ran for. It is unset for StepStarted.
+	Elapsed time.Duration
+	// Err is the error the step failed with. It is only set for StepFailed.
+	Err error
+}
+
+// Percent returns the percentage of the build's steps that have finished
+func (e ProgressEvent) Percent() int {
+	if e.Total == 0 {
+		return 100
+	}
+	return e.Completed * 100 / e.Total
+}
+
+// ProgressFunc receives the progress events of a build. It is called synchronously from the build, so it should
+// return quickly.
+type ProgressFunc func(ProgressEvent)
+
+// pipelineStep is a single step of the build pipeline
+type pipelineStep struct {
+	step model.BuildStep
+	run  func(ctx context.Context) error
+}
+
+// runPipeline runs each step in order, stopping at the first failure. The context is checked before each step,
+// so a cancelled build stops at the next step boundary even if the running step does not watch the context itself.
+func runPipeline(ctx context.Context, steps []pipelineStep, progress ProgressFunc) error {
+	if progress == nil {
+		progress = func(ProgressEvent) {}
+	}
+	for i, s := range steps {
+		event := ProgressEvent{Step: s.step, Completed: i, Total: len(steps)}
+		if err := ctx.Err(); err != nil {
+			err = fmt.Errorf("build cancelled before step %v: %w", s.step, err)
+			event.Type, event.Err = StepFailed, err
+			progress(event)
+			return err
+		}
+		event.Type = StepStarted
+		progress(event)
+		start := time.Now()
+		err := s.run(ctx)
+		event.Elapsed = time.Since(start)
+		if err != nil {
+			if ctx.Err() != nil && !errors.Is(err, ctx.Err()) {
+				// Steps report the failures of the commands they run, which do not carry the cancellation
+				err = fmt.Errorf("build cancelled during step %v: %w (%v)", s.step, ctx.Err(), err)
+			}
+			event.Type, event.Err = StepFailed, err
+			progress(event)
+			return err
+		}
+		event.Type, event.Completed = StepFinished, i+1
+		progress(event)
+	}
+	return nil
+}
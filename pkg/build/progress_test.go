@@ -0,0 +1,214 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+	"github.com/alauda-mesh/release-builder/pkg/testutil"
+)
+
+func TestRunPipelineEvents(t *testing.T) {
+	ran := []model.BuildStep{}
+	step := func(s model.BuildStep, err error) pipelineStep {
+		return pipelineStep{s, func(context.Context) error {
+			ran = append(ran, s)
+			return err
+		}}
+	}
+	cases := []struct {
+		name   string
+		steps  []pipelineStep
+		ran    []model.BuildStep
+		events []string
+		err    bool
+	}{
+		{
+			name:  "all succeed",
+			steps: []pipelineStep{step(model.StepDocker, nil), step(model.StepHelm, nil), step(model.StepArchive, nil), step(model.StepIndex, nil)},
+			ran:   []model.BuildStep{model.StepDocker, model.StepHelm, model.StepArchive, model.StepIndex},
+			events: []string{
+				"docker started 0%", "docker finished 25%",
+				"helm started 25%", "helm finished 50%",
+				"archive started 50%", "archive finished 75%",
+				"index started 75%", "index finished 100%",
+			},
+		},
+		{
+			name:   "stops at failure",
+			steps:  []pipelineStep{step(model.StepDocker, nil), step(model.StepHelm, fmt.Errorf("boom")), step(model.StepArchive, nil)},
+			ran:    []model.BuildStep{model.StepDocker, model.StepHelm},
+			events: []string{"docker started 0%", "docker finished 33%", "helm started 33%", "helm failed 33%"},
+			err:    true,
+		},
+		{
+			name:   "no steps",
+			ran:    []model.BuildStep{},
+			events: []string{},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			ran = []model.BuildStep{}
+			events := []string{}
+			err := runPipeline(context.Background(), tt.steps, func(e ProgressEvent) {
+				if e.Total != len(tt.steps) {
+					t.Errorf("event %+v has total %d, expected %d", e, e.Total, len(tt.steps))
+				}
+				if (e.Type == StepFailed) != (e.Err != nil) {
+					t.Errorf("event %+v: only failed events should carry an error", e)
+				}
+				events = append(events, fmt.Sprintf("%v %v %d%%", e.Step, e.Type, e.Percent()))
+			})
+			if (err != nil) != tt.err {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if !reflect.DeepEqual(ran, tt.ran) {
+				t.Fatalf("expected steps %v to run, got %v", tt.ran, ran)
+			}
+			if !reflect.DeepEqual(events, tt.events) {
+				t.Fatalf("expected events %v, got %v", tt.events, events)
+			}
+		})
+	}
+}
+
+func TestRunPipelineCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	later := false
+	steps := []pipelineStep{
+		// Like a step running make, which is killed when the context is cancelled
+		{model.StepDocker, func(ctx context.Context) error {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("make docker.save was killed")
+			case <-time.After(10 * time.Second):
+				return nil
+			}
+		}},
+		{model.StepArchive, func(context.Context) error {
+			later = true
+			return nil
+		}},
+	}
+	events := []ProgressEventType{}
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	err := runPipeline(ctx, steps, func(e ProgressEvent) { events = append(events, e.Type) })
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("expected the build to stop when cancelled, took %v", elapsed)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a cancellation error, got %v", err)
+	}
+	if later {
+		t.Fatalf("expected no steps to run after cancellation")
+	}
+	if !reflect.DeepEqual(events, []ProgressEventType{StepStarted, StepFailed}) {
+		t.Fatalf("unexpected events %v", events)
+	}
+
+	// A build cancelled before it starts runs nothing
+	ran := false
+	err = runPipeline(ctx, []pipelineStep{{model.StepDocker, func(context.Context) error {
+		ran = true
+		return nil
+	}}}, nil)
+	if !errors.Is(err, context.Canceled) || ran {
+		t.Fatalf("expected the cancelled build to run nothing, got ran=%v err=%v", ran, err)
+	}
+}
+
+func TestBuildPipelineSteps(t *testing.T) {
+	manifest := model.Manifest{BuildOutputs: map[model.BuildOutput]struct{}{
+		model.Docker:  {},
+		model.Rpm:     {},
+		model.Archive: {},
+	}}
+	cases := []struct {
+		name     string
+		selector []string
+		steps    []model.BuildStep
+	}{
+		{
+			name:  "all steps",
+			steps: []model.BuildStep{model.StepDocker, model.StepHelm, model.StepPackages, model.StepArchive, model.StepMetadata, model.StepLicenses, model.StepSbom, model.StepIndex},
+		},
+		{
+			name:     "selected steps",
+			selector: []string{"archive", "helm"},
+			steps:    []model.BuildStep{model.StepHelm, model.StepArchive},
+		},
+		{
+			name:     "output not built",
+			selector: []string{"grafana", "index"},
+			steps:    []model.BuildStep{model.StepIndex},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			selector, err := ParseBuildSelector(tt.selector)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []model.BuildStep{}
+			for _, s := range buildPipeline(manifest, selector, false) {
+				got = append(got, s.step)
+			}
+			if !reflect.DeepEqual(got, tt.steps) {
+				t.Fatalf("expected steps %v, got %v", tt.steps, got)
+			}
+		})
+	}
+}
+
+func TestBuildSelectorSteps(t *testing.T) {
+	selector, err := ParseBuildSelector([]string{"sbom", "docker", "helm", "archive"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []model.BuildStep{model.StepArchive, model.StepDocker, model.StepHelm, model.StepSbom}
+	if got := selector.Steps(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected steps %v, got %v", want, got)
+	}
+	if got := (BuildSelector{}).Steps(); got != nil {
+		t.Fatalf("expected no steps for the empty selector, got %v", got)
+	}
+}
+
+func TestBuildSelectorPrerequisites(t *testing.T) {
+	cases := []struct {
+		name    string
+		steps   []string
+		wantErr string
+	}{
+		{"sbom with its prerequisites", []string{"sbom", "docker", "helm", "archive"}, ""},
+		{"sbom without helm", []string{"sbom", "docker", "archive"}, "build step sbom requires step helm"},
+		{"sbom without archive", []string{"sbom", "docker", "helm"}, "build step sbom requires step archive"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseBuildSelector(tt.steps)
+			testutil.AssertError(t, err, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"istio.io/istio/pkg/log"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+	"github.com/alauda-mesh/release-builder/pkg/util"
+)
+
+var (
+	// proxyOverrideAttempts is how many times each Envoy binary is requested before giving up
+	proxyOverrideAttempts = 4
+	// proxyOverrideBackoff is the delay before the first retry, doubling for each further retry
+	proxyOverrideBackoff = 2 * time.Second
+	// httpClient is used for all requests made by the build
+	httpClient = &http.Client{Timeout: 30 * time.Second}
+)
+
+// proxyOverrideURLs returns the URL of the Envoy binary the build pulls from a proxy override base URL for each
+// architecture
+func proxyOverrideURLs(manifest model.Manifest, base string) ([]string, error) {
+	proxy := manifest.Dependencies.Get()["proxy"]
+	if proxy == nil || proxy.Sha == "" {
+		return nil, fmt.Errorf("proxy override is set, but the manifest has no proxy SHA")
+	}
+	base = strings.TrimSuffix(base, "/")
+	urls := []string{}
+	for _, plat := range manifest.GetDockerArchitectures() {
+		suffix, err := util.ImageArchSuffix(plat)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, fmt.Sprintf("%s/envoy-alpha-%s%s.tar.gz", base, proxy.Sha, suffix))
+	}
+	return urls, nil
+}
+
+// resolveProxyOverride returns the first of the proxy override and its mirrors the Envoy binaries for every
+// architecture can be fetched from, so an unreachable URL fails the build before running the docker build rather
+// than part way through it.
+func resolveProxyOverride(ctx context.Context, manifest model.Manifest) (string, error) {
+	var errs []error
+	for _, base := range append([]string{manifest.ProxyOverride}, manifest.ProxyOverrideMirrors...) {
+		err := checkProxyOverride(ctx, manifest, base)
+		if err == nil {
+			if base != manifest.ProxyOverride {
+				log.Warnf("proxy override %v is unavailable, using mirror %v", manifest.ProxyOverride, base)
+			}
+			return base, nil
+		}
+		errs = append(errs, err)
+	}
+	return "", errors.Join(errs...)
+}
+
+// checkProxyOverride ensures the Envoy binaries for every architecture can be fetched from a proxy override base URL
+func checkProxyOverride(ctx context.Context, manifest model.Manifest, base string) error {
+	urls, err := proxyOverrideURLs(manifest, base)
+	if err != nil {
+		return err
+	}
+	for _, url := range urls {
+		backoff := proxyOverrideBackoff
+		for attempt := 1; ; attempt++ {
+			err := checkURL(url)
+			if err == nil {
+				break
+			}
+			if attempt == proxyOverrideAttempts {
+				return fmt.Errorf("proxy override %v is unreachable after %d attempts: %v", url, attempt, err)
+			}
+			log.Warnf("failed to reach proxy override %v, retrying in %v: %v", url, backoff, err)
+			if err := util.Sleep(ctx, backoff); err != nil {
+				return fmt.Errorf("checking proxy override %v was cancelled: %v", url, err)
+			}
+			backoff *= 2
+		}
+	}
+	return nil
+}
+
+// checkURL checks a URL can be downloaded. Servers that do not support HEAD are sent a GET of the first byte instead.
+func checkURL(url string) error {
+	resp, err := httpClient.Head(url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusMethodNotAllowed {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Range", "bytes=0-0")
+		resp, err = httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("unexpected status %v", resp.Status)
+	}
+	return nil
+}
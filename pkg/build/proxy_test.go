@@ -0,0 +1,185 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+)
+
+func TestCheckProxyOverride(t *testing.T) {
+	orig := proxyOverrideBackoff
+	proxyOverrideBackoff = time.Millisecond
+	t.Cleanup(func() { proxyOverrideBackoff = orig })
+
+	cases := []struct {
+		name     string
+		handler  func(requests int32, w http.ResponseWriter, r *http.Request)
+		wantErr  bool
+		requests int32
+		cancel   bool
+	}{
+		{
+			name:     "available",
+			handler:  func(int32, http.ResponseWriter, *http.Request) {},
+			requests: 2,
+		},
+		{
+			name: "head not allowed",
+			handler: func(_ int32, w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodHead {
+					w.WriteHeader(http.StatusMethodNotAllowed)
+					return
+				}
+				if r.Header.Get("Range") != "bytes=0-0" {
+					t.Errorf("expected ranged get, got range %q", r.Header.Get("Range"))
+				}
+				w.WriteHeader(http.StatusPartialContent)
+			},
+			requests: 4,
+		},
+		{
+			name: "flaky",
+			handler: func(requests int32, w http.ResponseWriter, _ *http.Request) {
+				if requests == 1 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			},
+			requests: 3,
+		},
+		{
+			name: "missing",
+			handler: func(_ int32, w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			},
+			wantErr:  true,
+			requests: int32(proxyOverrideAttempts),
+		},
+		{
+			name: "cancelled",
+			handler: func(_ int32, w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			},
+			wantErr:  true,
+			requests: 1,
+			cancel:   true,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tt.handler(requests.Add(1), w, r)
+			}))
+			defer server.Close()
+			manifest := model.Manifest{
+				ProxyOverride: server.URL + "/",
+				Architectures: []string{"linux/amd64", "linux/arm64"},
+				Dependencies:  model.IstioDependencies{Proxy: &model.Dependency{Sha: "abc"}},
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			if tt.cancel {
+				cancel()
+			}
+			defer cancel()
+			err := checkProxyOverride(ctx, manifest, manifest.ProxyOverride)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got err %v, want error %v", err, tt.wantErr)
+			}
+			if got := requests.Load(); got != tt.requests {
+				t.Fatalf("expected %d requests, got %d", tt.requests, got)
+			}
+		})
+	}
+}
+
+func TestResolveProxyOverride(t *testing.T) {
+	orig := proxyOverrideBackoff
+	proxyOverrideBackoff = time.Millisecond
+	t.Cleanup(func() { proxyOverrideBackoff = orig })
+
+	newServer := func(status int) (*httptest.Server, *atomic.Int32) {
+		requests := &atomic.Int32{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			requests.Add(1)
+			w.WriteHeader(status)
+		}))
+		t.Cleanup(server.Close)
+		return server, requests
+	}
+	down, _ := newServer(http.StatusServiceUnavailable)
+	up, _ := newServer(http.StatusOK)
+	unused, unusedRequests := newServer(http.StatusOK)
+
+	cases := []struct {
+		name     string
+		override string
+		mirrors  []string
+		want     string
+		wantErr  bool
+	}{
+		{"primary up", up.URL, []string{unused.URL}, up.URL, false},
+		{"primary down, mirror up", down.URL, []string{down.URL + "/mirror", up.URL}, up.URL, false},
+		{"all down", down.URL, []string{down.URL + "/mirror"}, "", true},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest := model.Manifest{
+				ProxyOverride:        tt.override,
+				ProxyOverrideMirrors: tt.mirrors,
+				Architectures:        []string{"linux/amd64"},
+				Dependencies:         model.IstioDependencies{Proxy: &model.Dependency{Sha: "abc"}},
+			}
+			got, err := resolveProxyOverride(context.Background(), manifest)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got err %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+	if n := unusedRequests.Load(); n != 0 {
+		t.Fatalf("expected mirror of a reachable proxy override to be unused, got %d requests", n)
+	}
+}
+
+func TestProxyOverrideURLs(t *testing.T) {
+	manifest := model.Manifest{
+		ProxyOverride: "https://example.com/proxy",
+		Architectures: []string{"linux/amd64", "linux/arm64"},
+	}
+	if _, err := proxyOverrideURLs(manifest, manifest.ProxyOverride); err == nil {
+		t.Fatalf("expected error without proxy SHA")
+	}
+	manifest.Dependencies.Proxy = &model.Dependency{Sha: "abc"}
+	urls, err := proxyOverrideURLs(manifest, manifest.ProxyOverride)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"https://example.com/proxy/envoy-alpha-abc.tar.gz",
+		"https://example.com/proxy/envoy-alpha-abc-arm64.tar.gz",
+	}
+	if len(urls) != len(expected) || urls[0] != expected[0] || urls[1] != expected[1] {
+		t.Fatalf("expected %v, got %v", expected, urls)
+	}
+}
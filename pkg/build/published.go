@@ -0,0 +1,61 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"fmt"
+	"net/http"
+
+	"istio.io/istio/pkg/log"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+	"github.com/alauda-mesh/release-builder/pkg/util"
+)
+
+// CheckNotPublished fails if the manifest version has already been published to the manifest ReleaseURL, so a
+// published release is not rebuilt and overwritten by mistake. The release is published if its manifest.yaml, or the
+// istio or istioctl archive of any of its architectures, exists. A private bucket answers 403 Forbidden rather than
+// 404 Not Found for a missing object, so both mean the file is not published. Nothing is checked if the manifest does
+// not set a ReleaseURL, or for development builds without a semantic version, which are expected to be rebuilt.
+func CheckNotPublished(manifest model.Manifest) error {
+	if manifest.ReleaseURL == "" {
+		return nil
+	}
+	if !util.IsValidSemver(manifest.Version) {
+		log.Infof("Skipping published release check; not a valid semver")
+		return nil
+	}
+	files := []string{"manifest.yaml"}
+	for _, arch := range manifest.GetArchiveArchitectures() {
+		files = append(files, archiveName("istio", manifest.Version, arch), archiveName("istioctl", manifest.Version, arch))
+	}
+	for _, file := range files {
+		url := manifest.GetReleaseURL() + "/" + file
+		resp, err := httpClient.Head(url)
+		if err != nil {
+			return fmt.Errorf("failed to check if %v is published: %v", manifest.Version, err)
+		}
+		resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusOK:
+			return fmt.Errorf("version %v is already published at %v, found %v", manifest.Version, manifest.GetReleaseURL(), file)
+		case http.StatusNotFound, http.StatusForbidden:
+			continue
+		default:
+			return fmt.Errorf("failed to check if %v is published: unexpected status %v from %v", manifest.Version, resp.Status, url)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+	"github.com/alauda-mesh/release-builder/pkg/testutil"
+)
+
+func TestCheckNotPublished(t *testing.T) {
+	published := map[string]bool{
+		"/releases/1.20.0/manifest.yaml":                      true,
+		"/releases/1.20.2/istioctl-1.20.2-linux-arm64.tar.gz": true,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/releases/1.21.0/manifest.yaml":
+			w.WriteHeader(http.StatusInternalServerError)
+		case strings.HasPrefix(r.URL.Path, "/private/"):
+			w.WriteHeader(http.StatusForbidden)
+		case !published[r.URL.Path]:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	cases := []struct {
+		name       string
+		version    string
+		releaseURL string
+		wantErr    string
+	}{
+		{"published", "1.20.0", server.URL + "/releases/", "already published"},
+		{"archive published", "1.20.2", server.URL + "/releases", "found istioctl-1.20.2-linux-arm64.tar.gz"},
+		{"absent", "1.20.1", server.URL + "/releases", ""},
+		{"private bucket", "1.20.1", server.URL + "/private", ""},
+		{"remote error", "1.21.0", server.URL + "/releases", "unexpected status"},
+		{"no release url", "1.20.0", "", ""},
+		{"development build", "master", server.URL + "/releases", ""},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckNotPublished(model.Manifest{Version: tt.version, ReleaseURL: tt.releaseURL})
+			testutil.AssertError(t, err, tt.wantErr)
+		})
+	}
+}
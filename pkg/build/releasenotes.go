@@ -0,0 +1,113 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"istio.io/istio/pkg/log"
+
+	"github.com/alauda-mesh/release-builder/pkg"
+	"github.com/alauda-mesh/release-builder/pkg/model"
+	"github.com/alauda-mesh/release-builder/pkg/util"
+)
+
+// CommitLogProvider lists the commits of a repo between two SHAs, as one line per commit
+type CommitLogProvider interface {
+	Log(manifest model.Manifest, repo, from, to string) ([]string, error)
+}
+
+// gitCommitLog reads commits from the git history of the repo in the working directory
+type gitCommitLog struct{}
+
+func (gitCommitLog) Log(manifest model.Manifest, repo, from, to string) ([]string, error) {
+	out, err := util.Run(util.RunOptions{Dir: manifest.RepoDir(repo), CaptureStdout: true},
+		"git", "log", "--no-merges", "--format=%h %s", from+".."+to)
+	if err != nil {
+		return nil, err
+	}
+	trimmed := strings.TrimSpace(out)
+	if trimmed == "" {
+		return nil, nil
+	}
+	return strings.Split(trimmed, "\n"), nil
+}
+
+// GenerateReleaseNotes writes release-notes.md, listing the commits of each dependency since the previous release.
+func GenerateReleaseNotes(manifest model.Manifest) error {
+	return generateReleaseNotes(manifest, gitCommitLog{})
+}
+
+func generateReleaseNotes(manifest model.Manifest, commits CommitLogProvider) error {
+	var previous *model.Manifest
+	if manifest.PreviousManifest != "" {
+		m, err := pkg.ReadManifest(manifest.PreviousManifest)
+		if err != nil {
+			return fmt.Errorf("failed to read previous manifest: %v", err)
+		}
+		previous = &m
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("# Istio %s\n", manifest.Version))
+	if previous != nil {
+		sb.WriteString(fmt.Sprintf("\nChanges since %s.\n", previous.Version))
+	}
+
+	deps := manifest.Dependencies.Get()
+	repos := make([]string, 0, len(deps))
+	for repo, dep := range deps {
+		if dep != nil {
+			repos = append(repos, repo)
+		}
+	}
+	sort.Strings(repos)
+	for _, repo := range repos {
+		current := deps[repo].Sha
+		sb.WriteString(fmt.Sprintf("\n## %s\n\n", repo))
+		var prev *model.Dependency
+		if previous != nil {
+			prev = previous.Dependencies.Get()[repo]
+		}
+		switch {
+		case prev == nil || prev.Sha == "":
+			sb.WriteString(fmt.Sprintf("Built from %s.\n", current))
+		case prev.Sha == current:
+			sb.WriteString("No changes.\n")
+		default:
+			lines, err := commits.Log(manifest, repo, prev.Sha, current)
+			if err != nil {
+				// Shallow clones may not contain the history, which should not block the release
+				log.Warnf("failed to read commits for %v: %v", repo, err)
+				sb.WriteString(fmt.Sprintf("Commit history unavailable for %s..%s.\n", prev.Sha, current))
+				continue
+			}
+			if len(lines) == 0 {
+				sb.WriteString("No changes.\n")
+			}
+			for _, l := range lines {
+				sb.WriteString(fmt.Sprintf("- %s\n", l))
+			}
+		}
+	}
+
+	if err := util.WriteFileAtomic(path.Join(manifest.OutDir(), "release-notes.md"), []byte(sb.String()), 0o644); err != nil {
+		return fmt.Errorf("failed to write release notes: %v", err)
+	}
+	return nil
+}
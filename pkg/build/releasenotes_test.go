@@ -0,0 +1,90 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+)
+
+type fakeCommitLog map[string][]string
+
+func (f fakeCommitLog) Log(_ model.Manifest, repo, from, to string) ([]string, error) {
+	commits, ok := f[fmt.Sprintf("%s:%s..%s", repo, from, to)]
+	if !ok {
+		return nil, fmt.Errorf("unknown range %v..%v", from, to)
+	}
+	return commits, nil
+}
+
+func TestGenerateReleaseNotes(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "out"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	previous := filepath.Join(dir, "previous.yaml")
+	if err := os.WriteFile(previous, []byte(`
+version: 1.20.0
+dependencies:
+  istio:
+    sha: aaaa
+  api:
+    sha: cccc
+  proxy:
+    sha: eeee
+`), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest := model.Manifest{
+		Version:          "1.20.1",
+		Directory:        dir,
+		PreviousManifest: previous,
+		Dependencies: model.IstioDependencies{
+			Istio:    &model.Dependency{Sha: "bbbb"},
+			Api:      &model.Dependency{Sha: "cccc"},
+			Proxy:    &model.Dependency{Sha: "ffff"},
+			ClientGo: &model.Dependency{Sha: "dddd"},
+		},
+	}
+	commits := fakeCommitLog{
+		"istio:aaaa..bbbb": {"1234 Fix the thing", "5678 Add the other thing"},
+	}
+	if err := generateReleaseNotes(manifest, commits); err != nil {
+		t.Fatal(err)
+	}
+	notes, err := os.ReadFile(filepath.Join(manifest.OutDir(), "release-notes.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"# Istio 1.20.1",
+		"Changes since 1.20.0.",
+		"## istio\n\n- 1234 Fix the thing\n- 5678 Add the other thing\n",
+		"## api\n\nNo changes.\n",
+		"## client-go\n\nBuilt from dddd.\n",
+		"## proxy\n\nCommit history unavailable for eeee..ffff.\n",
+	} {
+		if !strings.Contains(string(notes), want) {
+			t.Fatalf("expected release notes to contain %q, got:\n%s", want, notes)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+	"github.com/alauda-mesh/release-builder/pkg/util"
+)
+
+// pruneBuildCacheArgs are the docker arguments removing the build cache of the buildx builder used by the docker build
+var pruneBuildCacheArgs = []string{"buildx", "prune", "--all", "--force"}
+
+// runDocker runs a docker command. It is a variable so tests can fake it.
+var runDocker = func(args ...string) error {
+	return util.RunSummarized(util.VerboseCommand("docker", args...))
+}
+
+// verifyImageReproducibility rebuilds the docker images, and compares each image of the rebuild to the image of the
+// first build. The images of the first build are kept under the work directory, while the rebuild replaces them in
+// the release. The build cache is pruned before the rebuild, as a rebuild from the cache would reuse every layer of the
+// first build, and so always match it.
+func verifyImageReproducibility(ctx context.Context, manifest model.Manifest, env []string) error {
+	images := path.Join(manifest.OutDir(), manifest.ArtifactDir(model.DockerArtifacts))
+	first := path.Join(manifest.WorkDir(), "docker-first-build")
+	if err := os.RemoveAll(first); err != nil {
+		return err
+	}
+	if err := os.Rename(images, first); err != nil {
+		return fmt.Errorf("failed to move aside the first docker build: %v", err)
+	}
+	// Images left by the first build in the source repo would otherwise be copied again
+	if err := os.RemoveAll(path.Join(manifest.RepoOutDir("istio"), "docker")); err != nil {
+		return err
+	}
+	if err := runDocker(pruneBuildCacheArgs...); err != nil {
+		return fmt.Errorf("failed to prune the docker build cache before the rebuild: %v", err)
+	}
+	if err := buildDockerImages(ctx, manifest, env); err != nil {
+		return fmt.Errorf("failed to rebuild docker images: %v", err)
+	}
+	if err := checkDockerImages(manifest); err != nil {
+		return fmt.Errorf("failed to rebuild docker images: %v", err)
+	}
+
+	var problems []string
+	for _, plat := range manifest.GetDockerArchitectures() {
+		suffix, err := util.ImageArchSuffix(plat)
+		if err != nil {
+			return err
+		}
+		for _, image := range manifest.DockerImages {
+			name := manifest.ShippedImage(image) + suffix + ".tar.gz"
+			diffs, err := compareImages(path.Join(first, name), path.Join(images, name))
+			if err != nil {
+				return fmt.Errorf("failed to compare %v: %v", name, err)
+			}
+			for _, d := range diffs {
+				problems = append(problems, name+": "+d)
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("docker images are not reproducible: %v", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// imageConfig is the part of a docker image config compared between builds
+type imageConfig struct {
+	RootFS struct {
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+	History []struct {
+		CreatedBy  string `json:"created_by"`
+		EmptyLayer bool   `json:"empty_layer"`
+	} `json:"history"`
+}
+
+// compareImages returns the differences between two `docker save` tarballs of an image. Each layer is compared by
+// its digest, and the rest of the config is compared once the timestamps, which differ between builds, are removed.
+func compareImages(a, b string) ([]string, error) {
+	aConfig, err := util.ImageConfig(a)
+	if err != nil {
+		return nil, err
+	}
+	bConfig, err := util.ImageConfig(b)
+	if err != nil {
+		return nil, err
+	}
+	var aImage, bImage imageConfig
+	if err := json.Unmarshal(aConfig, &aImage); err != nil {
+		return nil, fmt.Errorf("failed to read image config: %v", err)
+	}
+	if err := json.Unmarshal(bConfig, &bImage); err != nil {
+		return nil, fmt.Errorf("failed to read image config: %v", err)
+	}
+
+	diffs := []string{}
+	aLayers, bLayers := aImage.RootFS.DiffIDs, bImage.RootFS.DiffIDs
+	if len(aLayers) != len(bLayers) {
+		diffs = append(diffs, fmt.Sprintf("has %d layers, rebuild has %d", len(aLayers), len(bLayers)))
+	}
+	steps := layerSteps(aImage)
+	for i := 0; i < len(aLayers) && i < len(bLayers); i++ {
+		if aLayers[i] != bLayers[i] {
+			diffs = append(diffs, fmt.Sprintf("layer %d (%v) is %v, rebuild is %v", i, steps[i], aLayers[i], bLayers[i]))
+		}
+	}
+
+	aNormalized, err := normalizeImageConfig(aConfig)
+	if err != nil {
+		return nil, err
+	}
+	bNormalized, err := normalizeImageConfig(bConfig)
+	if err != nil {
+		return nil, err
+	}
+	if !reflect.DeepEqual(aNormalized, bNormalized) {
+		diffs = append(diffs, "config differs")
+	}
+	return diffs, nil
+}
+
+// layerSteps returns the step creating each layer of an image, from the history entries that created a layer
+func layerSteps(image imageConfig) []string {
+	steps := make([]string, len(image.RootFS.DiffIDs))
+	i := 0
+	for _, h := range image.History {
+		if h.EmptyLayer || i == len(steps) {
+			continue
+		}
+		steps[i] = h.CreatedBy
+		i++
+	}
+	for ; i < len(steps); i++ {
+		steps[i] = "unknown step"
+	}
+	return steps
+}
+
+// normalizeImageConfig returns an image config without the layers, compared separately, and the build timestamps
+func normalizeImageConfig(config []byte) (map[string]interface{}, error) {
+	var normalized map[string]interface{}
+	if err := json.Unmarshal(config, &normalized); err != nil {
+		return nil, fmt.Errorf("failed to read image config: %v", err)
+	}
+	delete(normalized, "created")
+	delete(normalized, "rootfs")
+	if history, ok := normalized["history"].([]interface{}); ok {
+		for _, h := range history {
+			if entry, ok := h.(map[string]interface{}); ok {
+				delete(entry, "created")
+			}
+		}
+	}
+	return normalized, nil
+}
@@ -0,0 +1,99 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+	"github.com/alauda-mesh/release-builder/pkg/testutil"
+)
+
+func TestCompareImages(t *testing.T) {
+	config := func(created string, layers ...string) string {
+		return `{
+			"created": "` + created + `",
+			"config": {"Entrypoint": ["/usr/local/bin/pilot-discovery"]},
+			"history": [
+				{"created": "` + created + `", "created_by": "ADD base", "empty_layer": false},
+				{"created": "` + created + `", "created_by": "ENV FOO=bar", "empty_layer": true},
+				{"created": "` + created + `", "created_by": "COPY pilot-discovery", "empty_layer": false}
+			],
+			"rootfs": {"type": "layers", "diff_ids": ["` + layers[0] + `", "` + layers[1] + `"]}
+		}`
+	}
+	first := config("2024-01-01T00:00:00Z", "sha256:base", "sha256:pilot")
+	cases := []struct {
+		name    string
+		rebuild string
+		want    []string
+	}{
+		{"reproducible", config("2024-01-02T00:00:00Z", "sha256:base", "sha256:pilot"), []string{}},
+		{
+			"layer differs",
+			config("2024-01-02T00:00:00Z", "sha256:base", "sha256:other"),
+			[]string{"layer 1 (COPY pilot-discovery) is sha256:pilot, rebuild is sha256:other"},
+		},
+		{
+			"config differs",
+			`{"config": {"Entrypoint": ["/bin/sh"]}, "history": [{"created_by": "ADD base"}, {"created_by": "COPY pilot-discovery"}],
+				"rootfs": {"type": "layers", "diff_ids": ["sha256:base", "sha256:pilot"]}}`,
+			[]string{"config differs"},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			testutil.WriteImage(t, filepath.Join(dir, "first.tar.gz"), first, nil)
+			testutil.WriteImage(t, filepath.Join(dir, "rebuild.tar.gz"), tt.rebuild, nil)
+			got, err := compareImages(filepath.Join(dir, "first.tar.gz"), filepath.Join(dir, "rebuild.tar.gz"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestVerifyImageReproducibilityPrunesCache(t *testing.T) {
+	var ran [][]string
+	orig := runDocker
+	t.Cleanup(func() { runDocker = orig })
+	runDocker = func(args ...string) error {
+		ran = append(ran, args)
+		return nil
+	}
+	manifest := model.Manifest{Directory: t.TempDir(), DockerOutput: model.DockerOutputTar}
+	for _, dir := range []string{filepath.Join(manifest.OutDir(), manifest.ArtifactDir(model.DockerArtifacts)), manifest.WorkDir()} {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Without an istio repo the rebuild fails, once the cache has been pruned
+	err := verifyImageReproducibility(context.Background(), manifest, nil)
+	if err == nil || !strings.Contains(err.Error(), "failed to rebuild docker images") {
+		t.Fatalf("expected the rebuild to fail, got %v", err)
+	}
+	if want := [][]string{{"buildx", "prune", "--all", "--force"}}; !reflect.DeepEqual(ran, want) {
+		t.Fatalf("expected the build cache to be pruned with %v, got %v", want, ran)
+	}
+}
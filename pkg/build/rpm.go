@@ -15,6 +15,7 @@
 package build
 
 import (
+	"context"
 	"fmt"
 	"path"
 	"strings"
@@ -24,30 +25,30 @@ import (
 )
 
 // Rpm produces an rpm package just for the sidecar
-func Rpm(manifest model.Manifest) error {
+func Rpm(ctx context.Context, manifest model.Manifest) error {
 	for _, plat := range manifest.Architectures {
 		_, arch, _ := strings.Cut(plat, "/")
 		envs := []string{"TARGET_ARCH=" + arch}
-		output := "istio-sidecar.rpm"
-		if arch != "amd64" {
-			output = fmt.Sprintf("istio-sidecar-%s.rpm", arch)
+		output, err := util.SidecarPackageName(plat, "rpm")
+		if err != nil {
+			return err
 		}
 
-		if err := runRpm(manifest, envs, arch, output); err != nil {
+		if err := runRpm(ctx, manifest, envs, arch, output); err != nil {
 			return fmt.Errorf("failed to run rpm for arch %s: %v", arch, err)
 		}
 	}
 	return nil
 }
 
-func runRpm(manifest model.Manifest, envs []string, arch, output string) error {
-	if err := util.RunMake(manifest, "istio", envs, "rpm/fpm"); err != nil {
+func runRpm(ctx context.Context, manifest model.Manifest, envs []string, arch, output string) error {
+	if err := util.RunMakeContext(ctx, manifest, "istio", envs, util.DefaultMakeTimeout, "rpm/fpm"); err != nil {
 		return fmt.Errorf("failed to build sidecar.rpm: %v", err)
 	}
-	if err := util.CopyFile(path.Join(manifest.RepoArchOutDir("istio", arch), "istio-sidecar.rpm"), path.Join(manifest.OutDir(), "rpm", output)); err != nil {
+	if err := util.CopyFile(path.Join(manifest.RepoArchOutDir("istio", arch), "istio-sidecar.rpm"), path.Join(manifest.OutDir(), manifest.ArtifactDir(model.RpmArtifacts), output)); err != nil {
 		return fmt.Errorf("failed to package istio-sidecar.rpm: %v", err)
 	}
-	if err := util.CreateSha(path.Join(manifest.OutDir(), "rpm", output)); err != nil {
+	if err := createSha(manifest, path.Join(manifest.OutDir(), manifest.ArtifactDir(model.RpmArtifacts), output)); err != nil {
 		return fmt.Errorf("failed to package istio-sidecar.rpm: %v", err)
 	}
 	return nil
@@ -21,25 +21,124 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/Masterminds/semver/v3"
 	"istio.io/istio/pkg/log"
 
+	"github.com/alauda-mesh/release-builder/pkg"
 	"github.com/alauda-mesh/release-builder/pkg/model"
 	"github.com/alauda-mesh/release-builder/pkg/util"
 )
 
+// minBomVersion is the oldest bom release known to support the flags used to generate the SBOMs
+const minBomVersion = "0.5.1"
+
+// bomVersion returns the output of `bom version`. It is a variable so tests can fake the installed bom.
+var bomVersion = func() (string, error) {
+	return util.Run(util.RunOptions{CaptureStdout: true}, "bom", "version")
+}
+
+// checkBomVersion ensures the installed bom is new enough, rather than failing with a confusing flag parsing error
+func checkBomVersion() error {
+	out, err := bomVersion()
+	if err != nil {
+		return fmt.Errorf("failed to get bom version: %v", err)
+	}
+	v, err := parseBomVersion(out)
+	if err != nil {
+		return err
+	}
+	if v.LessThan(semver.MustParse(minBomVersion)) {
+		return fmt.Errorf("bom %v is too old, at least %v is required", v, minBomVersion)
+	}
+	return nil
+}
+
+// parseBomVersion extracts the version from the GitVersion line of `bom version`
+func parseBomVersion(out string) (*semver.Version, error) {
+	for _, line := range strings.Split(out, "\n") {
+		k, v, f := strings.Cut(strings.TrimSpace(line), ":")
+		if !f || k != "GitVersion" {
+			continue
+		}
+		version, err := semver.NewVersion(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse bom version %q: %v", strings.TrimSpace(v), err)
+		}
+		return version, nil
+	}
+	return nil, fmt.Errorf("bom version output has no GitVersion: %q", out)
+}
+
+// runBom runs the bom tool. It is a variable so tests can fake it.
+var runBom = func(args ...string) error {
+	return util.RunSummarized(util.VerboseCommand("bom", args...))
+}
+
 // Sbom generates Software Bill Of Materials for istio repo in an SPDX readable format.
 func GenerateBillOfMaterials(manifest model.Manifest) error {
+	if err := checkBomVersion(); err != nil {
+		return err
+	}
+
+	if err := releaseBillOfMaterials(manifest, manifest.OutDir()); err != nil {
+		return err
+	}
+
+	if err := sourceBillOfMaterials(manifest); err != nil {
+		return err
+	}
+
+	if manifest.LicensePolicy != nil {
+		if err := checkLicensePolicy(manifest); err != nil {
+			return err
+		}
+	}
+
+	if manifest.ArtifactBillOfMaterials {
+		if err := generateArtifactBillOfMaterials(manifest); err != nil {
+			return fmt.Errorf("couldn't generate sbom for istio artifacts: %v", err)
+		}
+	}
+	return nil
+}
+
+// sourceBillOfMaterials writes istio-source.spdx, covering the istio source code and its dependencies
+func sourceBillOfMaterials(manifest model.Manifest) error {
 	// Retrieve istio repository path to run the sbom generator
 	istioRepoDir := manifest.RepoDir("istio")
 	sourceSbomFile := path.Join(manifest.OutDir(), "istio-source.spdx")
-	sourceSbomNamespace := fmt.Sprintf("https://storage.googleapis.com/istio-release/releases/%s/istio-source.spdx",
-		manifest.Version)
-	releaseSbomFile := path.Join(manifest.OutDir(), "istio-release.spdx")
-	releaseSbomNamespace := fmt.Sprintf("https://storage.googleapis.com/istio-release/releases/%s/istio-release.spdx",
-		manifest.Version)
+	sourceSbomNamespace := manifest.GetReleaseURL() + "/istio-source.spdx"
+
+	// Run bom generator to generate the software bill of materials(SBOM) for istio.
+	log.Infof("Generating Software Bill of Materials for istio source code")
+	if err := runBom("--log-level", "error", "generate", "--name", "Istio Source "+manifest.Version,
+		"--namespace", sourceSbomNamespace, "--dirs", istioRepoDir, "--output", sourceSbomFile); err != nil {
+		return fmt.Errorf("couldn't generate sbom for istio source: %v", err)
+	}
+	return nil
+}
+
+// RegenerateReleaseBillOfMaterials regenerates istio-release.spdx for an already built release directory. Only the
+// release itself is needed, not the sources it was built from, so the SBOM of a published release can be re-issued.
+func RegenerateReleaseBillOfMaterials(release string) error {
+	manifest, err := pkg.ReadManifest(path.Join(release, "manifest.yaml"))
+	if err != nil {
+		return fmt.Errorf("failed to read release manifest: %v", err)
+	}
+	if err := checkBomVersion(); err != nil {
+		return err
+	}
+	return releaseBillOfMaterials(manifest, release)
+}
+
+// releaseBillOfMaterials writes istio-release.spdx, covering the docker images and other artifacts in the release
+// directory
+func releaseBillOfMaterials(manifest model.Manifest, release string) error {
+	releaseSbomFile := path.Join(release, "istio-release.spdx")
+	releaseSbomNamespace := manifest.GetReleaseURL() + "/istio-release.spdx"
 
 	// construct all the docker image tarball names as bom currently cannot accept directory as input
-	dockerDir := path.Join(manifest.OutDir(), "docker")
+	dockerDir := path.Join(release, manifest.ArtifactDir(model.DockerArtifacts))
 	dockerImages := []string{}
 	if err := filepath.Walk(dockerDir, func(path string, fi os.FileInfo, err error) error {
 		if err != nil {
@@ -58,18 +157,76 @@ func GenerateBillOfMaterials(manifest model.Manifest) error {
 	}
 
 	// Run bom generator to generate the software bill of materials(SBOM) for istio.
+	// Earlier SBOMs are ignored, so regenerating one does not include the previous.
 	log.Infof("Generating Software Bill of Materials for istio release artifacts")
-	if err := util.VerboseCommand("bom", "--log-level", "error", "generate", "--name", "Istio Release "+manifest.Version,
-		"--namespace", releaseSbomNamespace, "--ignore", "licenses,'*.sha256',docker", "--dirs", manifest.OutDir(),
-		"--image-archive", strings.Join(dockerImages, ","), "--output", releaseSbomFile).Run(); err != nil {
+	if err := runBom("--log-level", "error", "generate", "--name", "Istio Release "+manifest.Version,
+		"--namespace", releaseSbomNamespace, "--ignore", manifest.ArtifactDir(model.LicenseArtifacts)+",'*.sha256','*.sha512','*.spdx',"+manifest.ArtifactDir(model.DockerArtifacts), "--dirs", release,
+		"--image-archive", strings.Join(dockerImages, ","), "--output", releaseSbomFile); err != nil {
 		return fmt.Errorf("couldn't generate sbom for istio release artifacts: %v", err)
 	}
+	return nil
+}
 
-	// Run bom generator to generate the software bill of materials(SBOM) for istio.
-	log.Infof("Generating Software Bill of Materials for istio source code")
-	if err := util.VerboseCommand("bom", "--log-level", "error", "generate", "--name", "Istio Source "+manifest.Version,
-		"--namespace", sourceSbomNamespace, "--dirs", istioRepoDir, "--output", sourceSbomFile).Run(); err != nil {
-		return fmt.Errorf("couldn't generate sbom for istio source: %v", err)
+// generateArtifactBillOfMaterials writes istio-artifacts.spdx, covering the contents of each helm chart and each
+// release archive. The bom tool cannot read inside chart packages, so they are extracted first.
+func generateArtifactBillOfMaterials(manifest model.Manifest) error {
+	chartsDir := path.Join(manifest.WorkDir(), "sbom", "charts")
+	if err := os.RemoveAll(chartsDir); err != nil {
+		return err
 	}
-	return nil
+	charts, err := filepath.Glob(path.Join(manifest.OutDir(), manifest.ArtifactDir(model.HelmArtifacts), "*.tgz"))
+	if err != nil {
+		return err
+	}
+	samples, err := filepath.Glob(path.Join(manifest.OutDir(), manifest.ArtifactDir(model.HelmArtifacts), "samples", "*.tgz"))
+	if err != nil {
+		return err
+	}
+	charts = append(charts, samples...)
+	if len(charts) == 0 {
+		return fmt.Errorf("no helm charts found; the helm step must run first")
+	}
+	args := []string{
+		"--log-level", "error", "generate", "--name", "Istio Artifacts " + manifest.Version,
+		"--namespace", manifest.GetReleaseURL() + "/istio-artifacts.spdx",
+		"--output", path.Join(manifest.OutDir(), "istio-artifacts.spdx"),
+	}
+	for _, chart := range charts {
+		// Keep the version in the directory, so the SBOM identifies which chart was shipped
+		dst := path.Join(chartsDir, strings.TrimSuffix(path.Base(chart), ".tgz"))
+		if err := os.MkdirAll(dst, 0o750); err != nil {
+			return err
+		}
+		if _, err := util.Run(util.RunOptions{}, "tar", "-xzf", chart, "-C", dst); err != nil {
+			return fmt.Errorf("failed to extract %v: %v", chart, err)
+		}
+		args = append(args, "--dirs", dst)
+	}
+	archives, err := releaseArchives(manifest)
+	if err != nil {
+		return err
+	}
+	for _, archive := range archives {
+		args = append(args, "--file", archive)
+	}
+	return runBom(args...)
+}
+
+// releaseArchives returns the release and standalone istioctl archives in the output directory
+func releaseArchives(manifest model.Manifest) ([]string, error) {
+	entries, err := os.ReadDir(manifest.OutDir())
+	if err != nil {
+		return nil, err
+	}
+	archives := []string{}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, "istio-"+manifest.Version+"-") && !strings.HasPrefix(name, "istioctl-"+manifest.Version+"-") {
+			continue
+		}
+		if strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tar") || strings.HasSuffix(name, ".zip") {
+			archives = append(archives, path.Join(manifest.OutDir(), name))
+		}
+	}
+	return archives, nil
 }
@@ -0,0 +1,111 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+	"github.com/alauda-mesh/release-builder/pkg/testutil"
+)
+
+func TestCheckBomVersion(t *testing.T) {
+	versionOutput := func(v string) string {
+		return fmt.Sprintf(`bom: A tool for working with SPDX manifests
+
+GitVersion:    %s
+GitCommit:     ac7bc1fbd04b4eb3eeb5a4d2d76aaf1fd1a8c1b9
+GitTreeState:  clean
+BuildDate:     2023-08-04T21:04:57Z
+GoVersion:     go1.20.7
+`, v)
+	}
+	cases := []struct {
+		name    string
+		out     string
+		wantErr string
+	}{
+		{"minimum", versionOutput("v" + minBomVersion), ""},
+		{"newer", versionOutput("v0.6.0"), ""},
+		{"too old", versionOutput("v0.4.1"), "too old"},
+		{"unparsable", versionOutput("devel"), "failed to parse"},
+		{"no version", "bom: A tool for working with SPDX manifests", "no GitVersion"},
+	}
+	orig := bomVersion
+	t.Cleanup(func() { bomVersion = orig })
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			bomVersion = func() (string, error) { return tt.out, nil }
+			err := checkBomVersion()
+			testutil.AssertError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestRegenerateReleaseBillOfMaterials(t *testing.T) {
+	origVersion, origBom := bomVersion, runBom
+	t.Cleanup(func() { bomVersion, runBom = origVersion, origBom })
+	bomVersion = func() (string, error) { return "GitVersion: v" + minBomVersion, nil }
+	var args []string
+	runBom = func(a ...string) error {
+		args = a
+		for i, arg := range a {
+			if arg == "--output" {
+				return os.WriteFile(a[i+1], []byte("SPDXVersion: SPDX-2.3\n"), 0o640)
+			}
+		}
+		return fmt.Errorf("no --output")
+	}
+
+	// A release directory alone, with no work directory or sources
+	release := t.TempDir()
+	if err := os.WriteFile(path.Join(release, "manifest.yaml"),
+		[]byte("version: 1.20.0\nlayout:\n  docker: images\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	testutil.WriteFile(t, path.Join(release, "images", "pilot-distroless.tar.gz"), "test")
+	testutil.WriteFile(t, path.Join(release, "istio-1.20.0-linux-amd64.tar.gz"), "test")
+
+	if err := RegenerateReleaseBillOfMaterials(release); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path.Join(release, "istio-release.spdx")); err != nil {
+		t.Fatalf("expected release SBOM: %v", err)
+	}
+	flags := map[string]string{}
+	for i := 0; i+1 < len(args); i++ {
+		if strings.HasPrefix(args[i], "--") {
+			flags[args[i]] = args[i+1]
+		}
+	}
+	expected := map[string]string{
+		"--dirs":          release,
+		"--image-archive": path.Join(release, "images", "pilot-distroless.tar.gz"),
+		"--namespace":     model.DefaultReleaseURL + "/1.20.0/istio-release.spdx",
+		"--output":        path.Join(release, "istio-release.spdx"),
+	}
+	for flag, want := range expected {
+		if got := flags[flag]; got != want {
+			t.Errorf("expected %v %v, got %v", flag, want, got)
+		}
+	}
+	if !strings.Contains(flags["--ignore"], "images") {
+		t.Errorf("expected docker directory to be ignored, got %v", flags["--ignore"])
+	}
+}
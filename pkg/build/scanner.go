@@ -106,8 +106,8 @@ func Scanner(manifest model.Manifest, githubToken, git, branch string) error {
 
 	// Setup for multiarch build.
 	// See https://medium.com/@artur.klauser/building-multi-architecture-docker-images-with-buildx-27d80f7e2408 for more info
-	if err := util.VerboseCommand("docker",
-		"run", "--rm", "--privileged", "multiarch/qemu-user-static", "--reset", "-p", "yes").Run(); err != nil {
+	if err := util.RunSummarized(util.VerboseCommand("docker",
+		"run", "--rm", "--privileged", "multiarch/qemu-user-static", "--reset", "-p", "yes")); err != nil {
 		return fmt.Errorf("failed to run qemu-user-static container: %v", err)
 	}
 
@@ -138,7 +138,7 @@ func Scanner(manifest model.Manifest, githubToken, git, branch string) error {
 	cmd.Stderr = os.Stderr
 	cmd.Stdout = os.Stdout
 	cmd.Dir = istioDir
-	if err := cmd.Run(); err != nil {
+	if err := util.RunSummarized(cmd); err != nil {
 		return fmt.Errorf("failed to build base images: %v", err)
 	}
 
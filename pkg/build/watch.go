@@ -0,0 +1,198 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"istio.io/istio/pkg/log"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+)
+
+// Notifier reports changes to the files watched by WatchBuild
+type Notifier interface {
+	// Changes returns a channel receiving each changed path. It is closed once the notifier is closed.
+	Changes() <-chan string
+	Close()
+}
+
+// pollNotifier detects changes by periodically checking the latest modification time, and number of files, of each
+// watched path. Directories are watched recursively, skipping .git.
+type pollNotifier struct {
+	paths    []string
+	interval time.Duration
+	changes  chan string
+	done     chan struct{}
+	once     sync.Once
+}
+
+// NewPollNotifier returns a Notifier polling the paths for changes every interval
+func NewPollNotifier(paths []string, interval time.Duration) Notifier {
+	n := &pollNotifier{
+		paths:    paths,
+		interval: interval,
+		changes:  make(chan string),
+		done:     make(chan struct{}),
+	}
+	state := map[string]pathState{}
+	for _, p := range paths {
+		state[p] = statPath(p)
+	}
+	go n.poll(state)
+	return n
+}
+
+func (n *pollNotifier) Changes() <-chan string {
+	return n.changes
+}
+
+func (n *pollNotifier) Close() {
+	n.once.Do(func() { close(n.done) })
+}
+
+func (n *pollNotifier) poll(state map[string]pathState) {
+	defer close(n.changes)
+	ticker := time.NewTicker(n.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.done:
+			return
+		case <-ticker.C:
+		}
+		for _, p := range n.paths {
+			current := statPath(p)
+			if current == state[p] {
+				continue
+			}
+			state[p] = current
+			select {
+			case n.changes <- p:
+			case <-n.done:
+				return
+			}
+		}
+	}
+}
+
+// pathState summarizes a path, so that modifying, adding or removing any file below it changes the summary
+type pathState struct {
+	modified time.Time
+	files    int
+}
+
+func statPath(p string) pathState {
+	state := pathState{}
+	_ = filepath.WalkDir(p, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		state.files++
+		if info.ModTime().After(state.modified) {
+			state.modified = info.ModTime()
+		}
+		return nil
+	})
+	return state
+}
+
+// WatchBuild runs build once, and then again each time the notifier reports a change, passing the changed paths.
+// Changes arriving less than debounce apart are combined into a single build. A failed build is logged rather than
+// ending the watch, so the next change can fix it. The watch ends when stop is closed, or the notifier is closed.
+func WatchBuild(notifier Notifier, debounce time.Duration, stop <-chan struct{}, build func(changed []string) error) error {
+	runWatchedBuild(build, nil)
+	for {
+		changed, ok := waitForChanges(notifier.Changes(), debounce, stop)
+		if !ok {
+			return nil
+		}
+		log.Infof("Detected changes to %v, rebuilding", strings.Join(changed, ", "))
+		runWatchedBuild(build, changed)
+	}
+}
+
+func runWatchedBuild(build func(changed []string) error, changed []string) {
+	if err := build(changed); err != nil {
+		log.Errorf("Build failed, waiting for changes: %v", err)
+		return
+	}
+	log.Infof("Build succeeded, waiting for changes")
+}
+
+// waitForChanges blocks until a change is reported, and then collects further changes until none arrive for
+// debounce. It returns false if the watch should end.
+func waitForChanges(changes <-chan string, debounce time.Duration, stop <-chan struct{}) ([]string, bool) {
+	changed := []string{}
+	seen := map[string]struct{}{}
+	add := func(p string) {
+		if _, f := seen[p]; !f {
+			seen[p] = struct{}{}
+			changed = append(changed, p)
+		}
+	}
+	select {
+	case <-stop:
+		return nil, false
+	case p, ok := <-changes:
+		if !ok {
+			return nil, false
+		}
+		add(p)
+	}
+	timer := time.NewTimer(debounce)
+	defer timer.Stop()
+	for {
+		select {
+		case <-stop:
+			return nil, false
+		case p, ok := <-changes:
+			if !ok {
+				return nil, false
+			}
+			add(p)
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(debounce)
+		case <-timer.C:
+			return changed, true
+		}
+	}
+}
+
+// removeSources removes the fetched and working copies of the sources, so a rebuild can fetch them again.
+// Outputs, and the fingerprints of the steps that produced them, are kept.
+func removeSources(manifest model.Manifest) error {
+	for _, dir := range []string{manifest.SourceDir(), manifest.WorkDir()} {
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("failed to remove %v: %v", dir, err)
+		}
+	}
+	return nil
+}
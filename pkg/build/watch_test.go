@@ -0,0 +1,115 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeNotifier reports the changes sent by the test
+type fakeNotifier struct {
+	changes chan string
+}
+
+func (f fakeNotifier) Changes() <-chan string {
+	return f.changes
+}
+
+func (f fakeNotifier) Close() {}
+
+func TestWatchBuild(t *testing.T) {
+	notifier := fakeNotifier{changes: make(chan string)}
+	stop := make(chan struct{})
+	builds := make(chan []string)
+	done := make(chan error)
+	go func() {
+		done <- WatchBuild(notifier, 50*time.Millisecond, stop, func(changed []string) error {
+			builds <- changed
+			// A failed build must not end the watch
+			return errors.New("failed")
+		})
+	}()
+
+	if changed := <-builds; changed != nil {
+		t.Fatalf("expected initial build without changes, got %v", changed)
+	}
+	// Rapid changes are combined into a single build
+	for _, p := range []string{"manifest.yaml", "istio", "manifest.yaml"} {
+		notifier.changes <- p
+	}
+	if changed := <-builds; !reflect.DeepEqual(changed, []string{"manifest.yaml", "istio"}) {
+		t.Fatalf("expected one build for all changes, got %v", changed)
+	}
+	notifier.changes <- "manifest.yaml"
+	if changed := <-builds; !reflect.DeepEqual(changed, []string{"manifest.yaml"}) {
+		t.Fatalf("expected a build for the later change, got %v", changed)
+	}
+
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPollNotifier(t *testing.T) {
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "manifest.yaml")
+	source := filepath.Join(dir, "istio")
+	if err := os.WriteFile(manifest, []byte("version: 1.2.3"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(source, ".git"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+
+	notifier := NewPollNotifier([]string{manifest, source}, 10*time.Millisecond)
+	defer notifier.Close()
+	expectChange := func(expected string) {
+		t.Helper()
+		select {
+		case p := <-notifier.Changes():
+			if p != expected {
+				t.Fatalf("expected change to %v, got %v", expected, p)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected change to %v", expected)
+		}
+	}
+
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(manifest, later, later); err != nil {
+		t.Fatal(err)
+	}
+	expectChange(manifest)
+	if err := os.WriteFile(filepath.Join(source, "main.go"), []byte("package main"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	expectChange(source)
+
+	// Changes to git metadata are ignored
+	if err := os.WriteFile(filepath.Join(source, ".git", "index"), []byte("index"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case p := <-notifier.Changes():
+		t.Fatalf("expected no change, got %v", p)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
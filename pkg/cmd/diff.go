@@ -0,0 +1,64 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/alauda-mesh/release-builder/pkg"
+	"github.com/alauda-mesh/release-builder/pkg/validate"
+)
+
+// getDiffCommand returns a command printing the changes between two manifests
+func getDiffCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:          "diff <from manifest> <to manifest>",
+		Short:        "Shows the changes between two manifests",
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(2),
+		RunE: func(c *cobra.Command, args []string) error {
+			from, err := pkg.ReadManifest(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to read %v: %v", args[0], err)
+			}
+			to, err := pkg.ReadManifest(args[1])
+			if err != nil {
+				return fmt.Errorf("failed to read %v: %v", args[1], err)
+			}
+			_, err = fmt.Fprint(c.OutOrStdout(), pkg.DiffManifests(from, to).String())
+			return err
+		},
+	}
+}
+
+// getDiffArchiveCommand returns a command printing the changes between two release archives
+func getDiffArchiveCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:          "diff-archive <from archive or URL> <to archive>",
+		Short:        "Shows the files, and values of YAML files, that changed between two release archives",
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(2),
+		RunE: func(c *cobra.Command, args []string) error {
+			d, err := validate.DiffArchives(args[0], args[1])
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprint(c.OutOrStdout(), d.String())
+			return err
+		},
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/alauda-mesh/release-builder/pkg/branch"
 	"github.com/alauda-mesh/release-builder/pkg/build"
 	"github.com/alauda-mesh/release-builder/pkg/publish"
+	"github.com/alauda-mesh/release-builder/pkg/util"
 	"github.com/alauda-mesh/release-builder/pkg/validate"
 )
 
@@ -30,11 +31,18 @@ func GetRootCmd(args []string) *cobra.Command {
 		Short:        "Istio build, release, and publishing tool.",
 		SilenceUsage: true,
 	}
+	rootCmd.PersistentFlags().IntVar(&util.LogSummaryLines, "log-summary-lines", util.LogSummaryLines,
+		"The number of last lines of output logged in the summary of a failed command.")
+	rootCmd.PersistentFlags().StringArrayVar(&util.LogErrorPatterns, "log-error-pattern", util.LogErrorPatterns,
+		"A regular expression matching lines of output logged in the summary of a failed command. May be repeated.")
 
 	rootCmd.AddCommand(build.GetBuildCommand())
 	rootCmd.AddCommand(validate.GetValidateCommand())
 	rootCmd.AddCommand(publish.GetPublishCommand())
 	rootCmd.AddCommand(branch.GetBranchCommand())
+	rootCmd.AddCommand(getDiffCommand())
+	rootCmd.AddCommand(getDiffArchiveCommand())
+	rootCmd.AddCommand(getSbomCommand())
 
 	return rootCmd
 }
@@ -0,0 +1,38 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/alauda-mesh/release-builder/pkg/build"
+)
+
+// getSbomCommand returns a command regenerating the release SBOM of an already built release
+func getSbomCommand() *cobra.Command {
+	release := ""
+	cmd := &cobra.Command{
+		Use:          "sbom",
+		Short:        "Regenerates the release SBOM of an already built release, without its sources",
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(0),
+		RunE: func(c *cobra.Command, _ []string) error {
+			return build.RegenerateReleaseBillOfMaterials(release)
+		},
+	}
+	cmd.Flags().StringVar(&release, "release", release, "The release directory to generate the SBOM for.")
+	_ = cmd.MarkFlagRequired("release")
+	return cmd
+}
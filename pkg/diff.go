@@ -0,0 +1,150 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+)
+
+// DependencyChange describes a dependency whose git reference differs between two manifests. From is empty for an
+// added dependency, and To is empty for a removed one.
+type DependencyChange struct {
+	Repo string
+	From string
+	To   string
+}
+
+// ManifestDiff describes what changed between two manifests
+type ManifestDiff struct {
+	FromVersion string
+	ToVersion   string
+	FromDocker  string
+	ToDocker    string
+	// Dependencies lists the changed dependencies, sorted by repo
+	Dependencies         []DependencyChange
+	AddedArchitectures   []string
+	RemovedArchitectures []string
+	AddedImages          []string
+	RemovedImages        []string
+}
+
+// DiffManifests compares manifest a to manifest b
+func DiffManifests(a, b model.Manifest) ManifestDiff {
+	d := ManifestDiff{
+		FromVersion: a.Version,
+		ToVersion:   b.Version,
+		FromDocker:  a.Docker,
+		ToDocker:    b.Docker,
+	}
+	from, to := a.Dependencies.Get(), b.Dependencies.Get()
+	repos := map[string]struct{}{}
+	for repo := range from {
+		repos[repo] = struct{}{}
+	}
+	for repo := range to {
+		repos[repo] = struct{}{}
+	}
+	for repo := range repos {
+		var fromRef, toRef string
+		if dep := from[repo]; dep != nil {
+			fromRef = dep.Ref()
+		}
+		if dep := to[repo]; dep != nil {
+			toRef = dep.Ref()
+		}
+		if fromRef != toRef {
+			d.Dependencies = append(d.Dependencies, DependencyChange{Repo: repo, From: fromRef, To: toRef})
+		}
+	}
+	sort.Slice(d.Dependencies, func(i, j int) bool { return d.Dependencies[i].Repo < d.Dependencies[j].Repo })
+	d.AddedArchitectures, d.RemovedArchitectures = diffLists(a.Architectures, b.Architectures)
+	d.AddedImages, d.RemovedImages = diffLists(a.DockerImages, b.DockerImages)
+	return d
+}
+
+// diffLists returns the sorted entries only in b, and only in a
+func diffLists(a, b []string) (added []string, removed []string) {
+	inA, inB := map[string]struct{}{}, map[string]struct{}{}
+	for _, s := range a {
+		inA[s] = struct{}{}
+	}
+	for _, s := range b {
+		inB[s] = struct{}{}
+		if _, f := inA[s]; !f {
+			added = append(added, s)
+		}
+	}
+	for _, s := range a {
+		if _, f := inB[s]; !f {
+			removed = append(removed, s)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// Empty returns true if the manifests had no differences
+func (d ManifestDiff) Empty() bool {
+	return d.FromVersion == d.ToVersion && d.FromDocker == d.ToDocker && len(d.Dependencies) == 0 &&
+		len(d.AddedArchitectures) == 0 && len(d.RemovedArchitectures) == 0 &&
+		len(d.AddedImages) == 0 && len(d.RemovedImages) == 0
+}
+
+// String formats the diff for review, with one change per line
+func (d ManifestDiff) String() string {
+	if d.Empty() {
+		return "No changes.\n"
+	}
+	sb := strings.Builder{}
+	if d.FromVersion != d.ToVersion {
+		sb.WriteString(fmt.Sprintf("version: %s -> %s\n", d.FromVersion, d.ToVersion))
+	}
+	if d.FromDocker != d.ToDocker {
+		sb.WriteString(fmt.Sprintf("docker: %s -> %s\n", d.FromDocker, d.ToDocker))
+	}
+	if len(d.Dependencies) > 0 {
+		sb.WriteString("dependencies:\n")
+		for _, c := range d.Dependencies {
+			switch {
+			case c.From == "":
+				sb.WriteString(fmt.Sprintf("  + %s: %s\n", c.Repo, c.To))
+			case c.To == "":
+				sb.WriteString(fmt.Sprintf("  - %s: %s\n", c.Repo, c.From))
+			default:
+				sb.WriteString(fmt.Sprintf("  ~ %s: %s -> %s\n", c.Repo, c.From, c.To))
+			}
+		}
+	}
+	writeList := func(name string, added, removed []string) {
+		if len(added) == 0 && len(removed) == 0 {
+			return
+		}
+		sb.WriteString(name + ":\n")
+		for _, s := range added {
+			sb.WriteString(fmt.Sprintf("  + %s\n", s))
+		}
+		for _, s := range removed {
+			sb.WriteString(fmt.Sprintf("  - %s\n", s))
+		}
+	}
+	writeList("architectures", d.AddedArchitectures, d.RemovedArchitectures)
+	writeList("images", d.AddedImages, d.RemovedImages)
+	return sb.String()
+}
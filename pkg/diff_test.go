@@ -0,0 +1,89 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+)
+
+func TestDiffManifests(t *testing.T) {
+	base := model.Manifest{
+		Version:       "1.20.0",
+		Docker:        "docker.io/istio",
+		Architectures: []string{"linux/amd64"},
+		DockerImages:  []string{"pilot-debug", "proxyv2-debug"},
+		Dependencies: model.IstioDependencies{
+			Istio: &model.Dependency{Sha: "1111"},
+			Proxy: &model.Dependency{Sha: "2222"},
+		},
+	}
+
+	t.Run("no changes", func(t *testing.T) {
+		d := DiffManifests(base, base)
+		if !d.Empty() {
+			t.Fatalf("expected empty diff, got %+v", d)
+		}
+		if d.String() != "No changes.\n" {
+			t.Fatalf("unexpected output %q", d.String())
+		}
+	})
+
+	t.Run("dependency bump", func(t *testing.T) {
+		next := base
+		next.Version = "1.20.1"
+		next.Dependencies = model.IstioDependencies{
+			Istio: &model.Dependency{Sha: "3333"},
+			Proxy: &model.Dependency{Sha: "2222"},
+			Api:   &model.Dependency{Branch: "master"},
+		}
+		d := DiffManifests(base, next)
+		expected := []DependencyChange{
+			{Repo: "api", To: "master"},
+			{Repo: "istio", From: "1111", To: "3333"},
+		}
+		if !reflect.DeepEqual(d.Dependencies, expected) {
+			t.Fatalf("expected %+v, got %+v", expected, d.Dependencies)
+		}
+		out := `version: 1.20.0 -> 1.20.1
+dependencies:
+  + api: master
+  ~ istio: 1111 -> 3333
+`
+		if d.String() != out {
+			t.Fatalf("expected:\n%s\ngot:\n%s", out, d.String())
+		}
+	})
+
+	t.Run("arch addition", func(t *testing.T) {
+		next := base
+		next.Architectures = []string{"linux/amd64", "linux/arm64"}
+		next.DockerImages = []string{"pilot-debug"}
+		d := DiffManifests(base, next)
+		if !reflect.DeepEqual(d.AddedArchitectures, []string{"linux/arm64"}) || len(d.RemovedArchitectures) != 0 {
+			t.Fatalf("expected linux/arm64 added, got %+v", d)
+		}
+		out := `architectures:
+  + linux/arm64
+images:
+  - proxyv2-debug
+`
+		if d.String() != out {
+			t.Fatalf("expected:\n%s\ngot:\n%s", out, d.String())
+		}
+	})
+}
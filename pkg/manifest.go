@@ -17,25 +17,22 @@ package pkg
 import (
 	"fmt"
 	"os"
+	"regexp"
+	"slices"
 	"strings"
 
 	"istio.io/istio/pkg/log"
 	"sigs.k8s.io/yaml"
+	yamlv3 "sigs.k8s.io/yaml/goyaml.v3"
 
 	"github.com/alauda-mesh/release-builder/pkg/model"
+	"github.com/alauda-mesh/release-builder/pkg/util"
 )
 
-func InputManifestToManifest(in model.InputManifest) (model.Manifest, error) {
-	wd := in.Directory
-	if wd == "" {
-		var err error
-		wd, err = os.MkdirTemp(os.TempDir(), "istio-release")
-		if err != nil {
-			return model.Manifest{}, fmt.Errorf("failed to create working directory: %v", err)
-		}
-	}
+// parseBuildOutputs converts the outputs of an input manifest to the build outputs. No outputs means every output.
+func parseBuildOutputs(names []string) (map[model.BuildOutput]struct{}, error) {
 	outputs := map[model.BuildOutput]struct{}{}
-	for _, o := range in.BuildOutputs {
+	for _, o := range names {
 		switch strings.ToLower(o) {
 		case "docker":
 			outputs[model.Docker] = struct{}{}
@@ -50,7 +47,7 @@ func InputManifestToManifest(in model.InputManifest) (model.Manifest, error) {
 		case "scanner":
 			outputs[model.Scanner] = struct{}{}
 		default:
-			return model.Manifest{}, fmt.Errorf("unknown build output: %v", o)
+			return nil, fmt.Errorf("unknown build output: %v", o)
 		}
 	}
 	if len(outputs) == 0 {
@@ -62,6 +59,22 @@ func InputManifestToManifest(in model.InputManifest) (model.Manifest, error) {
 		outputs[model.Grafana] = struct{}{}
 		outputs[model.Scanner] = struct{}{}
 	}
+	return outputs, nil
+}
+
+func InputManifestToManifest(in model.InputManifest) (model.Manifest, error) {
+	wd := in.Directory
+	if wd == "" {
+		var err error
+		wd, err = os.MkdirTemp(os.TempDir(), "istio-release")
+		if err != nil {
+			return model.Manifest{}, fmt.Errorf("failed to create working directory: %v", err)
+		}
+	}
+	outputs, err := parseBuildOutputs(in.BuildOutputs)
+	if err != nil {
+		return model.Manifest{}, err
+	}
 	do := in.DockerOutput
 	if do == "" {
 		do = model.DockerOutputTar
@@ -71,20 +84,204 @@ func InputManifestToManifest(in model.InputManifest) (model.Manifest, error) {
 		// Default to just amd64. In the future we may want to include arm64 by default
 		arch = []string{"linux/amd64"}
 	}
+	images := in.DockerImages
+	if len(images) == 0 {
+		images = model.DefaultDockerImages
+	}
+	if in.BuildOperator {
+		// Copy, so the defaults are never modified
+		images = append(append([]string{}, images...), missingImages(images, model.OperatorDockerImages)...)
+	}
+	variants := in.DockerVariants
+	if len(variants) == 0 {
+		variants = model.DefaultDockerVariants
+	}
+	for _, v := range variants {
+		if v == "" || strings.ContainsAny(v, " \t-") {
+			return model.Manifest{}, fmt.Errorf("invalid docker variant %q", v)
+		}
+	}
+	images = imagesForVariants(images, variants)
+	skipAmbient := in.Ambient != nil && !*in.Ambient
+	if skipAmbient {
+		if len(in.DockerImages) > 0 && slices.ContainsFunc(in.DockerImages, model.IsAmbientImage) {
+			return model.Manifest{}, fmt.Errorf("dockerImages lists ambient images, but ambient is disabled")
+		}
+		images = slices.DeleteFunc(slices.Clone(images), model.IsAmbientImage)
+	}
+	for _, t := range in.DockerExtraTargets {
+		if t.Target == "" || len(t.Images) == 0 {
+			return model.Manifest{}, fmt.Errorf("docker extra target %q must have a target and images", t.Target)
+		}
+		images = append(slices.Clone(images), missingImages(images, t.Images)...)
+	}
+	licenseRepos := in.LicenseRepos
+	if len(licenseRepos) == 0 {
+		licenseRepos = model.DefaultLicenseRepos
+	}
+	shaAlgorithms := in.ShaAlgorithms
+	if len(shaAlgorithms) == 0 {
+		shaAlgorithms = []string{string(util.Sha256)}
+	}
+	for _, algo := range shaAlgorithms {
+		if _, err := util.ShaSum(util.ShaAlgorithm(algo), nil); err != nil {
+			return model.Manifest{}, err
+		}
+	}
+	gzipLevel := in.GzipLevel
+	if gzipLevel == 0 {
+		// Recorded in the manifest of the release, so validation knows the archives were compressed by the builder
+		gzipLevel = model.DefaultGzipLevel
+	}
+	candidates := model.ArchiveArchitectures
+	if len(in.ArchiveArchitectures) > 0 {
+		candidates = in.ArchiveArchitectures
+	}
+	var archiveArch []string
+	for _, a := range candidates {
+		if strings.HasPrefix(a, "osx") && in.BuildDarwin != nil && !*in.BuildDarwin {
+			continue
+		}
+		if strings.HasPrefix(a, "win") && in.BuildWindows != nil && !*in.BuildWindows {
+			continue
+		}
+		archiveArch = append(archiveArch, a)
+	}
 	return model.Manifest{
 		Dependencies:                in.Dependencies,
 		Version:                     in.Version,
 		Docker:                      in.Docker,
 		DockerOutput:                do,
+		DockerImages:                images,
+		CustomDockerImages:          len(in.DockerImages) > 0,
 		Directory:                   wd,
 		BuildOutputs:                outputs,
 		ProxyOverride:               in.ProxyOverride,
+		ProxyOverrideMirrors:        in.ProxyOverrideMirrors,
 		GrafanaDashboards:           in.GrafanaDashboards,
+		FetchGrafanaDashboards:      in.FetchGrafanaDashboards,
+		GrafanaDashboardURLs:        in.GrafanaDashboardURLs,
 		SkipGenerateBillOfMaterials: in.SkipGenerateBillOfMaterials,
 		Architectures:               arch,
+		LicenseRepos:                licenseRepos,
+		PreviousManifest:            in.PreviousManifest,
+		EmbedBuildInfo:              in.EmbedBuildInfo,
+		SkipBuildTimestamp:          in.SkipBuildTimestamp,
+		AdditionalCompletions:       in.AdditionalCompletions,
+		ShaAlgorithms:               shaAlgorithms,
+		UncompressedArchives:        in.UncompressedArchives,
+		ArchiveArchitectures:        archiveArch,
+		DockerArchitectures:         in.DockerArchitectures,
+		BuildOperator:               in.BuildOperator,
+		Layout:                      in.Layout,
+		ImageSizeLimits:             in.ImageSizeLimits,
+		ProxyExtensions:             in.ProxyExtensions,
+		ReleaseURL:                  in.ReleaseURL,
+		DockerVariants:              variants,
+		SkipAmbient:                 skipAmbient,
+		DockerExtraTargets:          in.DockerExtraTargets,
+		Storage:                     in.Storage,
+		ThirdPartyNotices:           in.ThirdPartyNotices,
+		LicensePolicy:               in.LicensePolicy,
+		ProfileComponents:           in.ProfileComponents,
+		ImageLock:                   in.ImageLock,
+		ToolsArchive:                in.ToolsArchive,
+		VerifyImageReproducibility:  in.VerifyImageReproducibility,
+		ImageRenames:                in.ImageRenames,
+		HelmRepoIndex:               in.HelmRepoIndex,
+		GzipLevel:                   gzipLevel,
+		CosignSigning:               in.CosignSigning,
+		StripIstioctl:               in.StripIstioctl,
+		ArtifactBillOfMaterials:     in.ArtifactBillOfMaterials,
 	}, nil
 }
 
+// imagesForVariants drops images in a default variant that is not built, and adds each image in every variant that
+// is not a default variant.
+func imagesForVariants(images []string, variants []string) []string {
+	known := append(append([]string{}, model.DefaultDockerVariants...), variants...)
+	result := []string{}
+	names := []string{}
+	for _, image := range images {
+		name, variant := model.SplitImageVariant(image, known)
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+		if variant == "" || slices.Contains(variants, variant) {
+			result = append(result, image)
+		}
+	}
+	extra := []string{}
+	for _, v := range variants {
+		if slices.Contains(model.DefaultDockerVariants, v) {
+			continue
+		}
+		for _, name := range names {
+			extra = append(extra, name+"-"+v)
+		}
+	}
+	return append(result, missingImages(result, extra)...)
+}
+
+// missingImages returns the images in want that are not already in images
+func missingImages(images []string, want []string) []string {
+	have := map[string]struct{}{}
+	for _, i := range images {
+		have[i] = struct{}{}
+	}
+	missing := []string{}
+	for _, i := range want {
+		if _, f := have[i]; !f {
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
+
+// envVarRegex matches an escaped `$$`, or a `${VAR}` reference with an optional `:-default` suffix
+var envVarRegex = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv replaces `${VAR}` references with the value from the process environment. Like the shell,
+// `${VAR:-default}` resolves to default if VAR is unset or empty. Unset variables without a default are an error.
+// A literal `$` can be written as `$$`.
+func expandEnv(in []byte) ([]byte, error) {
+	var missing []string
+	out := envVarRegex.ReplaceAllFunc(in, func(match []byte) []byte {
+		if string(match) == "$$" {
+			return []byte("$")
+		}
+		groups := envVarRegex.FindSubmatch(match)
+		if v, f := os.LookupEnv(string(groups[1])); f && v != "" {
+			return []byte(v)
+		}
+		if groups[2] != nil {
+			return groups[3]
+		}
+		if _, f := os.LookupEnv(string(groups[1])); !f {
+			missing = append(missing, string(groups[1]))
+		}
+		return nil
+	})
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("unset environment variables: %v", strings.Join(missing, ", "))
+	}
+	return out, nil
+}
+
+// readInputManifestFile reads an input manifest file, expanding any environment variable references. The manifest a
+// release is built with is written with any references already expanded, so it is read as is.
+func readInputManifestFile(manifestFile string) ([]byte, error) {
+	by, err := os.ReadFile(manifestFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest file: %v", err)
+	}
+	by, err = expandEnv(by)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand manifest file %v: %v", manifestFile, err)
+	}
+	return by, nil
+}
+
 func ReadManifest(manifestFile string) (model.Manifest, error) {
 	manifest := model.Manifest{}
 	by, err := os.ReadFile(manifestFile)
@@ -97,6 +294,64 @@ func ReadManifest(manifestFile string) (model.Manifest, error) {
 	return manifest, nil
 }
 
+// ReadManifestWithOverlay reads a base input manifest and deep-merges an overlay input manifest on top of it. This
+// allows keeping a single canonical manifest, with small per-release overlays changing only a few fields.
+// Maps, such as dependencies, are merged recursively and scalar values from the overlay take precedence.
+// Lists are not merged; a list in the overlay replaces the list in the base entirely. The merged manifest is set up
+// exactly as a single input manifest with the same content would be.
+func ReadManifestWithOverlay(base, overlay string) (model.Manifest, error) {
+	baseValues, err := readManifestValues(base)
+	if err != nil {
+		return model.Manifest{}, err
+	}
+	overlayValues, err := readManifestValues(overlay)
+	if err != nil {
+		return model.Manifest{}, err
+	}
+	by, err := yaml.Marshal(mergeValues(baseValues, overlayValues))
+	if err != nil {
+		return model.Manifest{}, fmt.Errorf("failed to marshal merged manifest: %v", err)
+	}
+	in := model.InputManifest{}
+	if err := yaml.Unmarshal(by, &in); err != nil {
+		return model.Manifest{}, fmt.Errorf("failed to unmarshal merged manifest: %v", err)
+	}
+	if err := validateManifestDependencies(in.Dependencies); err != nil {
+		return model.Manifest{}, fmt.Errorf("invalid manifest: %v", err)
+	}
+	return InputManifestToManifest(in)
+}
+
+func readManifestValues(manifestFile string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	by, err := readInputManifestFile(manifestFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(by, &values); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal manifest file %v: %v", manifestFile, err)
+	}
+	return values, nil
+}
+
+// mergeValues returns base with overlay merged on top of it. Neither input is modified.
+func mergeValues(base, overlay map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(base))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range overlay {
+		if overlayMap, ok := v.(map[string]interface{}); ok {
+			if baseMap, ok := out[k].(map[string]interface{}); ok {
+				out[k] = mergeValues(baseMap, overlayMap)
+				continue
+			}
+		}
+		out[k] = v
+	}
+	return out
+}
+
 func validateManifestDependencies(dependencies model.IstioDependencies) error {
 	for repo, dep := range dependencies.Get() {
 		if dep == nil {
@@ -116,9 +371,9 @@ func validateManifestDependencies(dependencies model.IstioDependencies) error {
 
 func ReadInManifest(manifestFile string) (model.InputManifest, error) {
 	manifest := model.InputManifest{}
-	by, err := os.ReadFile(manifestFile)
+	by, err := readInputManifestFile(manifestFile)
 	if err != nil {
-		return manifest, fmt.Errorf("failed to read manifest file: %v", err)
+		return manifest, err
 	}
 	if err := yaml.Unmarshal(by, &manifest); err != nil {
 		return manifest, fmt.Errorf("failed to unmarshal manifest file: %v", err)
@@ -128,3 +383,16 @@ func ReadInManifest(manifestFile string) (model.InputManifest, error) {
 	}
 	return manifest, nil
 }
+
+// WriteInManifest writes an input manifest to a file. Fields, including dependencies, are written in the order
+// they are declared, so a manifest read with ReadInManifest can be modified and written back.
+func WriteInManifest(manifest model.InputManifest, manifestFile string) error {
+	by, err := yamlv3.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %v", err)
+	}
+	if err := os.WriteFile(manifestFile, by, 0o640); err != nil {
+		return fmt.Errorf("failed to write manifest file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,522 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+)
+
+const baseManifest = `
+version: 1.19.0
+docker: docker.io/istio
+architectures: [linux/amd64, linux/arm64]
+dependencies:
+  istio:
+    git: https://github.com/istio/istio
+    branch: master
+  api:
+    git: https://github.com/istio/api
+    sha: abc
+dashboards:
+  pilot-dashboard: 7645
+`
+
+func writeTempFile(t *testing.T, name, contents string) string {
+	f := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(f, []byte(contents), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestReadManifestWithOverlay(t *testing.T) {
+	// Manifests without a directory get a temporary working directory
+	t.Setenv("TMPDIR", t.TempDir())
+	base := writeTempFile(t, "base.yaml", baseManifest)
+
+	t.Run("scalar override", func(t *testing.T) {
+		overlay := writeTempFile(t, "overlay.yaml", "version: 1.20.0\ndocker: gcr.io/istio-release\n")
+		m, err := ReadManifestWithOverlay(base, overlay)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Version != "1.20.0" {
+			t.Fatalf("expected version 1.20.0, got %v", m.Version)
+		}
+		if m.Docker != "gcr.io/istio-release" {
+			t.Fatalf("expected docker gcr.io/istio-release, got %v", m.Docker)
+		}
+		if !reflect.DeepEqual(m.Architectures, []string{"linux/amd64", "linux/arm64"}) {
+			t.Fatalf("expected architectures from base, got %v", m.Architectures)
+		}
+	})
+
+	t.Run("list replacement", func(t *testing.T) {
+		overlay := writeTempFile(t, "overlay.yaml", "architectures: [linux/arm64]\n")
+		m, err := ReadManifestWithOverlay(base, overlay)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(m.Architectures, []string{"linux/arm64"}) {
+			t.Fatalf("expected architectures to be replaced, got %v", m.Architectures)
+		}
+	})
+
+	t.Run("nested dependency override", func(t *testing.T) {
+		overlay := writeTempFile(t, "overlay.yaml", "dependencies:\n  istio:\n    branch: release-1.20\n")
+		m, err := ReadManifestWithOverlay(base, overlay)
+		if err != nil {
+			t.Fatal(err)
+		}
+		istio := m.Dependencies.Istio
+		if istio == nil || istio.Branch != "release-1.20" || istio.Git != "https://github.com/istio/istio" {
+			t.Fatalf("expected istio branch overridden and git kept, got %+v", istio)
+		}
+		if api := m.Dependencies.Api; api == nil || api.Sha != "abc" {
+			t.Fatalf("expected api dependency from base, got %+v", api)
+		}
+		if m.GrafanaDashboards["pilot-dashboard"] != 7645 {
+			t.Fatalf("expected dashboards from base, got %v", m.GrafanaDashboards)
+		}
+	})
+	t.Run("input only fields", func(t *testing.T) {
+		base := writeTempFile(t, "base.yaml", baseManifest+"directory: /work\nproxyOverride: https://example.com/envoy\noutputs: [docker, helm]\n")
+		overlay := writeTempFile(t, "overlay.yaml", "previousManifest: /releases/1.19.0/manifest.yaml\nproxyOverrideMirrors: [https://mirror.example.com]\n")
+		m, err := ReadManifestWithOverlay(base, overlay)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Directory != "/work" || m.ProxyOverride != "https://example.com/envoy" || m.PreviousManifest != "/releases/1.19.0/manifest.yaml" {
+			t.Fatalf("expected input only fields to be kept, got %+v", m)
+		}
+		if !reflect.DeepEqual(m.ProxyOverrideMirrors, []string{"https://mirror.example.com"}) {
+			t.Fatalf("expected proxy override mirrors from overlay, got %v", m.ProxyOverrideMirrors)
+		}
+		if want := map[model.BuildOutput]struct{}{model.Docker: {}, model.Helm: {}}; !reflect.DeepEqual(m.BuildOutputs, want) {
+			t.Fatalf("expected outputs %v, got %v", want, m.BuildOutputs)
+		}
+	})
+
+	t.Run("input manifest defaults", func(t *testing.T) {
+		overlay := writeTempFile(t, "overlay.yaml", "dockerVariants: [debug]\nambient: false\n")
+		m, err := ReadManifestWithOverlay(base, overlay)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(m.DockerVariants, []string{"debug"}) {
+			t.Fatalf("expected docker variants from overlay, got %v", m.DockerVariants)
+		}
+		if !m.SkipAmbient {
+			t.Fatalf("expected ambient to be disabled")
+		}
+		for _, image := range m.DockerImages {
+			if strings.HasSuffix(image, "-distroless") || model.IsAmbientImage(image) {
+				t.Fatalf("expected only non-ambient debug images, got %v", m.DockerImages)
+			}
+		}
+		if m.GzipLevel != model.DefaultGzipLevel || !reflect.DeepEqual(m.LicenseRepos, model.DefaultLicenseRepos) {
+			t.Fatalf("expected input manifest defaults, got gzip level %v and license repos %v", m.GzipLevel, m.LicenseRepos)
+		}
+	})
+}
+
+func TestReadManifestDevVersion(t *testing.T) {
+	dev := writeTempFile(t, "manifest.yaml", `
+version: master-dev
+docker: docker.io/istio
+architectures: [linux/amd64]
+outputs: [docker, helm, archive]
+dependencies:
+  istio:
+    git: https://github.com/istio/istio
+    sha: a
+  api:
+    git: https://github.com/istio/api
+    sha: b
+  proxy:
+    git: https://github.com/istio/proxy
+    sha: c
+  client-go:
+    git: https://github.com/istio/client-go
+    sha: d
+`)
+	in, err := ReadInManifest(dev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in.Directory = t.TempDir()
+	m, err := InputManifestToManifest(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, f := m.BuildOutputs[model.Helm]; !f {
+		t.Fatalf("expected the helm output, got %v", m.BuildOutputs)
+	}
+	if err := m.Validate(); err != nil {
+		t.Fatalf("expected a dev version to validate: %v", err)
+	}
+}
+
+func TestReadManifestEnv(t *testing.T) {
+	t.Setenv("TEST_RELEASE_VERSION", "1.20.1")
+	t.Setenv("TEST_RELEASE_EMPTY", "")
+
+	cases := []struct {
+		name      string
+		manifest  string
+		version   string
+		docker    string
+		expectErr bool
+	}{
+		{
+			"set",
+			"version: ${TEST_RELEASE_VERSION}\ndocker: docker.io/istio\n",
+			"1.20.1",
+			"docker.io/istio",
+			false,
+		},
+		{
+			"unset with default",
+			"version: ${TEST_RELEASE_VERSION}\ndocker: ${TEST_RELEASE_HUB:-gcr.io/istio-release}\n",
+			"1.20.1",
+			"gcr.io/istio-release",
+			false,
+		},
+		{
+			"empty with default",
+			"version: ${TEST_RELEASE_EMPTY:-1.0.0}\ndocker: docker.io/istio\n",
+			"1.0.0",
+			"docker.io/istio",
+			false,
+		},
+		{
+			"unset without default",
+			"version: ${TEST_RELEASE_UNSET}\n",
+			"",
+			"",
+			true,
+		},
+		{
+			"escaped",
+			"version: 1.20.1\ndocker: docker.io/$${TEST_RELEASE_VERSION}\n",
+			"1.20.1",
+			"docker.io/${TEST_RELEASE_VERSION}",
+			false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := ReadInManifest(writeTempFile(t, "manifest.yaml", tc.manifest))
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Version != tc.version {
+				t.Fatalf("expected version %v, got %v", tc.version, m.Version)
+			}
+			if m.Docker != tc.docker {
+				t.Fatalf("expected docker %v, got %v", tc.docker, m.Docker)
+			}
+		})
+	}
+
+	t.Run("release manifest", func(t *testing.T) {
+		// The manifest of a release holds the escaped value as written by the build, which must not be expanded again
+		m, err := ReadManifest(writeTempFile(t, "manifest.yaml", "version: 1.20.1\ndocker: docker.io/${TEST_RELEASE_UNSET}\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Docker != "docker.io/${TEST_RELEASE_UNSET}" {
+			t.Fatalf("expected docker to be read as is, got %v", m.Docker)
+		}
+	})
+}
+
+func TestWriteInManifestRoundTrip(t *testing.T) {
+	nested := "dockerExtraTargets:\n- target: docker.wasm-plugin\n  images: [wasm-plugin-distroless]\n" +
+		"licensePolicy:\n  denied: [GPL-*]\n  allowUnknown: true\n" +
+		"storage:\n  type: s3\n  bucket: istio-release/releases\n" +
+		"cosignSigning:\n  key: gcpkms://keys/release\n"
+	in, err := ReadInManifest(writeTempFile(t, "manifest.yaml", baseManifest+nested))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := in.Dependencies.Set("istio", &model.Dependency{Git: "https://github.com/istio/istio", Sha: "1234"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := in.Dependencies.Set("unknown", &model.Dependency{}); err == nil {
+		t.Fatalf("expected error setting unknown dependency")
+	}
+
+	out := filepath.Join(t.TempDir(), "out.yaml")
+	if err := WriteInManifest(in, out); err != nil {
+		t.Fatal(err)
+	}
+	written, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Index(string(written), "istio:") > strings.Index(string(written), "api:") {
+		t.Fatalf("expected dependencies in declaration order, got:\n%s", written)
+	}
+	for _, key := range []string{"allowUnknown: true", "bucket: istio-release/releases", "target: docker.wasm-plugin"} {
+		if !strings.Contains(string(written), key) {
+			t.Fatalf("expected %q in the written manifest, got:\n%s", key, written)
+		}
+	}
+	for _, key := range []string{"allowed:", "url:", "identity:", "skipAmbient:"} {
+		if strings.Contains(string(written), key) {
+			t.Fatalf("expected unset %v to be omitted, got:\n%s", key, written)
+		}
+	}
+
+	reloaded, err := ReadInManifest(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, reloaded) {
+		t.Fatalf("manifest did not round trip:\nexpected %+v\ngot %+v", in, reloaded)
+	}
+	if reloaded.Dependencies.Istio.Sha != "1234" || reloaded.Dependencies.Istio.Branch != "" {
+		t.Fatalf("expected updated istio dependency, got %+v", reloaded.Dependencies.Istio)
+	}
+}
+
+func TestArchiveArchitectures(t *testing.T) {
+	cases := []struct {
+		name     string
+		extra    string
+		expected []string
+	}{
+		{"default", "", model.ArchiveArchitectures},
+		{"no darwin", "buildDarwin: false\n", []string{"linux-amd64", "linux-armv7", "linux-arm64", "win-amd64"}},
+		{"no windows", "buildWindows: false\n", []string{"linux-amd64", "linux-armv7", "linux-arm64", "osx-amd64", "osx-arm64"}},
+		{"linux only", "buildDarwin: false\nbuildWindows: false\n", []string{"linux-amd64", "linux-armv7", "linux-arm64"}},
+		{"listed", "archiveArchitectures: [linux-amd64, osx-arm64]\n", []string{"linux-amd64", "osx-arm64"}},
+		{"listed without darwin", "archiveArchitectures: [linux-amd64, osx-arm64]\nbuildDarwin: false\n", []string{"linux-amd64"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			in, err := ReadInManifest(writeTempFile(t, "manifest.yaml", baseManifest+tc.extra))
+			if err != nil {
+				t.Fatal(err)
+			}
+			in.Directory = t.TempDir()
+			m, err := InputManifestToManifest(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := m.GetArchiveArchitectures(); !reflect.DeepEqual(got, tc.expected) {
+				t.Fatalf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestBuildOperator(t *testing.T) {
+	defaults := slices.Clone(model.DefaultDockerImages)
+	cases := []struct {
+		name   string
+		extra  string
+		images []string
+	}{
+		{
+			"disabled",
+			"",
+			model.DefaultDockerImages,
+		},
+		{
+			"enabled",
+			"buildOperator: true\n",
+			append(append([]string{}, model.DefaultDockerImages...), model.OperatorDockerImages...),
+		},
+		{
+			"enabled with image listed",
+			"buildOperator: true\ndockerImages: [pilot-debug, operator-debug]\n",
+			[]string{"pilot-debug", "operator-debug", "operator-distroless"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			in, err := ReadInManifest(writeTempFile(t, "manifest.yaml", baseManifest+tc.extra))
+			if err != nil {
+				t.Fatal(err)
+			}
+			in.Directory = t.TempDir()
+			m, err := InputManifestToManifest(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(m.DockerImages, tc.images) {
+				t.Fatalf("expected images %v, got %v", tc.images, m.DockerImages)
+			}
+		})
+	}
+	if !reflect.DeepEqual(model.DefaultDockerImages, defaults) {
+		t.Fatalf("default docker images were modified: %v", model.DefaultDockerImages)
+	}
+}
+
+func TestDockerVariants(t *testing.T) {
+	cases := []struct {
+		name      string
+		extra     string
+		images    []string
+		expectErr bool
+	}{
+		{
+			"default",
+			"dockerImages: [pilot-debug, pilot-distroless, install-cni-debug]\n",
+			[]string{"pilot-debug", "pilot-distroless", "install-cni-debug"},
+			false,
+		},
+		{
+			"ubi added",
+			"dockerImages: [pilot-debug, pilot-distroless, install-cni-debug]\ndockerVariants: [debug, distroless, ubi]\n",
+			[]string{"pilot-debug", "pilot-distroless", "install-cni-debug", "pilot-ubi", "install-cni-ubi"},
+			false,
+		},
+		{
+			"ubi only",
+			"dockerImages: [pilot-debug, pilot-distroless]\ndockerVariants: [ubi]\n",
+			[]string{"pilot-ubi"},
+			false,
+		},
+		{
+			"invalid variant",
+			"dockerVariants: [ubi-9]\n",
+			nil,
+			true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			in, err := ReadInManifest(writeTempFile(t, "manifest.yaml", baseManifest+tc.extra))
+			if err != nil {
+				t.Fatal(err)
+			}
+			in.Directory = t.TempDir()
+			m, err := InputManifestToManifest(in)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(m.DockerImages, tc.images) {
+				t.Fatalf("expected images %v, got %v", tc.images, m.DockerImages)
+			}
+		})
+	}
+}
+
+func TestAmbient(t *testing.T) {
+	cases := []struct {
+		name      string
+		extra     string
+		ztunnel   bool
+		expectErr bool
+	}{
+		{"default", "", true, false},
+		{"enabled", "ambient: true\n", true, false},
+		{"disabled", "ambient: false\n", false, false},
+		{"disabled with ztunnel listed", "ambient: false\ndockerImages: [pilot-debug, ztunnel-debug]\n", false, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			in, err := ReadInManifest(writeTempFile(t, "manifest.yaml", baseManifest+tc.extra))
+			if err != nil {
+				t.Fatal(err)
+			}
+			in.Directory = t.TempDir()
+			m, err := InputManifestToManifest(in)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			ztunnel := false
+			for _, image := range m.DockerImages {
+				ztunnel = ztunnel || model.IsAmbientImage(image)
+			}
+			if ztunnel != tc.ztunnel || m.SkipAmbient == tc.ztunnel {
+				t.Fatalf("expected ztunnel images %v, got images %v and skipAmbient %v", tc.ztunnel, m.DockerImages, m.SkipAmbient)
+			}
+		})
+	}
+	if !slices.Contains(model.DefaultDockerImages, "ztunnel-debug") {
+		t.Fatalf("default docker images were modified: %v", model.DefaultDockerImages)
+	}
+}
+
+func TestDockerExtraTargets(t *testing.T) {
+	cases := []struct {
+		name      string
+		extra     string
+		images    []string
+		expectErr bool
+	}{
+		{"none", "", []string{"pilot-debug", "pilot-distroless"}, false},
+		{
+			"extra target",
+			"dockerExtraTargets:\n- target: docker.wasm-plugin\n  images: [wasm-plugin-distroless]\n",
+			[]string{"pilot-debug", "pilot-distroless", "wasm-plugin-distroless"},
+			false,
+		},
+		{"missing images", "dockerExtraTargets:\n- target: docker.wasm-plugin\n", nil, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			in, err := ReadInManifest(writeTempFile(t, "manifest.yaml", baseManifest+"dockerImages: [pilot-debug, pilot-distroless]\n"+tc.extra))
+			if err != nil {
+				t.Fatal(err)
+			}
+			in.Directory = t.TempDir()
+			m, err := InputManifestToManifest(in)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(m.DockerImages, tc.images) {
+				t.Fatalf("expected images %v, got %v", tc.images, m.DockerImages)
+			}
+		})
+	}
+}
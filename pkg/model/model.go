@@ -15,8 +15,18 @@
 package model
 
 import (
+	"compress/gzip"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
 	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	yaml "sigs.k8s.io/yaml/goyaml.v3"
 )
 
 type (
@@ -42,21 +52,45 @@ const (
 	ProxyWorkspace string = "proxy_workspace"
 )
 
+// BuildStep identifies a single step of the build
+type BuildStep string
+
+const (
+	// StepDocker builds the docker images
+	StepDocker BuildStep = "docker"
+	// StepHelm packages the helm charts
+	StepHelm BuildStep = "helm"
+	// StepPackages builds the deb and rpm packages
+	StepPackages BuildStep = "packages"
+	// StepArchive builds the release archives and istioctl
+	StepArchive BuildStep = "archive"
+	// StepGrafana packages the grafana dashboards
+	StepGrafana BuildStep = "grafana"
+	// StepMetadata bundles the sources, and writes the manifest, release notes and istioctl download script
+	StepMetadata BuildStep = "metadata"
+	// StepLicenses bundles the licenses of all dependencies
+	StepLicenses BuildStep = "licenses"
+	// StepSbom generates the software bill of materials
+	StepSbom BuildStep = "sbom"
+	// StepIndex writes the release index, describing the output of all other steps
+	StepIndex BuildStep = "index"
+)
+
 // Dependency defines a git dependency for the build
 type Dependency struct {
 	// Git repository to pull from. Required if branch or sha is set
-	Git string `json:"git,omitempty"`
+	Git string `json:"git,omitempty" yaml:"git,omitempty"`
 	// Checkout the git branch
-	Branch string `json:"branch,omitempty"`
+	Branch string `json:"branch,omitempty" yaml:"branch,omitempty"`
 	// Checkout the git SHA
-	Sha string `json:"sha,omitempty"`
+	Sha string `json:"sha,omitempty" yaml:"sha,omitempty"`
 	// Copy the local path. Note this still needs to be a git repo.
-	LocalPath string `json:"localpath,omitempty"`
+	LocalPath string `json:"localpath,omitempty" yaml:"localpath,omitempty"`
 	// Auto will fetch the SHA to use based on other repos. Currently this supports reading
 	// istio.deps from istio/istio only.
-	Auto string `json:"auto,omitempty"`
+	Auto string `json:"auto,omitempty" yaml:"auto,omitempty"`
 	// If true, go version semantic will be used for tagging the git repo, e.g. v1.2.3.
-	GoVersionEnabled bool `json:"goversionenabled,omitempty"`
+	GoVersionEnabled bool `json:"goversionenabled,omitempty" yaml:"goversionenabled,omitempty"`
 }
 
 // Ref returns the git reference of a dependency.
@@ -111,47 +145,414 @@ func (i IstioDependencies) MarshalJSON() ([]byte, error) {
 	return json.Marshal(deps)
 }
 
-func (i *IstioDependencies) Set(repo string, dependency Dependency) {
-	dp := i.Get()[repo]
-	*dp = dependency
+// MarshalYAML writes the complete dependencies in the order they are declared. Unlike MarshalJSON, which
+// exposes just the SHA for the release output, this allows an input manifest to be read, modified, and written back.
+func (i IstioDependencies) MarshalYAML() (interface{}, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	deps := i.Get()
+	for _, repo := range dependencyNames {
+		dep := deps[repo]
+		if dep == nil {
+			continue
+		}
+		value := &yaml.Node{}
+		if err := value.Encode(dep); err != nil {
+			return nil, fmt.Errorf("failed to encode dependency %v: %v", repo, err)
+		}
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: repo}, value)
+	}
+	return node, nil
+}
+
+// Set replaces the dependency for a repo. A nil dependency removes it.
+func (i *IstioDependencies) Set(repo string, dep *Dependency) error {
+	field := i.field(repo)
+	if field == nil {
+		return fmt.Errorf("unknown dependency: %v", repo)
+	}
+	*field = dep
+	return nil
+}
+
+// dependencyNames lists all dependencies in the order they are declared in IstioDependencies
+var dependencyNames = []string{
+	"istio", "api", "proxy", "ztunnel", "client-go", "test-infra", "tools", "envoy", "enhancements", "release-builder", "common-files",
+}
+
+// field returns the struct field holding the dependency for a repo, or nil if the repo is unknown
+func (i *IstioDependencies) field(repo string) **Dependency {
+	switch repo {
+	case "istio":
+		return &i.Istio
+	case "api":
+		return &i.Api
+	case "proxy":
+		return &i.Proxy
+	case "ztunnel":
+		return &i.Ztunnel
+	case "client-go":
+		return &i.ClientGo
+	case "test-infra":
+		return &i.TestInfra
+	case "tools":
+		return &i.Tools
+	case "envoy":
+		return &i.Envoy
+	case "enhancements":
+		return &i.Enhancements
+	case "release-builder":
+		return &i.ReleaseBuilder
+	case "common-files":
+		return &i.CommonFiles
+	}
+	return nil
 }
 
 type DockerOutput string
 
+// The docker output mode is recorded in the release manifest, so validation knows where to find the images.
 const (
-	// DockerOutputTar outputs docker images to tar files on disk
+	// DockerOutputTar outputs docker images to tar files on disk, under docker/ in the release
 	DockerOutputTar DockerOutput = "tar"
-	// DockerOutputContext loads docker images into the local docker context
+	// DockerOutputContext loads docker images into the local docker context. No images are written to
+	// the release, and no SBOM is produced.
 	DockerOutputContext DockerOutput = "context"
 )
 
+// ArtifactCategory is a kind of artifact written to its own directory of the release
+type ArtifactCategory string
+
+const (
+	DockerArtifacts  ArtifactCategory = "docker"
+	HelmArtifacts    ArtifactCategory = "helm"
+	GrafanaArtifacts ArtifactCategory = "grafana"
+	LicenseArtifacts ArtifactCategory = "licenses"
+	DebianArtifacts  ArtifactCategory = "deb"
+	RpmArtifacts     ArtifactCategory = "rpm"
+)
+
+// ArtifactCategories are all categories whose directory can be set by the manifest layout. By default, each is written
+// to a directory of the same name.
+var ArtifactCategories = []ArtifactCategory{
+	DockerArtifacts, HelmArtifacts, GrafanaArtifacts, LicenseArtifacts, DebianArtifacts, RpmArtifacts,
+}
+
+// ArchiveArchitectures are all platforms a release archive, with its own istioctl, can be built for
+var ArchiveArchitectures = []string{"linux-amd64", "linux-armv7", "linux-arm64", "osx-amd64", "osx-arm64", "win-amd64"}
+
+// ValidatedArchiveArchitecture is the archive architecture whose istioctl validation runs, so every release builds it
+const ValidatedArchiveArchitecture = "linux-amd64"
+
+// DefaultDockerImages are the docker images, including their variant, built when the manifest does not specify any.
+var DefaultDockerImages = []string{
+	"pilot-distroless",
+	"pilot-debug",
+	"install-cni-debug",
+	"ztunnel-debug",
+	"ztunnel-distroless",
+	"proxyv2-debug",
+	"proxyv2-distroless",
+}
+
+// DockerTarget is an additional make target run by the docker build, and the images it produces
+type DockerTarget struct {
+	// Target is the make target in the istio repo, such as docker.wasm-plugin
+	Target string `json:"target" yaml:"target,omitempty"`
+	// Images are the images, including their variant, the target writes to the docker output directory. As for other
+	// images, one is expected for every architecture.
+	Images []string `json:"images" yaml:"images,omitempty"`
+}
+
+// LicensePolicy decides which licenses dependencies may have. Licenses are SPDX identifiers, and may be glob patterns
+// such as GPL-*.
+type LicensePolicy struct {
+	// Allowed are the only licenses dependencies may have. If empty, any license not denied is allowed.
+	Allowed []string `json:"allowed,omitempty" yaml:"allowed,omitempty"`
+	// Denied are licenses no dependency may have
+	Denied []string `json:"denied,omitempty" yaml:"denied,omitempty"`
+	// AllowUnknown permits dependencies whose license the SBOM could not determine
+	AllowUnknown bool `json:"allowUnknown,omitempty" yaml:"allowUnknown,omitempty"`
+}
+
+// CosignSigning configures the cosign blob signatures of the release archives. Each archive is signed with a key, or,
+// if no key is set, keyless, with a certificate issued for the OIDC identity of the build.
+type CosignSigning struct {
+	// Key is the cosign private key, as passed to `cosign sign-blob --key`. This may be a file, or a KMS URI such as
+	// gcpkms://... or hashivault://... The password of a key file is read from COSIGN_PASSWORD. The public key is
+	// written to the release as CosignPublicKeyFile.
+	Key string `json:"key,omitempty" yaml:"key,omitempty"`
+	// Identity and Issuer are the certificate identity and OIDC issuer keyless signatures are verified against.
+	// Both are required for keyless signing.
+	Identity string `json:"identity,omitempty" yaml:"identity,omitempty"`
+	Issuer   string `json:"issuer,omitempty" yaml:"issuer,omitempty"`
+}
+
+// Keyless returns whether archives are signed keyless, rather than with a key
+func (c CosignSigning) Keyless() bool {
+	return c.Key == ""
+}
+
+// VerificationKey returns the key signatures can be verified with from the manifest alone. This is only the case for a
+// KMS URI, as cosign reads its public key from the KMS; a key file is private to the build, so "" is returned.
+func (c CosignSigning) VerificationKey() string {
+	if strings.Contains(c.Key, "://") {
+		return c.Key
+	}
+	return ""
+}
+
+// CosignPublicKeyFile is the name of the public key of the cosign key the archives are signed with, in the release
+const CosignPublicKeyFile = "cosign.pub"
+
+// ArchiveManifestsDir is the directory of the release archive holding the charts and profiles istioctl installs from.
+// It mirrors the layout of the istio repo, which the build copies them from.
+const ArchiveManifestsDir = "manifests"
+
+// ArchiveChartsDir is the directory of the release archive holding the charts
+const ArchiveChartsDir = ArchiveManifestsDir + "/charts"
+
+// ArchiveProfilesDir is the directory of the release archive holding the installation profiles
+const ArchiveProfilesDir = ArchiveManifestsDir + "/profiles"
+
+// ArchiveDefaultProfile is the path of the default profile in the release archive
+const ArchiveDefaultProfile = ArchiveProfilesDir + "/default.yaml"
+
+// ToolsArchiveDirs are the directories of the release archive included in the istio-tools archive
+var ToolsArchiveDirs = []string{"bin", "tools", "samples"}
+
+// SignedArchivePatterns match the names of the release archives signed with cosign: the istio, istio-tools and
+// istioctl archives of each architecture. The checksum files of each archive are signed as well.
+var SignedArchivePatterns = []string{"istio-*.tar.gz", "istio-*.tar", "istio-*.zip", "istioctl-*.tar.gz", "istioctl-*.tar", "istioctl-*.zip"}
+
+// StorageType is a backend release artifacts can be published to
+type StorageType string
+
+const (
+	StorageGCS   StorageType = "gcs"
+	StorageS3    StorageType = "s3"
+	StorageLocal StorageType = "local"
+)
+
+// ArtifactStorage is where release artifacts are published
+type ArtifactStorage struct {
+	// Type is the storage backend
+	Type StorageType `json:"type" yaml:"type,omitempty"`
+	// Bucket is the bucket, optionally followed by a path prefix, such as istio-release/releases. For local storage,
+	// it is the directory releases are copied to.
+	Bucket string `json:"bucket" yaml:"bucket,omitempty"`
+	// URL is the public URL of the bucket. If unset, it is derived from the bucket.
+	URL string `json:"url,omitempty" yaml:"url,omitempty"`
+}
+
+// GetURL returns the public URL of the storage, under which each release is published in a directory of its version
+func (s ArtifactStorage) GetURL() string {
+	if s.URL != "" {
+		return s.URL
+	}
+	switch s.Type {
+	case StorageGCS:
+		return "https://storage.googleapis.com/" + s.Bucket
+	case StorageS3:
+		bucket, prefix, _ := strings.Cut(s.Bucket, "/")
+		return strings.TrimSuffix(fmt.Sprintf("https://%s.s3.amazonaws.com/%s", bucket, prefix), "/")
+	default:
+		return "file://" + s.Bucket
+	}
+}
+
+// DefaultDockerVariants are the base image variants docker images are built in when the manifest does not specify any
+var DefaultDockerVariants = []string{"debug", "distroless"}
+
+// SplitImageVariant splits an image, such as pilot-distroless, into its name and variant. The variant is empty if
+// the image does not end with any of the variants.
+func SplitImageVariant(image string, variants []string) (string, string) {
+	for _, v := range variants {
+		if name, f := strings.CutSuffix(image, "-"+v); f {
+			return name, v
+		}
+	}
+	return image, ""
+}
+
+// IsAmbientImage returns true if an image, including its variant, is only used by ambient mode
+func IsAmbientImage(image string) bool {
+	return image == "ztunnel" || strings.HasPrefix(image, "ztunnel-")
+}
+
+// OperatorDockerImages are the docker images, including their variant, added when the manifest sets BuildOperator.
+var OperatorDockerImages = []string{"operator-debug", "operator-distroless"}
+
+// DefaultReleaseURL is the base URL releases are published to when the manifest does not specify one
+const DefaultReleaseURL = "https://storage.googleapis.com/istio-release/releases"
+
+// ImageLockFile is the name of the image lock in the release root, an ImageLock in JSON
+const ImageLockFile = "images.lock"
+
+// ImageLock pins each docker image built by the release to its image ID
+type ImageLock struct {
+	// Images are the locked images of each architecture, sorted by reference
+	Images []LockedImage `json:"images"`
+}
+
+// LockedImage pins the reference a docker image is tagged with by the build to its image ID
+type LockedImage struct {
+	// Image is the reference, such as docker.io/istio/pilot:1.2.3-distroless-arm64
+	Image string `json:"image"`
+	// ImageID is the digest of the image config, sha256:<hex>. This is not a registry manifest digest, which is only
+	// known once the image is pushed, so it cannot be used as <image>@<digest>.
+	ImageID string `json:"imageID"`
+}
+
+// DownloadScriptFile is the name of the script, in the release root, installing the istioctl of the release
+const DownloadScriptFile = "downloadIstioctl.sh"
+
+// HelmRepoIndexFile is the name of the helm repo index in the helm artifact directory
+const HelmRepoIndexFile = "index.yaml"
+
+// DefaultGzipLevel is the compression level of the gzip archives written by the build, if the manifest does not set one
+const DefaultGzipLevel = gzip.BestCompression
+
+// DefaultLicenseRepos are the repos whose licenses must be bundled when the manifest does not specify any.
+var DefaultLicenseRepos = []string{"istio", "client-go", "tools", "test-infra", "release-builder"}
+
 // Manifest defines what is in a release
 type InputManifest struct {
 	// Dependencies declares all git repositories used to build this release
-	Dependencies IstioDependencies `json:"dependencies"`
+	Dependencies IstioDependencies `json:"dependencies" yaml:"dependencies,omitempty"`
 	// Version specifies what version of Istio this release is
-	Version string `json:"version"`
+	Version string `json:"version" yaml:"version,omitempty"`
 	// Docker specifies the docker hub to use in the helm charts.
-	Docker string `json:"docker"`
+	Docker string `json:"docker" yaml:"docker,omitempty"`
 	// DockerOutput specifies where docker images are written.
-	DockerOutput DockerOutput `json:"dockerOutput"`
+	DockerOutput DockerOutput `json:"dockerOutput" yaml:"dockerOutput,omitempty"`
+	// DockerImages defines the docker images, including their variant, to build. Example: []string{"pilot-distroless"}.
+	// If unset, DefaultDockerImages is used.
+	DockerImages []string `json:"dockerImages" yaml:"dockerImages,omitempty"`
 	// Architectures defines the architectures to build for.
 	// Note: this impacts only docker and deb/rpm; istioctl is always built in additional platforms.
 	// Example: []string{"linux/amd64", "linux/arm64"}.
-	Architectures []string `json:"architectures"`
+	Architectures []string `json:"architectures" yaml:"architectures,omitempty"`
 	// Directory defines the base working directory for the release.
 	// This is excluded from the final serialization
-	Directory string `json:"directory"`
+	Directory string `json:"directory" yaml:"directory,omitempty"`
 	// ProxyOverride specifies a URL to an Envoy binary to use instead of the default proxy
 	// The binary will be pulled from `$proxyOverride/envoy-alpha-SHA.tar.gz`
-	ProxyOverride string `json:"proxyOverride"`
+	ProxyOverride string `json:"proxyOverride" yaml:"proxyOverride,omitempty"`
+	// ProxyOverrideMirrors are URLs serving the same Envoy binaries as ProxyOverride. The first of ProxyOverride and
+	// its mirrors serving the binaries for every architecture is used.
+	ProxyOverrideMirrors []string `json:"proxyOverrideMirrors" yaml:"proxyOverrideMirrors,omitempty"`
 	// BuildOutputs defines what components to build. This allows building only some components.
-	BuildOutputs []string `json:"outputs"`
-	// GrafanaDashboards defines a mapping of dashboard name -> ID of the dashboard on grafana.com
-	GrafanaDashboards map[string]int `json:"dashboards"`
+	BuildOutputs []string `json:"outputs" yaml:"outputs,omitempty"`
+	// GrafanaDashboards defines a mapping of dashboard name -> ID of the dashboard on grafana.com. Every dashboard must
+	// have an ID.
+	GrafanaDashboards map[string]int `json:"dashboards" yaml:"dashboards,omitempty"`
+	// FetchGrafanaDashboards flag determines if the dashboards are downloaded, rather than taken from the istio repo.
+	// Each dashboard is downloaded from its URL in GrafanaDashboardURLs, or otherwise the latest revision of its ID on
+	// grafana.com.
+	FetchGrafanaDashboards bool `json:"fetchDashboards" yaml:"fetchDashboards,omitempty"`
+	// GrafanaDashboardURLs maps a dashboard of GrafanaDashboards to the URL it is downloaded from, if
+	// FetchGrafanaDashboards is set
+	GrafanaDashboardURLs map[string]string `json:"dashboardURLs" yaml:"dashboardURLs,omitempty"`
 	// BillOfMaterials flag determines if a Bill of Materials should be produced
 	// by the build.
-	SkipGenerateBillOfMaterials bool `json:"skipGenerateBillOfMaterials"`
+	SkipGenerateBillOfMaterials bool `json:"skipGenerateBillOfMaterials" yaml:"skipGenerateBillOfMaterials,omitempty"`
+	// LicenseRepos defines the dependencies whose licenses must be bundled in the release.
+	// If unset, DefaultLicenseRepos is used.
+	LicenseRepos []string `json:"licenseRepos" yaml:"licenseRepos,omitempty"`
+	// PreviousManifest specifies the path to the manifest.yaml of the previous release. Release notes
+	// include the commits of each dependency since this release.
+	PreviousManifest string `json:"previousManifest" yaml:"previousManifest,omitempty"`
+	// EmbedBuildInfo flag determines if a build-info.json, describing how the release was built, is
+	// included in the release archive.
+	EmbedBuildInfo bool `json:"embedBuildInfo" yaml:"embedBuildInfo,omitempty"`
+	// SkipBuildTimestamp flag omits the build timestamp from build-info.json, keeping archives reproducible.
+	SkipBuildTimestamp bool `json:"skipBuildTimestamp" yaml:"skipBuildTimestamp,omitempty"`
+	// AdditionalCompletions flag determines if fish and powershell completions for istioctl are included
+	// in the release archive, in addition to bash and zsh.
+	AdditionalCompletions bool `json:"additionalCompletions" yaml:"additionalCompletions,omitempty"`
+	// ShaAlgorithms defines the checksum files, such as sha256 and sha512, written next to each artifact.
+	// If unset, only sha256 is used.
+	ShaAlgorithms []string `json:"shaAlgorithms" yaml:"shaAlgorithms,omitempty"`
+	// UncompressedArchives flag determines if an uncompressed .tar is written next to each .tar.gz archive
+	UncompressedArchives bool `json:"uncompressedArchives" yaml:"uncompressedArchives,omitempty"`
+	// ArchiveArchitectures defines the platforms, from ArchiveArchitectures, release archives are built for. If unset,
+	// archives are built for all of them. Example: []string{"linux-amd64", "linux-arm64"}.
+	ArchiveArchitectures []string `json:"archiveArchitectures" yaml:"archiveArchitectures,omitempty"`
+	// DockerArchitectures defines the architectures, from Architectures, docker images are built for. This allows
+	// shipping packages and archives for architectures the build host cannot build images for. If unset, images are
+	// built for all Architectures.
+	DockerArchitectures []string `json:"dockerArchitectures" yaml:"dockerArchitectures,omitempty"`
+	// BuildDarwin flag determines if osx release archives are built. Defaults to true.
+	BuildDarwin *bool `json:"buildDarwin" yaml:"buildDarwin,omitempty"`
+	// BuildWindows flag determines if windows release archives are built. Defaults to true.
+	BuildWindows *bool `json:"buildWindows" yaml:"buildWindows,omitempty"`
+	// BuildOperator flag determines if the istio operator image is built. The operator was removed from newer
+	// versions of istio, so this should only be set for versions that still include it.
+	BuildOperator bool `json:"buildOperator" yaml:"buildOperator,omitempty"`
+	// Layout overrides the directory, relative to the release root, each category of artifact is written to.
+	// Example: {docker: images/docker}. Categories not listed use the default layout.
+	Layout map[ArtifactCategory]string `json:"layout" yaml:"layout,omitempty"`
+	// ImageSizeLimits maps docker images, including their variant, to the maximum size in MiB of their compressed
+	// archive. Keys may be glob patterns, such as `*-distroless`. Images without a limit are not checked.
+	ImageSizeLimits map[string]int `json:"imageSizeLimits" yaml:"imageSizeLimits,omitempty"`
+	// ProxyExtensions are the absolute paths of the wasm extensions bundled into the proxyv2 image. Validation fails
+	// if any is missing from a proxyv2 image.
+	ProxyExtensions []string `json:"proxyExtensions" yaml:"proxyExtensions,omitempty"`
+	// ReleaseURL is the base URL releases are published to, with each release under `$releaseURL/$version`.
+	// If set, the build fails if the version is already published there. If unset, DefaultReleaseURL is used.
+	ReleaseURL string `json:"releaseURL" yaml:"releaseURL,omitempty"`
+	// DockerVariants defines the base image variants docker images are built in, such as ubi.
+	// If unset, DefaultDockerVariants is used. Each image is also built in every variant not in DefaultDockerVariants,
+	// and images in a default variant that is not listed are not built.
+	DockerVariants []string `json:"dockerVariants" yaml:"dockerVariants,omitempty"`
+	// Ambient flag determines if the images only used by ambient mode, such as ztunnel, are built. Defaults to true.
+	Ambient *bool `json:"ambient" yaml:"ambient,omitempty"`
+	// ArtifactBillOfMaterials flag determines if an additional SBOM, istio-artifacts.spdx, is produced covering the
+	// contents of the helm charts and the release archives.
+	ArtifactBillOfMaterials bool `json:"artifactBillOfMaterials" yaml:"artifactBillOfMaterials,omitempty"`
+	// DockerExtraTargets are additional make targets run by the docker build, such as one building a custom image.
+	// The images they produce are added to DockerImages.
+	DockerExtraTargets []DockerTarget `json:"dockerExtraTargets" yaml:"dockerExtraTargets,omitempty"`
+	// Storage configures where the publish step uploads the release artifacts. If the ReleaseURL is unset, it is
+	// derived from the storage, so the SBOM namespaces point to where the release is published.
+	Storage *ArtifactStorage `json:"storage" yaml:"storage,omitempty"`
+	// ThirdPartyNotices flag determines if a THIRD_PARTY_NOTICES.txt, listing the license of every dependency in the
+	// source SBOM, is included in the release archive.
+	ThirdPartyNotices bool `json:"thirdPartyNotices" yaml:"thirdPartyNotices,omitempty"`
+	// LicensePolicy restricts the licenses of the dependencies in the source SBOM. The build fails if any dependency
+	// has a license the policy does not allow.
+	LicensePolicy *LicensePolicy `json:"licensePolicy" yaml:"licensePolicy,omitempty"`
+	// ProfileComponents maps components of the default istioctl profile, such as pilot or cni, to whether the profile
+	// must enable them. Components not listed are not checked. If unset, DefaultProfileComponents is used.
+	ProfileComponents map[string]bool `json:"profileComponents" yaml:"profileComponents,omitempty"`
+	// ImageLock flag determines if ImageLockFile, pinning each docker image built by the release to its digest, is
+	// written to the release. This requires the tar docker output.
+	ImageLock bool `json:"imageLock" yaml:"imageLock,omitempty"`
+	// ToolsArchive flag determines if an istio-tools-<version>-<arch> archive, containing only the bin, tools and
+	// samples directories of the release archive, is built for each archive architecture. This is a smaller download
+	// for users that only need istioctl.
+	ToolsArchive bool `json:"toolsArchive" yaml:"toolsArchive,omitempty"`
+	// VerifyImageReproducibility flag determines if the docker images are built a second time, and the build fails
+	// unless both builds produce the same image configs and layers. The build cache is pruned before the second build,
+	// so it builds every layer again. This doubles the time of the docker build, and requires the tar docker output.
+	VerifyImageReproducibility bool `json:"verifyImageReproducibility" yaml:"verifyImageReproducibility,omitempty"`
+	// ImageRenames maps the name of an image built by istio, without its variant, to the name it is shipped with. For
+	// example, {"pilot": "istiod"} ships pilot-distroless as istiod-distroless, tagged <hub>/istiod:<tag>. This
+	// requires the tar docker output.
+	ImageRenames map[string]string `json:"imageRenames" yaml:"imageRenames,omitempty"`
+	// HelmRepoIndex flag determines if HelmRepoIndexFile, indexing the packaged charts, is written to the helm
+	// artifact directory, so the release can be added as a classic helm repo.
+	HelmRepoIndex bool `json:"helmRepoIndex" yaml:"helmRepoIndex,omitempty"`
+	// GzipLevel is the compression level, from 1 (fastest) to 9 (smallest), of the .tar.gz archives written by the
+	// build. The archives are compressed by the builder rather than the host gzip, so the same level produces the same
+	// archives on every build host. If unset, DefaultGzipLevel is used.
+	GzipLevel int `json:"gzipLevel" yaml:"gzipLevel,omitempty"`
+	// CosignSigning, if set, signs each release archive with cosign, writing a .sig signature, and for keyless
+	// signing a .pem certificate, next to it
+	CosignSigning *CosignSigning `json:"cosignSigning" yaml:"cosignSigning,omitempty"`
+	// StripIstioctl flag determines if istioctl is built without its symbol table and debug info, making the archives
+	// notably smaller. The version is still stamped. By default, istioctl is built with debug info for debugging.
+	StripIstioctl bool `json:"stripIstioctl" yaml:"stripIstioctl,omitempty"`
 }
 
 // Manifest defines what is in a release
@@ -164,6 +565,12 @@ type Manifest struct {
 	Docker string `json:"docker"`
 	// DockerOutput specifies where docker images are written.
 	DockerOutput DockerOutput `json:"dockerOutput"`
+	// DockerImages defines the docker images, including their variant, to build. Example: []string{"pilot-distroless"}.
+	// If unset, DefaultDockerImages is used.
+	DockerImages []string `json:"dockerImages"`
+	// CustomDockerImages flag is set if the input manifest lists DockerImages. Only then are the docker make targets
+	// limited to the images; otherwise the istio repo builds its default set.
+	CustomDockerImages bool `json:"customDockerImages"`
 	// Architectures defines the architectures to build for.
 	// Note: this impacts only docker and deb/rpm; istioctl is always built in additional platforms.
 	// Example: []string{"linux/amd64", "linux/arm64"}.
@@ -174,14 +581,299 @@ type Manifest struct {
 	// ProxyOverride specifies a URL to an Envoy binary to use instead of the default proxy
 	// The binary will be pulled from `$proxyOverride/envoy-alpha-SHA.tar.gz`
 	ProxyOverride string `json:"-"`
+	// ProxyOverrideMirrors are URLs serving the same Envoy binaries as ProxyOverride
+	ProxyOverrideMirrors []string `json:"-"`
 	// BuildOutputs defines what components to build. This allows building only some components.
 	BuildOutputs map[BuildOutput]struct{} `json:"-"`
 	// GrafanaDashboards defines a mapping of dashboard name -> ID of the dashboard on grafana.com
 	// Note: this tool is not yet smart enough to create dashboards that do not already exist, it can only update dashboards.
 	GrafanaDashboards map[string]int `json:"dashboards"`
+	// FetchGrafanaDashboards flag determines if the dashboards are downloaded, rather than taken from the istio repo
+	FetchGrafanaDashboards bool `json:"fetchDashboards"`
+	// GrafanaDashboardURLs maps a dashboard to the URL it is downloaded from
+	GrafanaDashboardURLs map[string]string `json:"dashboardURLs,omitempty"`
 	// BillOfMaterials flag determines if a Bill of Materials should be produced
 	// by the build.
 	SkipGenerateBillOfMaterials bool `json:"skipGenerateBillOfMaterials"`
+	// LicenseRepos defines the dependencies whose licenses must be bundled in the release.
+	// If unset, DefaultLicenseRepos is used.
+	LicenseRepos []string `json:"licenseRepos"`
+	// PreviousManifest specifies the path to the manifest.yaml of the previous release. Release notes
+	// include the commits of each dependency since this release.
+	PreviousManifest string `json:"-"`
+	// EmbedBuildInfo flag determines if a build-info.json, describing how the release was built, is
+	// included in the release archive.
+	EmbedBuildInfo bool `json:"embedBuildInfo"`
+	// SkipBuildTimestamp flag omits the build timestamp from build-info.json, keeping archives reproducible.
+	SkipBuildTimestamp bool `json:"skipBuildTimestamp"`
+	// AdditionalCompletions flag determines if fish and powershell completions for istioctl are included
+	// in the release archive, in addition to bash and zsh.
+	AdditionalCompletions bool `json:"additionalCompletions"`
+	// ShaAlgorithms defines the checksum files, such as sha256 and sha512, written next to each artifact.
+	// If unset, only sha256 is used.
+	ShaAlgorithms []string `json:"shaAlgorithms"`
+	// UncompressedArchives flag determines if an uncompressed .tar is written next to each .tar.gz archive
+	UncompressedArchives bool `json:"uncompressedArchives"`
+	// ArchiveArchitectures defines the platforms release archives are built for. If unset, archives are built for all
+	// ArchiveArchitectures.
+	ArchiveArchitectures []string `json:"archiveArchitectures"`
+	// DockerArchitectures defines the architectures docker images are built for. If unset, images are built for all
+	// Architectures.
+	DockerArchitectures []string `json:"dockerArchitectures"`
+	// BuildOperator flag determines if the istio operator image is built. The operator was removed from newer
+	// versions of istio, so this should only be set for versions that still include it.
+	BuildOperator bool `json:"buildOperator"`
+	// Layout overrides the directory, relative to the release root, each category of artifact is written to.
+	// Example: {docker: images/docker}. Categories not listed use the default layout.
+	Layout map[ArtifactCategory]string `json:"layout"`
+	// ImageSizeLimits maps docker images, including their variant, to the maximum size in MiB of their compressed
+	// archive. Keys may be glob patterns, such as `*-distroless`. Images without a limit are not checked.
+	ImageSizeLimits map[string]int `json:"imageSizeLimits"`
+	// ProxyExtensions are the absolute paths of the wasm extensions bundled into the proxyv2 image. Validation fails
+	// if any is missing from a proxyv2 image.
+	ProxyExtensions []string `json:"proxyExtensions"`
+	// ReleaseURL is the base URL releases are published to, with each release under `$releaseURL/$version`.
+	// If set, the build fails if the version is already published there. If unset, DefaultReleaseURL is used.
+	ReleaseURL string `json:"releaseURL"`
+	// DockerVariants defines the base image variants docker images are built in, such as ubi.
+	// If unset, DefaultDockerVariants is used.
+	DockerVariants []string `json:"dockerVariants"`
+	// SkipAmbient flag is set if the images only used by ambient mode, such as ztunnel, are not built
+	SkipAmbient bool `json:"skipAmbient"`
+	// ArtifactBillOfMaterials flag determines if an additional SBOM, istio-artifacts.spdx, is produced covering the
+	// contents of the helm charts and the release archives.
+	ArtifactBillOfMaterials bool `json:"artifactBillOfMaterials"`
+	// DockerExtraTargets are additional make targets run by the docker build. Their images are in DockerImages.
+	DockerExtraTargets []DockerTarget `json:"dockerExtraTargets"`
+	// Storage configures where the publish step uploads the release artifacts
+	Storage *ArtifactStorage `json:"storage,omitempty"`
+	// ThirdPartyNotices flag determines if a THIRD_PARTY_NOTICES.txt, listing the license of every dependency in the
+	// source SBOM, is included in the release archive.
+	ThirdPartyNotices bool `json:"thirdPartyNotices"`
+	// LicensePolicy restricts the licenses of the dependencies in the source SBOM
+	LicensePolicy *LicensePolicy `json:"licensePolicy,omitempty"`
+	// ProfileComponents maps components of the default istioctl profile to whether the profile must enable them
+	ProfileComponents map[string]bool `json:"profileComponents,omitempty"`
+	// ImageLock flag determines if ImageLockFile is written to the release
+	ImageLock bool `json:"imageLock"`
+	// ToolsArchive flag determines if an istio-tools archive is built for each archive architecture
+	ToolsArchive bool `json:"toolsArchive"`
+	// VerifyImageReproducibility flag determines if the docker images are rebuilt to check they are reproducible
+	VerifyImageReproducibility bool `json:"verifyImageReproducibility"`
+	// ImageRenames maps the name of an image built by istio, without its variant, to the name it is shipped with
+	ImageRenames map[string]string `json:"imageRenames,omitempty"`
+	// HelmRepoIndex flag determines if HelmRepoIndexFile is written to the helm artifact directory
+	HelmRepoIndex bool `json:"helmRepoIndex"`
+	// GzipLevel is the compression level of the .tar.gz archives written by the build
+	GzipLevel int `json:"gzipLevel,omitempty"`
+	// CosignSigning configures the cosign signatures of the release archives
+	CosignSigning *CosignSigning `json:"cosignSigning,omitempty"`
+	// StripIstioctl flag determines if istioctl is built without its symbol table and debug info
+	StripIstioctl bool `json:"stripIstioctl"`
+	// BuildSteps are the steps the release was built with. Empty if all steps ran.
+	BuildSteps []BuildStep `json:"buildSteps,omitempty"`
+}
+
+// HasBuildStep returns true if the release was built with the step
+func (m Manifest) HasBuildStep(step BuildStep) bool {
+	return len(m.BuildSteps) == 0 || slices.Contains(m.BuildSteps, step)
+}
+
+// BuildInfo records the provenance of a release archive. It is written as build-info.json in the archive root.
+type BuildInfo struct {
+	// BuilderVersion is the version of the release builder that produced the archive
+	BuilderVersion string `json:"builderVersion"`
+	// Timestamp is the time the archive was built, in RFC 3339 format. Empty if SkipBuildTimestamp is set.
+	Timestamp string `json:"timestamp,omitempty"`
+	// Host is the hostname of the machine that produced the archive
+	Host string `json:"host"`
+	// Dependencies maps each dependency to the git SHA it was built from
+	Dependencies map[string]string `json:"dependencies"`
+}
+
+// ReleaseIndexSchemaVersion is the version of the ReleaseIndex format. It is incremented on incompatible changes.
+const ReleaseIndexSchemaVersion = 1
+
+// ReleaseIndex describes every artifact of a release. It is written as release-index.json in the release.
+type ReleaseIndex struct {
+	SchemaVersion int `json:"schemaVersion"`
+	// Manifest is the manifest the release was built from
+	Manifest Manifest `json:"manifest"`
+	// Dependencies maps each dependency to the git SHA it was built from
+	Dependencies map[string]string `json:"dependencies"`
+	// Artifacts lists every file in the release, other than the index itself, sorted by name
+	Artifacts []ReleaseArtifact `json:"artifacts"`
+}
+
+// ReleaseArtifact is a single file of a release
+type ReleaseArtifact struct {
+	// Name is the path of the file, relative to the release
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	Sha256 string `json:"sha256"`
+}
+
+// DefaultProfileComponents are the components the default istioctl profile enables, and must not enable, if the manifest
+// does not set ProfileComponents
+var DefaultProfileComponents = map[string]bool{
+	"base":    true,
+	"pilot":   true,
+	"cni":     false,
+	"ztunnel": false,
+}
+
+// requiredDependencies are the dependencies every release must declare
+var requiredDependencies = []string{"istio", "api", "proxy", "client-go"}
+
+// packagedChartsRequiredBy returns the options of the manifest which need the helm charts to be packaged
+func (m Manifest) packagedChartsRequiredBy() []string {
+	var needs []string
+	if _, f := m.BuildOutputs[Helm]; f && m.HelmRepoIndex {
+		needs = append(needs, "helmRepoIndex")
+	}
+	if m.ArtifactBillOfMaterials {
+		needs = append(needs, "artifactBillOfMaterials")
+	}
+	return needs
+}
+
+// Validate checks the manifest is well-formed, returning an error listing all problems found.
+func (m Manifest) Validate() error {
+	var errs []error
+	if m.Version == "" {
+		errs = append(errs, errors.New("version is required"))
+	} else if needs := m.packagedChartsRequiredBy(); len(needs) > 0 {
+		// The helm step only warns and skips packaging the charts for a version that is not semver, such as of a dev
+		// build, so it is only rejected if other outputs need the packaged charts
+		if _, err := semver.NewVersion(m.Version); err != nil {
+			errs = append(errs, fmt.Errorf("version %q is not a valid semantic version, required by %v: %v", m.Version, strings.Join(needs, ", "), err))
+		}
+	}
+	if m.Docker == "" {
+		errs = append(errs, errors.New("docker hub is required"))
+	}
+	if len(m.Architectures) == 0 {
+		errs = append(errs, errors.New("at least one architecture is required"))
+	}
+	for _, a := range m.DockerArchitectures {
+		if !slices.Contains(m.Architectures, a) {
+			errs = append(errs, fmt.Errorf("docker architecture %v is not one of the architectures %v", a, m.Architectures))
+		}
+	}
+	for _, a := range m.ArchiveArchitectures {
+		if !slices.Contains(ArchiveArchitectures, a) {
+			errs = append(errs, fmt.Errorf("unknown archive architecture %v, expected one of %v", a, ArchiveArchitectures))
+		}
+	}
+	if len(m.ArchiveArchitectures) > 0 && !slices.Contains(m.ArchiveArchitectures, ValidatedArchiveArchitecture) {
+		errs = append(errs, fmt.Errorf("archive architectures must include %v, which validation runs", ValidatedArchiveArchitecture))
+	}
+	deps := m.Dependencies.Get()
+	for _, repo := range requiredDependencies {
+		if deps[repo] == nil {
+			errs = append(errs, fmt.Errorf("missing required dependency: %v", repo))
+		}
+	}
+	errs = append(errs, m.validateLayout()...)
+	if m.Storage != nil {
+		switch m.Storage.Type {
+		case StorageGCS, StorageS3, StorageLocal:
+		default:
+			errs = append(errs, fmt.Errorf("unknown storage type %q", m.Storage.Type))
+		}
+		if m.Storage.Bucket == "" {
+			errs = append(errs, errors.New("storage bucket is required"))
+		}
+	}
+	if len(m.ProxyOverrideMirrors) > 0 && m.ProxyOverride == "" {
+		errs = append(errs, errors.New("proxy override mirrors require a proxy override"))
+	}
+	if m.ImageLock && m.DockerOutput == DockerOutputContext {
+		errs = append(errs, errors.New("image lock requires the tar docker output"))
+	}
+	if m.VerifyImageReproducibility && m.DockerOutput == DockerOutputContext {
+		errs = append(errs, errors.New("verifying image reproducibility requires the tar docker output"))
+	}
+	if len(m.ImageRenames) > 0 && m.DockerOutput == DockerOutputContext {
+		errs = append(errs, errors.New("image renames require the tar docker output"))
+	}
+	var noID []string
+	for name, id := range m.GrafanaDashboards {
+		if strings.TrimSpace(name) == "" {
+			errs = append(errs, errors.New("grafana dashboard names must not be empty"))
+		} else if id <= 0 {
+			noID = append(noID, name)
+		}
+	}
+	if len(noID) > 0 {
+		sort.Strings(noID)
+		errs = append(errs, fmt.Errorf("grafana dashboards have no grafana.com ID: %v", strings.Join(noID, ", ")))
+	}
+	if len(m.GrafanaDashboardURLs) > 0 && !m.FetchGrafanaDashboards {
+		errs = append(errs, errors.New("dashboard URLs require fetching the dashboards"))
+	}
+	for _, name := range slices.Sorted(maps.Keys(m.GrafanaDashboardURLs)) {
+		if _, f := m.GrafanaDashboards[name]; !f {
+			errs = append(errs, fmt.Errorf("dashboard URL for %v, which is not one of the dashboards", name))
+		}
+	}
+	if m.GzipLevel != 0 && (m.GzipLevel < gzip.BestSpeed || m.GzipLevel > gzip.BestCompression) {
+		errs = append(errs, fmt.Errorf("gzip level %d must be between %d and %d", m.GzipLevel, gzip.BestSpeed, gzip.BestCompression))
+	}
+	if c := m.CosignSigning; c != nil && c.Keyless() && (c.Identity == "" || c.Issuer == "") {
+		errs = append(errs, errors.New("keyless cosign signing requires an identity and issuer"))
+	}
+	for name, renamed := range m.ImageRenames {
+		if renamed == "" || strings.ContainsAny(renamed, "/: \t") {
+			errs = append(errs, fmt.Errorf("invalid name %q for image %v", renamed, name))
+		}
+	}
+	if m.SkipAmbient && m.ProfileComponents["ztunnel"] {
+		errs = append(errs, errors.New("profile components enable ztunnel, but ambient is disabled"))
+	}
+	for pattern, limit := range m.ImageSizeLimits {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Errorf("invalid image size limit pattern %q: %v", pattern, err))
+		}
+		if limit <= 0 {
+			errs = append(errs, fmt.Errorf("image size limit for %v must be positive", pattern))
+		}
+	}
+	for _, ext := range m.ProxyExtensions {
+		if !path.IsAbs(ext) {
+			errs = append(errs, fmt.Errorf("proxy extension %q must be an absolute path", ext))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SplitImage splits an image, such as pilot-distroless, into its name and variant, matching the default and manifest
+// variants
+func (m Manifest) SplitImage(image string) (string, string) {
+	return SplitImageVariant(image, append(append([]string{}, DefaultDockerVariants...), m.DockerVariants...))
+}
+
+// ImageReference returns the reference an image, including its variant, is tagged with in hub for the tag. The debug
+// variant is the default, so it has no tag suffix.
+func (m Manifest) ImageReference(hub, tag, image string) string {
+	name, variant := m.SplitImage(image)
+	if variant != "" && variant != "debug" {
+		tag += "-" + variant
+	}
+	return fmt.Sprintf("%s/%s:%s", hub, name, tag)
+}
+
+// ShippedImage returns the name an image, including its variant, is shipped with, applying ImageRenames
+func (m Manifest) ShippedImage(image string) string {
+	name, variant := m.SplitImage(image)
+	renamed, f := m.ImageRenames[name]
+	if !f {
+		return image
+	}
+	if variant == "" {
+		return renamed
+	}
+	return renamed + "-" + variant
 }
 
 // RepoDir is a helper to return the working directory for a repo
@@ -219,6 +911,86 @@ func (m Manifest) OutDir() string {
 	return path.Join(m.Directory, "out")
 }
 
+// ArtifactDir returns the directory, relative to the release root, a category of artifact is written to
+func (m Manifest) ArtifactDir(category ArtifactCategory) string {
+	if dir, f := m.Layout[category]; f {
+		return path.Clean(dir)
+	}
+	return string(category)
+}
+
+// validateLayout ensures every layout directory is a distinct directory within the release
+func (m Manifest) validateLayout() []error {
+	var errs []error
+	for _, category := range slices.Sorted(maps.Keys(m.Layout)) {
+		dir := m.Layout[category]
+		if !slices.Contains(ArtifactCategories, category) {
+			errs = append(errs, fmt.Errorf("unknown layout category: %v", category))
+			continue
+		}
+		clean := path.Clean(dir)
+		if dir == "" || clean == "." || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			errs = append(errs, fmt.Errorf("layout directory %q for %v must be a directory within the release", dir, category))
+		}
+	}
+	seen := map[string]ArtifactCategory{}
+	for _, category := range ArtifactCategories {
+		dir := m.ArtifactDir(category)
+		if other, f := seen[dir]; f {
+			errs = append(errs, fmt.Errorf("layout directory %q is used by both %v and %v", dir, other, category))
+		}
+		seen[dir] = category
+	}
+	return errs
+}
+
+// GetDockerVariants returns the base image variants docker images are built in
+func (m Manifest) GetDockerVariants() []string {
+	if len(m.DockerVariants) == 0 {
+		// Releases built before the variants were recorded in the manifest
+		return DefaultDockerVariants
+	}
+	return m.DockerVariants
+}
+
+// GetReleaseURL returns the URL this release is published to
+func (m Manifest) GetReleaseURL() string {
+	base := m.ReleaseURL
+	if base == "" && m.Storage != nil {
+		base = m.Storage.GetURL()
+	}
+	if base == "" {
+		base = DefaultReleaseURL
+	}
+	return strings.TrimSuffix(base, "/") + "/" + m.Version
+}
+
+// GetDockerArchitectures returns the architectures docker images are built for
+func (m Manifest) GetDockerArchitectures() []string {
+	if len(m.DockerArchitectures) == 0 {
+		// Releases built before the docker architectures were recorded in the manifest
+		return m.Architectures
+	}
+	return m.DockerArchitectures
+}
+
+// GetGzipLevel returns the compression level of the gzip archives written by the build
+func (m Manifest) GetGzipLevel() int {
+	if m.GzipLevel == 0 {
+		return DefaultGzipLevel
+	}
+	return m.GzipLevel
+}
+
+// GetArchiveArchitectures returns the platforms release archives are built for
+func (m Manifest) GetArchiveArchitectures() []string {
+	if len(m.ArchiveArchitectures) == 0 {
+		// Releases built before the architectures were recorded in the manifest
+		return ArchiveArchitectures
+	}
+	return m.ArchiveArchitectures
+}
+
 // IstioDep identifies a external dependency of Istio.
 type IstioDep struct {
 	Comment       string `json:"_comment,omitempty"`
@@ -0,0 +1,295 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func validManifest() Manifest {
+	return Manifest{
+		Version:       "1.19.0",
+		Docker:        "docker.io/istio",
+		Architectures: []string{"linux/amd64"},
+		Dependencies: IstioDependencies{
+			Istio:    &Dependency{Sha: "a"},
+			Api:      &Dependency{Sha: "b"},
+			Proxy:    &Dependency{Sha: "c"},
+			ClientGo: &Dependency{Sha: "d"},
+		},
+		BuildOutputs: map[BuildOutput]struct{}{Helm: {}},
+	}
+}
+
+func TestManifestValidate(t *testing.T) {
+	cases := []struct {
+		name   string
+		mutate func(m *Manifest)
+		errors []string
+	}{
+		{
+			"valid",
+			func(m *Manifest) {},
+			nil,
+		},
+		{
+			"missing version",
+			func(m *Manifest) { m.Version = "" },
+			[]string{"version is required"},
+		},
+		{
+			"non-semver version with helm",
+			func(m *Manifest) { m.Version = "master" },
+			nil,
+		},
+		{
+			"non-semver version with packaged charts",
+			func(m *Manifest) {
+				m.Version = "master"
+				m.HelmRepoIndex = true
+				m.ArtifactBillOfMaterials = true
+			},
+			[]string{`version "master" is not a valid semantic version, required by helmRepoIndex, artifactBillOfMaterials`},
+		},
+		{
+			"non-semver version without helm",
+			func(m *Manifest) {
+				m.Version = "master"
+				m.BuildOutputs = map[BuildOutput]struct{}{Docker: {}}
+			},
+			nil,
+		},
+		{
+			"missing docker and architectures",
+			func(m *Manifest) {
+				m.Docker = ""
+				m.Architectures = nil
+			},
+			[]string{"docker hub is required", "at least one architecture is required"},
+		},
+		{
+			"docker architectures subset",
+			func(m *Manifest) {
+				m.Architectures = []string{"linux/amd64", "linux/arm64"}
+				m.DockerArchitectures = []string{"linux/arm64"}
+			},
+			nil,
+		},
+		{
+			"unknown docker architecture",
+			func(m *Manifest) { m.DockerArchitectures = []string{"linux/s390x"} },
+			[]string{"docker architecture linux/s390x is not one of the architectures"},
+		},
+		{
+			"archive architectures subset",
+			func(m *Manifest) { m.ArchiveArchitectures = []string{"linux-amd64", "osx-arm64"} },
+			nil,
+		},
+		{
+			"archive architectures without linux-amd64",
+			func(m *Manifest) { m.ArchiveArchitectures = []string{"linux-arm64"} },
+			[]string{"archive architectures must include linux-amd64"},
+		},
+		{
+			"grafana dashboards",
+			func(m *Manifest) { m.GrafanaDashboards = map[string]int{"pilot-dashboard": 7645} },
+			nil,
+		},
+		{
+			"grafana dashboards without ID",
+			func(m *Manifest) {
+				m.GrafanaDashboards = map[string]int{"pilot-dashboard": 7645, "mesh-dashboard": 0, "ztunnel-dashboard": -1, " ": 1}
+			},
+			[]string{"grafana dashboards have no grafana.com ID: mesh-dashboard, ztunnel-dashboard", "grafana dashboard names must not be empty"},
+		},
+		{
+			"dashboard URLs without fetching",
+			func(m *Manifest) {
+				m.GrafanaDashboards = map[string]int{"pilot-dashboard": 7645}
+				m.GrafanaDashboardURLs = map[string]string{"pilot-dashboard": "https://example.com/pilot.json", "mesh-dashboard": "https://example.com/mesh.json"}
+			},
+			[]string{"dashboard URLs require fetching the dashboards", "dashboard URL for mesh-dashboard, which is not one of the dashboards"},
+		},
+		{
+			"cosign key",
+			func(m *Manifest) {
+				m.CosignSigning = &CosignSigning{Key: "gcpkms://projects/p/locations/l/keyRings/r/cryptoKeys/k"}
+			},
+			nil,
+		},
+		{
+			"keyless cosign without identity",
+			func(m *Manifest) {
+				m.CosignSigning = &CosignSigning{Issuer: "https://token.actions.githubusercontent.com"}
+			},
+			[]string{"keyless cosign signing requires an identity and issuer"},
+		},
+		{
+			"invalid gzip level",
+			func(m *Manifest) { m.GzipLevel = 10 },
+			[]string{"gzip level 10 must be between 1 and 9"},
+		},
+		{
+			"invalid storage",
+			func(m *Manifest) { m.Storage = &ArtifactStorage{Type: "ftp"} },
+			[]string{`unknown storage type "ftp"`, "storage bucket is required"},
+		},
+		{
+			"missing dependencies",
+			func(m *Manifest) {
+				m.Dependencies.Proxy = nil
+				m.Dependencies.ClientGo = nil
+			},
+			[]string{"missing required dependency: proxy", "missing required dependency: client-go"},
+		},
+		{
+			"valid layout",
+			func(m *Manifest) { m.Layout = map[ArtifactCategory]string{DockerArtifacts: "images/docker/"} },
+			nil,
+		},
+		{
+			"invalid layout",
+			func(m *Manifest) {
+				m.Layout = map[ArtifactCategory]string{
+					"unknown":        "unknown",
+					HelmArtifacts:    "../helm",
+					RpmArtifacts:     "/rpm",
+					GrafanaArtifacts: "docker",
+				}
+			},
+			[]string{
+				"unknown layout category: unknown",
+				`layout directory "../helm" for helm must be a directory within the release`,
+				`layout directory "/rpm" for rpm must be a directory within the release`,
+				`layout directory "docker" is used by both docker and grafana`,
+			},
+		},
+		{
+			"invalid image size limits",
+			func(m *Manifest) { m.ImageSizeLimits = map[string]int{"[": 10, "pilot-debug": 0} },
+			[]string{`invalid image size limit pattern "["`, "image size limit for pilot-debug must be positive"},
+		},
+		{
+			"relative proxy extension",
+			func(m *Manifest) {
+				m.ProxyExtensions = []string{"/etc/istio/extensions/stats.wasm", "extensions/metadata.wasm"}
+			},
+			[]string{`proxy extension "extensions/metadata.wasm" must be an absolute path`},
+		},
+		{
+			"ztunnel profile component without ambient",
+			func(m *Manifest) {
+				m.SkipAmbient = true
+				m.ProfileComponents = map[string]bool{"ztunnel": true}
+			},
+			[]string{"profile components enable ztunnel, but ambient is disabled"},
+		},
+		{
+			"image lock without tar output",
+			func(m *Manifest) {
+				m.ImageLock = true
+				m.DockerOutput = DockerOutputContext
+			},
+			[]string{"image lock requires the tar docker output"},
+		},
+		{
+			"invalid image renames",
+			func(m *Manifest) {
+				m.ImageRenames = map[string]string{"pilot": "example.com/istiod", "proxyv2": ""}
+				m.DockerOutput = DockerOutputContext
+			},
+			[]string{
+				"image renames require the tar docker output",
+				`invalid name "example.com/istiod" for image pilot`,
+				`invalid name "" for image proxyv2`,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := validManifest()
+			tc.mutate(&m)
+			err := m.Validate()
+			if len(tc.errors) == 0 {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected errors %v, got none", tc.errors)
+			}
+			for _, e := range tc.errors {
+				if !strings.Contains(err.Error(), e) {
+					t.Fatalf("expected error to contain %q, got %v", e, err)
+				}
+			}
+		})
+	}
+}
+
+func TestShippedImage(t *testing.T) {
+	m := Manifest{DockerVariants: []string{"distroless", "debug"}, ImageRenames: map[string]string{"pilot": "istiod"}}
+	cases := map[string]string{
+		"pilot-distroless":   "istiod-distroless",
+		"pilot-debug":        "istiod-debug",
+		"pilot":              "istiod",
+		"proxyv2-distroless": "proxyv2-distroless",
+		"pilotx-distroless":  "pilotx-distroless",
+	}
+	for image, want := range cases {
+		if got := m.ShippedImage(image); got != want {
+			t.Errorf("%v: expected %v, got %v", image, want, got)
+		}
+	}
+}
+
+func TestArtifactDir(t *testing.T) {
+	m := Manifest{Layout: map[ArtifactCategory]string{DockerArtifacts: "images/docker/"}}
+	if got := m.ArtifactDir(DockerArtifacts); got != "images/docker" {
+		t.Fatalf("expected images/docker, got %v", got)
+	}
+	if got := m.ArtifactDir(HelmArtifacts); got != "helm" {
+		t.Fatalf("expected default helm, got %v", got)
+	}
+}
+
+func TestGetReleaseURL(t *testing.T) {
+	cases := []struct {
+		name     string
+		url      string
+		storage  *ArtifactStorage
+		expected string
+	}{
+		{"default", "", nil, DefaultReleaseURL + "/1.20.0"},
+		{"release url", "https://example.com/releases/", nil, "https://example.com/releases/1.20.0"},
+		{"gcs", "", &ArtifactStorage{Type: StorageGCS, Bucket: "istio-release/releases"}, "https://storage.googleapis.com/istio-release/releases/1.20.0"},
+		{"s3", "", &ArtifactStorage{Type: StorageS3, Bucket: "istio-release/releases"}, "https://istio-release.s3.amazonaws.com/releases/1.20.0"},
+		{"s3 bucket root", "", &ArtifactStorage{Type: StorageS3, Bucket: "istio-release"}, "https://istio-release.s3.amazonaws.com/1.20.0"},
+		{"local", "", &ArtifactStorage{Type: StorageLocal, Bucket: "/srv/releases"}, "file:///srv/releases/1.20.0"},
+		{"storage url", "", &ArtifactStorage{Type: StorageS3, Bucket: "b", URL: "https://cdn.example.com"}, "https://cdn.example.com/1.20.0"},
+		{"release url wins", "https://example.com", &ArtifactStorage{Type: StorageGCS, Bucket: "b"}, "https://example.com/1.20.0"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			m := Manifest{Version: "1.20.0", ReleaseURL: tt.url, Storage: tt.storage}
+			if got := m.GetReleaseURL(); got != tt.expected {
+				t.Fatalf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
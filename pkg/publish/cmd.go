@@ -36,6 +36,8 @@ var (
 		s3bucket     string
 		helmbucket   string
 		helmhub      string
+		helmoci      bool
+		helmdryrun   bool
 		s3alias      []string
 		github       string
 		githubtoken  string
@@ -79,6 +81,10 @@ func init() {
 		"The S3 bucket to publish helm to. Example: istio-release/charts.")
 	publishCmd.PersistentFlags().StringVar(&flags.helmhub, "helmhub", flags.helmhub,
 		"The oci registry to publish helm to. Example: gcr.io/istio-release/charts.")
+	publishCmd.PersistentFlags().BoolVar(&flags.helmoci, "helmoci", flags.helmoci,
+		"Publish helm charts as OCI artifacts to --helmhub, or to charts under the manifest docker hub if --helmhub is unset.")
+	publishCmd.PersistentFlags().BoolVar(&flags.helmdryrun, "helmdryrun", flags.helmdryrun,
+		"Log the helm charts that would be published as OCI artifacts, without pushing them.")
 	publishCmd.PersistentFlags().StringSliceVar(&flags.s3alias, "s3aliases", flags.s3alias,
 		"Alias to publish to S3. Example: latest")
 	publishCmd.PersistentFlags().StringVar(&flags.github, "github", flags.github,
@@ -108,13 +114,18 @@ func Publish(manifest model.Manifest) error {
 			return fmt.Errorf("failed to publish to docker: %v", err)
 		}
 	}
+	if manifest.Storage != nil {
+		if err := PublishRelease(manifest); err != nil {
+			return fmt.Errorf("failed to publish to %v storage: %v", manifest.Storage.Type, err)
+		}
+	}
 	if flags.s3bucket != "" {
 		if err := S3Archive(manifest, flags.s3bucket, flags.s3alias); err != nil {
 			return fmt.Errorf("failed to publish to S3: %v", err)
 		}
 	}
-	if flags.helmbucket != "" || flags.helmhub != "" {
-		if err := Helm(manifest, flags.helmbucket, flags.helmhub); err != nil {
+	if flags.helmbucket != "" || flags.helmhub != "" || flags.helmoci {
+		if err := Helm(manifest, flags.helmbucket, flags.helmhub, flags.helmoci, flags.helmdryrun); err != nil {
 			return fmt.Errorf("failed to publish to helm charts: %v", err)
 		}
 	}
@@ -82,7 +82,7 @@ func Docker(manifest model.Manifest, hub string, tags []string, cosignkey string
 	if len(tags) == 0 {
 		tags = []string{manifest.Version}
 	}
-	dockerArchives, err := os.ReadDir(path.Join(manifest.Directory, "docker"))
+	dockerArchives, err := os.ReadDir(path.Join(manifest.Directory, manifest.ArtifactDir(model.DockerArtifacts)))
 	if err != nil {
 		return fmt.Errorf("failed to read docker output of release: %v", err)
 	}
@@ -109,10 +109,10 @@ func Docker(manifest model.Manifest, hub string, tags []string, cosignkey string
 		if !strings.HasSuffix(f.Name(), "tar.gz") {
 			return fmt.Errorf("invalid image found in docker folder: %v", f.Name())
 		}
-		if err := util.VerboseCommand("docker", "load", "-i", path.Join(manifest.Directory, "docker", f.Name())).Run(); err != nil {
+		if err := util.VerboseCommand("docker", "load", "-i", path.Join(manifest.Directory, manifest.ArtifactDir(model.DockerArtifacts), f.Name())).Run(); err != nil {
 			return fmt.Errorf("failed to load docker image %v: %v", f.Name(), err)
 		}
-		imageName, variant, arch := getImageNameVariant(f.Name())
+		imageName, variant, arch := getImageNameVariant(f.Name(), manifest)
 		variants := []string{variant}
 		for _, tag := range tags {
 			for _, variant := range variants {
@@ -277,20 +277,12 @@ func publishManifest(img Image, architectures []string) (string, error) {
 
 // getImageNameVariant determines the name of the image (eg, pilot) and variant (eg, distroless).
 // This is derived from the file name.
-func getImageNameVariant(fname string) (name string, variant string, arch string) {
+func getImageNameVariant(fname string, manifest model.Manifest) (name string, variant string, arch string) {
 	imageName := strings.Split(fname, ".")[0]
 	if match, _ := filepath.Match("*-arm64", imageName); match {
 		arch = "arm64"
 		imageName = strings.TrimSuffix(imageName, "-arm64")
 	}
-	if match, _ := filepath.Match("*-distroless", imageName); match {
-		variant = "distroless"
-		imageName = strings.TrimSuffix(imageName, "-distroless")
-	}
-	if match, _ := filepath.Match("*-debug", imageName); match {
-		variant = "debug"
-		imageName = strings.TrimSuffix(imageName, "-debug")
-	}
-	name = imageName
+	name, variant = manifest.SplitImage(imageName)
 	return
 }
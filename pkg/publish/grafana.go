@@ -32,7 +32,7 @@ import (
 func Grafana(manifest model.Manifest, token string) error {
 	for db, id := range manifest.GrafanaDashboards {
 		url := fmt.Sprintf("https://grafana.com/api/dashboards/%d/revisions", id)
-		dashboard := filepath.Join(manifest.Directory, "grafana", db+".json")
+		dashboard := filepath.Join(manifest.Directory, manifest.ArtifactDir(model.GrafanaArtifacts), db+".json")
 		req, err := fileUploadRequest(url, "json", dashboard)
 		if err != nil {
 			return fmt.Errorf("failed to create request for %v: %v", db, err)
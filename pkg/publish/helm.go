@@ -17,6 +17,7 @@ package publish
 import (
 	"bufio"
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"os"
 	"path"
@@ -37,16 +38,17 @@ var chartSubtypeDir = []string{
 	"samples",
 }
 
-// Helm publishes charts to the given GCS bucket
-func Helm(manifest model.Manifest, bucket string, hub string) error {
+// Helm publishes charts to the given GCS bucket, and as OCI artifacts to the given hub. If oci is set and hub
+// is empty, the OCI hub is derived from the manifest docker hub.
+func Helm(manifest model.Manifest, bucket string, hub string, oci bool, dryrun bool) error {
 	if bucket != "" {
 		if err := publishHelmIndex(manifest, bucket); err != nil {
 			return err
 		}
 	}
 
-	if hub != "" {
-		if err := publishHelmOCI(manifest, hub); err != nil {
+	if hub != "" || oci {
+		if err := PushHelmCharts(manifest, hub, dryrun); err != nil {
 			return err
 		}
 	}
@@ -70,7 +72,22 @@ func publishHelmIndex(manifest model.Manifest, bucket string) error {
 		objectPrefix = splitbucket[1]
 	}
 
-	helmPublishRoot := filepath.Join(manifest.Directory, "helm")
+	helmPublishRoot := filepath.Join(manifest.Directory, manifest.ArtifactDir(model.HelmArtifacts))
+
+	// The offline index of the release has relative chart URLs, so it must not be merged into the published index, and
+	// the published index must not overwrite it. The published index is generated in a copy of the charts instead.
+	tmpDir, err := os.MkdirTemp("", "helm-index")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	indexRoot := filepath.Join(tmpDir, "helm")
+	if err := util.CopyDir(helmPublishRoot, indexRoot); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(filepath.Join(indexRoot, model.HelmRepoIndexFile)); err != nil {
+		return err
+	}
 
 	// Pull down the index, update it, and push it back up.
 	// MutateObject ensures there are no races.
@@ -78,17 +95,17 @@ func publishHelmIndex(manifest model.Manifest, bucket string) error {
 	// Note that `helm repo index` will index charts in subdirectories as well, which
 	// is desired behavior here - we will have to push them separately however,
 	// so the index matches the bucket contents.
-	err = MutateObject(helmPublishRoot, client, bucket, objectPrefix, "index.yaml", func() error {
-		dumpIndexFile(filepath.Join(helmPublishRoot, "index.yaml"), "before")
+	err = MutateObject(indexRoot, client, bucket, objectPrefix, "index.yaml", func() error {
+		dumpIndexFile(filepath.Join(indexRoot, "index.yaml"), "before")
 		idxCmd := util.VerboseCommand("helm", "repo", "index", ".",
 			"--url", fmt.Sprintf("https://%s.storage.googleapis.com/%s", bucketName, objectPrefix),
 			"--merge", "index.yaml")
-		idxCmd.Dir = helmPublishRoot
+		idxCmd.Dir = indexRoot
 		log.Infof("Running helm repo index with dir %v", idxCmd.Dir)
 		if err := idxCmd.Run(); err != nil {
 			return fmt.Errorf("index repo: %v", err)
 		}
-		dumpIndexFile(filepath.Join(helmPublishRoot, "index.yaml"), "after")
+		dumpIndexFile(filepath.Join(indexRoot, "index.yaml"), "after")
 		return nil
 	})
 	if err != nil {
@@ -183,17 +200,30 @@ func dumpIndex(data []byte, context string) {
 	log.Infof("index.yaml contents %v: %v", context, versions)
 }
 
-func publishHelmOCI(manifest model.Manifest, hub string) error {
-	helmPublishRoot := filepath.Join(manifest.Directory, "helm")
+// PushHelmCharts pushes all packaged charts as OCI artifacts to the given hub, then verifies each pushed chart
+// is identical to the local package. If hub is empty, the charts are pushed to `charts` under the manifest docker hub.
+// Registry credentials may be passed with HELM_REGISTRY_USERNAME and HELM_REGISTRY_PASSWORD; otherwise the
+// existing helm registry login is used.
+func PushHelmCharts(manifest model.Manifest, hub string, dryrun bool) error {
+	if hub == "" {
+		hub = path.Join(manifest.Docker, "charts")
+	}
+	if !dryrun {
+		if err := helmRegistryLogin(hub); err != nil {
+			return err
+		}
+	}
+
+	helmPublishRoot := filepath.Join(manifest.Directory, manifest.ArtifactDir(model.HelmArtifacts))
 
 	// Now push all the packaged charts in the helm root directory up
-	if err := pushChartsInDirOCI(helmPublishRoot, hub); err != nil {
+	if err := pushChartsInDirOCI(manifest, helmPublishRoot, hub, dryrun); err != nil {
 		return err
 	}
 
 	// For any packaged charts in "chart subtype" subdirectories ("samples" etc), push those up
 	for _, chartType := range chartSubtypeDir {
-		if err := pushChartsInDirOCI(filepath.Join(helmPublishRoot, chartType), path.Join(hub, chartType)); err != nil {
+		if err := pushChartsInDirOCI(manifest, filepath.Join(helmPublishRoot, chartType), path.Join(hub, chartType), dryrun); err != nil {
 			return err
 		}
 	}
@@ -201,7 +231,22 @@ func publishHelmOCI(manifest model.Manifest, hub string) error {
 	return nil
 }
 
-func pushChartsInDirOCI(packagedChartOutputDir, hub string) error {
+// helmRegistryLogin logs in to the registry of the hub, if credentials are set in the environment
+func helmRegistryLogin(hub string) error {
+	username := os.Getenv("HELM_REGISTRY_USERNAME")
+	if username == "" {
+		return nil
+	}
+	registry, _, _ := strings.Cut(hub, "/")
+	cmd := util.VerboseCommand("helm", "registry", "login", registry, "--username", username, "--password-stdin")
+	cmd.Stdin = strings.NewReader(os.Getenv("HELM_REGISTRY_PASSWORD"))
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to login to helm registry %v: %v", registry, err)
+	}
+	return nil
+}
+
+func pushChartsInDirOCI(manifest model.Manifest, packagedChartOutputDir, hub string, dryrun bool) error {
 	dirInfo, err := os.ReadDir(packagedChartOutputDir)
 	if err != nil {
 		return err
@@ -212,9 +257,50 @@ func pushChartsInDirOCI(packagedChartOutputDir, hub string) error {
 			continue
 		}
 		name := filepath.Join(packagedChartOutputDir, f.Name())
+		if dryrun {
+			log.Infof("Dry run: skipping push of %v to oci://%v", name, hub)
+			continue
+		}
 		if err := util.VerboseCommand("helm", "push", name, "oci://"+hub).Run(); err != nil {
-			return fmt.Errorf("failed to load docker image %v: %v", f.Name(), err)
+			return fmt.Errorf("failed to push helm chart %v: %v", f.Name(), err)
+		}
+		chart := strings.TrimSuffix(f.Name(), "-"+manifest.Version+".tgz")
+		if err := verifyChartOCI(name, "oci://"+path.Join(hub, chart), manifest.Version); err != nil {
+			return fmt.Errorf("failed to verify helm chart %v: %v", f.Name(), err)
 		}
 	}
 	return nil
 }
+
+// verifyChartOCI pulls a pushed chart back from the registry, and checks its digest matches the local package
+func verifyChartOCI(local, ref, version string) error {
+	tmpDir, err := os.MkdirTemp("", "helm-verify")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	if err := util.VerboseCommand("helm", "pull", ref, "--version", version, "--destination", tmpDir).Run(); err != nil {
+		return fmt.Errorf("failed to pull %v: %v", ref, err)
+	}
+	want, err := fileDigest(local)
+	if err != nil {
+		return err
+	}
+	got, err := fileDigest(filepath.Join(tmpDir, filepath.Base(local)))
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("digest of %v is %v, expected %v", ref, got, want)
+	}
+	log.Infof("Verified %v has digest %v", ref, got)
+	return nil
+}
+
+func fileDigest(file string) (string, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %v: %v", file, err)
+	}
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(b)), nil
+}
@@ -45,8 +45,7 @@ func NewS3Client(ctx context.Context) (*s3.Client, error) {
 
 // S3Archive publishes the final release archive to the given GCS bucket
 func S3Archive(manifest model.Manifest, bucket string, aliases []string) error {
-	ctx := context.Background()
-	client, err := NewS3Client(ctx)
+	client, err := NewS3Client(context.Background())
 	if err != nil {
 		// TODO: Handle error.
 		return err
@@ -54,51 +53,15 @@ func S3Archive(manifest model.Manifest, bucket string, aliases []string) error {
 
 	// Allow the caller to pass a reference like bucket/folder/subfolder, but split this to
 	// bucket, and folder/subfolder prefix
-	splitbucket := strings.SplitN(bucket, "/", 2)
-	bucketName := splitbucket[0]
-	objectPrefix := ""
-	if len(splitbucket) > 1 {
-		objectPrefix = splitbucket[1]
-	}
-	if err := filepath.Walk(manifest.Directory, func(p string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if info.IsDir() {
-			return nil
-		}
-		objName := path.Join(objectPrefix, manifest.Version, strings.TrimPrefix(p, manifest.Directory))
-
-		f, err := os.Open(p)
-		if err != nil {
-			return fmt.Errorf("failed to open %v: %v", p, err)
-		}
-		defer f.Close()
-
-		_, err = client.PutObject(ctx, &s3.PutObjectInput{
-			Bucket: aws.String(bucketName),
-			Key:    aws.String(objName),
-			Body:   bufio.NewReader(f),
-		})
-		if err != nil {
-			return fmt.Errorf("failed to put object: %v", err)
-		}
-
-		log.Infof("Wrote %v to s3://%s/%s", p, bucketName, objName)
-		return nil
-	}); err != nil {
+	bucketName, objectPrefix, _ := strings.Cut(bucket, "/")
+	publisher := s3Publisher{client: client, bucket: bucketName, prefix: objectPrefix}
+	if err := publishRelease(manifest, publisher); err != nil {
 		return fmt.Errorf("failed to walk directory: %v", err)
 	}
 
 	// Add alias objects. These are basically symlinks/tags for GCS, pointing to the latest version
 	for _, alias := range aliases {
-		objName := path.Join(objectPrefix, alias)
-		_, err = client.PutObject(ctx, &s3.PutObjectInput{
-			Bucket: aws.String(bucketName),
-			Key:    aws.String(objName),
-			Body:   strings.NewReader(manifest.Version),
-		})
-		if err != nil {
+		if err := publisher.put(alias, strings.NewReader(manifest.Version)); err != nil {
 			return fmt.Errorf("failed to write alias %v: %v", alias, err)
 		}
 
@@ -0,0 +1,147 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package publish
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"istio.io/istio/pkg/log"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+	"github.com/alauda-mesh/release-builder/pkg/util"
+)
+
+// Publisher uploads files to a storage backend
+type Publisher interface {
+	// Upload writes the local file to the remote path, relative to the root of the storage
+	Upload(localPath, remotePath string) error
+}
+
+// NewPublisher returns the Publisher for the storage backend
+func NewPublisher(storage model.ArtifactStorage) (Publisher, error) {
+	bucket, prefix, _ := strings.Cut(storage.Bucket, "/")
+	switch storage.Type {
+	case model.StorageGCS:
+		return gcsPublisher{bucket: bucket, prefix: prefix}, nil
+	case model.StorageS3:
+		client, err := NewS3Client(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create S3 client: %v", err)
+		}
+		return s3Publisher{client: client, bucket: bucket, prefix: prefix}, nil
+	case model.StorageLocal:
+		return localPublisher{dir: storage.Bucket}, nil
+	default:
+		return nil, fmt.Errorf("unknown storage type %q", storage.Type)
+	}
+}
+
+// gcsPublisher uploads to a GCS bucket with gsutil, which uses the ambient gcloud credentials
+type gcsPublisher struct {
+	bucket string
+	prefix string
+}
+
+func (p gcsPublisher) Upload(localPath, remotePath string) error {
+	dst := fmt.Sprintf("gs://%s/%s", p.bucket, path.Join(p.prefix, remotePath))
+	if err := util.VerboseCommand("gsutil", "cp", localPath, dst).Run(); err != nil {
+		return fmt.Errorf("failed to upload %v to %v: %v", localPath, dst, err)
+	}
+	return nil
+}
+
+// s3Publisher uploads to an S3 bucket
+type s3Publisher struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+func (p s3Publisher) Upload(localPath, remotePath string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open %v: %v", localPath, err)
+	}
+	defer f.Close()
+	return p.put(remotePath, bufio.NewReader(f))
+}
+
+// put writes the object at the remote path, relative to the prefix of the publisher
+func (p s3Publisher) put(remotePath string, body io.Reader) error {
+	_, err := p.client.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket: aws.String(p.bucket),
+		Key:    aws.String(path.Join(p.prefix, remotePath)),
+		Body:   body,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put object: %v", err)
+	}
+	return nil
+}
+
+// localPublisher copies to a directory, such as a mirror served over http
+type localPublisher struct {
+	dir string
+}
+
+func (p localPublisher) Upload(localPath, remotePath string) error {
+	dst := filepath.Join(p.dir, remotePath)
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	return util.CopyFile(localPath, dst)
+}
+
+// PublishRelease uploads every file in the release to the manifest storage, under a directory of the release version
+func PublishRelease(manifest model.Manifest) error {
+	if manifest.Storage == nil {
+		return fmt.Errorf("manifest has no storage to publish to")
+	}
+	publisher, err := NewPublisher(*manifest.Storage)
+	if err != nil {
+		return err
+	}
+	return publishRelease(manifest, publisher)
+}
+
+func publishRelease(manifest model.Manifest, publisher Publisher) error {
+	return filepath.Walk(manifest.Directory, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(manifest.Directory, p)
+		if err != nil {
+			return err
+		}
+		remote := path.Join(manifest.Version, filepath.ToSlash(rel))
+		if err := publisher.Upload(p, remote); err != nil {
+			return err
+		}
+		log.Infof("Published %v to %v", p, remote)
+		return nil
+	})
+}
@@ -0,0 +1,96 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package publish
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+)
+
+// fakePublisher records the uploads instead of performing them
+type fakePublisher struct {
+	uploads map[string]string
+}
+
+func (f *fakePublisher) Upload(localPath, remotePath string) error {
+	f.uploads[remotePath] = localPath
+	return nil
+}
+
+func writeRelease(t *testing.T, files ...string) string {
+	t.Helper()
+	release := t.TempDir()
+	for _, f := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(release, f)), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(release, f), []byte(f), 0o640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return release
+}
+
+func TestPublishRelease(t *testing.T) {
+	files := []string{"manifest.yaml", "istio-1.20.0-linux-amd64.tar.gz", "helm/base-1.20.0.tgz"}
+	release := writeRelease(t, files...)
+	manifest := model.Manifest{Version: "1.20.0", Directory: release}
+
+	fake := &fakePublisher{uploads: map[string]string{}}
+	if err := publishRelease(manifest, fake); err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for remote, local := range fake.uploads {
+		got = append(got, remote)
+		if want := filepath.Join(release, remote[len("1.20.0/"):]); local != want {
+			t.Fatalf("expected %v to be uploaded from %v, got %v", remote, want, local)
+		}
+	}
+	sort.Strings(got)
+	expected := []string{"1.20.0/helm/base-1.20.0.tgz", "1.20.0/istio-1.20.0-linux-amd64.tar.gz", "1.20.0/manifest.yaml"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected uploads %v, got %v", expected, got)
+	}
+
+	t.Run("local", func(t *testing.T) {
+		mirror := t.TempDir()
+		manifest.Storage = &model.ArtifactStorage{Type: model.StorageLocal, Bucket: mirror}
+		if err := PublishRelease(manifest); err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range files {
+			by, err := os.ReadFile(filepath.Join(mirror, "1.20.0", f))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(by) != f {
+				t.Fatalf("unexpected content of %v: %q", f, by)
+			}
+		}
+	})
+
+	t.Run("no storage", func(t *testing.T) {
+		manifest.Storage = nil
+		if err := PublishRelease(manifest); err == nil {
+			t.Fatalf("expected error without storage")
+		}
+	})
+}
@@ -0,0 +1,114 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"fmt"
+	"strings"
+
+	"istio.io/istio/pkg/log"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+	"github.com/alauda-mesh/release-builder/pkg/util"
+)
+
+// GitResolver resolves a branch or tag of a remote git repository to a commit SHA
+type GitResolver interface {
+	Resolve(git, ref string) (string, error)
+}
+
+// LsRemoteResolver resolves references by querying the remote with `git ls-remote`
+type LsRemoteResolver struct{}
+
+func (LsRemoteResolver) Resolve(git, ref string) (string, error) {
+	out, err := util.RunWithOutput("git", "ls-remote", git, ref, ref+"^{}")
+	if err != nil {
+		return "", fmt.Errorf("failed to query %v: %v", git, err)
+	}
+	return parseLsRemote(out, ref)
+}
+
+// parseLsRemote finds the SHA for ref in `git ls-remote` output. For annotated tags the peeled
+// commit (`ref^{}`) is preferred over the tag object itself.
+func parseLsRemote(out, ref string) (string, error) {
+	sha := ""
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		switch fields[1] {
+		case "refs/tags/" + ref + "^{}":
+			return fields[0], nil
+		case "refs/heads/" + ref, "refs/tags/" + ref:
+			if sha == "" {
+				sha = fields[0]
+			}
+		}
+	}
+	if sha == "" {
+		return "", fmt.Errorf("reference %v not found", ref)
+	}
+	return sha, nil
+}
+
+// CachingResolver wraps a GitResolver, only resolving each repository and reference once
+type CachingResolver struct {
+	resolver GitResolver
+	cache    map[string]string
+}
+
+func NewCachingResolver(resolver GitResolver) *CachingResolver {
+	return &CachingResolver{
+		resolver: resolver,
+		cache:    map[string]string{},
+	}
+}
+
+func (c *CachingResolver) Resolve(git, ref string) (string, error) {
+	key := git + "@" + ref
+	if sha, f := c.cache[key]; f {
+		return sha, nil
+	}
+	sha, err := c.resolver.Resolve(git, ref)
+	if err != nil {
+		return "", err
+	}
+	c.cache[key] = sha
+	return sha, nil
+}
+
+// PinDependencies resolves every dependency referencing a branch or tag to the commit SHA it currently
+// points to, so the build uses exactly that commit. Dependencies already using a SHA, a local path, or
+// automatic resolution are left unchanged.
+func PinDependencies(dependencies *model.IstioDependencies, resolver GitResolver) error {
+	for repo, dep := range dependencies.Get() {
+		if dep == nil || dep.Branch == "" || dep.Sha != "" || dep.LocalPath != "" || dep.Auto != "" {
+			continue
+		}
+		sha, err := resolver.Resolve(dep.Git, dep.Branch)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %v at %v: %v", repo, dep.Branch, err)
+		}
+		log.Infof("Pinned %v at %v to %v", repo, dep.Branch, sha)
+		pinned := *dep
+		pinned.Branch = ""
+		pinned.Sha = sha
+		if err := dependencies.Set(repo, &pinned); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+)
+
+type fakeResolver struct {
+	refs  map[string]string
+	calls int
+}
+
+func (f *fakeResolver) Resolve(git, ref string) (string, error) {
+	f.calls++
+	sha, ok := f.refs[git+"@"+ref]
+	if !ok {
+		return "", fmt.Errorf("reference %v not found", ref)
+	}
+	return sha, nil
+}
+
+func TestPinDependencies(t *testing.T) {
+	fake := &fakeResolver{refs: map[string]string{
+		"https://github.com/istio/istio@master":       "1111",
+		"https://github.com/istio/test-infra@master":  "2222",
+		"https://github.com/istio/tools@release-1.20": "3333",
+	}}
+	deps := model.IstioDependencies{
+		Istio:     &model.Dependency{Git: "https://github.com/istio/istio", Branch: "master"},
+		Api:       &model.Dependency{Git: "https://github.com/istio/api", Auto: model.Modules},
+		Proxy:     &model.Dependency{Git: "https://github.com/istio/proxy", Sha: "4444"},
+		TestInfra: &model.Dependency{Git: "https://github.com/istio/test-infra", Branch: "master"},
+		Tools:     &model.Dependency{Git: "https://github.com/istio/tools", Branch: "release-1.20", GoVersionEnabled: true},
+	}
+	resolver := NewCachingResolver(fake)
+	if err := PinDependencies(&deps, resolver); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]model.Dependency{
+		"istio":      {Git: "https://github.com/istio/istio", Sha: "1111"},
+		"api":        {Git: "https://github.com/istio/api", Auto: model.Modules},
+		"proxy":      {Git: "https://github.com/istio/proxy", Sha: "4444"},
+		"test-infra": {Git: "https://github.com/istio/test-infra", Sha: "2222"},
+		"tools":      {Git: "https://github.com/istio/tools", Sha: "3333", GoVersionEnabled: true},
+	}
+	for repo, want := range expected {
+		got := deps.Get()[repo]
+		if got == nil || *got != want {
+			t.Fatalf("%v: expected %+v, got %+v", repo, want, got)
+		}
+	}
+
+	// Resolving again should be served from the cache
+	calls := fake.calls
+	if _, err := resolver.Resolve("https://github.com/istio/istio", "master"); err != nil {
+		t.Fatal(err)
+	}
+	if fake.calls != calls {
+		t.Fatalf("expected cached result, resolver called %d times", fake.calls)
+	}
+
+	deps.Envoy = &model.Dependency{Git: "https://github.com/envoyproxy/envoy", Branch: "missing"}
+	if err := PinDependencies(&deps, resolver); err == nil {
+		t.Fatalf("expected error resolving unknown reference")
+	}
+}
+
+func TestParseLsRemote(t *testing.T) {
+	out := "aaaa\trefs/heads/master\nbbbb\trefs/tags/1.20.0\ncccc\trefs/tags/1.20.0^{}\n"
+	cases := map[string]string{
+		"master": "aaaa",
+		"1.20.0": "cccc",
+	}
+	for ref, want := range cases {
+		got, err := parseLsRemote(out, ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("%v: expected %v, got %v", ref, want, got)
+		}
+	}
+	if _, err := parseLsRemote(out, "missing"); err == nil {
+		t.Fatalf("expected error for missing reference")
+	}
+}
@@ -136,11 +136,13 @@ func StandardizeManifest(manifest *model.Manifest) error {
 		if err != nil {
 			return fmt.Errorf("failed to get SHA for %v: %v", repo, err)
 		}
-		newDep := model.Dependency{
+		newDep := &model.Dependency{
 			Sha:              strings.TrimSpace(sha),
 			GoVersionEnabled: dep.GoVersionEnabled,
 		}
-		manifest.Dependencies.Set(repo, newDep)
+		if err := manifest.Dependencies.Set(repo, newDep); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -0,0 +1,212 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package testutil writes the archive, image and chart fixtures shared by the tests of the release builder
+package testutil
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Entry is a file, directory or symlink in a test archive
+type Entry struct {
+	Name    string
+	Content string
+	// Mode defaults to 0o644, or 0o755 for a directory
+	Mode int64
+	// Typeflag defaults to tar.TypeReg. Zip archives only hold regular files and directories.
+	Typeflag byte
+	// Linkname is the target of a symlink
+	Linkname string
+}
+
+// Files returns a regular file entry for each of files, sorted by name
+func Files(files map[string]string) []Entry {
+	entries := make([]Entry, 0, len(files))
+	for name, content := range files {
+		entries = append(entries, Entry{Name: name, Content: content})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries
+}
+
+// Empty returns an empty regular file entry for each of names
+func Empty(names ...string) []Entry {
+	entries := make([]Entry, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, Entry{Name: name})
+	}
+	return entries
+}
+
+// WriteFile writes content to file, creating its directory
+func WriteFile(t testing.TB, file, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(file), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(content), 0o640); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TarBytes returns a tar of the entries, gzipped if compress is set
+func TarBytes(t testing.TB, compress bool, entries ...Entry) []byte {
+	t.Helper()
+	buf := bytes.Buffer{}
+	if err := writeTar(&buf, compress, entries); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// WriteArchive writes the entries to file: a zip archive if it ends with .zip, a tar if it ends with .tar, and
+// otherwise a gzipped tar. The directory of file is created.
+func WriteArchive(t testing.TB, file string, entries ...Entry) {
+	t.Helper()
+	buf := bytes.Buffer{}
+	var err error
+	switch {
+	case strings.HasSuffix(file, ".zip"):
+		err = writeZip(&buf, entries)
+	case strings.HasSuffix(file, ".tar"):
+		err = writeTar(&buf, false, entries)
+	default:
+		err = writeTar(&buf, true, entries)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	WriteFile(t, file, buf.String())
+}
+
+// WriteImage writes a gzipped `docker save` tarball of an image with the config and tags, and one layer holding the
+// entries of each of layers. As by docker, the manifest is written after the layers and config.
+func WriteImage(t testing.TB, file, config string, tags []string, layers ...[]Entry) {
+	t.Helper()
+	entries := []Entry{}
+	layerNames := []string{}
+	for i, layer := range layers {
+		name := fmt.Sprintf("blobs/sha256/layer%d", i)
+		entries = append(entries, Entry{Name: name, Content: string(TarBytes(t, false, layer...))})
+		layerNames = append(layerNames, name)
+	}
+	manifest, err := json.Marshal([]struct {
+		Config   string
+		RepoTags []string
+		Layers   []string
+	}{{Config: "blobs/sha256/config", RepoTags: tags, Layers: layerNames}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries = append(entries, Entry{Name: "blobs/sha256/config", Content: config}, Entry{Name: "manifest.json", Content: string(manifest)})
+	WriteArchive(t, file, entries...)
+}
+
+// WriteChart writes the Chart.yaml of a chart, and the files relative to it, to dir
+func WriteChart(t testing.TB, dir, name, version string, files map[string]string) {
+	t.Helper()
+	WriteFile(t, filepath.Join(dir, "Chart.yaml"), "apiVersion: v2\nname: "+name+"\nversion: "+version+"\n")
+	for f, content := range files {
+		WriteFile(t, filepath.Join(dir, f), content)
+	}
+}
+
+// AssertError fails the test unless err contains want, or, if want is empty, err is nil
+func AssertError(t testing.TB, err error, want string) {
+	t.Helper()
+	if want == "" {
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("expected error containing %q, got %v", want, err)
+	}
+}
+
+func writeTar(w io.Writer, compress bool, entries []Entry) error {
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(w)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.Name, Mode: e.Mode, Typeflag: e.Typeflag, Linkname: e.Linkname, Size: int64(len(e.Content))}
+		if hdr.Typeflag == 0 {
+			hdr.Typeflag = tar.TypeReg
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			hdr.Size = 0
+		}
+		if hdr.Mode == 0 {
+			hdr.Mode = 0o644
+			if hdr.Typeflag == tar.TypeDir {
+				hdr.Mode = 0o755
+			}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write([]byte(e.Content)); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if gz != nil {
+		return gz.Close()
+	}
+	return nil
+}
+
+func writeZip(w io.Writer, entries []Entry) error {
+	zw := zip.NewWriter(w)
+	for _, e := range entries {
+		hdr := &zip.FileHeader{Name: e.Name, Method: zip.Deflate}
+		mode := os.FileMode(e.Mode)
+		if e.Typeflag == tar.TypeDir {
+			if mode == 0 {
+				mode = 0o755
+			}
+			hdr.Name = strings.TrimSuffix(e.Name, "/") + "/"
+			mode |= os.ModeDir
+		} else if mode == 0 {
+			mode = 0o644
+		}
+		hdr.SetMode(mode)
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write([]byte(e.Content)); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
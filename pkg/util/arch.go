@@ -0,0 +1,127 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"strings"
+)
+
+// architectures maps each platform in the docker convention, used by the manifest architectures, to the name used
+// for release archives, and the architecture declared by deb and rpm packages. Only linux has packages.
+var architectures = []struct {
+	docker  string
+	archive string
+	deb     string
+	rpm     string
+}{
+	{"linux/amd64", "linux-amd64", "amd64", "x86_64"},
+	{"linux/arm64", "linux-arm64", "arm64", "aarch64"},
+	{"linux/arm/v7", "linux-armv7", "armhf", "armv7hl"},
+	{"darwin/amd64", "osx-amd64", "", ""},
+	{"darwin/arm64", "osx-arm64", "", ""},
+	{"windows/amd64", "win-amd64", "", ""},
+}
+
+// legacyArchiveArchitectures are the deprecated archive names, without an architecture, still published for amd64
+var legacyArchiveArchitectures = map[string]string{
+	"osx": "darwin/amd64",
+	"win": "windows/amd64",
+}
+
+// ToArchiveArch converts a docker platform, such as linux/arm64, to the name used in release archives, such as
+// linux-arm64
+func ToArchiveArch(docker string) (string, error) {
+	for _, a := range architectures {
+		if a.docker == docker {
+			return a.archive, nil
+		}
+	}
+	return "", fmt.Errorf("unknown architecture %q", docker)
+}
+
+// ToDockerArch converts a release archive architecture, such as osx-arm64, to the docker platform, such as
+// darwin/arm64. The legacy osx and win archive names are amd64.
+func ToDockerArch(archive string) (string, error) {
+	if docker, f := legacyArchiveArchitectures[archive]; f {
+		return docker, nil
+	}
+	for _, a := range architectures {
+		if a.archive == archive {
+			return a.docker, nil
+		}
+	}
+	return "", fmt.Errorf("unknown archive architecture %q", archive)
+}
+
+// ImageArchSuffix returns the suffix of docker image archives for a docker platform, such as -arm64 for
+// pilot-distroless-arm64.tar.gz. The amd64 images have no suffix. Platforms without release archives, such as
+// linux/s390x, use their GOARCH name.
+func ImageArchSuffix(docker string) (string, error) {
+	var arch string
+	if archive, err := ToArchiveArch(docker); err == nil {
+		_, arch, _ = strings.Cut(archive, "-")
+	} else if arch, err = goArch(docker); err != nil {
+		return "", err
+	}
+	if arch == "amd64" {
+		return "", nil
+	}
+	return "-" + arch, nil
+}
+
+// SidecarPackageName returns the file name of the sidecar package of a format, deb or rpm, for a docker platform, such
+// as istio-sidecar-arm64.deb. As with docker images, the amd64 package has no suffix.
+func SidecarPackageName(docker, format string) (string, error) {
+	if _, err := PackageArch(docker, format); err != nil {
+		return "", err
+	}
+	suffix, err := ImageArchSuffix(docker)
+	if err != nil {
+		return "", err
+	}
+	return "istio-sidecar" + suffix + "." + format, nil
+}
+
+// PackageArch returns the architecture declared by a package of a format, deb or rpm, for a docker platform, such as
+// arm64 for a deb and aarch64 for an rpm. Other linux platforms, such as linux/ppc64le, use their GOARCH name.
+func PackageArch(docker, format string) (string, error) {
+	if format != "deb" && format != "rpm" {
+		return "", fmt.Errorf("unknown package format %q", format)
+	}
+	for _, a := range architectures {
+		if a.docker != docker {
+			continue
+		}
+		arch := map[string]string{"deb": a.deb, "rpm": a.rpm}[format]
+		if arch == "" {
+			return "", fmt.Errorf("no %v packages are built for %v", format, docker)
+		}
+		return arch, nil
+	}
+	if !strings.HasPrefix(docker, "linux/") {
+		return "", fmt.Errorf("no %v packages are built for %v", format, docker)
+	}
+	return goArch(docker)
+}
+
+// goArch returns the GOARCH name, with any variant appended, of a docker platform such as linux/s390x or linux/arm/v6
+func goArch(docker string) (string, error) {
+	parts := strings.Split(docker, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("unknown architecture %q", docker)
+	}
+	return strings.Join(parts[1:], ""), nil
+}
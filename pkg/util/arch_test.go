@@ -0,0 +1,130 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import "testing"
+
+func TestArchitectures(t *testing.T) {
+	cases := []struct {
+		docker  string
+		archive string
+		suffix  string
+	}{
+		{"linux/amd64", "linux-amd64", ""},
+		{"linux/arm64", "linux-arm64", "-arm64"},
+		{"linux/arm/v7", "linux-armv7", "-armv7"},
+		{"darwin/amd64", "osx-amd64", ""},
+		{"darwin/arm64", "osx-arm64", "-arm64"},
+		{"windows/amd64", "win-amd64", ""},
+	}
+	for _, tt := range cases {
+		t.Run(tt.docker, func(t *testing.T) {
+			archive, err := ToArchiveArch(tt.docker)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if archive != tt.archive {
+				t.Fatalf("expected archive arch %v, got %v", tt.archive, archive)
+			}
+			docker, err := ToDockerArch(tt.archive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if docker != tt.docker {
+				t.Fatalf("expected docker arch %v, got %v", tt.docker, docker)
+			}
+			suffix, err := ImageArchSuffix(tt.docker)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if suffix != tt.suffix {
+				t.Fatalf("expected suffix %q, got %q", tt.suffix, suffix)
+			}
+		})
+	}
+
+	t.Run("legacy archives", func(t *testing.T) {
+		for archive, want := range map[string]string{"osx": "darwin/amd64", "win": "windows/amd64"} {
+			if got, err := ToDockerArch(archive); err != nil || got != want {
+				t.Fatalf("expected %v for %v, got %v, %v", want, archive, got, err)
+			}
+		}
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		if _, err := ToArchiveArch("linux/s390x"); err == nil {
+			t.Fatalf("expected error for unknown docker arch")
+		}
+		if _, err := ToDockerArch("plan9-amd64"); err == nil {
+			t.Fatalf("expected error for unknown archive arch")
+		}
+		if _, err := ImageArchSuffix("arm64"); err == nil {
+			t.Fatalf("expected error for arch without os")
+		}
+	})
+
+	t.Run("goarch fallback", func(t *testing.T) {
+		for docker, want := range map[string]string{"linux/s390x": "-s390x", "linux/ppc64le": "-ppc64le", "linux/arm/v6": "-armv6"} {
+			if got, err := ImageArchSuffix(docker); err != nil || got != want {
+				t.Fatalf("expected suffix %q for %v, got %q, %v", want, docker, got, err)
+			}
+		}
+	})
+}
+
+func TestSidecarPackages(t *testing.T) {
+	cases := []struct {
+		docker string
+		format string
+		name   string
+		arch   string
+	}{
+		{"linux/amd64", "deb", "istio-sidecar.deb", "amd64"},
+		{"linux/arm64", "deb", "istio-sidecar-arm64.deb", "arm64"},
+		{"linux/arm/v7", "deb", "istio-sidecar-armv7.deb", "armhf"},
+		{"linux/amd64", "rpm", "istio-sidecar.rpm", "x86_64"},
+		{"linux/arm64", "rpm", "istio-sidecar-arm64.rpm", "aarch64"},
+		{"linux/arm/v7", "rpm", "istio-sidecar-armv7.rpm", "armv7hl"},
+		{"linux/s390x", "deb", "istio-sidecar-s390x.deb", "s390x"},
+		{"linux/ppc64le", "rpm", "istio-sidecar-ppc64le.rpm", "ppc64le"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			name, err := SidecarPackageName(tt.docker, tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name != tt.name {
+				t.Fatalf("expected %v, got %v", tt.name, name)
+			}
+			arch, err := PackageArch(tt.docker, tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if arch != tt.arch {
+				t.Fatalf("expected arch %v, got %v", tt.arch, arch)
+			}
+		})
+	}
+
+	t.Run("no packages", func(t *testing.T) {
+		if _, err := SidecarPackageName("darwin/arm64", "deb"); err == nil {
+			t.Fatalf("expected error for darwin package")
+		}
+		if _, err := PackageArch("linux/amd64", "apk"); err == nil {
+			t.Fatalf("expected error for unknown format")
+		}
+	})
+}
@@ -15,8 +15,16 @@
 package util
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"os/exec"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/Masterminds/semver/v3"
 	"istio.io/istio/pkg/log"
@@ -34,7 +42,7 @@ func StandardEnv(manifest model.Manifest) []string {
 		"BUILD_WITH_CONTAINER=0", // Build should already run in container, having multiple layers of docker causes issues
 		"IGNORE_DIRTY_TREE=1",
 		"INCLUDE_UNTAGGED_DEFAULT=true",
-		"DOCKER_ARCHITECTURES="+strings.Join(manifest.Architectures, ","),
+		"DOCKER_ARCHITECTURES="+strings.Join(manifest.GetDockerArchitectures(), ","),
 	)
 	if manifest.Docker != "" {
 		env = append(env, "HUB="+manifest.Docker)
@@ -51,9 +59,32 @@ func removeEnvKey(s []string, key string) []string {
 	return s
 }
 
+// DefaultMakeTimeout is how long RunMake lets make run before killing it. It is generous, as it only exists to turn a
+// hung build into a failure.
+const DefaultMakeTimeout = 3 * time.Hour
+
 // RunMake runs a make command for the repo, with standard environment variables set
 func RunMake(manifest model.Manifest, repo string, env []string, c ...string) error {
-	cmd := VerboseCommand("make", c...)
+	return RunMakeWithTimeout(manifest, repo, env, DefaultMakeTimeout, c...)
+}
+
+// RunMakeWithTimeout runs a make command like RunMake, killing make and everything it started if it has not
+// completed within the timeout.
+func RunMakeWithTimeout(manifest model.Manifest, repo string, env []string, timeout time.Duration, c ...string) error {
+	return RunMakeContext(context.Background(), manifest, repo, env, timeout, c...)
+}
+
+// RunMakeContext runs a make command like RunMakeWithTimeout, also killing make and everything it started if the
+// context is cancelled, so a cancelled build stops promptly.
+func RunMakeContext(parent context.Context, manifest model.Manifest, repo string, env []string, timeout time.Duration, c ...string) error {
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "make", c...)
+	// Run make in its own process group, so a timeout also kills the compilers and other commands it is waiting on
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
 	cmd.Env = StandardEnv(manifest)
 	// Unset the environment variables that are set in a container which cause `make` artifacts
 	// to build in the container directories. release-builder expects all `make` artifacts to be
@@ -70,7 +101,76 @@ func RunMake(manifest model.Manifest, repo string, env []string, c ...string) er
 	cmd.Stdout = os.Stdout
 	cmd.Dir = manifest.RepoDir(repo)
 	log.Infof("Running make %v with env=%v wd=%v", strings.Join(c, " "), strings.Join(env, " "), cmd.Dir)
-	return cmd.Run()
+	if err := RunSummarized(cmd); err != nil {
+		if err := parent.Err(); err != nil {
+			return fmt.Errorf("make %v was cancelled: %w", strings.Join(c, " "), err)
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("make %v timed out after %v", strings.Join(c, " "), timeout)
+		}
+		return err
+	}
+	return nil
+}
+
+// Sleep waits for d, returning the context's error early if it is cancelled first, so a cancelled build does not wait
+// out a retry backoff
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// RunOptions configures how Run runs a command
+type RunOptions struct {
+	// Dir is the working directory of the command. If unset, the current directory is used.
+	Dir string
+	// Env is added to the environment of the current process
+	Env []string
+	// CaptureStdout returns the stdout of the command from Run, in addition to streaming it
+	CaptureStdout bool
+	// Timeout kills the command if it has not completed in time. If unset, there is no timeout.
+	Timeout time.Duration
+}
+
+// Run runs a command, streaming its stdout and stderr. Stdout is returned if CaptureStdout is set. If the command
+// fails, the returned error includes its stderr.
+func Run(opts RunOptions, name string, arg ...string) (string, error) {
+	ctx := context.Background()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	log.Infof("Running command: %v %v", name, strings.Join(arg, " "))
+	cmd := exec.CommandContext(ctx, name, arg...)
+	// Children of a killed command may keep its output open; stop waiting for them shortly after a timeout
+	cmd.WaitDelay = time.Second
+	cmd.Dir = opts.Dir
+	if len(opts.Env) > 0 {
+		cmd.Env = append(os.Environ(), opts.Env...)
+	}
+	var outBuffer, errBuffer bytes.Buffer
+	cmd.Stdout = os.Stdout
+	if opts.CaptureStdout {
+		cmd.Stdout = io.MultiWriter(os.Stdout, &outBuffer)
+	}
+	cmd.Stderr = io.MultiWriter(os.Stderr, &errBuffer)
+	if err := RunSummarized(cmd); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("timed out after %v", opts.Timeout)
+		}
+		if stderr := strings.TrimSpace(errBuffer.String()); stderr != "" {
+			err = fmt.Errorf("%v: %v", err, stderr)
+		}
+		return outBuffer.String(), fmt.Errorf("%v %v: %v", name, strings.Join(arg, " "), err)
+	}
+	return outBuffer.String(), nil
 }
 
 // YamlLog logs a object as yaml
@@ -0,0 +1,109 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	cases := []struct {
+		name    string
+		opts    RunOptions
+		script  string
+		out     string
+		wantErr string
+	}{
+		{"capture", RunOptions{CaptureStdout: true}, "echo hello", "hello\n", ""},
+		{"no capture", RunOptions{}, "echo hello", "", ""},
+		{"dir", RunOptions{Dir: dir, CaptureStdout: true}, "pwd", dir + "\n", ""},
+		{"env", RunOptions{Env: []string{"RUN_TEST=value"}, CaptureStdout: true}, "echo $RUN_TEST", "value\n", ""},
+		{"stderr in error", RunOptions{}, "echo broken >&2; exit 3", "", "exit status 3: broken"},
+		{"timeout", RunOptions{Timeout: 50 * time.Millisecond}, "exec sleep 5", "", "timed out after 50ms"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := Run(tt.opts, "sh", "-c", tt.script)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+			if out != tt.out {
+				t.Fatalf("expected output %q, got %q", tt.out, out)
+			}
+		})
+	}
+}
+
+func TestRunMakeWithTimeout(t *testing.T) {
+	manifest := model.Manifest{Directory: t.TempDir()}
+	repo := manifest.RepoDir("istio")
+	if err := os.MkdirAll(repo, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	makefile := "quick:\n\t@true\n\nhang:\n\t@sleep 5\n"
+	if err := os.WriteFile(filepath.Join(repo, "Makefile"), []byte(makefile), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunMakeWithTimeout(manifest, "istio", nil, time.Minute, "quick"); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	err := RunMakeWithTimeout(manifest, "istio", nil, 100*time.Millisecond, "hang")
+	if err == nil || !strings.Contains(err.Error(), "make hang timed out after 100ms") {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("expected make to be killed at the timeout, took %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start = time.Now()
+	err = RunMakeContext(ctx, manifest, "istio", nil, time.Minute, "hang")
+	if !errors.Is(err, context.Canceled) || !strings.Contains(err.Error(), "make hang was cancelled") {
+		t.Fatalf("expected cancellation error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("expected make to be killed when cancelled, took %v", elapsed)
+	}
+}
+
+func TestSleep(t *testing.T) {
+	if err := Sleep(context.Background(), time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if err := Sleep(ctx, time.Hour); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected a cancelled sleep to return promptly, took %v", elapsed)
+	}
+}
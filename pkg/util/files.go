@@ -17,16 +17,21 @@ package util
 import (
 	"archive/zip"
 	"bytes"
+	"compress/gzip"
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 
 	"golang.org/x/mod/modfile"
@@ -51,7 +56,7 @@ func RunWithOutput(name string, arg ...string) (string, error) {
 	cmd := VerboseCommand(name, arg...)
 	cmd.Stdout = io.MultiWriter(os.Stdout, &outBuffer)
 	cmd.Stderr = io.MultiWriter(os.Stderr, &errBuffer)
-	if err := cmd.Run(); err != nil {
+	if err := RunSummarized(cmd); err != nil {
 		log.Infof("Running command %s %s failed: %s: %s",
 			name, strings.Join(arg, " "), err.Error(), errBuffer.String())
 		return "", err
@@ -69,21 +74,74 @@ func CopyDir(src, dst string) error {
 	return nil
 }
 
-// CopyFilesToDir copies all files in one directory to another
-func CopyFilesToDir(src, dst string) error {
+// CopyOptions configures CopyFilesToDir
+type CopyOptions struct {
+	// PreserveDirs recreates the subdirectories of the source directory in the destination. Otherwise, files in
+	// subdirectories are copied directly into the destination, and files with the same name in different
+	// subdirectories are an error rather than overwriting each other.
+	PreserveDirs bool
+}
+
+// CopyFilesToDir copies all files in one directory, including those in its subdirectories, to another. Unless opts
+// preserves the directories, the files are flattened into dst. Before CopyOptions was added, only the top level files
+// were copied, and a subdirectory failed the copy; such subdirectories are now flattened instead.
+func CopyFilesToDir(src, dst string, opts CopyOptions) error {
 	if err := VerboseCommand("mkdir", "-p", path.Join(dst, "..")).Run(); err != nil {
 		return fmt.Errorf("failed to create output directory: %v", err)
 	}
-	dir, err := os.ReadDir(src)
-	if err != nil {
-		return err
-	}
-	for _, i := range dir {
-		if err := CopyFile(filepath.Join(src, i.Name()), filepath.Join(dst, i.Name())); err != nil {
+	copied := map[string]string{}
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		if !opts.PreserveDirs {
+			rel = d.Name()
+			if other, f := copied[rel]; f {
+				return fmt.Errorf("failed to copy: %v and %v would both be copied to %v", other, p, filepath.Join(dst, rel))
+			}
+			copied[rel] = p
+		}
+		if err := CopyFile(p, filepath.Join(dst, rel)); err != nil {
 			return fmt.Errorf("failed to copy: %v", err)
 		}
-	}
-	return nil
+		return nil
+	})
+}
+
+// LinkDir recreates the directory tree of src at dst, hard linking each file. Files that cannot be linked, such as
+// across filesystems, are copied instead. As linked files share their content, they must not be modified in place.
+func LinkDir(src, dst string) error {
+	return filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		}
+		if err := os.Link(p, target); err == nil {
+			return nil
+		}
+		if err := CopyFile(p, target); err != nil {
+			return err
+		}
+		return os.Chmod(target, info.Mode().Perm())
+	})
 }
 
 // FileExists checks if a file exists
@@ -118,20 +176,177 @@ func CopyDirFiltered(src, dst string, include []string) error {
 	return nil
 }
 
+// renameFile is overridden in tests to simulate a crash before the rename
+var renameFile = os.Rename
+
+// WriteFileAtomic writes data to a file, like os.WriteFile, but never leaves a partially written file. The data is
+// written to a temporary file in the same directory, which is then renamed into place.
+func WriteFileAtomic(file string, data []byte, mode os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".tmp*")
+	if err != nil {
+		return err
+	}
+	// Once renamed this is a no-op; otherwise it cleans up after a failure
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return renameFile(tmp.Name(), file)
+}
+
+// ShaAlgorithm is a hash algorithm used for checksum files. The checksum file uses the algorithm as its extension.
+type ShaAlgorithm string
+
+const (
+	Sha256 ShaAlgorithm = "sha256"
+	Sha512 ShaAlgorithm = "sha512"
+)
+
+// ShaAlgorithms are the supported checksum algorithms
+var ShaAlgorithms = []ShaAlgorithm{Sha256, Sha512}
+
+// SignedFiles returns the files of the release in dir signed with cosign, sorted: each archive matching
+// model.SignedArchivePatterns, and the checksum files next to it.
+func SignedFiles(dir string) ([]string, error) {
+	files := []string{}
+	for _, pattern := range model.SignedArchivePatterns {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		for _, archive := range matches {
+			files = append(files, archive)
+			for _, algo := range ShaAlgorithms {
+				if shaFile := archive + "." + string(algo); FileExists(shaFile) {
+					files = append(files, shaFile)
+				}
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
 // CreateSha will create and write a sha256sum of a file
 func CreateSha(src string) error {
+	return CreateShaAlgo(src, Sha256)
+}
+
+// CreateShaAlgo will create and write a checksum of a file, in the format of sha256sum/sha512sum, to src.<algo>
+func CreateShaAlgo(src string, algo ShaAlgorithm) error {
 	b, err := os.ReadFile(src)
 	if err != nil {
 		return fmt.Errorf("failed to read file %v: %v", src, err)
 	}
-	sha := sha256.Sum256(b)
-	shaFile := fmt.Sprintf("%x %s\n", sha, path.Base(src))
-	if err := os.WriteFile(src+".sha256", []byte(shaFile), 0o644); err != nil {
-		return fmt.Errorf("failed to write sha256 to %v: %v", src, err)
+	sum, err := ShaSum(algo, b)
+	if err != nil {
+		return err
+	}
+	shaFile := fmt.Sprintf("%s %s\n", sum, path.Base(src))
+	if err := WriteFileAtomic(src+"."+string(algo), []byte(shaFile), 0o644); err != nil {
+		return fmt.Errorf("failed to write %v to %v: %v", algo, src, err)
 	}
 	return nil
 }
 
+// ShaSum returns the hex encoded checksum of b
+func ShaSum(algo ShaAlgorithm, b []byte) (string, error) {
+	switch algo {
+	case Sha256:
+		return fmt.Sprintf("%x", sha256.Sum256(b)), nil
+	case Sha512:
+		return fmt.Sprintf("%x", sha512.Sum512(b)), nil
+	default:
+		return "", fmt.Errorf("unsupported checksum algorithm %q", algo)
+	}
+}
+
+// FileSha256 returns the hex encoded sha256 checksum of a file, without reading it all into memory
+func FileSha256(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return ReaderSha256(f)
+}
+
+// FileShaSum returns the hex encoded checksum of a file, without reading it all into memory
+func FileShaSum(algo ShaAlgorithm, file string) (string, error) {
+	var h hash.Hash
+	switch algo {
+	case Sha256:
+		h = sha256.New()
+	case Sha512:
+		h = sha512.New()
+	default:
+		return "", fmt.Errorf("unsupported checksum algorithm %q", algo)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// ReaderSha256 returns the hex encoded sha256 checksum of everything read from r
+func ReaderSha256(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// ListArtifacts returns the size and sha256 digest of every file in dir, except those in exclude, sorted by name.
+// Names are relative to dir and use forward slashes.
+func ListArtifacts(dir string, exclude ...string) ([]model.ReleaseArtifact, error) {
+	skip := map[string]struct{}{}
+	for _, e := range exclude {
+		skip[e] = struct{}{}
+	}
+	artifacts := []model.ReleaseArtifact{}
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(name)
+		if _, f := skip[name]; f {
+			return nil
+		}
+		sum, err := FileSha256(p)
+		if err != nil {
+			return err
+		}
+		artifacts = append(artifacts, model.ReleaseArtifact{Name: name, Size: info.Size(), Sha256: sum})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Walk visits files in lexical order, so artifacts are already sorted
+	return artifacts, nil
+}
+
 func CopyFile(src, dst string) error {
 	log.Infof("Copying %v -> %v", src, dst)
 	in, err := os.Open(src)
@@ -259,6 +474,50 @@ func fetchAutoProxyWorkspace(dep *model.Dependency, dest string) error {
 	return nil
 }
 
+// Unzip extracts a zip archive into the target directory
+func Unzip(source, target string) error {
+	archive, err := zip.OpenReader(source)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	for _, f := range archive.File {
+		dest := filepath.Join(target, f.Name)
+		if !strings.HasPrefix(dest, filepath.Clean(target)+string(os.PathSeparator)) {
+			return fmt.Errorf("invalid file path in archive: %v", f.Name)
+		}
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(dest, 0o750); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(dest), 0o750); err != nil {
+			return err
+		}
+		if err := unzipFile(f, dest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unzipFile(f *zip.File, dest string) error {
+	in, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, f.Mode())
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = io.Copy(out, in)
+	return err
+}
+
 func ZipFolder(source, target string) error {
 	zipfile, err := os.Create(target)
 	if err != nil {
@@ -317,3 +576,42 @@ func ZipFolder(source, target string) error {
 		return err
 	})
 }
+
+// TarGz archives srcs, relative to dir, as the .tar.gz dest. Only the tar is written by the host tar; it is compressed
+// at the given gzip level by the builder, so the archive does not depend on the gzip of the build host.
+func TarGz(dir string, dest string, level int, srcs ...string) error {
+	if !filepath.IsAbs(dest) {
+		dest = filepath.Join(dir, dest)
+	}
+	tmp := dest + ".tmp"
+	defer os.Remove(tmp)
+	if _, err := Run(RunOptions{Dir: dir}, "tar", append([]string{"-cf", tmp}, srcs...)...); err != nil {
+		return err
+	}
+	return GzipFile(tmp, dest, level)
+}
+
+// GzipFile compresses src as dst at the given gzip level. The gzip header records no file name or modification time.
+func GzipFile(src, dst string, level int) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	gz, err := gzip.NewWriterLevel(out, level)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(gz, in); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
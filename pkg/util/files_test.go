@@ -0,0 +1,255 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCreateShaAlgo(t *testing.T) {
+	cases := []struct {
+		algo     ShaAlgorithm
+		file     string
+		checksum string
+	}{
+		{
+			Sha256,
+			"istioctl.sha256",
+			"2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824 istioctl\n",
+		},
+		{
+			Sha512,
+			"istioctl.sha512",
+			"9b71d224bd62f3785d96d46ad3ea3d73319bfbc2890caadae2dff72519673ca72323c3d99ba5c11d7c7acc6e14b8c5da0c4663475c2e5c3adef46f73bcdec043 istioctl\n",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(string(tc.algo), func(t *testing.T) {
+			dir := t.TempDir()
+			src := filepath.Join(dir, "istioctl")
+			if err := os.WriteFile(src, []byte("hello"), 0o640); err != nil {
+				t.Fatal(err)
+			}
+			if err := CreateShaAlgo(src, tc.algo); err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(filepath.Join(dir, tc.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.checksum {
+				t.Fatalf("expected %q, got %q", tc.checksum, string(got))
+			}
+			sum, err := FileShaSum(tc.algo, src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := strings.Fields(tc.checksum)[0]; sum != want {
+				t.Fatalf("expected file checksum %q, got %q", want, sum)
+			}
+		})
+	}
+
+	src := filepath.Join(t.TempDir(), "istioctl")
+	if err := os.WriteFile(src, []byte("hello"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateShaAlgo(src, "md5"); err == nil {
+		t.Fatalf("expected error for unsupported algorithm")
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "manifest.yaml")
+	if err := WriteFileAtomic(file, []byte("version: 1.20.0"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash between writing the data and renaming it into place
+	renameFile = func(string, string) error { return fmt.Errorf("interrupted") }
+	t.Cleanup(func() { renameFile = os.Rename })
+	if err := WriteFileAtomic(file, []byte("version: 1.20.1"), 0o640); err == nil {
+		t.Fatalf("expected interrupted write to fail")
+	}
+	if err := WriteFileAtomic(filepath.Join(dir, "release-index.json"), []byte("{}"), 0o640); err == nil {
+		t.Fatalf("expected interrupted write to fail")
+	}
+
+	got, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "version: 1.20.0" {
+		t.Fatalf("expected original contents to be kept, got %q", string(got))
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected only the original file to remain, got %v", entries)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o640 {
+		t.Fatalf("expected mode 0640, got %v", info.Mode().Perm())
+	}
+}
+
+func TestCopyFilesToDir(t *testing.T) {
+	cases := []struct {
+		name    string
+		files   []string
+		opts    CopyOptions
+		want    []string
+		wantErr string
+	}{
+		{
+			name:  "flattened",
+			files: []string{"pilot.tar.gz", "arm64/proxyv2-arm64.tar.gz", "arm64/nested/ztunnel-arm64.tar.gz"},
+			want:  []string{"pilot.tar.gz", "proxyv2-arm64.tar.gz", "ztunnel-arm64.tar.gz"},
+		},
+		{
+			name:    "flattened collision",
+			files:   []string{"amd64/proxyv2.tar.gz", "arm64/proxyv2.tar.gz"},
+			wantErr: "would both be copied to",
+		},
+		{
+			name:  "preserved",
+			files: []string{"pilot.tar.gz", "amd64/proxyv2.tar.gz", "arm64/proxyv2.tar.gz", "arm64/nested/ztunnel.tar.gz"},
+			opts:  CopyOptions{PreserveDirs: true},
+			want:  []string{"amd64/proxyv2.tar.gz", "arm64/nested/ztunnel.tar.gz", "arm64/proxyv2.tar.gz", "pilot.tar.gz"},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			src := t.TempDir()
+			for _, f := range tt.files {
+				if err := os.MkdirAll(filepath.Join(src, filepath.Dir(f)), 0o750); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(src, f), []byte(f), 0o640); err != nil {
+					t.Fatal(err)
+				}
+			}
+			dst := filepath.Join(t.TempDir(), "docker")
+			err := CopyFilesToDir(src, dst, tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			err = filepath.WalkDir(dst, func(p string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+				rel, err := filepath.Rel(dst, p)
+				got = append(got, filepath.ToSlash(rel))
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected files %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLinkDir(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	if err := os.MkdirAll(filepath.Join(src, "samples", "bookinfo"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "samples", "bookinfo", "run.sh"), []byte("#!/bin/sh"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("bookinfo/run.sh", filepath.Join(src, "samples", "run.sh")); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(t.TempDir(), "dst")
+	if err := LinkDir(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	srcInfo, err := os.Stat(filepath.Join(src, "samples", "bookinfo", "run.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dstInfo, err := os.Stat(filepath.Join(dst, "samples", "bookinfo", "run.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(srcInfo, dstInfo) {
+		t.Fatalf("expected file to be linked")
+	}
+	if link, err := os.Readlink(filepath.Join(dst, "samples", "run.sh")); err != nil || link != "bookinfo/run.sh" {
+		t.Fatalf("expected symlink to be recreated, got %q: %v", link, err)
+	}
+}
+
+func TestTarGz(t *testing.T) {
+	src := t.TempDir()
+	var content strings.Builder
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&content, "line %d of %d\n", i*i%997, i)
+	}
+	if err := os.WriteFile(filepath.Join(src, "istioctl"), []byte(content.String()), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	sizes := map[int]int64{}
+	for _, level := range []int{gzip.BestSpeed, gzip.BestCompression} {
+		var first []byte
+		for i := 0; i < 2; i++ {
+			dest := filepath.Join(t.TempDir(), "istioctl.tar.gz")
+			if err := TarGz(src, dest, level, "istioctl"); err != nil {
+				t.Fatal(err)
+			}
+			by, err := os.ReadFile(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if first == nil {
+				first = by
+			} else if !bytes.Equal(first, by) {
+				t.Fatalf("expected deterministic archive at level %d, got sizes %d and %d", level, len(first), len(by))
+			}
+			if FileExists(dest + ".tmp") {
+				t.Fatalf("expected uncompressed tar to be removed")
+			}
+		}
+		sizes[level] = int64(len(first))
+	}
+	if sizes[gzip.BestSpeed] <= sizes[gzip.BestCompression] {
+		t.Fatalf("expected level to change the archive size, got %v", sizes)
+	}
+}
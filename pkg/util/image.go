@@ -0,0 +1,344 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// savedImage is an entry of the manifest.json of a `docker save` tarball
+type savedImage struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+// ImageConfig returns the raw config of the first image in a `docker save` tarball, which may be gzipped
+func ImageConfig(archive string) ([]byte, error) {
+	image, files, err := readImageTarball(archive)
+	if err != nil {
+		return nil, err
+	}
+	by, found := files[image.Config]
+	if !found {
+		return nil, fmt.Errorf("image config %v not found", image.Config)
+	}
+	return by, nil
+}
+
+// ImageRepoTags returns the tags of the first image in a `docker save` tarball, which may be gzipped
+func ImageRepoTags(archive string) ([]string, error) {
+	image, _, err := readImageTarball(archive)
+	if err != nil {
+		return nil, err
+	}
+	return image.RepoTags, nil
+}
+
+// ImageFiles returns the absolute path of every file, directory and link in the filesystem of the first image in a
+// `docker save` tarball, which may be gzipped. Paths removed by the whiteouts of a later layer are excluded.
+func ImageFiles(archive string) (map[string]struct{}, error) {
+	image, _, err := readImageTarball(archive)
+	if err != nil {
+		return nil, err
+	}
+	// The layers may come before manifest.json in the tarball, so they are listed in a second pass
+	layerIndex := map[string][]int{}
+	for i, layer := range image.Layers {
+		layerIndex[layer] = append(layerIndex[layer], i)
+	}
+	layers := make([][]string, len(image.Layers))
+	err = walkImageTarball(archive, func(hdr *tar.Header, r io.Reader) error {
+		indexes, f := layerIndex[hdr.Name]
+		if !f {
+			return nil
+		}
+		paths, err := ListTarPaths(r)
+		if err != nil {
+			return fmt.Errorf("failed to read layer %v: %v", hdr.Name, err)
+		}
+		for _, i := range indexes {
+			layers[i] = paths
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]struct{}{}
+	for i, paths := range layers {
+		if paths == nil {
+			return nil, fmt.Errorf("layer %v not found", image.Layers[i])
+		}
+		applyLayer(files, paths)
+	}
+	return files, nil
+}
+
+// applyLayer adds the paths of a layer to files, first removing the paths of lower layers hidden by its whiteouts
+func applyLayer(files map[string]struct{}, paths []string) {
+	added := []string{}
+	for _, p := range paths {
+		dir, name := path.Split(p)
+		if name == ".wh..wh..opq" {
+			// An opaque directory hides everything lower layers put in it
+			for f := range files {
+				if strings.HasPrefix(f, dir) {
+					delete(files, f)
+				}
+			}
+			continue
+		}
+		if hidden, f := strings.CutPrefix(name, ".wh."); f {
+			removed := dir + hidden
+			for f := range files {
+				if f == removed || strings.HasPrefix(f, removed+"/") {
+					delete(files, f)
+				}
+			}
+			continue
+		}
+		added = append(added, p)
+	}
+	for _, p := range added {
+		files[p] = struct{}{}
+	}
+}
+
+// ListTarPaths returns the absolute path of every entry of a tar stream, which may be gzipped
+func ListTarPaths(r io.Reader) ([]string, error) {
+	br := bufio.NewReader(r)
+	in := io.Reader(br)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		in = gz
+	}
+	paths := []string{}
+	tr := tar.NewReader(in)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return paths, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if p := path.Join("/", hdr.Name); p != "/" {
+			paths = append(paths, p)
+		}
+	}
+}
+
+// walkImageTarball calls fn with each regular file of a `docker save` tarball, which may be gzipped
+func walkImageTarball(archive string, fn func(hdr *tar.Header, r io.Reader) error) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var in io.Reader = f
+	if strings.HasSuffix(archive, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		in = gz
+	}
+	tr := tar.NewReader(in)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !hdr.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		if err := fn(hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// readImageTarball reads the manifest.json entry of the first image in a `docker save` tarball, and every small file
+func readImageTarball(archive string) (savedImage, map[string][]byte, error) {
+	// Configs are small, while layers may be huge; only small files are kept while reading the tarball once
+	const maxConfigSize = 1 << 20
+	files := map[string][]byte{}
+	err := walkImageTarball(archive, func(hdr *tar.Header, r io.Reader) error {
+		by, err := io.ReadAll(io.LimitReader(r, maxConfigSize+1))
+		if err != nil {
+			return err
+		}
+		if len(by) <= maxConfigSize {
+			files[hdr.Name] = by
+		}
+		return nil
+	})
+	if err != nil {
+		return savedImage{}, nil, err
+	}
+	var manifests []savedImage
+	if err := json.Unmarshal(files["manifest.json"], &manifests); err != nil {
+		return savedImage{}, nil, fmt.Errorf("failed to read image manifest.json: %v", err)
+	}
+	if len(manifests) == 0 {
+		return savedImage{}, nil, fmt.Errorf("image manifest.json lists no images")
+	}
+	return manifests[0], files, nil
+}
+
+// RenameImageTarball copies a `docker save` tarball, which may be gzipped, from src to dst, renaming the repositories
+// the images are tagged with. The tags themselves are kept.
+func RenameImageTarball(src, dst string, rename func(repository string) string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	var r io.Reader = in
+	if strings.HasSuffix(src, ".gz") {
+		gz, err := gzip.NewReader(in)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	var w io.Writer = out
+	var gz *gzip.Writer
+	if strings.HasSuffix(dst, ".gz") {
+		gz = gzip.NewWriter(out)
+		w = gz
+	}
+
+	tr := tar.NewReader(r)
+	tw := tar.NewWriter(w)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch hdr.Name {
+		case "manifest.json", "repositories", "index.json":
+			by, err := io.ReadAll(tr)
+			if err != nil {
+				return err
+			}
+			if by, err = renameImageMetadata(hdr.Name, by, rename); err != nil {
+				return fmt.Errorf("failed to rename images in %v: %v", hdr.Name, err)
+			}
+			hdr.Size = int64(len(by))
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if _, err := tw.Write(by); err != nil {
+				return err
+			}
+		default:
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if _, err := io.Copy(tw, tr); err != nil {
+				return err
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return err
+		}
+	}
+	return out.Close()
+}
+
+// renameImageMetadata renames the repositories in one of the files of a `docker save` tarball recording them:
+// manifest.json lists the RepoTags of each image, repositories maps each repository to its tags, and the OCI
+// index.json annotates each image with its reference.
+func renameImageMetadata(name string, by []byte, rename func(repository string) string) ([]byte, error) {
+	renameRef := func(ref string) string {
+		// The tag follows the last colon, unless that colon is part of the registry host
+		if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+			return rename(ref[:i]) + ref[i:]
+		}
+		return rename(ref)
+	}
+	switch name {
+	case "manifest.json":
+		var images []map[string]interface{}
+		if err := json.Unmarshal(by, &images); err != nil {
+			return nil, err
+		}
+		for _, image := range images {
+			tags, _ := image["RepoTags"].([]interface{})
+			for i, tag := range tags {
+				if s, ok := tag.(string); ok {
+					tags[i] = renameRef(s)
+				}
+			}
+		}
+		return json.Marshal(images)
+	case "repositories":
+		var repos map[string]interface{}
+		if err := json.Unmarshal(by, &repos); err != nil {
+			return nil, err
+		}
+		renamed := map[string]interface{}{}
+		for repo, tags := range repos {
+			renamed[rename(repo)] = tags
+		}
+		return json.Marshal(renamed)
+	default:
+		var index map[string]interface{}
+		if err := json.Unmarshal(by, &index); err != nil {
+			return nil, err
+		}
+		manifests, _ := index["manifests"].([]interface{})
+		for _, m := range manifests {
+			entry, _ := m.(map[string]interface{})
+			annotations, _ := entry["annotations"].(map[string]interface{})
+			if ref, ok := annotations["io.containerd.image.name"].(string); ok {
+				annotations["io.containerd.image.name"] = renameRef(ref)
+			}
+		}
+		return json.Marshal(index)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"encoding/json"
+	"path"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/alauda-mesh/release-builder/pkg/testutil"
+)
+
+func TestRenameImageTarball(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "pilot-distroless.tar.gz")
+	testutil.WriteArchive(t, src,
+		testutil.Entry{Name: "blobs/sha256/config", Content: `{"config":{}}`},
+		testutil.Entry{Name: "blobs/sha256/layer", Content: "layer"},
+		testutil.Entry{
+			Name:    "manifest.json",
+			Content: `[{"Config":"blobs/sha256/config","RepoTags":["localhost:5000/istio/pilot:1.2.3-distroless"],"Layers":["blobs/sha256/layer"]}]`,
+		},
+		testutil.Entry{Name: "repositories", Content: `{"localhost:5000/istio/pilot":{"1.2.3-distroless":"abc"}}`},
+		testutil.Entry{
+			Name:    "index.json",
+			Content: `{"manifests":[{"annotations":{"io.containerd.image.name":"localhost:5000/istio/pilot:1.2.3-distroless"}}]}`,
+		},
+	)
+
+	dst := filepath.Join(dir, "istiod-distroless.tar.gz")
+	err := RenameImageTarball(src, dst, func(repository string) string {
+		if hub, name := path.Split(repository); name == "pilot" {
+			return hub + "istiod"
+		}
+		return repository
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tags, err := ImageRepoTags(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"localhost:5000/istio/istiod:1.2.3-distroless"}; !reflect.DeepEqual(tags, want) {
+		t.Fatalf("expected tags %v, got %v", want, tags)
+	}
+	_, files, err := readImageTarball(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(files["blobs/sha256/layer"]); got != "layer" {
+		t.Fatalf("expected layer to be copied, got %q", got)
+	}
+	var repos map[string]interface{}
+	if err := json.Unmarshal(files["repositories"], &repos); err != nil {
+		t.Fatal(err)
+	}
+	if _, f := repos["localhost:5000/istio/istiod"]; !f || len(repos) != 1 {
+		t.Fatalf("expected renamed repository, got %v", repos)
+	}
+	var index struct {
+		Manifests []struct {
+			Annotations map[string]string `json:"annotations"`
+		} `json:"manifests"`
+	}
+	if err := json.Unmarshal(files["index.json"], &index); err != nil {
+		t.Fatal(err)
+	}
+	if got := index.Manifests[0].Annotations["io.containerd.image.name"]; got != "localhost:5000/istio/istiod:1.2.3-distroless" {
+		t.Fatalf("expected renamed index annotation, got %v", got)
+	}
+}
+
+func TestImageFiles(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "proxyv2-distroless.tar.gz")
+	lower := testutil.Empty("etc/istio/extensions/stats.wasm", "etc/istio/extensions/removed.wasm", "./usr/local/bin/envoy", "var/lib/old/file")
+	upper := testutil.Empty("etc/istio/extensions/.wh.removed.wasm", "var/lib/old/.wh..wh..opq", "var/lib/old/new", "etc/istio/extensions/metadata.wasm")
+	testutil.WriteArchive(t, archive,
+		testutil.Entry{Name: "blobs/sha256/lower", Content: string(testutil.TarBytes(t, false, lower...))},
+		// Layers may be compressed
+		testutil.Entry{Name: "blobs/sha256/upper", Content: string(testutil.TarBytes(t, true, upper...))},
+		testutil.Entry{Name: "blobs/sha256/config", Content: `{"config":{}}`},
+		// docker save writes manifest.json after the layers
+		testutil.Entry{
+			Name:    "manifest.json",
+			Content: `[{"Config":"blobs/sha256/config","RepoTags":["istio/proxyv2:1.2.3-distroless"],"Layers":["blobs/sha256/lower","blobs/sha256/upper"]}]`,
+		},
+	)
+
+	files, err := ImageFiles(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]struct{}{
+		"/etc/istio/extensions/stats.wasm":    {},
+		"/etc/istio/extensions/metadata.wasm": {},
+		"/usr/local/bin/envoy":                {},
+		"/var/lib/old/new":                    {},
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Fatalf("expected files %v, got %v", want, files)
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+
+	"istio.io/istio/pkg/log"
+)
+
+var (
+	// LogSummaryLines is how many of the last lines of output a failed command's summary includes
+	LogSummaryLines = 30
+	// LogErrorPatterns are regular expressions matching the lines of output a failed command's summary includes,
+	// wherever they appear in the output
+	LogErrorPatterns = []string{`Error:`, `FAILED`, `fatal:`}
+)
+
+// maxSummaryMatches limits how many lines matching the error patterns a summary includes, keeping the first ones, as
+// later errors are often caused by earlier ones
+const maxSummaryMatches = 50
+
+// LogSummary is a writer recording the last lines, and the lines matching error patterns, of a command's output, so
+// the cause of a failure can be found without searching the full output
+type LogSummary struct {
+	lines    int
+	patterns []*regexp.Regexp
+	// mu guards the lines recorded, as a command writes stdout and stderr concurrently
+	mu      sync.Mutex
+	tail    []string
+	matches []string
+	// out is the stream written by Write
+	out *summaryStream
+}
+
+// summaryStream is a stream of output recorded by a summary, buffering its incomplete last line
+type summaryStream struct {
+	summary *LogSummary
+	partial []byte
+}
+
+// NewLogSummary returns a summary of the last lines of output, and the lines matching any of the patterns
+func NewLogSummary(lines int, patterns []string) (*LogSummary, error) {
+	s := &LogSummary{lines: lines}
+	s.out = &summaryStream{summary: s}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid error pattern %q: %v", p, err)
+		}
+		s.patterns = append(s.patterns, re)
+	}
+	return s, nil
+}
+
+// Write records the complete lines of p, buffering any incomplete last line
+func (s *LogSummary) Write(p []byte) (int, error) {
+	return s.out.Write(p)
+}
+
+// Stream returns a writer recording another stream of output, such as stderr, in the summary. Each stream buffers its
+// own incomplete line, so lines of the streams are not mixed.
+func (s *LogSummary) Stream() io.Writer {
+	return &summaryStream{summary: s}
+}
+
+func (w *summaryStream) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.summary.addLine(string(w.partial[:i]))
+		w.partial = w.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+func (s *LogSummary) addLine(line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	line = strings.TrimRight(line, "\r")
+	if len(s.matches) < maxSummaryMatches && s.matchesError(line) {
+		s.matches = append(s.matches, line)
+	}
+	if s.lines <= 0 {
+		return
+	}
+	s.tail = append(s.tail, line)
+	if len(s.tail) > s.lines {
+		s.tail = s.tail[len(s.tail)-s.lines:]
+	}
+}
+
+// matchesError returns whether a line matches any of the error patterns
+func (s *LogSummary) matchesError(line string) bool {
+	for _, re := range s.patterns {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the lines matching the error patterns, followed by the last lines of output
+func (s *LogSummary) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tail, matches := s.tail, s.matches
+	if last := string(s.out.partial); last != "" {
+		// Output that did not end with a newline
+		if len(matches) < maxSummaryMatches && s.matchesError(last) {
+			matches = append(append([]string{}, matches...), last)
+		}
+		if s.lines > 0 {
+			tail = append(append([]string{}, tail...), last)
+			if len(tail) > s.lines {
+				tail = tail[len(tail)-s.lines:]
+			}
+		}
+	}
+	sb := strings.Builder{}
+	if len(matches) > 0 {
+		sb.WriteString("Lines matching error patterns:\n")
+		for _, l := range matches {
+			sb.WriteString("  " + l + "\n")
+		}
+	}
+	if len(tail) > 0 {
+		fmt.Fprintf(&sb, "Last %d lines:\n", len(tail))
+		for _, l := range tail {
+			sb.WriteString("  " + l + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// RunSummarized runs a command, streaming its output as before, and logs a summary of the output if it fails. The
+// error is returned unchanged.
+func RunSummarized(cmd *exec.Cmd) error {
+	summary, err := NewLogSummary(LogSummaryLines, LogErrorPatterns)
+	if err != nil {
+		log.Warnf("Not summarizing the output of %v: %v", cmd.Path, err)
+		return cmd.Run()
+	}
+	stdout, stderr := cmd.Stdout, cmd.Stderr
+	cmd.Stdout = teeWriter(stdout, summary)
+	if stderr == stdout {
+		// Keep a single writer, so interleaved output is not split
+		cmd.Stderr = cmd.Stdout
+	} else {
+		cmd.Stderr = teeWriter(stderr, summary.Stream())
+	}
+	defer func() { cmd.Stdout, cmd.Stderr = stdout, stderr }()
+	if err := cmd.Run(); err != nil {
+		if s := summary.String(); s != "" {
+			log.Errorf("%v failed: %v\n%v", strings.Join(cmd.Args, " "), err, s)
+		}
+		return err
+	}
+	return nil
+}
+
+// teeWriter writes to w, if set, and to the summary
+func teeWriter(w, summary io.Writer) io.Writer {
+	if w == nil {
+		return summary
+	}
+	return io.MultiWriter(w, summary)
+}
@@ -0,0 +1,129 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+const makeLog = `go build -o out/linux_amd64/pilot-discovery ./pilot/cmd/pilot-discovery
+# istio.io/istio/pilot/pkg/model
+pilot/pkg/model/push_context.go:123:2: undefined: foo
+make[1]: *** [Makefile.core.mk:200: build] Error 1
+make: *** [Makefile:49: build] Error 2
+`
+
+const helmLog = `Saving 1 charts
+Deleting outdated charts
+Error: found in Chart.yaml, but missing in charts/ directory: base
+`
+
+const dockerLog = `#5 [2/4] RUN apt-get update
+#5 0.512 E: Unable to locate package foo
+#5 ERROR: process "/bin/sh -c apt-get update" did not complete successfully: exit code: 100
+------
+ > [2/4] RUN apt-get update:
+------
+fatal: unable to access 'https://github.com/istio/istio/': Could not resolve host
+FAILED: docker.pilot`
+
+func TestLogSummary(t *testing.T) {
+	cases := []struct {
+		name     string
+		log      string
+		lines    int
+		patterns []string
+		matches  []string
+		tail     []string
+	}{
+		{
+			name:     "make",
+			log:      makeLog,
+			lines:    2,
+			patterns: []string{`Error \d+$`},
+			matches:  []string{"make[1]: *** [Makefile.core.mk:200: build] Error 1", "make: *** [Makefile:49: build] Error 2"},
+			tail:     []string{"make[1]: *** [Makefile.core.mk:200: build] Error 1", "make: *** [Makefile:49: build] Error 2"},
+		},
+		{
+			name:     "helm",
+			log:      helmLog,
+			lines:    1,
+			patterns: LogErrorPatterns,
+			matches:  []string{"Error: found in Chart.yaml, but missing in charts/ directory: base"},
+			tail:     []string{"Error: found in Chart.yaml, but missing in charts/ directory: base"},
+		},
+		{
+			name:     "docker without trailing newline",
+			log:      dockerLog,
+			lines:    3,
+			patterns: LogErrorPatterns,
+			matches:  []string{"fatal: unable to access 'https://github.com/istio/istio/': Could not resolve host", "FAILED: docker.pilot"},
+			tail:     []string{"------", "fatal: unable to access 'https://github.com/istio/istio/': Could not resolve host", "FAILED: docker.pilot"},
+		},
+		{
+			name:     "no matches",
+			log:      "a\nb\nc\n",
+			lines:    5,
+			patterns: LogErrorPatterns,
+			tail:     []string{"a", "b", "c"},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewLogSummary(tt.lines, tt.patterns)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Write in small chunks, splitting lines, as a command's output arrives
+			for i := 0; i < len(tt.log); i += 7 {
+				if _, err := s.Write([]byte(tt.log[i:min(i+7, len(tt.log))])); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want := ""
+			if len(tt.matches) > 0 {
+				want += "Lines matching error patterns:\n  " + strings.Join(tt.matches, "\n  ") + "\n"
+			}
+			want += fmt.Sprintf("Last %d lines:\n  %v\n", len(tt.tail), strings.Join(tt.tail, "\n  "))
+			if got := s.String(); got != want {
+				t.Fatalf("expected summary\n%v\ngot\n%v", want, got)
+			}
+		})
+	}
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		if _, err := NewLogSummary(1, []string{"("}); err == nil {
+			t.Fatalf("expected error for invalid pattern")
+		}
+	})
+}
+
+func TestRunSummarized(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "echo building; echo 'Error: boom' >&2; exit 3")
+	stdout := &strings.Builder{}
+	cmd.Stdout = stdout
+	if err := RunSummarized(cmd); err == nil || !strings.Contains(err.Error(), "exit status 3") {
+		t.Fatalf("expected the command error unchanged, got %v", err)
+	}
+	if stdout.String() != "building\n" {
+		t.Fatalf("expected the output to still be streamed, got %q", stdout.String())
+	}
+	if cmd.Stdout != stdout || cmd.Stderr != nil {
+		t.Fatalf("expected the command writers to be restored")
+	}
+}
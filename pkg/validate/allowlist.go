@@ -0,0 +1,130 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"istio.io/istio/pkg/log"
+
+	"github.com/alauda-mesh/release-builder/pkg"
+)
+
+// The allowlist has one line per file, in the form `<arch> <path>`. Paths are relative to the istio-<version>
+// directory, so the allowlist does not change between releases. Empty lines and lines starting with # are ignored.
+
+// TestArchiveAllowlist compares the files in each release archive with the allowlist, failing if any file is not
+// expected. Expected files that are missing only produce a warning, as other checks cover required files.
+func TestArchiveAllowlist(r ReleaseInfo) error {
+	if r.allowlist == "" {
+		return nil
+	}
+	by, err := os.ReadFile(r.allowlist)
+	if err != nil {
+		return fmt.Errorf("failed to read allowlist: %v", err)
+	}
+	expected := parseAllowlist(string(by))
+	actual, err := archiveFiles(r)
+	if err != nil {
+		return err
+	}
+	unexpected, missing := compareAllowlist(actual, expected)
+	for _, f := range missing {
+		log.Warnf("File %v is in the allowlist, but not in the release", f)
+	}
+	if len(unexpected) > 0 {
+		return fmt.Errorf("found files not in the allowlist %v: %v", r.allowlist, strings.Join(unexpected, ", "))
+	}
+	return nil
+}
+
+// WriteAllowlist writes an allowlist of the files in the archives of a release, to accept intentional changes
+func WriteAllowlist(release, file string) error {
+	manifest, err := pkg.ReadManifest(filepath.Join(release, "manifest.yaml"))
+	if err != nil {
+		return err
+	}
+	files, err := archiveFiles(ReleaseInfo{release: release, manifest: manifest})
+	if err != nil {
+		return err
+	}
+	sb := strings.Builder{}
+	sb.WriteString("# Files expected in the release archives. Regenerate with `validate --update-allowlist`.\n")
+	for _, f := range files {
+		sb.WriteString(f + "\n")
+	}
+	if err := os.WriteFile(file, []byte(sb.String()), 0o644); err != nil {
+		return fmt.Errorf("failed to write allowlist: %v", err)
+	}
+	return nil
+}
+
+// archiveFiles lists the files in the archive of every architecture, in allowlist form
+func archiveFiles(r ReleaseInfo) ([]string, error) {
+	prefix := "istio-" + r.manifest.Version + "/"
+	var files []string
+	for _, arch := range r.manifest.GetArchiveArchitectures() {
+		src := releaseArchive(r.release, r.manifest.Version, arch)
+		modes, err := archiveModes(src)
+		if err != nil {
+			return nil, missingArtifact(src, err)
+		}
+		for name, mode := range modes {
+			if mode.IsDir() {
+				continue
+			}
+			files = append(files, arch+" "+strings.TrimPrefix(name, prefix))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func parseAllowlist(contents string) []string {
+	var files []string
+	for _, l := range strings.Split(contents, "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		files = append(files, l)
+	}
+	return files
+}
+
+// compareAllowlist returns the actual files not in expected, and the expected files not in actual, both sorted
+func compareAllowlist(actual, expected []string) (unexpected []string, missing []string) {
+	want := map[string]struct{}{}
+	for _, f := range expected {
+		want[f] = struct{}{}
+	}
+	for _, f := range actual {
+		if _, f2 := want[f]; f2 {
+			delete(want, f)
+			continue
+		}
+		unexpected = append(unexpected, f)
+	}
+	for f := range want {
+		missing = append(missing, f)
+	}
+	sort.Strings(unexpected)
+	sort.Strings(missing)
+	return unexpected, missing
+}
@@ -0,0 +1,239 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ValueChange describes a value in a YAML file that differs between two archives, keyed by its path such as
+// spec.values.global.hub. From is empty for an added value, and To is empty for a removed one.
+type ValueChange struct {
+	Path string
+	From string
+	To   string
+}
+
+// FileChange describes a file whose content differs between two archives. Values lists the changed values of a YAML
+// file, and is empty for other files.
+type FileChange struct {
+	Name   string
+	Values []ValueChange
+}
+
+// ArchiveDiff describes what changed between two release archives. File names exclude the top level directory, such
+// as istio-1.2.3, so files are matched across versions.
+type ArchiveDiff struct {
+	Added   []string
+	Removed []string
+	Changed []FileChange
+}
+
+// archiveEntry is a file read from an archive. The content is only kept for YAML files.
+type archiveEntry struct {
+	sha     [sha256.Size]byte
+	content []byte
+}
+
+// DiffArchives compares archive a, which may be a path or an http(s) URL, such as the archive of the previous release,
+// to archive b
+func DiffArchives(a, b string) (ArchiveDiff, error) {
+	d := ArchiveDiff{}
+	a, cleanup, err := fetchArchive(a)
+	if err != nil {
+		return d, err
+	}
+	defer cleanup()
+	from, err := readArchiveEntries(a)
+	if err != nil {
+		return d, fmt.Errorf("failed to read %v: %v", a, err)
+	}
+	to, err := readArchiveEntries(b)
+	if err != nil {
+		return d, fmt.Errorf("failed to read %v: %v", b, err)
+	}
+	for name, t := range to {
+		f, found := from[name]
+		if !found {
+			d.Added = append(d.Added, name)
+			continue
+		}
+		if f.sha != t.sha {
+			d.Changed = append(d.Changed, FileChange{Name: name, Values: diffYaml(f.content, t.content)})
+		}
+	}
+	for name := range from {
+		if _, found := to[name]; !found {
+			d.Removed = append(d.Removed, name)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Slice(d.Changed, func(i, j int) bool { return d.Changed[i].Name < d.Changed[j].Name })
+	return d, nil
+}
+
+// fetchArchive downloads an archive given as an http(s) URL to a temporary file, returning its path and a function
+// removing it. Other archives are returned as is.
+func fetchArchive(src string) (string, func(), error) {
+	u, err := url.Parse(src)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return src, func() {}, nil
+	}
+	resp, err := http.Get(src)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to download %v: %v", src, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("failed to download %v: unexpected status %v", src, resp.Status)
+	}
+	dir, err := os.MkdirTemp("", "release-archive")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	// The name is kept, as the archive format is detected from its extension
+	dst := filepath.Join(dir, path.Base(u.Path))
+	f, err := os.Create(dst)
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to download %v: %v", src, err)
+	}
+	return dst, cleanup, nil
+}
+
+// readArchiveEntries reads the files in an archive, keyed by their name without the top level directory
+func readArchiveEntries(archive string) (map[string]archiveEntry, error) {
+	entries := map[string]archiveEntry{}
+	err := walkArchive(archive, func(name string, mode os.FileMode, r io.Reader) error {
+		if mode.IsDir() {
+			return nil
+		}
+		_, name, _ = strings.Cut(strings.TrimPrefix(name, "./"), "/")
+		if name == "" {
+			return nil
+		}
+		by, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		e := archiveEntry{sha: sha256.Sum256(by)}
+		if ext := path.Ext(name); ext == ".yaml" || ext == ".yml" {
+			e.content = by
+		}
+		entries[name] = e
+		return nil
+	})
+	return entries, err
+}
+
+// diffYaml returns the values that differ between two YAML documents, or nil if either is not a YAML map
+func diffYaml(a, b []byte) []ValueChange {
+	if len(a) == 0 || len(b) == 0 {
+		return nil
+	}
+	av, err := getValues(a)
+	if err != nil {
+		return nil
+	}
+	bv, err := getValues(b)
+	if err != nil {
+		return nil
+	}
+	from, to := map[string]string{}, map[string]string{}
+	flattenValues("", av, from)
+	flattenValues("", bv, to)
+	changes := []ValueChange{}
+	for p, t := range to {
+		if f := from[p]; f != t {
+			changes = append(changes, ValueChange{Path: p, From: f, To: t})
+		}
+	}
+	for p, f := range from {
+		if _, found := to[p]; !found {
+			changes = append(changes, ValueChange{Path: p, From: f})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// flattenValues records each scalar value in v by its path, joining map keys with . and indexing lists with [i]
+func flattenValues(prefix string, v interface{}, out map[string]string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			p := k
+			if prefix != "" {
+				p = prefix + "." + k
+			}
+			flattenValues(p, val, out)
+		}
+	case []interface{}:
+		for i, val := range v {
+			flattenValues(fmt.Sprintf("%s[%d]", prefix, i), val, out)
+		}
+	default:
+		out[prefix] = fmt.Sprint(v)
+	}
+}
+
+// Empty returns true if the archives had no differences
+func (d ArchiveDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// String formats the diff for review, with one change per line
+func (d ArchiveDiff) String() string {
+	if d.Empty() {
+		return "No changes.\n"
+	}
+	sb := strings.Builder{}
+	for _, name := range d.Added {
+		sb.WriteString(fmt.Sprintf("+ %s\n", name))
+	}
+	for _, name := range d.Removed {
+		sb.WriteString(fmt.Sprintf("- %s\n", name))
+	}
+	for _, c := range d.Changed {
+		sb.WriteString(fmt.Sprintf("~ %s\n", c.Name))
+		for _, v := range c.Values {
+			switch {
+			case v.From == "":
+				sb.WriteString(fmt.Sprintf("    + %s: %s\n", v.Path, v.To))
+			case v.To == "":
+				sb.WriteString(fmt.Sprintf("    - %s: %s\n", v.Path, v.From))
+			default:
+				sb.WriteString(fmt.Sprintf("    ~ %s: %s -> %s\n", v.Path, v.From, v.To))
+			}
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,86 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/alauda-mesh/release-builder/pkg/testutil"
+)
+
+func TestDiffArchives(t *testing.T) {
+	dir := t.TempDir()
+	from := filepath.Join(dir, "istio-1.20.0-linux-amd64.tar.gz")
+	to := filepath.Join(dir, "istio-1.20.1-linux-amd64.tar.gz")
+	testutil.WriteArchive(t, from, testutil.Files(map[string]string{
+		"istio-1.20.0/bin/istioctl":                  "istioctl 1.20.0",
+		"istio-1.20.0/manifests/profiles/demo.yaml":  "spec:\n  values:\n    global:\n      hub: docker.io/istio\n      tag: 1.20.0\n",
+		"istio-1.20.0/manifests/profiles/empty.yaml": "spec: {}\n",
+		"istio-1.20.0/samples/removed.yaml":          "kind: Service\n",
+	})...)
+	testutil.WriteArchive(t, to, testutil.Files(map[string]string{
+		"istio-1.20.1/bin/istioctl":                  "istioctl 1.20.1",
+		"istio-1.20.1/manifests/profiles/demo.yaml":  "spec:\n  values:\n    global:\n      hub: docker.io/istio\n      tag: 1.20.1\n      logAsJson: true\n",
+		"istio-1.20.1/manifests/profiles/empty.yaml": "spec: {}\n",
+		"istio-1.20.1/samples/added.yaml":            "kind: Service\n",
+	})...)
+
+	d, err := DiffArchives(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := ArchiveDiff{
+		Added:   []string{"samples/added.yaml"},
+		Removed: []string{"samples/removed.yaml"},
+		Changed: []FileChange{
+			{Name: "bin/istioctl"},
+			{Name: "manifests/profiles/demo.yaml", Values: []ValueChange{
+				{Path: "spec.values.global.logAsJson", To: "true"},
+				{Path: "spec.values.global.tag", From: "1.20.0", To: "1.20.1"},
+			}},
+		},
+	}
+	if !reflect.DeepEqual(d, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, d)
+	}
+	expectedReport := `+ samples/added.yaml
+- samples/removed.yaml
+~ bin/istioctl
+~ manifests/profiles/demo.yaml
+    + spec.values.global.logAsJson: true
+    ~ spec.values.global.tag: 1.20.0 -> 1.20.1
+`
+	if got := d.String(); got != expectedReport {
+		t.Fatalf("expected report:\n%v\ngot:\n%v", expectedReport, got)
+	}
+
+	// The previous archive may be downloaded
+	server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer server.Close()
+	d, err = DiffArchives(server.URL+"/istio-1.20.0-linux-amd64.tar.gz", from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Empty() {
+		t.Fatalf("expected no changes, got %v", d)
+	}
+	if _, err := DiffArchives(server.URL+"/missing.tar.gz", from); err == nil {
+		t.Fatalf("expected error downloading missing archive")
+	}
+}
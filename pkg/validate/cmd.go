@@ -23,7 +23,24 @@ import (
 
 var (
 	flags = struct {
-		release string
+		release         string
+		allowlist       string
+		updateAllowlist bool
+		provenance      string
+		builderID       string
+		hub             string
+		tag             string
+		mirrorRewrites  []string
+		junit           string
+		imageSource     string
+		lineEndingFiles []string
+		nonRootDebug    bool
+		rootImages      []string
+		samplesDir      string
+		cosignPublicKey string
+		installPackages bool
+		baseChart       string
+		extractDir      string
 	}{}
 
 	validateCmd = &cobra.Command{
@@ -32,26 +49,138 @@ var (
 		SilenceUsage: true,
 		Args:         cobra.ExactArgs(0),
 		RunE: func(c *cobra.Command, _ []string) error {
-			passed, info, failed := CheckRelease(flags.release)
-			for _, pass := range passed {
-				log.Infof("Check passed: %v", pass)
+			if flags.updateAllowlist {
+				if flags.release == "" || flags.allowlist == "" {
+					return fmt.Errorf("--release and --allowlist must be passed to update the allowlist")
+				}
+				if err := WriteAllowlist(flags.release, flags.allowlist); err != nil {
+					return err
+				}
+				log.Infof("Wrote allowlist to %v", flags.allowlist)
+				return nil
 			}
-			for _, fail := range failed {
-				log.Infof("Check failed: %v", fail)
+			rewrites := []MirrorRewrite{}
+			for _, rw := range flags.mirrorRewrites {
+				parsed, err := ParseMirrorRewrite(rw)
+				if err != nil {
+					return err
+				}
+				rewrites = append(rewrites, parsed)
+			}
+			results, info, err := CheckReleaseStructured(flags.release, CheckOptions{
+				Allowlist:       flags.allowlist,
+				Provenance:      flags.provenance,
+				BuilderID:       flags.builderID,
+				Hub:             flags.hub,
+				Tag:             flags.tag,
+				MirrorRewrites:  rewrites,
+				ImageSource:     ImageSource(flags.imageSource),
+				LineEndingFiles: flags.lineEndingFiles,
+				NonRootDebug:    flags.nonRootDebug,
+				RootImages:      flags.rootImages,
+				SamplesDir:      flags.samplesDir,
+				CosignPublicKey: flags.cosignPublicKey,
+				InstallPackages: flags.installPackages,
+				BaseChart:       flags.baseChart,
+				ExtractDir:      flags.extractDir,
+			})
+			if err != nil {
+				return err
+			}
+			if flags.junit != "" {
+				if err := WriteJUnit(results, flags.junit); err != nil {
+					return err
+				}
+			}
+			failed := 0
+			for _, res := range results {
+				if res.Err == nil {
+					log.Infof("Check passed: %v", res.Name)
+				}
+			}
+			for _, res := range results {
+				if res.Err != nil {
+					log.Infof("Check failed: check %v failed: %v", res.Name, res.Err)
+					failed++
+				}
 			}
 			log.Infof("Debug output:\n%v", info)
-			if len(failed) > 0 {
+			if failed > 0 {
 				return fmt.Errorf("release validation FAILED")
 			}
 			log.Info("Release validation PASSED")
 			return nil
 		},
 	}
+
+	imageCmd = &cobra.Command{
+		Use:          "image <tarball>...",
+		Short:        "Validates docker image tarballs, without a release",
+		SilenceUsage: true,
+		Args:         cobra.MinimumNArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			if flags.hub == "" || flags.tag == "" {
+				return fmt.Errorf("--hub and --tag must be passed to validate an image")
+			}
+			failed := 0
+			for _, tarball := range args {
+				res, err := ValidateImageTarball(tarball, flags.hub, flags.tag)
+				if err != nil {
+					log.Infof("Image failed: %v", err)
+					failed++
+					continue
+				}
+				log.Infof("Image passed: %v, tagged %v, architecture %v, version %q", tarball, res.RepoTags, res.Architecture, res.Version)
+			}
+			if failed > 0 {
+				return fmt.Errorf("image validation FAILED")
+			}
+			return nil
+		},
+	}
 )
 
 func init() {
 	validateCmd.PersistentFlags().StringVar(&flags.release, "release", flags.release,
 		"The release to validate.")
+	validateCmd.PersistentFlags().StringVar(&flags.allowlist, "allowlist", flags.allowlist,
+		"A file listing every file expected in the release archives. Unexpected files fail validation.")
+	validateCmd.PersistentFlags().BoolVar(&flags.updateAllowlist, "update-allowlist", flags.updateAllowlist,
+		"Regenerate the --allowlist file from the files in the release, rather than validating the release.")
+	validateCmd.PersistentFlags().StringVar(&flags.provenance, "provenance", flags.provenance,
+		"The SLSA provenance of the release, relative to the release. If set, it must list every release artifact.")
+	validateCmd.PersistentFlags().StringVar(&flags.builderID, "provenance-builder-id", flags.builderID,
+		"The builder id the --provenance must have.")
+	validateCmd.PersistentFlags().StringVar(&flags.hub, "hub", flags.hub,
+		"The hub the release images are expected to have, if it differs from the release manifest, such as for a mirrored release.")
+	validateCmd.PersistentFlags().StringVar(&flags.tag, "tag", flags.tag,
+		"The tag the release images are expected to have, if it differs from the release manifest version.")
+	validateCmd.PersistentFlags().StringArrayVar(&flags.mirrorRewrites, "mirror-rewrite", flags.mirrorRewrites,
+		"A rewrite of the release hub prefix, as <from>=<to>, such as docker.io=mirror.example.com, for a release mirrored "+
+			"to another registry. May be repeated; the first matching rewrite applies.")
+	validateCmd.PersistentFlags().StringVar(&flags.junit, "junit", flags.junit,
+		"If set, write the result of each check to this file as JUnit XML.")
+	validateCmd.PersistentFlags().StringVar(&flags.imageSource, "image-source", string(ImageSourceRelease),
+		"Where images run by the checks come from: release loads them from the release, registry pulls them from the "+
+			"release hub, using the docker credentials, to validate published images.")
+	validateCmd.PersistentFlags().StringSliceVar(&flags.lineEndingFiles, "line-ending-files", DefaultLineEndingFiles,
+		"Patterns of the files in the release archive that must have LF line endings. A **/ segment matches any directories.")
+	validateCmd.PersistentFlags().BoolVar(&flags.nonRootDebug, "non-root-debug", flags.nonRootDebug,
+		"Require debug images, like distroless images, to run as a non-root user.")
+	validateCmd.PersistentFlags().StringSliceVar(&flags.rootImages, "root-images", DefaultRootImages,
+		"The names of the images, without their variant, allowed to run as root.")
+	validateCmd.PersistentFlags().StringVar(&flags.samplesDir, "samples-dir", DefaultSamplesDir,
+		"The directory of the samples in the release archive, whose YAML files must all parse.")
+	validateCmd.PersistentFlags().StringVar(&flags.cosignPublicKey, "cosign-public-key", flags.cosignPublicKey,
+		"The trusted public key cosign signatures of the archives are verified with. Required for signatures made with a key file.")
+	validateCmd.PersistentFlags().BoolVar(&flags.installPackages, "install-packages", flags.installPackages,
+		"Install the deb and rpm packages in debian and rhel containers, checking they install cleanly. Requires docker.")
+	validateCmd.PersistentFlags().StringVar(&flags.baseChart, "base-chart", DefaultBaseChart,
+		"The name of the chart shipping the CRDs the other charts in the release archive depend on.")
+	validateCmd.PersistentFlags().StringVar(&flags.extractDir, "extract-dir", flags.extractDir,
+		"The directory the release archive is extracted to. If set, the extracted archive is kept and reused by later "+
+			"runs until the archive changes. By default it is extracted to a new temporary directory.")
+	validateCmd.AddCommand(imageCmd)
 }
 
 func GetValidateCommand() *cobra.Command {
@@ -0,0 +1,76 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/alauda-mesh/release-builder/pkg/util"
+)
+
+// verifyBlob runs `cosign verify-blob` with the given arguments
+var verifyBlob = func(args ...string) error {
+	cmd := util.VerboseCommand("cosign", append([]string{"verify-blob"}, args...)...)
+	if err := util.RunSummarized(cmd); err != nil {
+		return commandFailed(cmd, err)
+	}
+	return nil
+}
+
+// TestCosignSignatures checks each release archive and its checksum files have a cosign signature, if the manifest
+// enabled cosign signing, and verifies it. Signatures made with a key are verified with the public key passed to
+// validation, or a KMS key of the manifest; never with the public key in the release, which could be replaced along
+// with the signatures. Keyless signatures are verified against the identity and issuer of the manifest.
+func TestCosignSignatures(r ReleaseInfo) error {
+	c := r.manifest.CosignSigning
+	if c == nil {
+		return nil
+	}
+	files, err := util.SignedFiles(r.release)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return &ErrMissingArtifact{Path: filepath.Join(r.release, "istio-*")}
+	}
+	key := r.cosignPublicKey
+	if key == "" {
+		key = c.VerificationKey()
+	}
+	if key == "" && !c.Keyless() {
+		return errors.New("signatures made with a key file must be verified with a trusted public key, passed with --cosign-public-key")
+	}
+	for _, file := range files {
+		args := []string{"--signature", file + ".sig"}
+		required := []string{file + ".sig"}
+		if c.Keyless() {
+			args = append(args, "--certificate", file+".pem", "--certificate-identity", c.Identity, "--certificate-oidc-issuer", c.Issuer)
+			required = append(required, file+".pem")
+		} else {
+			args = append(args, "--key", key)
+		}
+		for _, f := range required {
+			if !util.FileExists(f) {
+				return &ErrMissingArtifact{Path: f}
+			}
+		}
+		if err := verifyBlob(append(args, file)...); err != nil {
+			return fmt.Errorf("invalid signature of %v: %w", filepath.Base(file), err)
+		}
+	}
+	return nil
+}
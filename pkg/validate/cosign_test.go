@@ -0,0 +1,168 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+)
+
+func TestCosignSignaturesCheck(t *testing.T) {
+	keyless := &model.CosignSigning{Identity: "release@example.com", Issuer: "https://accounts.example.com"}
+	cases := []struct {
+		name      string
+		signing   *model.CosignSigning
+		publicKey string
+		files     []string
+		invalid   string
+		wantArgs  string
+		wantErr   string
+	}{
+		{name: "unconfigured"},
+		{
+			name:     "kms key",
+			signing:  &model.CosignSigning{Key: "gcpkms://key"},
+			files:    []string{"istio-1.2.3-linux-amd64.tar.gz", "istio-1.2.3-linux-amd64.tar.gz.sig"},
+			wantArgs: "--signature istio-1.2.3-linux-amd64.tar.gz.sig --key gcpkms://key istio-1.2.3-linux-amd64.tar.gz",
+		},
+		{
+			name:      "key passed to validation",
+			signing:   &model.CosignSigning{Key: "cosign.key"},
+			publicKey: "/keys/release.pub",
+			files:     []string{"istio-1.2.3-linux-amd64.tar.gz", "istio-1.2.3-linux-amd64.tar.gz.sig"},
+			wantArgs:  "--signature istio-1.2.3-linux-amd64.tar.gz.sig --key /keys/release.pub istio-1.2.3-linux-amd64.tar.gz",
+		},
+		{
+			name:    "public key of the release is not trusted",
+			signing: &model.CosignSigning{Key: "cosign.key"},
+			files:   []string{"istio-1.2.3-linux-amd64.tar.gz", "istio-1.2.3-linux-amd64.tar.gz.sig", "cosign.pub"},
+			wantErr: "--cosign-public-key",
+		},
+		{
+			name:    "keyless",
+			signing: keyless,
+			files:   []string{"istioctl-1.2.3-linux-amd64.tar.gz", "istioctl-1.2.3-linux-amd64.tar.gz.sig", "istioctl-1.2.3-linux-amd64.tar.gz.pem"},
+			wantArgs: "--signature istioctl-1.2.3-linux-amd64.tar.gz.sig --certificate istioctl-1.2.3-linux-amd64.tar.gz.pem " +
+				"--certificate-identity release@example.com --certificate-oidc-issuer https://accounts.example.com istioctl-1.2.3-linux-amd64.tar.gz",
+		},
+		{
+			name:    "keyless missing certificate",
+			signing: keyless,
+			files:   []string{"istio-1.2.3-linux-amd64.tar.gz", "istio-1.2.3-linux-amd64.tar.gz.sig"},
+			wantErr: "istio-1.2.3-linux-amd64.tar.gz.pem",
+		},
+		{
+			name:    "missing signature",
+			signing: keyless,
+			files:   []string{"istio-1.2.3-linux-amd64.tar.gz", "istio-1.2.3-win-amd64.zip", "istio-1.2.3-linux-amd64.tar.gz.sig", "istio-1.2.3-linux-amd64.tar.gz.pem"},
+			wantErr: "istio-1.2.3-win-amd64.zip.sig",
+		},
+		{
+			name:    "missing checksum signature",
+			signing: keyless,
+			files: []string{"istio-1.2.3-linux-amd64.tar.gz", "istio-1.2.3-linux-amd64.tar.gz.sig", "istio-1.2.3-linux-amd64.tar.gz.pem",
+				"istio-1.2.3-linux-amd64.tar.gz.sha256"},
+			wantErr: "istio-1.2.3-linux-amd64.tar.gz.sha256.sig",
+		},
+		{
+			name:    "invalid checksum signature",
+			signing: keyless,
+			files: []string{"istio-1.2.3-linux-amd64.tar.gz", "istio-1.2.3-linux-amd64.tar.gz.sig", "istio-1.2.3-linux-amd64.tar.gz.pem",
+				"istio-1.2.3-linux-amd64.tar.gz.sha256", "istio-1.2.3-linux-amd64.tar.gz.sha256.sig", "istio-1.2.3-linux-amd64.tar.gz.sha256.pem"},
+			invalid: "istio-1.2.3-linux-amd64.tar.gz.sha256",
+			wantErr: "invalid signature of istio-1.2.3-linux-amd64.tar.gz.sha256",
+		},
+		{
+			name:    "invalid signature",
+			signing: keyless,
+			files:   []string{"istio-1.2.3-linux-amd64.tar.gz", "istio-1.2.3-linux-amd64.tar.gz.sig", "istio-1.2.3-linux-amd64.tar.gz.pem"},
+			invalid: "istio-1.2.3-linux-amd64.tar.gz",
+			wantErr: "invalid signature of istio-1.2.3-linux-amd64.tar.gz",
+		},
+		{name: "no archives", signing: keyless, wantErr: "istio-*"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			release := t.TempDir()
+			for _, f := range tt.files {
+				if err := os.WriteFile(filepath.Join(release, f), []byte(f), 0o640); err != nil {
+					t.Fatal(err)
+				}
+			}
+			verified := []string{}
+			orig := verifyBlob
+			verifyBlob = func(args ...string) error {
+				verified = append(verified, strings.ReplaceAll(strings.Join(args, " "), release+"/", ""))
+				if strings.HasSuffix(args[len(args)-1], "/"+tt.invalid) {
+					return errors.New("signature mismatch")
+				}
+				return nil
+			}
+			t.Cleanup(func() { verifyBlob = orig })
+
+			err := TestCosignSignatures(ReleaseInfo{release: release, cosignPublicKey: tt.publicKey, manifest: model.Manifest{CosignSigning: tt.signing}})
+			if tt.wantErr == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+			}
+			if tt.wantArgs != "" && (len(verified) != 1 || verified[0] != tt.wantArgs) {
+				t.Fatalf("expected verification\n%v\ngot\n%v", tt.wantArgs, verified)
+			}
+		})
+	}
+}
+
+func TestCosignSignaturesWithKey(t *testing.T) {
+	if _, err := exec.LookPath("cosign"); err != nil {
+		t.Skip("cosign is not installed")
+	}
+	t.Setenv("COSIGN_PASSWORD", "")
+	release := t.TempDir()
+	run := func(args ...string) {
+		cmd := exec.Command("cosign", args...)
+		cmd.Dir = release
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("cosign %v: %v: %s", args, err, out)
+		}
+	}
+	run("generate-key-pair")
+	archive := filepath.Join(release, "istio-1.2.3-linux-amd64.tar.gz")
+	if err := os.WriteFile(archive, []byte("archive"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	run("sign-blob", "--yes", "--key", "cosign.key", "--output-signature", archive+".sig", archive)
+	r := ReleaseInfo{
+		release:         release,
+		cosignPublicKey: filepath.Join(release, "cosign.pub"),
+		manifest:        model.Manifest{CosignSigning: &model.CosignSigning{Key: "cosign.key"}},
+	}
+	if err := TestCosignSignatures(r); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(archive, []byte("tampered"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := TestCosignSignatures(r); err == nil {
+		t.Fatalf("expected signature of a modified archive to fail verification")
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+)
+
+// DefaultBaseChart is the name of the chart shipping the CRDs the other charts depend on, if CheckOptions does not set
+// one
+const DefaultBaseChart = "base"
+
+var (
+	// resourceAPIVersion and resourceKind match the top level apiVersion and kind of a resource in a chart template
+	resourceAPIVersion = regexp.MustCompile(`(?m)^apiVersion:\s*["']?([a-z0-9.-]+)/([a-z0-9]+)["']?\s*$`)
+	resourceKind       = regexp.MustCompile(`(?m)^kind:\s*["']?([A-Za-z0-9]+)["']?\s*$`)
+)
+
+// crd is the part of a CustomResourceDefinition TestChartCRDs reads
+type crd struct {
+	Kind string `json:"kind"`
+	Spec struct {
+		Group string `json:"group"`
+		Names struct {
+			Kind string `json:"kind"`
+		} `json:"names"`
+		Versions []struct {
+			Name   string `json:"name"`
+			Served bool   `json:"served"`
+		} `json:"versions"`
+	} `json:"spec"`
+}
+
+// resourceRef is a custom resource a chart template creates
+type resourceRef struct {
+	File    string
+	Group   string
+	Version string
+	Kind    string
+}
+
+// TestChartCRDs checks every custom resource the chart templates in the archive create, in an API group the base chart
+// ships CRDs for, has a CRD in the base chart serving its version. Charts otherwise fail to install when the base chart
+// they are installed with lacks a CRD they depend on. Every missing or mismatched CRD is reported.
+func TestChartCRDs(r ReleaseInfo) error {
+	name := r.baseChart
+	if name == "" {
+		name = DefaultBaseChart
+	}
+	charts, err := archiveCharts(r)
+	if err != nil {
+		return err
+	}
+	base, f := charts[name]
+	if !f {
+		return &ErrMissingArtifact{Path: filepath.Join(r.archive, model.ArchiveChartsDir, name)}
+	}
+	crds, err := chartCRDs(base)
+	if err != nil {
+		return err
+	}
+	if len(crds) == 0 {
+		return fmt.Errorf("the %v chart has no CRDs", name)
+	}
+	groups := map[string]struct{}{}
+	for key := range crds {
+		group, _, _ := strings.Cut(key, "/")
+		groups[group] = struct{}{}
+	}
+	names := make([]string, 0, len(charts))
+	for chart := range charts {
+		if chart != name {
+			names = append(names, chart)
+		}
+	}
+	sort.Strings(names)
+	problems := []string{}
+	seen := map[string]struct{}{}
+	for _, chart := range names {
+		refs, err := chartResourceRefs(charts[chart])
+		if err != nil {
+			return err
+		}
+		for _, ref := range refs {
+			if _, f := groups[ref.Group]; !f {
+				continue
+			}
+			problem := ""
+			if served, f := crds[ref.Group+"/"+ref.Kind]; !f {
+				problem = fmt.Sprintf("%v %v creates %v.%v, which has no CRD in the %v chart", chart, ref.File, ref.Kind, ref.Group, name)
+			} else if _, f := served[ref.Version]; !f {
+				problem = fmt.Sprintf("%v %v creates %v.%v %v, but the %v chart CRD only serves %v", chart, ref.File, ref.Kind,
+					ref.Group, ref.Version, name, strings.Join(slices.Sorted(maps.Keys(served)), ", "))
+			}
+			if _, f := seen[problem]; problem != "" && !f {
+				seen[problem] = struct{}{}
+				problems = append(problems, problem)
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("charts depend on CRDs the %v chart does not ship: %v", name, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// archiveCharts returns the directory of each chart in the manifests of the archive, by chart name
+func archiveCharts(r ReleaseInfo) (map[string]string, error) {
+	dir := filepath.Join(r.archive, model.ArchiveChartsDir)
+	charts := map[string]string{}
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || d.Name() != "Chart.yaml" {
+			return nil
+		}
+		by, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		var chart struct {
+			Name string `json:"name"`
+		}
+		if err := yaml.Unmarshal(by, &chart); err != nil {
+			return fmt.Errorf("%v: %v", p, err)
+		}
+		charts[chart.Name] = filepath.Dir(p)
+		return nil
+	})
+	if err != nil {
+		return nil, missingArtifact(dir, err)
+	}
+	return charts, nil
+}
+
+// chartCRDs returns the versions each CRD in a chart serves, keyed by <group>/<kind>. Documents that are not valid
+// YAML, such as templates, are skipped.
+func chartCRDs(dir string) (map[string]map[string]struct{}, error) {
+	crds := map[string]map[string]struct{}{}
+	err := walkChartYaml(dir, func(_ string, doc string) {
+		var c crd
+		if err := yaml.Unmarshal([]byte(doc), &c); err != nil || c.Kind != "CustomResourceDefinition" {
+			return
+		}
+		key := c.Spec.Group + "/" + c.Spec.Names.Kind
+		if crds[key] == nil {
+			crds[key] = map[string]struct{}{}
+		}
+		for _, v := range c.Spec.Versions {
+			if v.Served {
+				crds[key][v.Name] = struct{}{}
+			}
+		}
+	})
+	return crds, err
+}
+
+// chartResourceRefs returns the resources the templates of a chart create. Templates are not valid YAML, so the top
+// level apiVersion and kind of each document are matched instead.
+func chartResourceRefs(dir string) ([]resourceRef, error) {
+	refs := []resourceRef{}
+	err := walkChartYaml(filepath.Join(dir, "templates"), func(file string, doc string) {
+		api := resourceAPIVersion.FindStringSubmatch(doc)
+		kind := resourceKind.FindStringSubmatch(doc)
+		if api == nil || kind == nil {
+			return
+		}
+		rel, _ := filepath.Rel(dir, file)
+		refs = append(refs, resourceRef{File: filepath.ToSlash(rel), Group: api[1], Version: api[2], Kind: kind[1]})
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return refs, err
+}
+
+// walkChartYaml calls fn with each document of the YAML files in a directory
+func walkChartYaml(dir string, fn func(file string, doc string)) error {
+	return filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || (filepath.Ext(p) != ".yaml" && filepath.Ext(p) != ".yml") {
+			return nil
+		}
+		by, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		for _, doc := range yamlDocumentSeparator.Split(string(by), -1) {
+			fn(p, doc)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,103 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/alauda-mesh/release-builder/pkg/testutil"
+)
+
+const testCRDs = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: envoyfilters.networking.istio.io
+spec:
+  group: networking.istio.io
+  names:
+    kind: EnvoyFilter
+  versions:
+  - name: v1alpha3
+    served: true
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: peerauthentications.security.istio.io
+spec:
+  group: security.istio.io
+  names:
+    kind: PeerAuthentication
+  versions:
+  - name: v1
+    served: true
+  - name: v1beta1
+    served: false
+`
+
+func TestChartCRDsCheck(t *testing.T) {
+	discovery := `{{- if .Values.pilot.enabled }}
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: istiod
+spec:
+  template:
+    spec:
+      containers:
+      - name: discovery
+---
+{{- end }}
+apiVersion: networking.istio.io/v1alpha3
+kind: EnvoyFilter
+metadata:
+  name: stats-filter
+`
+	cases := []struct {
+		name      string
+		baseChart string
+		baseDir   string
+		template  string
+		wantErr   string
+	}{
+		{"matching", "", "base", discovery, ""},
+		{"configured base chart", "istio-base", "istio-base", discovery, ""},
+		{"missing base chart", "istio-base", "base", discovery, "manifests/charts/istio-base"},
+		{
+			"missing crd", "", "base", discovery + "---\napiVersion: networking.istio.io/v1\nkind: Sidecar\n",
+			"istio-discovery templates/istiod.yaml creates Sidecar.networking.istio.io, which has no CRD in the base chart",
+		},
+		{
+			"unserved version", "", "base", discovery + "---\napiVersion: security.istio.io/v1beta1\nkind: PeerAuthentication\n",
+			"creates PeerAuthentication.security.istio.io v1beta1, but the base chart CRD only serves v1",
+		},
+		{"other groups", "", "base", discovery + "---\napiVersion: gateway.networking.k8s.io/v1\nkind: Gateway\n", ""},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := t.TempDir()
+			testutil.WriteChart(t, filepath.Join(archive, "manifests", "charts", tt.baseDir), tt.baseDir, "1.20.0", map[string]string{
+				"files/crd-all.gen.yaml": testCRDs,
+				"templates/crds.yaml":    `{{ .Files.Get "files/crd-all.gen.yaml" }}`,
+			})
+			testutil.WriteChart(t, filepath.Join(archive, "manifests", "charts", "istio-control/istio-discovery"), "istio-discovery", "1.20.0", map[string]string{
+				"templates/istiod.yaml": tt.template,
+			})
+			err := TestChartCRDs(ReleaseInfo{archive: archive, baseChart: tt.baseChart})
+			testutil.AssertError(t, err, tt.wantErr)
+		})
+	}
+}
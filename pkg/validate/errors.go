@@ -0,0 +1,119 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ErrMissingArtifact is returned when a file expected in the release is not present
+type ErrMissingArtifact struct {
+	// Path is the file or directory that was not found
+	Path string
+}
+
+func (e *ErrMissingArtifact) Error() string {
+	return fmt.Sprintf("missing artifact %v", e.Path)
+}
+
+// ErrVersionMismatch is returned when an artifact does not have the version or hub the release expects
+type ErrVersionMismatch struct {
+	Expected string
+	Got      string
+	// Where describes what was checked, such as a file or binary
+	Where string
+}
+
+func (e *ErrVersionMismatch) Error() string {
+	return fmt.Sprintf("%v: got %v expected %v", e.Where, e.Got, e.Expected)
+}
+
+// ErrChecksumMismatch is returned when the checksum of a file differs from its checksum file, or from the same file
+// elsewhere in the release
+type ErrChecksumMismatch struct {
+	// Algorithm is the checksum algorithm, such as sha256
+	Algorithm string
+	Expected  string
+	Got       string
+	// Where describes the file whose checksum was checked
+	Where string
+}
+
+func (e *ErrChecksumMismatch) Error() string {
+	return fmt.Sprintf("%v %v checksum: got %v expected %v", e.Where, e.Algorithm, e.Got, e.Expected)
+}
+
+// ErrCommandFailed is returned when a command run to inspect the release fails
+type ErrCommandFailed struct {
+	Command string
+	Err     error
+}
+
+func (e *ErrCommandFailed) Error() string {
+	return fmt.Sprintf("command %q failed: %v", e.Command, e.Err)
+}
+
+func (e *ErrCommandFailed) Unwrap() error {
+	return e.Err
+}
+
+// FailureKind classifies why a check failed
+type FailureKind string
+
+const (
+	FailureMissingArtifact  FailureKind = "MissingArtifact"
+	FailureVersionMismatch  FailureKind = "VersionMismatch"
+	FailureChecksumMismatch FailureKind = "ChecksumMismatch"
+	FailureCommandFailed    FailureKind = "CommandFailed"
+	// FailureOther is any failure without a more specific kind
+	FailureOther FailureKind = "Other"
+)
+
+// Classify returns the kind of a check failure
+func Classify(err error) FailureKind {
+	var missing *ErrMissingArtifact
+	var mismatch *ErrVersionMismatch
+	var checksum *ErrChecksumMismatch
+	var command *ErrCommandFailed
+	switch {
+	case errors.As(err, &missing):
+		return FailureMissingArtifact
+	case errors.As(err, &mismatch):
+		return FailureVersionMismatch
+	case errors.As(err, &checksum):
+		return FailureChecksumMismatch
+	case errors.As(err, &command):
+		return FailureCommandFailed
+	default:
+		return FailureOther
+	}
+}
+
+// missingArtifact converts an error from reading path into ErrMissingArtifact if the path does not exist
+func missingArtifact(path string, err error) error {
+	if os.IsNotExist(err) {
+		return &ErrMissingArtifact{Path: path}
+	}
+	return err
+}
+
+// commandFailed records the failure of cmd
+func commandFailed(cmd *exec.Cmd, err error) error {
+	return &ErrCommandFailed{Command: strings.Join(cmd.Args, " "), Err: err}
+}
@@ -0,0 +1,103 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+	"github.com/alauda-mesh/release-builder/pkg/testutil"
+	"github.com/alauda-mesh/release-builder/pkg/util"
+)
+
+func TestErrorTypes(t *testing.T) {
+	r := ReleaseInfo{
+		release: t.TempDir(),
+		manifest: model.Manifest{
+			Version:       "1.20.0",
+			Docker:        "docker.io/istio",
+			Architectures: []string{"linux/amd64"},
+		},
+	}
+
+	t.Run("missing artifact", func(t *testing.T) {
+		err := TestDebian(r)
+		var e *ErrMissingArtifact
+		if !errors.As(fmt.Errorf("check Debian failed: %w", err), &e) {
+			t.Fatalf("expected ErrMissingArtifact, got %v", err)
+		}
+		if want := filepath.Join(r.release, "deb", "istio-sidecar.deb"); e.Path != want {
+			t.Fatalf("expected path %v, got %v", want, e.Path)
+		}
+		if got := Classify(err); got != FailureMissingArtifact {
+			t.Fatalf("expected %v, got %v", FailureMissingArtifact, got)
+		}
+	})
+
+	t.Run("version mismatch", func(t *testing.T) {
+		values := []byte("global:\n  hub: docker.io/istio\n  tag: 1.19.0\n")
+		err := validateHubTag(r, values, "global")
+		var e *ErrVersionMismatch
+		if !errors.As(fmt.Errorf("istiod: %w", err), &e) {
+			t.Fatalf("expected ErrVersionMismatch, got %v", err)
+		}
+		if e.Expected != "1.20.0" || e.Got != "1.19.0" {
+			t.Fatalf("unexpected mismatch %+v", e)
+		}
+		if got := Classify(err); got != FailureVersionMismatch {
+			t.Fatalf("expected %v, got %v", FailureVersionMismatch, got)
+		}
+	})
+
+	t.Run("checksum mismatch", func(t *testing.T) {
+		file := filepath.Join(r.release, "istio-1.20.0-linux-amd64.tar.gz")
+		testutil.WriteFile(t, file, "archive")
+		testutil.WriteFile(t, file+".sha256", "0 istio-1.20.0-linux-amd64.tar.gz\n")
+		err := TestArtifactChecksums(r)
+		var e *ErrChecksumMismatch
+		if !errors.As(fmt.Errorf("check ArtifactChecksums failed: %w", err), &e) {
+			t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+		}
+		if e.Algorithm != "sha256" || e.Where != "istio-1.20.0-linux-amd64.tar.gz" {
+			t.Fatalf("unexpected mismatch %+v", e)
+		}
+		if got := Classify(err); got != FailureChecksumMismatch {
+			t.Fatalf("expected %v, got %v", FailureChecksumMismatch, got)
+		}
+	})
+
+	t.Run("command failed", func(t *testing.T) {
+		err := checkClientVersion(r, util.RunOptions{}, "false")
+		var e *ErrCommandFailed
+		if !errors.As(err, &e) {
+			t.Fatalf("expected ErrCommandFailed, got %v", err)
+		}
+		if e.Command != "false" || e.Err == nil {
+			t.Fatalf("unexpected command failure %+v", e)
+		}
+		if got := Classify(err); got != FailureCommandFailed {
+			t.Fatalf("expected %v, got %v", FailureCommandFailed, got)
+		}
+	})
+
+	t.Run("other", func(t *testing.T) {
+		if got := Classify(fmt.Errorf("unexpected")); got != FailureOther {
+			t.Fatalf("expected %v, got %v", FailureOther, got)
+		}
+	})
+}
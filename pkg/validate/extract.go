@@ -0,0 +1,70 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"istio.io/istio/pkg/log"
+
+	"github.com/alauda-mesh/release-builder/pkg/util"
+)
+
+// extractedMarker is written to a reused extract directory once the release archive is fully extracted, recording
+// the checksum of the archive it was extracted from
+const extractedMarker = ".release-builder-extracted"
+
+// unpackReleaseArchive extracts the release archive to dir, which then contains the istio directory archiveDir. If
+// reuse is set, an earlier extraction of the same archive is reused rather than extracted again. The archives of
+// other architectures, unpacked by extractArchive, are removed whenever the archive changes.
+func unpackReleaseArchive(archive, dir, archiveDir string, reuse bool) error {
+	extract := func() error {
+		return util.RunSummarized(util.VerboseCommand("tar", "xvf", archive, "-C", dir))
+	}
+	if !reuse {
+		return extract()
+	}
+	return extractUnlessUnchanged(archive, dir, archiveDir, []string{filepath.Join(dir, "archives")}, extract)
+}
+
+// extractUnlessUnchanged runs extract, unless the marker in dir records that archive, with the same checksum, was
+// already extracted to the existing directory extracted. Otherwise, the marker, extracted and each of stale are removed
+// first, and the marker is written once extract succeeds, so an interrupted extraction is never mistaken for a
+// complete one.
+func extractUnlessUnchanged(archive, dir, extracted string, stale []string, extract func() error) error {
+	sum, err := util.FileSha256(archive)
+	if err != nil {
+		return err
+	}
+	marker := filepath.Join(dir, extractedMarker)
+	if last, err := os.ReadFile(marker); err == nil && string(last) == sum && util.FileExists(extracted) {
+		log.Infof("Reusing %v extracted from unchanged %v", extracted, archive)
+		return nil
+	}
+	for _, p := range append([]string{marker, extracted}, stale...) {
+		if err := os.RemoveAll(p); err != nil {
+			return err
+		}
+	}
+	if err := extract(); err != nil {
+		return err
+	}
+	if err := os.WriteFile(marker, []byte(sum), 0o640); err != nil {
+		return fmt.Errorf("failed to record extracted archive: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+	"github.com/alauda-mesh/release-builder/pkg/util"
+)
+
+func TestUnpackReleaseArchive(t *testing.T) {
+	src := t.TempDir()
+	archive := filepath.Join(t.TempDir(), "istio-1.20.0-linux-amd64.tar.gz")
+	writeArchive := func(content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Join(src, "istio-1.20.0"), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(src, "istio-1.20.0", "manifest.yaml"), []byte(content), 0o640); err != nil {
+			t.Fatal(err)
+		}
+		if err := util.TarGz(src, archive, gzip.DefaultCompression, "istio-1.20.0"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dir := t.TempDir()
+	archiveDir := filepath.Join(dir, "istio-1.20.0")
+	extracted := filepath.Join(archiveDir, "manifest.yaml")
+	assertContent := func(expected string) {
+		t.Helper()
+		by, err := os.ReadFile(extracted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(by) != expected {
+			t.Fatalf("expected extracted content %q, got %q", expected, by)
+		}
+	}
+
+	writeArchive("first")
+	if err := unpackReleaseArchive(archive, dir, archiveDir, true); err != nil {
+		t.Fatal(err)
+	}
+	assertContent("first")
+
+	t.Run("skips unchanged archive", func(t *testing.T) {
+		// Changes to the extracted tree are kept, as it is not extracted again
+		if err := os.WriteFile(extracted, []byte("local"), 0o640); err != nil {
+			t.Fatal(err)
+		}
+		if err := unpackReleaseArchive(archive, dir, archiveDir, true); err != nil {
+			t.Fatal(err)
+		}
+		assertContent("local")
+	})
+
+	t.Run("re-extracts changed archive", func(t *testing.T) {
+		other := filepath.Join(dir, "archives", "linux-arm64")
+		if err := os.MkdirAll(other, 0o750); err != nil {
+			t.Fatal(err)
+		}
+		writeArchive("second")
+		if err := unpackReleaseArchive(archive, dir, archiveDir, true); err != nil {
+			t.Fatal(err)
+		}
+		assertContent("second")
+		if util.FileExists(other) {
+			t.Fatalf("expected archives of other architectures to be removed")
+		}
+	})
+
+	t.Run("re-extracts incomplete extraction", func(t *testing.T) {
+		if err := os.RemoveAll(archiveDir); err != nil {
+			t.Fatal(err)
+		}
+		if err := unpackReleaseArchive(archive, dir, archiveDir, true); err != nil {
+			t.Fatal(err)
+		}
+		assertContent("second")
+	})
+
+	t.Run("without reuse", func(t *testing.T) {
+		dir := t.TempDir()
+		archiveDir := filepath.Join(dir, "istio-1.20.0")
+		if err := unpackReleaseArchive(archive, dir, archiveDir, false); err != nil {
+			t.Fatal(err)
+		}
+		if !util.FileExists(filepath.Join(archiveDir, "manifest.yaml")) {
+			t.Fatalf("expected the archive to be extracted")
+		}
+		if util.FileExists(filepath.Join(dir, extractedMarker)) {
+			t.Fatalf("expected no marker without reuse")
+		}
+	})
+}
+
+func TestExtractArchiveReuse(t *testing.T) {
+	r := ReleaseInfo{release: t.TempDir(), tmpDir: t.TempDir(), manifest: model.Manifest{Version: "1.20.0"}}
+	src := t.TempDir()
+	writeArchive := func(content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Join(src, "istio-1.20.0"), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(src, "istio-1.20.0", "manifest.yaml"), []byte(content), 0o640); err != nil {
+			t.Fatal(err)
+		}
+		if err := util.TarGz(src, filepath.Join(r.release, "istio-1.20.0-linux-arm64.tar.gz"), gzip.DefaultCompression, "istio-1.20.0"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertExtracted := func(expected string) {
+		t.Helper()
+		archive, err := extractArchive(r, "linux-arm64")
+		if err != nil {
+			t.Fatal(err)
+		}
+		by, err := os.ReadFile(filepath.Join(archive, "manifest.yaml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(by) != expected {
+			t.Fatalf("expected extracted content %q, got %q", expected, by)
+		}
+	}
+
+	writeArchive("first")
+	assertExtracted("first")
+	// Changes to the extracted tree are kept while the archive is unchanged
+	extracted := filepath.Join(r.tmpDir, "archives", "linux-arm64", "istio-1.20.0", "manifest.yaml")
+	if err := os.WriteFile(extracted, []byte("local"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	assertExtracted("local")
+	// Only the linux-arm64 archive changes, so the linux-amd64 marker of unpackReleaseArchive does not cover it
+	writeArchive("second")
+	assertExtracted("second")
+}
@@ -0,0 +1,160 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/alauda-mesh/release-builder/pkg/util"
+)
+
+// ImageResult describes a docker image tarball checked by ValidateImageTarball
+type ImageResult struct {
+	// Path is the image tarball
+	Path string
+	// RepoTags are the references the image is tagged with
+	RepoTags []string
+	// Architecture is the architecture of the image config
+	Architecture string
+	// Labels are the labels of the image config
+	Labels map[string]string
+	// Version is the version the image reports when run. It is empty if the image does not report a version.
+	Version string
+}
+
+// versionEntrypoints are the entrypoints of images that report their version with `version --short -ojson`
+var versionEntrypoints = []string{"/usr/local/bin/pilot-agent"}
+
+// runImageVersion loads a docker image tarball into the local docker context, and returns the version reported by
+// running the image tagged ref. Images of a platform other than the host's are run by docker under emulation.
+var runImageVersion = func(path, ref, platform string) (string, error) {
+	load := util.VerboseCommand("docker", "load", "-i", path)
+	if err := withDocker(func() error { return util.RunSummarized(load) }); err != nil {
+		return "", commandFailed(load, err)
+	}
+	var v *BuildInfo
+	err := withDocker(func() error {
+		var err error
+		v, err = clientVersion(util.RunOptions{}, "docker", "run", "--rm", "--platform", platform, ref, "version", "--short", "-ojson")
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return v.Version, nil
+}
+
+// ValidateImageTarball checks a single `docker save` tarball, which may be gzipped, without a release. Every tag of
+// the image must be in expectedHub, with a tag of expectedVersion followed by any variant and architecture suffix,
+// and the version in the image config, from its version label or environment, must be expectedVersion. Images that
+// report their version, such as proxyv2, are also loaded into the local docker context and run to check the version.
+// Images built for another architecture than the host's are run under emulation, which must be set up for docker.
+func ValidateImageTarball(path, expectedHub, expectedVersion string) (ImageResult, error) {
+	return validateImageTarball(path, expectedHub, expectedVersion, true)
+}
+
+// validateImageTarball checks a `docker save` tarball like ValidateImageTarball, only running images that report
+// their version if run is set
+func validateImageTarball(path, expectedHub, expectedVersion string, run bool) (ImageResult, error) {
+	result := ImageResult{Path: path}
+	if !util.FileExists(path) {
+		return result, &ErrMissingArtifact{Path: path}
+	}
+	tags, err := util.ImageRepoTags(path)
+	if err != nil {
+		return result, fmt.Errorf("%v: %v", path, err)
+	}
+	result.RepoTags = tags
+	if len(tags) == 0 {
+		return result, fmt.Errorf("%v: image is not tagged", path)
+	}
+	for _, ref := range tags {
+		i := strings.LastIndex(ref, ":")
+		if i < 0 || i < strings.LastIndex(ref, "/") {
+			return result, fmt.Errorf("%v: tag %v has no version", path, ref)
+		}
+		inHub, err := repositoryInHub(ref[:i], expectedHub)
+		if err != nil {
+			return result, fmt.Errorf("%v: %v", path, err)
+		}
+		if !inHub {
+			return result, fmt.Errorf("%v: tag %v is not in hub %v", path, ref, expectedHub)
+		}
+		if tag := ref[i+1:]; tag != expectedVersion && !strings.HasPrefix(tag, expectedVersion+"-") {
+			return result, &ErrVersionMismatch{Expected: expectedVersion, Got: tag, Where: "image tag of " + path}
+		}
+	}
+
+	by, err := util.ImageConfig(path)
+	if err != nil {
+		return result, fmt.Errorf("%v: %v", path, err)
+	}
+	config, err := v1.ParseConfigFile(bytes.NewReader(by))
+	if err != nil {
+		return result, fmt.Errorf("%v: failed to read image config: %v", path, err)
+	}
+	result.Architecture = config.Architecture
+	result.Labels = config.Config.Labels
+	if v := imageVersion(config); v != "" && v != expectedVersion {
+		return result, &ErrVersionMismatch{Expected: expectedVersion, Got: v, Where: "image config of " + path}
+	}
+
+	if !run || len(config.Config.Entrypoint) == 0 || !slices.Contains(versionEntrypoints, config.Config.Entrypoint[0]) {
+		return result, nil
+	}
+	version, err := runImageVersion(path, tags[0], imagePlatform(config))
+	if err != nil {
+		return result, fmt.Errorf("%v: %w", path, err)
+	}
+	result.Version = version
+	if version != expectedVersion {
+		return result, &ErrVersionMismatch{Expected: expectedVersion, Got: version, Where: "version of " + path}
+	}
+	return result, nil
+}
+
+// imagePlatform returns the platform of an image config, such as linux/arm/v7. The OS and architecture default to
+// linux/amd64, as for images docker builds without a platform.
+func imagePlatform(config *v1.ConfigFile) string {
+	p := v1.Platform{OS: config.OS, Architecture: config.Architecture, Variant: config.Variant}
+	if p.OS == "" {
+		p.OS = "linux"
+	}
+	if p.Architecture == "" {
+		p.Architecture = "amd64"
+	}
+	return platformString(p)
+}
+
+// repositoryInHub reports whether an image repository, such as istio/pilot, is in the hub, such as docker.io/istio.
+// Both are normalized, so the familiar names `docker save` writes for Docker Hub images match their full hub.
+func repositoryInHub(repository, hub string) (bool, error) {
+	repo, err := name.NewRepository(repository)
+	if err != nil {
+		return false, fmt.Errorf("invalid image repository %v: %v", repository, err)
+	}
+	expected, err := name.NewRepository(hub + "/" + path.Base(repo.RepositoryStr()))
+	if err != nil {
+		return false, fmt.Errorf("invalid hub %v: %v", hub, err)
+	}
+	return repo.Name() == expected.Name(), nil
+}
@@ -0,0 +1,197 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+	"github.com/alauda-mesh/release-builder/pkg/testutil"
+)
+
+func TestValidateImageTarball(t *testing.T) {
+	other := "arm64"
+	if runtime.GOARCH == other {
+		other = "amd64"
+	}
+	proxy := func(arch string) string {
+		return `{"architecture":"` + arch + `","config":{"Entrypoint":["/usr/local/bin/pilot-agent"],"Env":["ISTIO_META_ISTIO_VERSION=1.20.0"]}}`
+	}
+	cases := []struct {
+		name     string
+		config   string
+		tags     []string
+		reported string
+		wantErr  string
+		wantRun  bool
+		platform string
+	}{
+		{
+			name:   "valid",
+			config: `{"architecture":"amd64","config":{"Entrypoint":["/usr/local/bin/pilot-discovery"]}}`,
+			tags:   []string{"docker.io/istio/pilot:1.20.0-distroless"},
+		},
+		{
+			name:   "familiar name",
+			config: `{"config":{}}`,
+			tags:   []string{"istio/pilot:1.20.0-distroless"},
+		},
+		{
+			name:   "fully qualified docker hub name",
+			config: `{"config":{}}`,
+			tags:   []string{"index.docker.io/istio/pilot:1.20.0"},
+		},
+		{
+			name:    "familiar name in another hub",
+			config:  `{"config":{}}`,
+			tags:    []string{"other/pilot:1.20.0"},
+			wantErr: "not in hub docker.io/istio",
+		},
+		{
+			name:    "untagged",
+			config:  `{"config":{}}`,
+			wantErr: "not tagged",
+		},
+		{
+			name:    "wrong hub",
+			config:  `{"config":{}}`,
+			tags:    []string{"gcr.io/istio/pilot:1.20.0"},
+			wantErr: "not in hub docker.io/istio",
+		},
+		{
+			name:    "wrong tag",
+			config:  `{"config":{}}`,
+			tags:    []string{"docker.io/istio/pilot:1.20.0", "docker.io/istio/pilot:1.20.1"},
+			wantErr: "got 1.20.1 expected 1.20.0",
+		},
+		{
+			name:    "wrong label",
+			config:  `{"config":{"Labels":{"org.opencontainers.image.version":"1.19.0"}}}`,
+			tags:    []string{"docker.io/istio/pilot:1.20.0"},
+			wantErr: "got 1.19.0 expected 1.20.0",
+		},
+		{
+			name:     "reported version",
+			config:   proxy(runtime.GOARCH),
+			tags:     []string{"docker.io/istio/proxyv2:1.20.0"},
+			reported: "1.20.0",
+			wantRun:  true,
+			platform: "linux/" + runtime.GOARCH,
+		},
+		{
+			name:     "wrong reported version",
+			config:   proxy(runtime.GOARCH),
+			tags:     []string{"docker.io/istio/proxyv2:1.20.0"},
+			reported: "1.19.0",
+			wantErr:  "got 1.19.0 expected 1.20.0",
+			wantRun:  true,
+			platform: "linux/" + runtime.GOARCH,
+		},
+		{
+			name:     "other architecture",
+			config:   proxy(other),
+			tags:     []string{"docker.io/istio/proxyv2:1.20.0-" + other},
+			reported: "1.20.0",
+			wantRun:  true,
+			platform: "linux/" + other,
+		},
+		{
+			name:     "variant",
+			config:   `{"architecture":"arm","variant":"v7","config":{"Entrypoint":["/usr/local/bin/pilot-agent"]}}`,
+			tags:     []string{"docker.io/istio/proxyv2:1.20.0-armv7"},
+			reported: "1.20.0",
+			wantRun:  true,
+			platform: "linux/arm/v7",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			ran := false
+			orig := runImageVersion
+			runImageVersion = func(_, ref, platform string) (string, error) {
+				if ref != tt.tags[0] || platform != tt.platform {
+					t.Fatalf("expected %v to be run for %v, got %v for %v", tt.tags[0], tt.platform, ref, platform)
+				}
+				ran = true
+				return tt.reported, nil
+			}
+			t.Cleanup(func() { runImageVersion = orig })
+
+			file := filepath.Join(t.TempDir(), "image.tar.gz")
+			testutil.WriteImage(t, file, tt.config, tt.tags)
+			res, err := ValidateImageTarball(file, "docker.io/istio", "1.20.0")
+			if tt.wantErr == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+			}
+			if ran != tt.wantRun {
+				t.Fatalf("expected image run %v, got %v", tt.wantRun, ran)
+			}
+			if len(tt.tags) > 0 && (len(res.RepoTags) != len(tt.tags) || res.RepoTags[0] != tt.tags[0]) {
+				t.Fatalf("expected tags %v, got %v", tt.tags, res.RepoTags)
+			}
+			if res.Version != tt.reported {
+				t.Fatalf("expected reported version %q, got %q", tt.reported, res.Version)
+			}
+		})
+	}
+
+	if _, err := ValidateImageTarball(filepath.Join(t.TempDir(), "missing.tar.gz"), "docker.io/istio", "1.20.0"); err == nil {
+		t.Fatalf("expected error for missing tarball")
+	}
+}
+
+func TestDockerImageTarballsCheck(t *testing.T) {
+	orig := runImageVersion
+	runImageVersion = func(string, string, string) (string, error) { return "1.20.0", nil }
+	t.Cleanup(func() { runImageVersion = orig })
+
+	release := t.TempDir()
+	r := ReleaseInfo{
+		release: release,
+		// The images are expected with the hub and tag of the build, not those of the mirror
+		hub: "gcr.io/mirror",
+		tag: "mirrored",
+		manifest: model.Manifest{
+			Version:        "1.20.0",
+			Docker:         "docker.io/istio",
+			DockerOutput:   model.DockerOutputTar,
+			DockerVariants: []string{"distroless"},
+			DockerImages:   []string{"pilot-distroless", "proxyv2-debug"},
+			Architectures:  []string{"linux/amd64", "linux/arm64"},
+			ImageRenames:   map[string]string{"pilot": "istiod"},
+		},
+	}
+	dir := filepath.Join(release, "docker")
+	testutil.WriteImage(t, filepath.Join(dir, "istiod-distroless.tar.gz"), `{"config":{}}`, []string{"docker.io/istio/istiod:1.20.0-distroless"})
+	testutil.WriteImage(t, filepath.Join(dir, "istiod-distroless-arm64.tar.gz"), `{"config":{}}`, []string{"docker.io/istio/istiod:1.20.0-distroless-arm64"})
+	testutil.WriteImage(t, filepath.Join(dir, "proxyv2-debug.tar.gz"), `{"config":{}}`, []string{"docker.io/istio/proxyv2:1.20.0"})
+	if err := TestDocker(r); err == nil || !strings.Contains(err.Error(), "proxyv2-debug-arm64.tar.gz") {
+		t.Fatalf("expected missing arm64 proxy, got %v", err)
+	}
+	testutil.WriteImage(t, filepath.Join(dir, "proxyv2-debug-arm64.tar.gz"), `{"config":{}}`, []string{"docker.io/istio/proxyv2:1.19.0-arm64"})
+	if err := TestDocker(r); err == nil || !strings.Contains(err.Error(), "got 1.19.0-arm64 expected 1.20.0") {
+		t.Fatalf("expected mismatched arm64 proxy tag, got %v", err)
+	}
+	testutil.WriteImage(t, filepath.Join(dir, "proxyv2-debug-arm64.tar.gz"), `{"config":{}}`, []string{"docker.io/istio/proxyv2:1.20.0-arm64"})
+	if err := TestDocker(r); err != nil {
+		t.Fatal(err)
+	}
+}
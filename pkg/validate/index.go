@@ -0,0 +1,152 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"istio.io/istio/pkg/log"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+)
+
+// versionLabel is the OCI image label holding the version of the software in the image
+const versionLabel = "org.opencontainers.image.version"
+
+// indexedImage is an image referenced by an image index
+type indexedImage struct {
+	// Platform is the platform of the image, such as linux/amd64 or linux/arm/v7
+	Platform string
+	// Version is the version the image reports, or empty if it does not report one
+	Version string
+}
+
+// fetchImageIndex returns the images referenced by the image index of an image in the registry, authenticating with
+// the docker credentials
+var fetchImageIndex = func(ref string) ([]indexedImage, error) {
+	r, err := name.ParseReference(ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %v: %w", ref, err)
+	}
+	index, err := remote.Index(r, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch image index %v: %w", ref, err)
+	}
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image index %v: %w", ref, err)
+	}
+	images := []indexedImage{}
+	for _, desc := range manifest.Manifests {
+		if desc.Platform == nil || !desc.MediaType.IsImage() {
+			continue
+		}
+		img, err := index.Image(desc.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch image %v of %v: %w", desc.Digest, ref, err)
+		}
+		cfg, err := img.ConfigFile()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config of image %v of %v: %w", desc.Digest, ref, err)
+		}
+		images = append(images, indexedImage{Platform: platformString(*desc.Platform), Version: imageVersion(cfg)})
+	}
+	return images, nil
+}
+
+// platformString formats a platform the way the manifest architectures are written, such as linux/arm/v7
+func platformString(p v1.Platform) string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// imageVersion returns the version an image reports, from the OCI version label or the Istio version in its
+// environment
+func imageVersion(cfg *v1.ConfigFile) string {
+	if cfg == nil {
+		return ""
+	}
+	if v := cfg.Config.Labels[versionLabel]; v != "" {
+		return v
+	}
+	for _, e := range cfg.Config.Env {
+		if v, f := strings.CutPrefix(e, "ISTIO_META_ISTIO_VERSION="); f {
+			return v
+		}
+	}
+	return ""
+}
+
+// TestDockerIndex checks the image index published for each image references exactly one image for every
+// architecture of the release, and that each of those images reports the release version. Images that do not report
+// a version are only checked to be present. This only applies to multi-arch releases validated against the registry.
+func TestDockerIndex(r ReleaseInfo) error {
+	if r.imageSource != ImageSourceRegistry {
+		log.Infof("Skipping TestDockerIndex; images are not validated against the registry")
+		return nil
+	}
+	if len(r.manifest.GetDockerArchitectures()) < 2 {
+		log.Infof("Skipping TestDockerIndex; single architecture images are published without an index")
+		return nil
+	}
+	expected := r.manifest.DockerImages
+	if len(expected) == 0 {
+		expected = model.DefaultDockerImages
+	}
+	for _, image := range expected {
+		ref := dockerContextReference(r, image)
+		images, err := fetchImageIndex(ref)
+		if err != nil {
+			return fmt.Errorf("%w, check docker is logged in to %v", err, r.expectedHub())
+		}
+		if err := checkImageIndex(ref, images, r.manifest.GetDockerArchitectures(), r.manifest.Version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkImageIndex checks the images of an index cover the architectures, once each, and report the version
+func checkImageIndex(ref string, images []indexedImage, architectures []string, version string) error {
+	found := map[string]int{}
+	for _, img := range images {
+		found[img.Platform]++
+		if img.Version != "" && img.Version != version {
+			return &ErrVersionMismatch{Expected: version, Got: img.Version, Where: fmt.Sprintf("%v image of %v", img.Platform, ref)}
+		}
+	}
+	missing := []string{}
+	for _, arch := range architectures {
+		switch found[arch] {
+		case 0:
+			missing = append(missing, arch)
+		case 1:
+		default:
+			return fmt.Errorf("image index %v references %d images for %v, expected 1", ref, found[arch], arch)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("image index %v is missing architectures %v", ref, strings.Join(missing, ", "))
+	}
+	return nil
+}
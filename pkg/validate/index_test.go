@@ -0,0 +1,162 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+)
+
+func TestDockerIndexCheck(t *testing.T) {
+	cases := []struct {
+		name    string
+		source  ImageSource
+		archs   []string
+		images  []indexedImage
+		wantErr string
+	}{
+		{
+			name:   "complete",
+			source: ImageSourceRegistry,
+			archs:  []string{"linux/amd64", "linux/arm64"},
+			images: []indexedImage{{"linux/amd64", "1.20.0"}, {"linux/arm64", ""}, {"unknown/unknown", ""}},
+		},
+		{
+			name:    "missing architecture",
+			source:  ImageSourceRegistry,
+			archs:   []string{"linux/amd64", "linux/arm64", "linux/arm/v7"},
+			images:  []indexedImage{{"linux/amd64", "1.20.0"}},
+			wantErr: "missing architectures linux/arm64, linux/arm/v7",
+		},
+		{
+			name:    "duplicate architecture",
+			source:  ImageSourceRegistry,
+			archs:   []string{"linux/amd64", "linux/arm64"},
+			images:  []indexedImage{{"linux/amd64", "1.20.0"}, {"linux/amd64", "1.20.0"}, {"linux/arm64", "1.20.0"}},
+			wantErr: "references 2 images for linux/amd64",
+		},
+		{
+			name:    "wrong version",
+			source:  ImageSourceRegistry,
+			archs:   []string{"linux/amd64", "linux/arm64"},
+			images:  []indexedImage{{"linux/amd64", "1.20.0"}, {"linux/arm64", "1.19.0"}},
+			wantErr: "got 1.19.0 expected 1.20.0",
+		},
+		{
+			name:   "release images",
+			source: ImageSourceRelease,
+			archs:  []string{"linux/amd64", "linux/arm64"},
+		},
+		{
+			name:   "single architecture",
+			source: ImageSourceRegistry,
+			archs:  []string{"linux/amd64"},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			var fetched []string
+			orig := fetchImageIndex
+			fetchImageIndex = func(ref string) ([]indexedImage, error) {
+				fetched = append(fetched, ref)
+				return tt.images, nil
+			}
+			t.Cleanup(func() { fetchImageIndex = orig })
+
+			r := ReleaseInfo{
+				imageSource: tt.source,
+				manifest: model.Manifest{
+					Version:       "1.20.0",
+					Docker:        "docker.io/istio",
+					Architectures: tt.archs,
+					DockerImages:  []string{"pilot-distroless"},
+				},
+			}
+			err := TestDockerIndex(r)
+			if tt.wantErr == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+			if tt.images != nil && (len(fetched) != 1 || fetched[0] != "docker.io/istio/pilot:1.20.0-distroless") {
+				t.Fatalf("expected index of pilot to be fetched, got %v", fetched)
+			}
+		})
+	}
+}
+
+func TestFetchImageIndex(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	ref, err := name.ParseReference(strings.TrimPrefix(server.URL, "http://") + "/istio/pilot:1.20.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var index v1.ImageIndex = empty.Index
+	for _, plat := range []v1.Platform{{OS: "linux", Architecture: "amd64"}, {OS: "linux", Architecture: "arm", Variant: "v7"}} {
+		img, err := random.Image(64, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := img.ConfigFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg = cfg.DeepCopy()
+		cfg.Config.Labels = map[string]string{versionLabel: "1.20.0"}
+		if img, err = mutate.ConfigFile(img, cfg); err != nil {
+			t.Fatal(err)
+		}
+		index = mutate.AppendManifests(index, mutate.IndexAddendum{Add: img, Descriptor: v1.Descriptor{Platform: &plat}})
+	}
+	if err := remote.WriteIndex(ref, index); err != nil {
+		t.Fatal(err)
+	}
+
+	images, err := fetchImageIndex(ref.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkImageIndex(ref.String(), images, []string{"linux/amd64", "linux/arm/v7"}, "1.20.0"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFetchImageIndexMissing(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+
+	_, err := fetchImageIndex(strings.TrimPrefix(server.URL, "http://") + "/istio/pilot:1.20.0")
+	var terr *transport.Error
+	if !errors.As(err, &terr) || terr.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected a not found registry error, got %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+)
+
+// junitSuites is the root of a JUnit XML report
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// JUnit converts check results to a JUnit XML report, with a testcase for each check, so CI can show the release
+// validation alongside unit tests.
+func JUnit(results []CheckResult) ([]byte, error) {
+	suite := junitSuite{Name: "release-validation", Tests: len(results)}
+	total := 0.0
+	for _, res := range results {
+		c := junitCase{
+			Name:      res.Name,
+			ClassName: "validate",
+			Time:      fmt.Sprintf("%.3f", res.Duration.Seconds()),
+		}
+		total += res.Duration.Seconds()
+		if res.Err != nil {
+			suite.Failures++
+			c.Failure = &junitFailure{
+				Message: fmt.Sprintf("check %v failed", res.Name),
+				Type:    string(res.Kind),
+				Text:    res.Err.Error(),
+			}
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+	suite.Time = fmt.Sprintf("%.3f", total)
+	by, err := xml.MarshalIndent(junitSuites{Suites: []junitSuite{suite}}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(by, '\n')...), nil
+}
+
+// WriteJUnit writes check results to file as a JUnit XML report
+func WriteJUnit(results []CheckResult, file string) error {
+	by, err := JUnit(results)
+	if err != nil {
+		return fmt.Errorf("failed to convert results to junit: %v", err)
+	}
+	if err := os.WriteFile(file, by, 0o640); err != nil {
+		return fmt.Errorf("failed to write junit report: %v", err)
+	}
+	return nil
+}
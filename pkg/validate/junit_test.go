@@ -0,0 +1,67 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteJUnit(t *testing.T) {
+	results := []CheckResult{
+		{Name: "Debian", Duration: 1500 * time.Millisecond},
+		{
+			Name:     "Rpm",
+			Err:      &ErrMissingArtifact{Path: "rpm/istio.rpm"},
+			Kind:     FailureMissingArtifact,
+			Duration: 250 * time.Millisecond,
+		},
+	}
+	file := filepath.Join(t.TempDir(), "junit.xml")
+	if err := WriteJUnit(results, file); err != nil {
+		t.Fatal(err)
+	}
+	by, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := junitSuites{}
+	if err := xml.Unmarshal(by, &got); err != nil {
+		t.Fatalf("invalid xml: %v\n%s", err, by)
+	}
+	if len(got.Suites) != 1 {
+		t.Fatalf("expected one suite, got %d", len(got.Suites))
+	}
+	suite := got.Suites[0]
+	if suite.Tests != 2 || suite.Failures != 1 || suite.Time != "1.750" {
+		t.Fatalf("unexpected suite %+v", suite)
+	}
+	if len(suite.Cases) != 2 {
+		t.Fatalf("expected two cases, got %d", len(suite.Cases))
+	}
+	if pass := suite.Cases[0]; pass.Name != "Debian" || pass.Time != "1.500" || pass.Failure != nil {
+		t.Fatalf("unexpected passing case %+v", pass)
+	}
+	fail := suite.Cases[1]
+	if fail.Name != "Rpm" || fail.Failure == nil {
+		t.Fatalf("expected failing case, got %+v", fail)
+	}
+	if fail.Failure.Type != string(FailureMissingArtifact) || fail.Failure.Text != results[1].Err.Error() {
+		t.Fatalf("unexpected failure %+v", fail.Failure)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+	"github.com/alauda-mesh/release-builder/pkg/util"
+)
+
+const (
+	inTotoStatementPrefix = "https://in-toto.io/Statement/"
+	inTotoPayloadType     = "application/vnd.in-toto+json"
+)
+
+// inTotoStatement is an in-toto attestation statement with a SLSA provenance predicate. Both the v0.2 and v1
+// predicate layouts of the builder id are supported.
+type inTotoStatement struct {
+	Type          string `json:"_type"`
+	PredicateType string `json:"predicateType"`
+	Subject       []struct {
+		Name   string            `json:"name"`
+		Digest map[string]string `json:"digest"`
+	} `json:"subject"`
+	Predicate struct {
+		Builder struct {
+			ID string `json:"id"`
+		} `json:"builder"`
+		RunDetails struct {
+			Builder struct {
+				ID string `json:"id"`
+			} `json:"builder"`
+		} `json:"runDetails"`
+	} `json:"predicate"`
+}
+
+// dsseEnvelope is a signed envelope wrapping a statement
+type dsseEnvelope struct {
+	PayloadType string `json:"payloadType"`
+	Payload     string `json:"payload"`
+}
+
+// TestProvenance checks the SLSA provenance of the release is an in-toto statement, from the expected builder, whose
+// subjects are exactly the release artifacts with matching sha256 digests. It is skipped if no provenance is configured.
+func TestProvenance(r ReleaseInfo) error {
+	if r.provenance == "" {
+		return nil
+	}
+	file := r.provenance
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(r.release, file)
+	}
+	by, err := os.ReadFile(file)
+	if err != nil {
+		return missingArtifact(file, err)
+	}
+	statement, err := parseProvenance(by)
+	if err != nil {
+		return err
+	}
+	builder := statement.Predicate.Builder.ID
+	if builder == "" {
+		builder = statement.Predicate.RunDetails.Builder.ID
+	}
+	if r.builderID != "" && builder != r.builderID {
+		return &ErrVersionMismatch{Expected: r.builderID, Got: builder, Where: "provenance builder id"}
+	}
+
+	artifacts, err := releaseArtifacts(r, file)
+	if err != nil {
+		return err
+	}
+	var problems []string
+	for _, s := range statement.Subject {
+		digest, f := artifacts[s.Name]
+		if !f {
+			problems = append(problems, fmt.Sprintf("subject %v is not in the release", s.Name))
+			continue
+		}
+		delete(artifacts, s.Name)
+		if s.Digest["sha256"] != digest {
+			problems = append(problems, fmt.Sprintf("subject %v has sha256 %v, expected %v", s.Name, s.Digest["sha256"], digest))
+		}
+	}
+	for name := range artifacts {
+		problems = append(problems, fmt.Sprintf("artifact %v has no subject", name))
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("provenance does not match release: %v", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// parseProvenance reads an in-toto statement, which may be wrapped in a DSSE envelope
+func parseProvenance(by []byte) (*inTotoStatement, error) {
+	var envelope dsseEnvelope
+	if err := json.Unmarshal(by, &envelope); err != nil {
+		return nil, fmt.Errorf("invalid provenance: %v", err)
+	}
+	if envelope.PayloadType != "" {
+		if envelope.PayloadType != inTotoPayloadType {
+			return nil, fmt.Errorf("unexpected provenance payload type %v", envelope.PayloadType)
+		}
+		payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid provenance payload: %v", err)
+		}
+		by = payload
+	}
+	statement := &inTotoStatement{}
+	if err := json.Unmarshal(by, statement); err != nil {
+		return nil, fmt.Errorf("invalid provenance statement: %v", err)
+	}
+	if !strings.HasPrefix(statement.Type, inTotoStatementPrefix) {
+		return nil, fmt.Errorf("provenance is not an in-toto statement, got type %q", statement.Type)
+	}
+	if !strings.HasPrefix(statement.PredicateType, "https://slsa.dev/provenance/") {
+		return nil, fmt.Errorf("provenance predicate is not SLSA provenance, got %q", statement.PredicateType)
+	}
+	return statement, nil
+}
+
+// releaseArtifacts returns the sha256 digest of each artifact in the release, keyed by its path relative to the release.
+// Like the SBOM, docker images and licenses are excluded, as are checksum files and the provenance itself.
+func releaseArtifacts(r ReleaseInfo, provenance string) (map[string]string, error) {
+	release := r.release
+	excluded := map[string]struct{}{
+		r.manifest.ArtifactDir(model.DockerArtifacts):  {},
+		r.manifest.ArtifactDir(model.LicenseArtifacts): {},
+	}
+	artifacts := map[string]string{}
+	err := filepath.Walk(release, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(release, p)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if _, f := excluded[name]; f {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if p == provenance || strings.HasSuffix(name, ".sha256") || strings.HasSuffix(name, ".sha512") {
+			return nil
+		}
+		sum, err := util.FileSha256(p)
+		if err != nil {
+			return err
+		}
+		artifacts[filepath.ToSlash(name)] = sum
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read release artifacts: %v", err)
+	}
+	return artifacts, nil
+}
@@ -0,0 +1,115 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProvenanceCheck(t *testing.T) {
+	const builder = "https://github.com/alauda-mesh/release-builder"
+	files := map[string]string{
+		"istio-1.20.0-linux-amd64.tar.gz":        "archive",
+		"istio-1.20.0-linux-amd64.tar.gz.sha256": "checksum",
+		"deb/istio-sidecar.deb":                  "deb",
+		"docker/pilot-distroless.tar.gz":         "image",
+	}
+	digest := func(s string) string {
+		return fmt.Sprintf("%x", sha256.Sum256([]byte(s)))
+	}
+	subject := func(name, content string) map[string]interface{} {
+		return map[string]interface{}{"name": name, "digest": map[string]string{"sha256": digest(content)}}
+	}
+	statement := func(builderID string, subjects ...map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"_type":         "https://in-toto.io/Statement/v0.1",
+			"predicateType": "https://slsa.dev/provenance/v0.2",
+			"subject":       subjects,
+			"predicate":     map[string]interface{}{"builder": map[string]string{"id": builderID}},
+		}
+	}
+	archive := subject("istio-1.20.0-linux-amd64.tar.gz", "archive")
+	deb := subject("deb/istio-sidecar.deb", "deb")
+
+	cases := []struct {
+		name       string
+		provenance interface{}
+		expectErr  bool
+	}{
+		{"valid", statement(builder, archive, deb), false},
+		{
+			"valid dsse",
+			func() interface{} {
+				js, _ := json.Marshal(statement(builder, archive, deb))
+				return map[string]string{"payloadType": inTotoPayloadType, "payload": base64.StdEncoding.EncodeToString(js)}
+			}(),
+			false,
+		},
+		{
+			"valid v1",
+			map[string]interface{}{
+				"_type":         "https://in-toto.io/Statement/v1",
+				"predicateType": "https://slsa.dev/provenance/v1",
+				"subject":       []map[string]interface{}{archive, deb},
+				"predicate": map[string]interface{}{
+					"runDetails": map[string]interface{}{"builder": map[string]string{"id": builder}},
+				},
+			},
+			false,
+		},
+		{"wrong builder", statement("https://example.com/other", archive, deb), true},
+		{"missing subject", statement(builder, archive), true},
+		{"mismatched digest", statement(builder, archive, subject("deb/istio-sidecar.deb", "stale")), true},
+		{"unknown subject", statement(builder, archive, deb, subject("extra.tar.gz", "extra")), true},
+		{"not in-toto", map[string]string{"_type": "something"}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			release := t.TempDir()
+			for name, content := range files {
+				if err := os.MkdirAll(filepath.Dir(filepath.Join(release, name)), 0o750); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(release, name), []byte(content), 0o640); err != nil {
+					t.Fatal(err)
+				}
+			}
+			js, err := json.Marshal(tc.provenance)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(release, "provenance.intoto.json"), js, 0o640); err != nil {
+				t.Fatal(err)
+			}
+			err = TestProvenance(ReleaseInfo{release: release, provenance: "provenance.intoto.json", builderID: builder})
+			if tc.expectErr && err == nil {
+				t.Fatalf("expected error, got none")
+			}
+			if !tc.expectErr && err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		})
+	}
+
+	if err := TestProvenance(ReleaseInfo{release: t.TempDir()}); err != nil {
+		t.Fatalf("expected check to be skipped without provenance, got %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"istio.io/istio/pkg/log"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+)
+
+// TestSbomNamespaces checks each SBOM of the release has the namespace the build gives it, under the release URL of
+// its version, and that no two SBOMs share a namespace, as SPDX consumers treat documents with the same namespace as
+// the same document
+func TestSbomNamespaces(r ReleaseInfo) error {
+	if r.manifest.DockerOutput == model.DockerOutputContext || r.manifest.SkipGenerateBillOfMaterials {
+		log.Infof("Skipping TestSbomNamespaces; release has no SBOM")
+		return nil
+	}
+	files := []string{"istio-source.spdx", "istio-release.spdx"}
+	if r.manifest.ArtifactBillOfMaterials {
+		files = append(files, "istio-artifacts.spdx")
+	}
+	var problems []string
+	owners := map[string]string{}
+	for _, file := range files {
+		p := filepath.Join(r.release, file)
+		by, err := os.ReadFile(p)
+		if err != nil {
+			return missingArtifact(p, err)
+		}
+		namespace, err := spdxDocumentNamespace(by)
+		if err != nil {
+			return fmt.Errorf("%v: %v", file, err)
+		}
+		if expected := r.manifest.GetReleaseURL() + "/" + file; namespace != expected {
+			problems = append(problems, fmt.Sprintf("%v has namespace %v, expected %v", file, namespace, expected))
+		}
+		if owner, f := owners[namespace]; f {
+			problems = append(problems, fmt.Sprintf("%v and %v share namespace %v", owner, file, namespace))
+			continue
+		}
+		owners[namespace] = file
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid SBOM namespaces: %v", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// spdxNames returns the base name of every package and file an SPDX tag-value document describes, from its
+// PackageName, PackageFileName and FileName tags
+func spdxNames(spdx []byte) (map[string]struct{}, error) {
+	names := map[string]struct{}{}
+	scanner := bufio.NewScanner(bytes.NewReader(spdx))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		tag, value, f := strings.Cut(scanner.Text(), ":")
+		if !f {
+			continue
+		}
+		switch strings.TrimSpace(tag) {
+		case "PackageName", "PackageFileName", "FileName":
+			if value = strings.TrimSpace(value); value != "" {
+				names[path.Base(value)] = struct{}{}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// spdxDocumentNamespace returns the DocumentNamespace of an SPDX tag-value document
+func spdxDocumentNamespace(spdx []byte) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(spdx))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		tag, value, f := strings.Cut(scanner.Text(), ":")
+		if f && strings.TrimSpace(tag) == "DocumentNamespace" {
+			if value = strings.TrimSpace(value); value != "" {
+				return value, nil
+			}
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no DocumentNamespace found")
+}
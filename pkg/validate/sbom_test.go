@@ -0,0 +1,96 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+	"github.com/alauda-mesh/release-builder/pkg/testutil"
+)
+
+func TestSbomNamespacesCheck(t *testing.T) {
+	const base = "https://example.com/releases/1.20.0/"
+	spdx := func(namespace string) string {
+		return "SPDXVersion: SPDX-2.3\nDataLicense: CC0-1.0\nDocumentName: Istio\nDocumentNamespace: " + namespace + "\n"
+	}
+	cases := []struct {
+		name      string
+		manifest  model.Manifest
+		documents map[string]string
+		wantErr   string
+	}{
+		{
+			name: "distinct namespaces",
+			documents: map[string]string{
+				"istio-source.spdx":  spdx(base + "istio-source.spdx"),
+				"istio-release.spdx": spdx(base + "istio-release.spdx"),
+			},
+		},
+		{
+			name:     "skipped sbom",
+			manifest: model.Manifest{SkipGenerateBillOfMaterials: true},
+		},
+		{
+			name: "shared namespace",
+			documents: map[string]string{
+				"istio-source.spdx":  spdx(base + "istio-source.spdx"),
+				"istio-release.spdx": spdx(base + "istio-source.spdx"),
+			},
+			wantErr: "istio-source.spdx and istio-release.spdx share namespace " + base + "istio-source.spdx",
+		},
+		{
+			name: "wrong version",
+			documents: map[string]string{
+				"istio-source.spdx":  spdx("https://example.com/releases/1.19.0/istio-source.spdx"),
+				"istio-release.spdx": spdx(base + "istio-release.spdx"),
+			},
+			wantErr: "expected " + base + "istio-source.spdx",
+		},
+		{
+			name: "no namespace",
+			documents: map[string]string{
+				"istio-source.spdx":  "SPDXVersion: SPDX-2.3\n",
+				"istio-release.spdx": spdx(base + "istio-release.spdx"),
+			},
+			wantErr: "istio-source.spdx: no DocumentNamespace found",
+		},
+		{
+			name:     "missing artifact sbom",
+			manifest: model.Manifest{ArtifactBillOfMaterials: true},
+			documents: map[string]string{
+				"istio-source.spdx":  spdx(base + "istio-source.spdx"),
+				"istio-release.spdx": spdx(base + "istio-release.spdx"),
+			},
+			wantErr: "istio-artifacts.spdx",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			release := t.TempDir()
+			for name, content := range tt.documents {
+				if err := os.WriteFile(filepath.Join(release, name), []byte(content), 0o640); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tt.manifest.Version = "1.20.0"
+			tt.manifest.ReleaseURL = "https://example.com/releases"
+			err := TestSbomNamespaces(ReleaseInfo{release: release, manifest: tt.manifest})
+			testutil.AssertError(t, err, tt.wantErr)
+		})
+	}
+}
@@ -15,16 +15,29 @@
 package validate
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"bytes"
+	"compress/gzip"
+	"debug/elf"
 	"encoding/json"
 	"fmt"
+	"io"
+	"maps"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
 	"reflect"
+	"regexp"
+	"runtime"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/Masterminds/semver/v3"
 	"istio.io/istio/pkg/log"
 	"sigs.k8s.io/yaml"
 
@@ -33,9 +46,22 @@ import (
 	"github.com/alauda-mesh/release-builder/pkg/util"
 )
 
+// NewReleaseInfo reads the release, extracting its model.ValidatedArchiveArchitecture archive to a new temporary
+// directory
 func NewReleaseInfo(release string) ReleaseInfo {
-	tmpDir, err := os.MkdirTemp("/tmp", "release-test")
-	if err != nil {
+	return newReleaseInfo(release, "")
+}
+
+// newReleaseInfo reads the release like NewReleaseInfo. If extractDir is set, the archive is extracted there instead,
+// reusing an earlier extraction of the same archive.
+func newReleaseInfo(release string, extractDir string) ReleaseInfo {
+	tmpDir := extractDir
+	if tmpDir == "" {
+		var err error
+		if tmpDir, err = os.MkdirTemp("/tmp", "release-test"); err != nil {
+			panic(err)
+		}
+	} else if err := os.MkdirAll(tmpDir, 0o750); err != nil {
 		panic(err)
 	}
 	log.Infof("test temporary dir at %s", tmpDir)
@@ -45,14 +71,14 @@ func NewReleaseInfo(release string) ReleaseInfo {
 		panic(err)
 	}
 
-	if err := util.VerboseCommand("tar", "xvf", filepath.Join(release,
-		fmt.Sprintf("istio-%s-linux-amd64.tar.gz", manifest.Version)), "-C", tmpDir).Run(); err != nil {
-		log.Warnf("failed to unpackage release archive")
+	archive := filepath.Join(tmpDir, "istio-"+manifest.Version)
+	if err := unpackReleaseArchive(releaseArchive(release, manifest.Version, model.ValidatedArchiveArchitecture), tmpDir, archive, extractDir != ""); err != nil {
+		log.Warnf("failed to unpackage release archive: %v", err)
 	}
 	return ReleaseInfo{
 		tmpDir:   tmpDir,
 		manifest: manifest,
-		archive:  filepath.Join(tmpDir, "istio-"+manifest.Version),
+		archive:  archive,
 		release:  release,
 	}
 }
@@ -60,44 +86,278 @@ func NewReleaseInfo(release string) ReleaseInfo {
 type ValidationFunction func(ReleaseInfo) error
 
 type ReleaseInfo struct {
-	tmpDir   string
-	manifest model.Manifest
-	archive  string
-	release  string
+	tmpDir    string
+	manifest  model.Manifest
+	archive   string
+	release   string
+	allowlist string
+	// provenance and builderID configure TestProvenance
+	provenance string
+	builderID  string
+	// hub and tag, if set, override the hub and tag images are expected to have, to validate a release mirrored to
+	// another registry
+	hub string
+	tag string
+	// mirrorRewrites rewrite the prefix of the manifest hub, to validate a release mirrored to another registry
+	mirrorRewrites []MirrorRewrite
+	// imageSource is where images run by the checks come from
+	imageSource ImageSource
+	// lineEndingFiles configures TestLineEndings
+	lineEndingFiles []string
+	// nonRootDebug configures TestImageUser to also require debug images run as non-root
+	nonRootDebug bool
+	// rootImages configures the images TestImageUser allows to run as root
+	rootImages []string
+	// samplesDir configures TestSamplesYaml
+	samplesDir string
+	// cosignPublicKey configures TestCosignSignatures
+	cosignPublicKey string
+	// installPackages enables TestPackageInstall
+	installPackages bool
+	// baseChart configures TestChartCRDs
+	baseChart string
 }
 
-func CheckRelease(release string) ([]string, string, []error) {
-	if release == "" {
-		return nil, "", []error{fmt.Errorf("--release must be passed")}
-	}
-	r := NewReleaseInfo(release)
-	checks := map[string]ValidationFunction{
-		"IstioctlArchive":    TestIstioctlArchive,
-		"IstioctlStandalone": TestIstioctlStandalone,
-		"TestDocker":         TestDocker,
-		"HelmVersionsIstio":  TestHelmVersionsIstio,
-		"HelmChartVersions":  TestHelmChartVersions,
-		"IstioctlProfiles":   TestIstioctlProfiles,
-		"Manifest":           TestManifest,
-		"Licenses":           TestLicenses,
-		"Grafana":            TestGrafana,
-		"CompletionFiles":    TestCompletionFiles,
-		"ProxyVersion":       TestProxyVersion,
-		"Debian":             TestDebian,
-		"Rpm":                TestRpm,
+// expectedHub returns the hub the release images should have
+func (r ReleaseInfo) expectedHub() string {
+	if r.hub != "" {
+		return r.hub
+	}
+	return rewriteHub(r.manifest.Docker, r.mirrorRewrites)
+}
+
+// MirrorRewrite rewrites hubs starting with From, such as docker.io, to start with To instead, such as
+// mirror.example.com/docker.io. From only matches whole path segments.
+type MirrorRewrite struct {
+	From string
+	To   string
+}
+
+// ParseMirrorRewrite parses a rewrite of the form <from>=<to>
+func ParseMirrorRewrite(s string) (MirrorRewrite, error) {
+	from, to, f := strings.Cut(s, "=")
+	from, to = strings.TrimSuffix(from, "/"), strings.TrimSuffix(to, "/")
+	if !f || from == "" || to == "" {
+		return MirrorRewrite{}, fmt.Errorf("invalid mirror rewrite %q, expected <from>=<to>", s)
+	}
+	return MirrorRewrite{From: from, To: to}, nil
+}
+
+// rewriteHub applies the first of the rewrites matching the hub
+func rewriteHub(hub string, rewrites []MirrorRewrite) string {
+	for _, rw := range rewrites {
+		if rest, f := strings.CutPrefix(hub, rw.From); f && (rest == "" || strings.HasPrefix(rest, "/")) {
+			return rw.To + rest
+		}
+	}
+	return hub
+}
+
+// expectedTag returns the tag the release images should have
+func (r ReleaseInfo) expectedTag() string {
+	if r.tag != "" {
+		return r.tag
+	}
+	return r.manifest.Version
+}
+
+// artifactDir returns the directory of a category of artifact in the release, following the release manifest layout
+func (r ReleaseInfo) artifactDir(category model.ArtifactCategory) string {
+	return filepath.Join(r.release, r.manifest.ArtifactDir(category))
+}
+
+// CheckOptions configures optional checks of a release
+type CheckOptions struct {
+	// Allowlist is a file listing every file expected in the release archives. If set, files not in the list fail
+	// validation.
+	Allowlist string
+	// Provenance is the SLSA provenance of the release, relative to the release. If set, it is checked against the
+	// release artifacts.
+	Provenance string
+	// BuilderID is the builder id the provenance must have. If unset, any builder is accepted.
+	BuilderID string
+	// Hub and Tag override the hub and tag of the release images, which otherwise come from the release manifest.
+	// This allows validating a release that was mirrored to another registry without editing its manifest.
+	Hub string
+	Tag string
+	// MirrorRewrites rewrite the prefix of the hub of the release images from the release manifest, such as docker.io
+	// to the registry the release was mirrored to. The first matching rewrite applies. Hub takes precedence.
+	MirrorRewrites []MirrorRewrite
+	// ImageSource selects where images run by the checks come from. If unset, they are loaded from the release.
+	ImageSource ImageSource
+	// LineEndingFiles are patterns of the files in the release archive that must have LF line endings. If unset,
+	// DefaultLineEndingFiles is used.
+	LineEndingFiles []string
+	// NonRootDebug requires debug images, like distroless images, to run as a non-root user. If unset, debug images
+	// may run as root.
+	NonRootDebug bool
+	// RootImages are the names of images, without their variant, allowed to run as root in every variant. If unset,
+	// DefaultRootImages is used.
+	RootImages []string
+	// SamplesDir is the directory of the samples in the release archive. If unset, DefaultSamplesDir is used.
+	SamplesDir string
+	// CosignPublicKey is the public key cosign signatures of the archives are verified with, if they were signed with a
+	// key. If unset, only a KMS key of the manifest is trusted; the public key in the release never is.
+	CosignPublicKey string
+	// InstallPackages installs the deb and rpm packages in containers of their distros, checking they install cleanly.
+	// This needs docker, so is disabled by default.
+	InstallPackages bool
+	// BaseChart is the name of the chart shipping the CRDs the other charts depend on. If unset, DefaultBaseChart is
+	// used.
+	BaseChart string
+	// ExtractDir is where the release archives are extracted. The extracted archives are kept, and each is reused by
+	// later runs until it changes, which speeds up iterating on the checks. If unset, the archive is
+	// extracted to a new temporary directory.
+	ExtractDir string
+}
+
+// ImageSource is where the images run by the checks come from
+type ImageSource string
+
+const (
+	// ImageSourceRelease loads images from the archives in the release
+	ImageSourceRelease ImageSource = "release"
+	// ImageSourceRegistry pulls images from the release hub, to validate the images published by the release
+	ImageSourceRegistry ImageSource = "registry"
+)
+
+func CheckRelease(release string, opts CheckOptions) ([]string, string, []error) {
+	results, info, err := CheckReleaseStructured(release, opts)
+	if err != nil {
+		return nil, "", []error{err}
 	}
 	var errors []error
 	var success []string
-	for name, check := range checks {
-		err := check(r)
-		if err != nil {
-			errors = append(errors, fmt.Errorf("check %v failed: %v", name, err))
+	for _, res := range results {
+		if res.Err != nil {
+			errors = append(errors, fmt.Errorf("check %v failed: %w", res.Name, res.Err))
 		} else {
-			success = append(success, name)
+			success = append(success, res.Name)
+		}
+	}
+	return success, info, errors
+}
+
+// CheckResult is the outcome of a single validation check
+type CheckResult struct {
+	Name string
+	// Err is nil if the check passed
+	Err error
+	// Kind classifies Err, allowing callers to treat some failures, such as a missing artifact, differently.
+	// It is empty if the check passed.
+	Kind FailureKind
+	// Duration is how long the check took to run
+	Duration time.Duration
+}
+
+// Checks are all the checks run against a release by CheckRelease, by name. Every exported Test function taking a
+// ReleaseInfo must be registered here, or it never runs.
+var Checks = map[string]ValidationFunction{
+	"IstioctlArchive":          TestIstioctlArchive,
+	"IstioctlGitTag":           TestIstioctlGitTag,
+	"IstioctlStandalone":       TestIstioctlStandalone,
+	"IstioctlChecksum":         TestIstioctlChecksum,
+	"ArtifactChecksums":        TestArtifactChecksums,
+	"IstioctlOffline":          TestIstioctlOffline,
+	"IstioctlCrossArch":        TestIstioctlCrossArch,
+	"IstioctlCommands":         TestIstioctlCommands,
+	"IstioctlStripped":         TestIstioctlStripped,
+	"IstioctlElf":              TestIstioctlElf,
+	"IstioctlManifestGenerate": TestIstioctlManifestGenerate,
+	"TestDocker":               TestDocker,
+	"DockerIndex":              TestDockerIndex,
+	"HelmVersionsIstio":        TestHelmVersionsIstio,
+	"HelmChartVersions":        TestHelmChartVersions,
+	"HelmTemplate":             TestHelmTemplate,
+	"HelmChartSet":             TestHelmChartSet,
+	"ArchiveCharts":            TestArchiveCharts,
+	"ArtifactSbom":             TestArtifactSbom,
+	"SbomNamespaces":           TestSbomNamespaces,
+	"IstioctlProfiles":         TestIstioctlProfiles,
+	"Manifest":                 TestManifest,
+	"Licenses":                 TestLicenses,
+	"Grafana":                  TestGrafana,
+	"CompletionFiles":          TestCompletionFiles,
+	"LineEndings":              TestLineEndings,
+	"ThirdPartyNotices":        TestThirdPartyNotices,
+	"ProxyVersion":             TestProxyVersion,
+	"Operator":                 TestOperator,
+	"ProxySha":                 TestProxySha,
+	"ProxyExtensions":          TestProxyExtensions,
+	"ImageEntrypoint":          TestImageEntrypoint,
+	"ImageSize":                TestImageSize,
+	"ImageUser":                TestImageUser,
+	"ImageLock":                TestImageLock,
+	"VersionConsistency":       TestVersionConsistency,
+	"ToolsArchive":             TestToolsArchive,
+	"SamplesYaml":              TestSamplesYaml,
+	"HelmRepoIndex":            TestHelmRepoIndex,
+	"GzipLevel":                TestGzipLevel,
+	"CosignSignatures":         TestCosignSignatures,
+	"PackageInstall":           TestPackageInstall,
+	"Debian":                   TestDebian,
+	"Rpm":                      TestRpm,
+	"ReleaseNotes":             TestReleaseNotes,
+	"DownloadScript":           TestDownloadScript,
+	"BuildInfo":                TestBuildInfo,
+	"FilePermissions":          TestFilePermissions,
+	"NonEmptyArtifacts":        TestNonEmptyArtifacts,
+	"ArchiveSafety":            TestArchiveSafety,
+	"ArchiveAllowlist":         TestArchiveAllowlist,
+	"ProfileSettings":          TestProfileSettings,
+	"ProfileComponents":        TestProfileComponents,
+	"ProfileCharts":            TestProfileCharts,
+	"ChartCRDs":                TestChartCRDs,
+	"Provenance":               TestProvenance,
+	"ReleaseIndex":             TestReleaseIndex,
+	"UncompressedArchives":     TestUncompressedArchives,
+	"StandaloneIstioctl":       TestStandaloneIstioctlMatchesArchive,
+}
+
+// CheckReleaseStructured runs all checks against the release, returning the result of each check sorted by name,
+// and debug output if any check failed. An error is returned only if the release could not be checked at all.
+func CheckReleaseStructured(release string, opts CheckOptions) ([]CheckResult, string, error) {
+	if release == "" {
+		return nil, "", fmt.Errorf("--release must be passed")
+	}
+	r := newReleaseInfo(release, opts.ExtractDir)
+	r.allowlist = opts.Allowlist
+	r.provenance = opts.Provenance
+	r.builderID = opts.BuilderID
+	r.hub = opts.Hub
+	r.tag = opts.Tag
+	r.mirrorRewrites = opts.MirrorRewrites
+	r.imageSource = opts.ImageSource
+	r.lineEndingFiles = opts.LineEndingFiles
+	r.nonRootDebug = opts.NonRootDebug
+	r.rootImages = opts.RootImages
+	r.samplesDir = opts.SamplesDir
+	r.cosignPublicKey = opts.CosignPublicKey
+	r.installPackages = opts.InstallPackages
+	r.baseChart = opts.BaseChart
+	if r.imageSource != "" && r.imageSource != ImageSourceRelease && r.imageSource != ImageSourceRegistry {
+		return nil, "", fmt.Errorf("unknown image source %q, must be %v or %v", r.imageSource, ImageSourceRelease, ImageSourceRegistry)
+	}
+	if err := r.manifest.Validate(); err != nil {
+		return nil, "", fmt.Errorf("invalid manifest: %v", err)
+	}
+	var results []CheckResult
+	failed := false
+	for name, check := range Checks {
+		start := time.Now()
+		res := CheckResult{Name: name, Err: check(r)}
+		res.Duration = time.Since(start)
+		if res.Err != nil {
+			res.Kind = Classify(res.Err)
+			failed = true
 		}
+		results = append(results, res)
 	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
 	sb := strings.Builder{}
-	if len(errors) > 0 {
+	if failed {
 		sb.WriteString(fmt.Sprintf("Checks failed. Release info: %+v", r))
 		sb.WriteString("Files in release: \n")
 		_ = filepath.Walk(r.release,
@@ -118,55 +378,451 @@ func CheckRelease(release string) ([]string, string, []error) {
 				return nil
 			})
 	}
-	return success, sb.String(), errors
+	return results, sb.String(), nil
 }
 
 func TestIstioctlArchive(r ReleaseInfo) error {
 	// Check istioctl from archive
-	buf := &bytes.Buffer{}
-	cmd := util.VerboseCommand(filepath.Join(r.archive, "bin", "istioctl"), "version", "--remote=false", "--short", "-ojson")
-	cmd.Stdout = buf
-	if err := cmd.Run(); err != nil {
-		return err
+	return checkClientVersion(r, util.RunOptions{}, filepath.Join(r.archive, "bin", "istioctl"), "version", "--remote=false", "--short", "-ojson")
+}
+
+func TestIstioctlStandalone(r ReleaseInfo) error {
+	// Check istioctl from stand-alone archive
+	istioctlArchivePath := releaseTarball(r.release, fmt.Sprintf("istioctl-%s-%s", r.manifest.Version, model.ValidatedArchiveArchitecture))
+	if !util.FileExists(istioctlArchivePath) {
+		return &ErrMissingArtifact{Path: istioctlArchivePath}
 	}
-	var v Version
-	if err := json.Unmarshal(buf.Bytes(), &v); err != nil {
-		return fmt.Errorf("failed to unmarshal version information: %v", err)
+	cmd := util.VerboseCommand("tar", "xvf", istioctlArchivePath, "-C", r.tmpDir)
+	if err := util.RunSummarized(cmd); err != nil {
+		return commandFailed(cmd, err)
 	}
+	return checkClientVersion(r, util.RunOptions{}, filepath.Join(r.tmpDir, "istioctl"), "version", "--remote=false", "--short", "-ojson")
+}
 
-	if v.ClientVersion == nil {
-		return fmt.Errorf("no client version found in version information")
+// istioctlTimeout bounds how long istioctl may run, so a command attempting network access fails rather than hangs
+const istioctlTimeout = 2 * time.Minute
+
+// TestIstioctlOffline ensures `istioctl version --remote=false` works without network access, so validation never
+// needs a cluster. When user namespaces are available, istioctl is run with `unshare --net`, giving it a network
+// namespace with only an unconfigured loopback interface. Otherwise, all proxies point at an unreachable address and
+// the kubeconfig is empty, so any connection attempt fails.
+func TestIstioctlOffline(r ReleaseInfo) error {
+	cmd := []string{filepath.Join(r.archive, "bin", "istioctl"), "version", "--remote=false", "--short", "-ojson"}
+	if util.VerboseCommand("unshare", "--net", "--map-root-user", "true").Run() == nil {
+		cmd = append([]string{"unshare", "--net", "--map-root-user"}, cmd...)
+	} else {
+		log.Warnf("unshare is unavailable; running istioctl with unreachable proxies instead")
+	}
+	unreachable := "http://127.0.0.1:9"
+	opts := util.RunOptions{Env: []string{
+		"HTTP_PROXY=" + unreachable, "HTTPS_PROXY=" + unreachable, "http_proxy=" + unreachable, "https_proxy=" + unreachable,
+		"NO_PROXY=", "no_proxy=", "KUBECONFIG=" + os.DevNull,
+	}}
+	return checkClientVersion(r, opts, cmd[0], cmd[1:]...)
+}
+
+// crossArchValidation enables running non-amd64 istioctl binaries under qemu user emulation
+var crossArchValidation = func() bool {
+	b, err := strconv.ParseBool(os.Getenv("VALIDATE_CROSS_ARCH"))
+	if err != nil {
+		return false
 	}
+	return b
+}()
+
+// qemuEmulators maps an archive architecture to the qemu user emulators able to run it
+var qemuEmulators = map[string][]string{
+	"linux-arm64": {"qemu-aarch64-static", "qemu-aarch64"},
+	"linux-armv7": {"qemu-arm-static", "qemu-arm"},
+}
 
-	if gotVersion := v.ClientVersion.Version; gotVersion != r.manifest.Version {
-		return fmt.Errorf("expected proxy version to be %s, got %s", r.manifest.Version, gotVersion)
+// TestIstioctlCrossArch runs the istioctl binaries of the other archive architectures under qemu, to catch broken
+// cross-compiles. This only runs when VALIDATE_CROSS_ARCH=true, and skips architectures without a qemu emulator installed.
+func TestIstioctlCrossArch(r ReleaseInfo) error {
+	if !crossArchValidation {
+		log.Infof("Skipping TestIstioctlCrossArch; VALIDATE_CROSS_ARCH is not set")
+		return nil
+	}
+	for _, arch := range r.manifest.GetArchiveArchitectures() {
+		if _, f := qemuEmulators[arch]; !f {
+			continue
+		}
+		qemu := qemuEmulator(arch)
+		if qemu == "" {
+			continue
+		}
+		archive, err := extractArchive(r, arch)
+		if err != nil {
+			return err
+		}
+		istioctl := filepath.Join(archive, "bin", "istioctl")
+		if err := checkClientVersion(r, util.RunOptions{}, qemu, istioctl, "version", "--remote=false", "--short", "-ojson"); err != nil {
+			return fmt.Errorf("istioctl %v: %w", arch, err)
+		}
 	}
 	return nil
 }
 
-func TestIstioctlStandalone(r ReleaseInfo) error {
-	// Check istioctl from stand-alone archive
-	istioctlArchivePath := filepath.Join(r.release, fmt.Sprintf("istioctl-%s-linux-amd64.tar.gz", r.manifest.Version))
-	if err := util.VerboseCommand("tar", "xvf", istioctlArchivePath, "-C", r.tmpDir).Run(); err != nil {
+// qemuEmulator returns the path of an installed qemu user emulator for an archive architecture, or an empty string if
+// none are installed
+func qemuEmulator(arch string) string {
+	for _, e := range qemuEmulators[arch] {
+		if p, err := exec.LookPath(e); err == nil {
+			return p
+		}
+	}
+	log.Warnf("Skipping istioctl %v; none of %v are installed", arch, qemuEmulators[arch])
+	return ""
+}
+
+// istioctlCommand is an istioctl command TestIstioctlCommands runs, with the text its output must contain
+type istioctlCommand struct {
+	Args   []string
+	Expect []string
+}
+
+// istioctlCommands returns the commands TestIstioctlCommands runs. Help output must list the subcommands and flags
+// users rely on, and the version output the release version.
+func istioctlCommands(version string) []istioctlCommand {
+	return []istioctlCommand{
+		{Args: []string{"--help"}, Expect: []string{"install", "uninstall", "version", "analyze", "proxy-config"}},
+		{Args: []string{"install", "--help"}, Expect: []string{"--set", "--filename"}},
+		{Args: []string{"version", "--remote=false"}, Expect: []string{version}},
+	}
+}
+
+// TestIstioctlCommands runs istioctl --help, istioctl install --help and istioctl version, checking each exits cleanly
+// and lists the expected subcommands, to catch a binary reporting its version but with a broken command set. When
+// VALIDATE_CROSS_ARCH=true, the binaries of other architectures are also run under qemu.
+func TestIstioctlCommands(r ReleaseInfo) error {
+	if err := checkIstioctlCommands(r, filepath.Join(r.archive, "bin", "istioctl")); err != nil {
 		return err
 	}
-	buf := &bytes.Buffer{}
-	cmd := util.VerboseCommand(filepath.Join(r.tmpDir, "istioctl"), "version", "--remote=false", "--short", "-ojson")
-	cmd.Stdout = buf
-	if err := cmd.Run(); err != nil {
+	if !crossArchValidation {
+		return nil
+	}
+	for _, arch := range r.manifest.GetArchiveArchitectures() {
+		if _, f := qemuEmulators[arch]; !f {
+			continue
+		}
+		qemu := qemuEmulator(arch)
+		if qemu == "" {
+			continue
+		}
+		archive, err := extractArchive(r, arch)
+		if err != nil {
+			return err
+		}
+		if err := checkIstioctlCommands(r, qemu, filepath.Join(archive, "bin", "istioctl")); err != nil {
+			return fmt.Errorf("istioctl %v: %w", arch, err)
+		}
+	}
+	return nil
+}
+
+// checkIstioctlCommands runs the istioctlCommands with istioctl, which may be prefixed by an emulator
+func checkIstioctlCommands(r ReleaseInfo, istioctl ...string) error {
+	for _, c := range istioctlCommands(r.manifest.Version) {
+		name := "istioctl " + strings.Join(c.Args, " ")
+		args := append(append([]string{}, istioctl[1:]...), c.Args...)
+		out, err := util.Run(util.RunOptions{CaptureStdout: true, Timeout: istioctlTimeout, Env: []string{"KUBECONFIG=" + os.DevNull}},
+			istioctl[0], args...)
+		if err != nil {
+			return fmt.Errorf("%v failed: %v", name, err)
+		}
+		missing := []string{}
+		for _, e := range c.Expect {
+			if !strings.Contains(out, e) {
+				missing = append(missing, e)
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("%v output is missing %v", name, strings.Join(missing, ", "))
+		}
+	}
+	return nil
+}
+
+// elfTarget is the ELF class and machine a linux binary must have
+type elfTarget struct {
+	Class   elf.Class
+	Machine elf.Machine
+}
+
+// istioctlElfTargets are the expected ELF class and machine of istioctl in each linux release archive
+var istioctlElfTargets = map[string]elfTarget{
+	"linux-amd64": {elf.ELFCLASS64, elf.EM_X86_64},
+	"linux-arm64": {elf.ELFCLASS64, elf.EM_AARCH64},
+	"linux-armv7": {elf.ELFCLASS32, elf.EM_ARM},
+}
+
+// TestIstioctlElf checks the istioctl binary in each linux archive is built for the archive's architecture, by
+// reading its ELF header. Unlike TestIstioctlCrossArch, this needs no emulator, so a misconfigured cross-compile, such
+// as a 64-bit binary in the armv7 archive, is always caught. osx and windows binaries are not ELF, so are skipped.
+func TestIstioctlElf(r ReleaseInfo) error {
+	for _, arch := range r.manifest.GetArchiveArchitectures() {
+		want, f := istioctlElfTargets[arch]
+		if !f {
+			continue
+		}
+		archive, err := extractArchive(r, arch)
+		if err != nil {
+			return err
+		}
+		istioctl := filepath.Join(archive, "bin", "istioctl")
+		bin, err := elf.Open(istioctl)
+		if os.IsNotExist(err) {
+			return &ErrMissingArtifact{Path: istioctl}
+		} else if err != nil {
+			return fmt.Errorf("%v istioctl is not an ELF binary: %v", arch, err)
+		}
+		got := elfTarget{bin.Class, bin.Machine}
+		bin.Close()
+		if got != want {
+			return &ErrVersionMismatch{
+				Expected: fmt.Sprintf("%v %v", want.Machine, want.Class),
+				Got:      fmt.Sprintf("%v %v", got.Machine, got.Class),
+				Where:    arch + " istioctl binary",
+			}
+		}
+	}
+	return nil
+}
+
+// TestIstioctlStripped checks the istioctl binary in each linux archive, if the manifest strips istioctl, has no
+// symbol table or DWARF debug sections. Whether the stripped binary still reports its version is checked by
+// TestIstioctlArchive.
+func TestIstioctlStripped(r ReleaseInfo) error {
+	if !r.manifest.StripIstioctl {
+		return nil
+	}
+	for _, arch := range r.manifest.GetArchiveArchitectures() {
+		if _, f := istioctlElfTargets[arch]; !f {
+			continue
+		}
+		archive, err := extractArchive(r, arch)
+		if err != nil {
+			return err
+		}
+		istioctl := filepath.Join(archive, "bin", "istioctl")
+		sections, err := debugSections(istioctl)
+		if os.IsNotExist(err) {
+			return &ErrMissingArtifact{Path: istioctl}
+		} else if err != nil {
+			return fmt.Errorf("%v istioctl is not an ELF binary: %v", arch, err)
+		}
+		if len(sections) > 0 {
+			return fmt.Errorf("%v istioctl is not stripped, it has sections %v", arch, strings.Join(sections, ", "))
+		}
+	}
+	return nil
+}
+
+// debugSections returns the symbol table and DWARF debug sections of an ELF binary
+func debugSections(file string) ([]string, error) {
+	bin, err := elf.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer bin.Close()
+	sections := []string{}
+	for _, s := range bin.Sections {
+		if s.Name == ".symtab" || strings.HasPrefix(s.Name, ".debug_") || strings.HasPrefix(s.Name, ".zdebug_") {
+			sections = append(sections, s.Name)
+		}
+	}
+	return sections, nil
+}
+
+// checkClientVersion runs a command printing `istioctl version -ojson` output, and checks it reports the release version
+func checkClientVersion(r ReleaseInfo, opts util.RunOptions, name string, args ...string) error {
+	v, err := clientVersion(opts, name, args...)
+	if err != nil {
 		return err
 	}
-	var v Version
-	if err := json.Unmarshal(buf.Bytes(), &v); err != nil {
-		return fmt.Errorf("failed to unmarshal version information: %v", err)
+	if gotVersion := v.Version; gotVersion != r.manifest.Version {
+		return &ErrVersionMismatch{Expected: r.manifest.Version, Got: gotVersion, Where: "istioctl version"}
 	}
+	return nil
+}
 
+// clientVersion runs a command printing `istioctl version -ojson` output, and returns the client version it reports.
+// The command is killed if it runs for longer than istioctlTimeout.
+func clientVersion(opts util.RunOptions, name string, args ...string) (*BuildInfo, error) {
+	opts.CaptureStdout = true
+	opts.Timeout = istioctlTimeout
+	out, err := util.Run(opts, name, args...)
+	if err != nil {
+		return nil, &ErrCommandFailed{Command: strings.Join(append([]string{name}, args...), " "), Err: err}
+	}
+	var v Version
+	if err := json.Unmarshal([]byte(out), &v); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal version information: %v", err)
+	}
 	if v.ClientVersion == nil {
-		return fmt.Errorf("no client version found in version information")
+		return nil, fmt.Errorf("no client version found in version information")
+	}
+	return v.ClientVersion, nil
+}
+
+// TestIstioctlGitTag checks the git tag istioctl reports was stamped by the build. For GA versions, such as 1.20.0,
+// the tag must be the version. Other versions, such as dev builds, may have an empty tag.
+func TestIstioctlGitTag(r ReleaseInfo) error {
+	v, err := clientVersion(util.RunOptions{}, filepath.Join(r.archive, "bin", "istioctl"), "version", "--remote=false", "--short", "-ojson")
+	if err != nil {
+		return err
+	}
+	return checkGitTag(r.manifest.Version, v.GitTag)
+}
+
+// checkGitTag checks the git tag a binary reports is acceptable for the release version
+func checkGitTag(version string, tag string) error {
+	if tag == version {
+		return nil
+	}
+	if tag == "" && !isGAVersion(version) {
+		return nil
+	}
+	return &ErrVersionMismatch{Expected: version, Got: tag, Where: "istioctl git tag"}
+}
+
+// isGAVersion returns whether a version is a semantic version without a prerelease, such as 1.20.0
+func isGAVersion(version string) bool {
+	v, err := semver.StrictNewVersion(version)
+	return err == nil && v.Prerelease() == ""
+}
+
+// TestIstioctlChecksum verifies each checksum file of istioctl in the archive. Checksums for every algorithm in the
+// manifest must be present.
+func TestIstioctlChecksum(r ReleaseInfo) error {
+	return verifyChecksums(filepath.Join(r.archive, "bin", "istioctl"), requiredShaAlgorithms(r.manifest))
+}
+
+// TestArtifactChecksums verifies the checksum files of every release artifact: the archives matching
+// model.SignedArchivePatterns, and any other file with a checksum next to it, such as the rpm and deb packages.
+// Checksums for every algorithm in the manifest must be present, and every checksum present must match.
+func TestArtifactChecksums(r ReleaseInfo) error {
+	artifacts := map[string]struct{}{}
+	for _, pattern := range model.SignedArchivePatterns {
+		matches, err := filepath.Glob(filepath.Join(r.release, pattern))
+		if err != nil {
+			return err
+		}
+		for _, m := range matches {
+			artifacts[m] = struct{}{}
+		}
+	}
+	err := filepath.Walk(r.release, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		for _, algo := range util.ShaAlgorithms {
+			if src := strings.TrimSuffix(p, "."+string(algo)); src != p {
+				artifacts[src] = struct{}{}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(artifacts))
+	for artifact := range artifacts {
+		names = append(names, artifact)
+	}
+	sort.Strings(names)
+	required := requiredShaAlgorithms(r.manifest)
+	for _, artifact := range names {
+		if err := verifyChecksums(artifact, required); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// requiredShaAlgorithms returns the checksum algorithms the manifest requires next to each artifact
+func requiredShaAlgorithms(manifest model.Manifest) map[string]struct{} {
+	required := map[string]struct{}{}
+	for _, algo := range manifest.ShaAlgorithms {
+		required[algo] = struct{}{}
+	}
+	if len(required) == 0 {
+		// Releases built before the algorithms were recorded in the manifest
+		required[string(util.Sha256)] = struct{}{}
+	}
+	return required
+}
+
+// verifyChecksums checks each checksum file of file matches it. Checksums for every required algorithm must be present.
+func verifyChecksums(file string, required map[string]struct{}) error {
+	if _, err := os.Stat(file); err != nil {
+		return missingArtifact(file, err)
+	}
+	for _, algo := range util.ShaAlgorithms {
+		shaFile := file + "." + string(algo)
+		expected, err := os.ReadFile(shaFile)
+		if err != nil {
+			if _, f := required[string(algo)]; f || !os.IsNotExist(err) {
+				return missingArtifact(shaFile, err)
+			}
+			continue
+		}
+		sum, err := util.FileShaSum(algo, file)
+		if err != nil {
+			return err
+		}
+		if got := fmt.Sprintf("%s %s\n", sum, filepath.Base(file)); got != string(expected) {
+			return &ErrChecksumMismatch{
+				Algorithm: string(algo),
+				Expected:  strings.TrimSpace(string(expected)),
+				Got:       strings.TrimSpace(got),
+				Where:     filepath.Base(file),
+			}
+		}
 	}
+	return nil
+}
 
-	if gotVersion := v.ClientVersion.Version; gotVersion != r.manifest.Version {
-		return fmt.Errorf("expected proxy version to be %s, got %s", r.manifest.Version, gotVersion)
+// TestIstioctlManifestGenerate renders the default profile with the archive istioctl and charts, and checks the
+// rendered istiod image uses the release hub and tag.
+func TestIstioctlManifestGenerate(r ReleaseInfo) error {
+	buf := &bytes.Buffer{}
+	cmd := util.VerboseCommand(filepath.Join(r.archive, "bin", "istioctl"), "manifest", "generate",
+		"-f", filepath.Join(r.archive, model.ArchiveDefaultProfile),
+		"--manifests", filepath.Join(r.archive, model.ArchiveManifestsDir))
+	cmd.Stdout = buf
+	if err := util.RunSummarized(cmd); err != nil {
+		return commandFailed(cmd, err)
+	}
+	if strings.TrimSpace(buf.String()) == "" {
+		return fmt.Errorf("manifest generate produced no output")
+	}
+	image := ""
+	for _, doc := range strings.Split(buf.String(), "\n---") {
+		values, err := getValues([]byte(doc))
+		if err != nil {
+			return fmt.Errorf("manifest generate produced invalid yaml: %v", err)
+		}
+		if values == nil {
+			continue
+		}
+		m := GenericMap{values}
+		kind, _ := m.Path([]string{"kind"})
+		name, _ := m.Path([]string{"metadata", "name"})
+		if kind != "Deployment" || name != "istiod" {
+			continue
+		}
+		img, err := m.Path([]string{"spec", "template", "spec", "containers", "0", "image"})
+		if err != nil {
+			return fmt.Errorf("invalid path: %v", err)
+		}
+		image, _ = img.(string)
+	}
+	if image == "" {
+		return fmt.Errorf("no istiod deployment found in generated manifest")
+	}
+	if expected := fmt.Sprintf("%s/pilot:%s", r.expectedHub(), r.expectedTag()); image != expected {
+		return &ErrVersionMismatch{Expected: expected, Got: image, Where: "istiod image in generated manifest"}
 	}
 	return nil
 }
@@ -190,7 +846,7 @@ func (g GenericMap) Path(path []string) (interface{}, error) {
 			tmpList = nil
 		}
 		switch v := val.(type) {
-		case string:
+		case string, bool:
 			return v, nil
 		case map[string]interface{}:
 			current = v
@@ -212,39 +868,101 @@ func getValues(values []byte) (map[string]interface{}, error) {
 }
 
 func TestDocker(r ReleaseInfo) error {
-	expected := []string{
-		"pilot-distroless",
-		"pilot-debug",
-		"install-cni-debug",
-		"ztunnel-debug",
-		"ztunnel-distroless",
-		"proxyv2-debug",
-		"proxyv2-distroless",
+	expected := r.manifest.DockerImages
+	if len(expected) == 0 {
+		// Releases built before the image list was recorded in the manifest
+		expected = model.DefaultDockerImages
+	}
+	if r.manifest.DockerOutput == model.DockerOutputContext {
+		// Images were loaded into the local docker context rather than saved to the release
+		return testDockerContext(r, expected)
 	}
 	found := map[string]struct{}{}
-	d, err := os.ReadDir(filepath.Join(r.release, "docker"))
+	d, err := os.ReadDir(r.artifactDir(model.DockerArtifacts))
 	if err != nil {
-		return fmt.Errorf("failed to read docker dir: %v", err)
+		return missingArtifact(r.artifactDir(model.DockerArtifacts), err)
 	}
 	for _, i := range d {
+		if r.manifest.SkipAmbient && model.IsAmbientImage(i.Name()) {
+			return fmt.Errorf("ambient is disabled, but found ambient image %v", i.Name())
+		}
 		found[i.Name()] = struct{}{}
 	}
-	for _, plat := range r.manifest.Architectures {
-		_, arch, _ := strings.Cut(plat, "/")
-		suffix := ""
-		if arch != "amd64" {
-			suffix = "-" + arch
+	for _, plat := range r.manifest.GetDockerArchitectures() {
+		suffix, err := util.ImageArchSuffix(plat)
+		if err != nil {
+			return err
 		}
 		for _, i := range expected {
-			image := i + suffix + ".tar.gz"
+			image := r.manifest.ShippedImage(i) + suffix + ".tar.gz"
 			if _, f := found[image]; !f {
-				return fmt.Errorf("expected docker image %v, but had %v", image, found)
+				return missingImage(i, filepath.Join(r.artifactDir(model.DockerArtifacts), image))
+			}
+			// The images are checked against the hub and version the build tagged them with, even if validating a
+			// mirrored release. Running images to check their version is left to TestProxyVersion.
+			if _, err := validateImageTarball(filepath.Join(r.artifactDir(model.DockerArtifacts), image), r.manifest.Docker, r.manifest.Version, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// missingImage returns the error for an expected image that was not found, explaining why ambient images are expected
+func missingImage(image, path string) error {
+	if model.IsAmbientImage(image) {
+		return fmt.Errorf("ambient is enabled, so %v is expected: %w", image, &ErrMissingArtifact{Path: path})
+	}
+	return &ErrMissingArtifact{Path: path}
+}
+
+// dockerConcurrency limits how many docker commands validation runs at once, as concurrent loads contend for disk
+// and can race writing the same layers. It is set with VALIDATE_DOCKER_CONCURRENCY, defaulting to 1.
+var dockerConcurrency = func() int {
+	n, err := strconv.Atoi(os.Getenv("VALIDATE_DOCKER_CONCURRENCY"))
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}()
+
+// dockerSemaphore is shared by all checks, and must be held while running a docker command
+var dockerSemaphore = make(chan struct{}, dockerConcurrency)
+
+// withDocker runs fn once fewer than dockerConcurrency docker commands are running
+func withDocker(fn func() error) error {
+	dockerSemaphore <- struct{}{}
+	defer func() { <-dockerSemaphore }()
+	return fn()
+}
+
+// dockerImageExists checks if an image is present in the local docker context
+var dockerImageExists = func(image string) bool {
+	return withDocker(util.VerboseCommand("docker", "image", "inspect", image).Run) == nil
+}
+
+func testDockerContext(r ReleaseInfo, expected []string) error {
+	for _, plat := range r.manifest.GetDockerArchitectures() {
+		suffix, err := util.ImageArchSuffix(plat)
+		if err != nil {
+			return err
+		}
+		for _, i := range expected {
+			image := dockerContextReference(r, i) + suffix
+			if !dockerImageExists(image) {
+				return missingImage(i, image)
 			}
 		}
 	}
 	return nil
 }
 
+// dockerContextReference returns the tag of an image built by istio, such as pilot-distroless, in the local docker
+// context, applying the manifest ImageRenames. The debug variant is the default, so it has no tag suffix.
+func dockerContextReference(r ReleaseInfo, image string) string {
+	return r.manifest.ImageReference(r.expectedHub(), r.expectedTag(), r.manifest.ShippedImage(image))
+}
+
 type DockerManifest struct {
 	Config string `json:"Config"`
 }
@@ -254,253 +972,2120 @@ type DockerConfig struct {
 }
 
 type DockerConfigConfig struct {
-	Env []string `json:"Env"`
+	Entrypoint []string `json:"Entrypoint"`
+	Env        []string `json:"Env"`
+	User       string   `json:"User"`
 }
 
-// BuildInfo describes version information about the binary build.
-type BuildInfo struct {
-	Version       string `json:"version"`
-	GitRevision   string `json:"revision"`
-	GolangVersion string `json:"golang_version"`
-	BuildStatus   string `json:"status"`
-	GitTag        string `json:"tag"`
-}
+// TestImageSize checks the compressed archive of each docker image is within its limit in the manifest
+func TestImageSize(r ReleaseInfo) error {
+	if len(r.manifest.ImageSizeLimits) == 0 {
+		return nil
+	}
+	if r.manifest.DockerOutput == model.DockerOutputContext {
+		log.Infof("Skipping TestImageSize; images were not saved to the release")
+		return nil
+	}
+	for _, plat := range r.manifest.GetDockerArchitectures() {
+		suffix, err := util.ImageArchSuffix(plat)
+		if err != nil {
+			return err
+		}
+		for _, image := range r.manifest.DockerImages {
+			limit, f := imageSizeLimit(r.manifest.ImageSizeLimits, image)
+			if !f {
+				continue
+			}
+			archive := filepath.Join(r.artifactDir(model.DockerArtifacts), r.manifest.ShippedImage(image)+suffix+".tar.gz")
+			info, err := os.Stat(archive)
+			if err != nil {
+				return missingArtifact(archive, err)
+			}
+			size := float64(info.Size()) / (1 << 20)
+			if size > float64(limit) {
+				return fmt.Errorf("image %v is %.1f MiB, exceeding its limit of %d MiB", image+suffix, size, limit)
+			}
+			if size > 0.9*float64(limit) {
+				log.Warnf("image %v is %.1f MiB, close to its limit of %d MiB", image+suffix, size, limit)
+			}
+		}
+	}
+	return nil
+}
 
-// Version holds info for client and control plane versions
-type Version struct {
-	ClientVersion *BuildInfo `json:"clientVersion,omitempty" yaml:"clientVersion,omitempty"`
+// imageSizeLimit returns the limit for an image. If several patterns match the image, the lowest limit is used.
+func imageSizeLimit(limits map[string]int, image string) (int, bool) {
+	limit, found := 0, false
+	for pattern, l := range limits {
+		if m, _ := path.Match(pattern, image); m && (!found || l < limit) {
+			limit, found = l, true
+		}
+	}
+	return limit, found
 }
 
-func TestProxyVersion(r ReleaseInfo) error {
-	archive := filepath.Join(r.release, "docker", "proxyv2-debug.tar.gz")
-	if err := util.VerboseCommand("docker", "load", "-i", archive).Run(); err != nil {
-		return fmt.Errorf("failed to load proxyv2-debug.tar.gz as docker image: %v", err)
+// imageConfigRule defines the entrypoint of an image, and the environment its config must, and must not, set. Each
+// environment entry is either `KEY`, matching any value, or `KEY=VALUE`, matching exactly.
+type imageConfigRule struct {
+	Entrypoint string
+	Required   []string
+	// Forbidden is the environment each variant of the image must not set, keyed by variant
+	Forbidden map[string][]string
+}
+
+// imageConfigRules are the config rules checked by TestImageEntrypoint, keyed by image name without its variant. They
+// apply to every variant of the image the release builds.
+var imageConfigRules = map[string]imageConfigRule{
+	"proxyv2": {
+		Entrypoint: "/usr/local/bin/pilot-agent",
+		Required:   []string{"ISTIO_META_ISTIO_PROXY_SHA"},
+		Forbidden:  map[string][]string{"distroless": {"ENVOY_UID=0"}},
+	},
+}
+
+// TestImageEntrypoint checks the entrypoint and environment of each built image with a rule in imageConfigRules, read
+// from the config in the image tarball without loading it into docker.
+func TestImageEntrypoint(r ReleaseInfo) error {
+	if r.manifest.DockerOutput == model.DockerOutputContext {
+		log.Infof("Skipping TestImageEntrypoint; images were not saved to the release")
+		return nil
 	}
-	buf := bytes.Buffer{}
-	image := fmt.Sprintf("%s/%s:%s", r.manifest.Docker, "proxyv2", r.manifest.Version)
-	cmd := util.VerboseCommand("docker", "run", "--rm", image, "version", "--short", "-ojson")
-	cmd.Stdout = &buf
-	if err := cmd.Run(); err != nil {
-		return err
+	images := r.manifest.DockerImages
+	if len(images) == 0 {
+		images = model.DefaultDockerImages
 	}
-
-	var v Version
-	if err := json.Unmarshal(buf.Bytes(), &v); err != nil {
-		return fmt.Errorf("failed to unmarshal version information: %v", err)
+	for _, plat := range r.manifest.GetDockerArchitectures() {
+		suffix, err := util.ImageArchSuffix(plat)
+		if err != nil {
+			return err
+		}
+		for _, image := range images {
+			name, variant := r.manifest.SplitImage(image)
+			rule, f := imageConfigRules[name]
+			if !f {
+				continue
+			}
+			archive := filepath.Join(r.artifactDir(model.DockerArtifacts), r.manifest.ShippedImage(image)+suffix+".tar.gz")
+			if !util.FileExists(archive) {
+				return &ErrMissingArtifact{Path: archive}
+			}
+			config, err := imageConfig(archive)
+			if err != nil {
+				return fmt.Errorf("%v: %v", image+suffix, err)
+			}
+			if err := checkImageConfig(rule, variant, config.Config); err != nil {
+				return fmt.Errorf("%v: %v", image+suffix, err)
+			}
+		}
 	}
+	return nil
+}
 
-	if v.ClientVersion == nil {
-		return fmt.Errorf("no client version found in version information")
+// checkImageConfig checks the config of an image variant against a rule
+func checkImageConfig(rule imageConfigRule, variant string, config DockerConfigConfig) error {
+	if rule.Entrypoint != "" && (len(config.Entrypoint) == 0 || config.Entrypoint[0] != rule.Entrypoint) {
+		return fmt.Errorf("expected entrypoint %v, got %v", rule.Entrypoint, config.Entrypoint)
 	}
-
-	if gotVersion := v.ClientVersion.Version; gotVersion != r.manifest.Version {
-		return fmt.Errorf("expected proxy version to be %s, got %s", r.manifest.Version, gotVersion)
+	matches := func(want string) bool {
+		for _, e := range config.Env {
+			key, _, _ := strings.Cut(e, "=")
+			if e == want || key == want {
+				return true
+			}
+		}
+		return false
+	}
+	for _, want := range rule.Required {
+		if !matches(want) {
+			return fmt.Errorf("missing env %v", want)
+		}
+	}
+	for _, deny := range rule.Forbidden[variant] {
+		if matches(deny) {
+			return fmt.Errorf("forbidden env %v is set", deny)
+		}
 	}
 	return nil
 }
 
-func TestHelmChartVersions(r ReleaseInfo) error {
-	if !util.IsValidSemver(r.manifest.Version) {
-		log.Infof("Skipping TestHelmChartVersions; not a valid semver")
+// imageConfig reads the config of the first image in a `docker save` tarball
+func imageConfig(archive string) (DockerConfig, error) {
+	by, err := util.ImageConfig(archive)
+	if err != nil {
+		return DockerConfig{}, err
+	}
+	var config DockerConfig
+	if err := json.Unmarshal(by, &config); err != nil {
+		return DockerConfig{}, fmt.Errorf("failed to read image config: %v", err)
+	}
+	return config, nil
+}
+
+// imageIDRegex matches the image ID of a locked image
+var imageIDRegex = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// TestImageLock checks the image lock, if the manifest enabled it, pins every expected image and architecture to a
+// well-formed image ID
+func TestImageLock(r ReleaseInfo) error {
+	if !r.manifest.ImageLock {
 		return nil
 	}
-	expected := map[string]string{
-		"cni":     "_internal_defaults_do_not_set.global",
-		"ztunnel": "_internal_defaults_do_not_set",
-		"istiod":  "_internal_defaults_do_not_set.global",
-		"base":    "none",
-		"gateway": "none",
+	lockFile := filepath.Join(r.release, model.ImageLockFile)
+	by, err := os.ReadFile(lockFile)
+	if err != nil {
+		return missingArtifact(lockFile, err)
 	}
-	for chart, path := range expected {
-		buf := bytes.Buffer{}
-		c := util.VerboseCommand("helm", "show", "values",
-			filepath.Join(r.release, "helm", fmt.Sprintf("%s-%s.tgz", chart, r.manifest.Version)))
-		c.Stdout = &buf
-		if err := c.Run(); err != nil {
-			return fmt.Errorf("helm show: %v", err)
+	lock := model.ImageLock{}
+	if err := json.Unmarshal(by, &lock); err != nil {
+		return fmt.Errorf("failed to parse %v: %v", model.ImageLockFile, err)
+	}
+	locked := map[string]struct{}{}
+	for _, image := range lock.Images {
+		if !imageIDRegex.MatchString(image.ImageID) {
+			return fmt.Errorf("%v: expected image ID sha256:<hex> of %v, got %q", model.ImageLockFile, image.Image, image.ImageID)
 		}
-		if path == "none" {
-			// Chart no hub/tag
-			continue
+		locked[image.Image] = struct{}{}
+	}
+	// The lock records the references the build tagged the images with, even if validating a mirrored release
+	built := r
+	built.hub, built.tag, built.mirrorRewrites = "", "", nil
+	expected := r.manifest.DockerImages
+	if len(expected) == 0 {
+		expected = model.DefaultDockerImages
+	}
+	missing := []string{}
+	for _, plat := range r.manifest.GetDockerArchitectures() {
+		suffix, err := util.ImageArchSuffix(plat)
+		if err != nil {
+			return err
 		}
-		if err := validateHubTag(r, buf.Bytes(), path); err != nil {
-			return fmt.Errorf("%s: %v", chart, err)
+		for _, image := range expected {
+			ref := dockerContextReference(built, image) + suffix
+			if _, f := locked[ref]; !f {
+				missing = append(missing, ref)
+			}
 		}
 	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%v does not pin images: %v", model.ImageLockFile, strings.Join(missing, ", "))
+	}
 	return nil
 }
 
-func TestHelmVersionsIstio(r ReleaseInfo) error {
-	manifestValues := []string{
-		"manifests/charts/gateways/istio-egress/values.yaml",
-		"manifests/charts/gateways/istio-ingress/values.yaml",
-		"manifests/charts/istio-cni/values.yaml",
-		"manifests/charts/istio-control/istio-discovery/values.yaml",
+// DefaultRootImages are the images allowed to run as root: install-cni writes the CNI configuration to the host, and
+// ztunnel configures the network of the pods on the node.
+var DefaultRootImages = []string{"install-cni", "ztunnel"}
+
+// TestImageUser checks distroless images, and debug images if nonRootDebug is set, run as a non-root user, reading the
+// user from the config in the image tarball without loading it into docker. Images in rootImages are exempt. Every
+// image running as root is reported.
+func TestImageUser(r ReleaseInfo) error {
+	if r.manifest.DockerOutput == model.DockerOutputContext {
+		log.Infof("Skipping TestImageUser; images were not saved to the release")
+		return nil
 	}
-	topLevel := []string{"manifests/charts/ztunnel/values.yaml"}
-	for _, file := range manifestValues {
-		err := validateHubTagFromFile(r, file, "_internal_defaults_do_not_set.global")
-		if err != nil {
-			return err
-		}
+	nonRoot := []string{"distroless"}
+	if r.nonRootDebug {
+		nonRoot = append(nonRoot, "debug")
+	}
+	rootImages := r.rootImages
+	if len(rootImages) == 0 {
+		rootImages = DefaultRootImages
 	}
-	for _, file := range topLevel {
-		err := validateHubTagFromFile(r, file, "_internal_defaults_do_not_set")
+	images := r.manifest.DockerImages
+	if len(images) == 0 {
+		images = model.DefaultDockerImages
+	}
+	root := []string{}
+	for _, plat := range r.manifest.GetDockerArchitectures() {
+		suffix, err := util.ImageArchSuffix(plat)
 		if err != nil {
 			return err
 		}
+		for _, image := range images {
+			if name, variant := r.manifest.SplitImage(image); !slices.Contains(nonRoot, variant) || slices.Contains(rootImages, name) {
+				continue
+			}
+			archive := filepath.Join(r.artifactDir(model.DockerArtifacts), r.manifest.ShippedImage(image)+suffix+".tar.gz")
+			if !util.FileExists(archive) {
+				return &ErrMissingArtifact{Path: archive}
+			}
+			config, err := imageConfig(archive)
+			if err != nil {
+				return fmt.Errorf("%v: %v", image+suffix, err)
+			}
+			if isRootUser(config.Config.User) {
+				root = append(root, fmt.Sprintf("%v (user %q)", image+suffix, config.Config.User))
+			}
+		}
+	}
+	if len(root) > 0 {
+		return fmt.Errorf("images must run as a non-root user, but run as root: %v", strings.Join(root, ", "))
 	}
 	return nil
 }
 
-func validateHubTagFromFile(r ReleaseInfo, file string, paths string) error {
-	values, err := os.ReadFile(filepath.Join(r.archive, file))
+// isRootUser returns true if an image config user, in the form user[:group], runs as root. An unset user defaults
+// to root.
+func isRootUser(user string) bool {
+	name, _, _ := strings.Cut(user, ":")
+	return name == "" || name == "root" || name == "0"
+}
+
+// BuildInfo describes version information about the binary build.
+type BuildInfo struct {
+	Version       string `json:"version"`
+	GitRevision   string `json:"revision"`
+	GolangVersion string `json:"golang_version"`
+	BuildStatus   string `json:"status"`
+	GitTag        string `json:"tag"`
+}
+
+// Version holds info for client and control plane versions
+type Version struct {
+	ClientVersion *BuildInfo `json:"clientVersion,omitempty" yaml:"clientVersion,omitempty"`
+}
+
+// TestProxyVersion checks the proxyv2 image reports the release version. The image of every architecture saved to the
+// release is checked with ValidateImageTarball, and otherwise the image is run from the local docker context.
+func TestProxyVersion(r ReleaseInfo) error {
+	if r.imageSource != ImageSourceRegistry && r.manifest.DockerOutput != model.DockerOutputContext {
+		for _, plat := range r.manifest.GetDockerArchitectures() {
+			suffix, err := util.ImageArchSuffix(plat)
+			if err != nil {
+				return err
+			}
+			archive := filepath.Join(r.artifactDir(model.DockerArtifacts), r.manifest.ShippedImage("proxyv2-debug")+suffix+".tar.gz")
+			if _, err := ValidateImageTarball(archive, r.manifest.Docker, r.manifest.Version); err != nil {
+				return fmt.Errorf("proxy: %w", err)
+			}
+		}
+		return nil
+	}
+	image, err := loadProxyImage(r)
 	if err != nil {
 		return err
 	}
-	return validateHubTag(r, values, paths)
+	err = withDocker(func() error {
+		return checkClientVersion(r, util.RunOptions{}, "docker", "run", "--rm", image, "version", "--short", "-ojson")
+	})
+	if err != nil {
+		return fmt.Errorf("proxy: %w", err)
+	}
+	return nil
 }
 
-func validateHubTag(r ReleaseInfo, valuesBytes []byte, paths string) error {
-	values, err := getValues(valuesBytes)
+// TestProxySha checks the Envoy binary in the proxyv2 image was built from the proxy dependency. A stale binary, such
+// as one pulled from an outdated ProxyOverride, would otherwise go unnoticed as the image still reports the release version.
+func TestProxySha(r ReleaseInfo) error {
+	proxy := r.manifest.Dependencies.Get()["proxy"]
+	if proxy == nil || proxy.Sha == "" {
+		return fmt.Errorf("no proxy SHA in manifest")
+	}
+	image, err := loadProxyImage(r)
 	if err != nil {
 		return err
 	}
-	tagPath := append(strings.Split(paths, "."), "tag")
-	if paths == "" {
-		tagPath = []string{"tag"}
+	buf := bytes.Buffer{}
+	cmd := util.VerboseCommand("docker", "run", "--rm", "--entrypoint", "/usr/local/bin/envoy", image, "--version")
+	cmd.Stdout = &buf
+	if err := withDocker(func() error { return util.RunSummarized(cmd) }); err != nil {
+		return commandFailed(cmd, err)
 	}
-	tag, err := GenericMap{values}.Path(tagPath)
+	sha, err := parseEnvoyVersion(buf.String())
 	if err != nil {
-		return fmt.Errorf("invalid path: %v", err)
+		return err
 	}
-	if tag != r.manifest.Version {
-		return fmt.Errorf("archive tag incorrect: got %v expected %v", tag, r.manifest.Version)
+	if sha != proxy.Sha {
+		return &ErrVersionMismatch{Expected: proxy.Sha, Got: sha, Where: "envoy build SHA"}
 	}
-	hubPath := append(strings.Split(paths, "."), "hub")
-	if paths == "" {
-		hubPath = []string{"hub"}
+	return nil
+}
+
+// TestProxyExtensions checks every proxyv2 image, of each variant and architecture, bundles the wasm extensions listed
+// in the manifest. The filesystem is read from the image layers, or from an exported container if the images are not
+// in the release, so images without a shell, such as distroless, are checked too. Each missing extension is reported.
+func TestProxyExtensions(r ReleaseInfo) error {
+	if len(r.manifest.ProxyExtensions) == 0 {
+		log.Infof("Skipping TestProxyExtensions; manifest lists no proxy extensions")
+		return nil
 	}
-	hub, err := GenericMap{values}.Path(hubPath)
-	if err != nil {
-		return fmt.Errorf("invalid path: %v", err)
+	variants := append(append([]string{}, model.DefaultDockerVariants...), r.manifest.DockerVariants...)
+	images := r.manifest.DockerImages
+	if len(images) == 0 {
+		images = model.DefaultDockerImages
+	}
+	var missing []string
+	for _, image := range images {
+		if name, _ := model.SplitImageVariant(image, variants); name != "proxyv2" {
+			continue
+		}
+		for _, plat := range r.manifest.GetDockerArchitectures() {
+			suffix, err := util.ImageArchSuffix(plat)
+			if err != nil {
+				return err
+			}
+			files, err := proxyImageFiles(r, image, suffix)
+			if err != nil {
+				return fmt.Errorf("%v: %w", image+suffix, err)
+			}
+			for _, ext := range r.manifest.ProxyExtensions {
+				if _, f := files[path.Clean(ext)]; !f {
+					missing = append(missing, fmt.Sprintf("%v in %v", ext, image+suffix))
+				}
+			}
+			if r.imageSource == ImageSourceRegistry {
+				// Only the image of the host architecture is pulled
+				break
+			}
+		}
 	}
-	if hub != r.manifest.Docker {
-		return fmt.Errorf("hub incorrect: got %v expected %v", hub, r.manifest.Docker)
+	if len(missing) > 0 {
+		return fmt.Errorf("proxy extensions are missing: %v", strings.Join(missing, ", "))
 	}
 	return nil
 }
 
-func TestIstioctlProfiles(r ReleaseInfo) error {
-	operatorChecks := []string{
-		"manifests/profiles/default.yaml",
+// proxyImageFiles returns the filesystem of a proxyv2 image for the architecture suffix, from its archive in the
+// release, or otherwise from the local docker context
+func proxyImageFiles(r ReleaseInfo, image, suffix string) (map[string]struct{}, error) {
+	switch {
+	case r.imageSource == ImageSourceRegistry:
+		ref, err := loadImage(r, image)
+		if err != nil {
+			return nil, err
+		}
+		return containerFiles(ref)
+	case r.manifest.DockerOutput == model.DockerOutputContext:
+		return containerFiles(dockerContextReference(r, image) + suffix)
+	default:
+		archive := filepath.Join(r.artifactDir(model.DockerArtifacts), r.manifest.ShippedImage(image)+suffix+".tar.gz")
+		if !util.FileExists(archive) {
+			return nil, &ErrMissingArtifact{Path: archive}
+		}
+		return util.ImageFiles(archive)
 	}
-	for _, f := range operatorChecks {
-		by, err := os.ReadFile(filepath.Join(r.archive, f))
+}
+
+// containerFiles returns the filesystem of an image in the local docker context, exporting a container created from
+// it. The container is never started, so this works for images without a shell.
+var containerFiles = func(ref string) (map[string]struct{}, error) {
+	var files map[string]struct{}
+	err := withDocker(func() error {
+		out, err := util.Run(util.RunOptions{CaptureStdout: true}, "docker", "create", ref)
 		if err != nil {
 			return err
 		}
-		values, err := getValues(by)
+		id := strings.TrimSpace(out)
+		defer func() {
+			_, _ = util.Run(util.RunOptions{}, "docker", "rm", id)
+		}()
+		cmd := util.VerboseCommand("docker", "export", id)
+		cmd.Stdout = nil
+		stdout, err := cmd.StdoutPipe()
 		if err != nil {
 			return err
 		}
-		tag, err := GenericMap{values}.Path([]string{"spec", "tag"})
-		if err != nil {
-			return fmt.Errorf("invalid path: %v", err)
+		if err := cmd.Start(); err != nil {
+			return commandFailed(cmd, err)
 		}
-		if tag != r.manifest.Version {
-			return fmt.Errorf("archive tag incorrect, got %v expected %v", tag, r.manifest.Version)
+		paths, listErr := util.ListTarPaths(stdout)
+		// Drain the export, so docker is not blocked writing it if listing failed part way
+		_, _ = io.Copy(io.Discard, stdout)
+		if err := cmd.Wait(); err != nil {
+			return commandFailed(cmd, err)
 		}
-		hub, err := GenericMap{values}.Path([]string{"spec", "hub"})
-		if err != nil {
-			return fmt.Errorf("invalid path: %v", err)
+		if listErr != nil {
+			return fmt.Errorf("failed to list %v: %v", ref, listErr)
 		}
-		if hub != r.manifest.Docker {
-			return fmt.Errorf("hub incorrect, got %v expected %v", hub, r.manifest.Docker)
+		files = map[string]struct{}{}
+		for _, p := range paths {
+			files[p] = struct{}{}
 		}
-	}
-	return nil
+		return nil
+	})
+	return files, err
 }
 
-func TestManifest(r ReleaseInfo) error {
-	for _, repo := range []string{"api", "client-go", "istio", "proxy"} {
-		d, f := r.manifest.Dependencies.Get()[repo]
-		if d == nil {
-			return fmt.Errorf("missing dependency: %v", repo)
-		}
-		if !f || d.Sha == "" {
-			return fmt.Errorf("got empty SHA for %v", repo)
-		}
+// envoyVersionRegex matches the build SHA in `envoy --version` output, such as
+// `envoy  version: 0123456789abcdef0123456789abcdef01234567/1.30.0-dev/Clean/RELEASE/BoringSSL`
+var envoyVersionRegex = regexp.MustCompile(`version: ([0-9a-f]{40})/`)
+
+func parseEnvoyVersion(out string) (string, error) {
+	m := envoyVersionRegex.FindStringSubmatch(out)
+	if m == nil {
+		return "", fmt.Errorf("no build SHA found in envoy version %q", strings.TrimSpace(out))
 	}
-	if r.manifest.Directory != "" {
-		return fmt.Errorf("expected manifest directory to be hidden, got %v", r.manifest.Directory)
+	return m[1], nil
+}
+
+// loadProxyImage loads the proxyv2 image from the release into the local docker context, unless the build already
+// wrote the images there, and returns the reference to run it with
+func loadProxyImage(r ReleaseInfo) (string, error) {
+	return loadImage(r, "proxyv2-debug")
+}
+
+// dockerPull pulls an image into the local docker context, authenticating with the docker credentials
+var dockerPull = func(image string) error {
+	cmd := util.VerboseCommand("docker", "pull", image)
+	if err := withDocker(func() error { return util.RunSummarized(cmd) }); err != nil {
+		return commandFailed(cmd, err)
 	}
 	return nil
 }
 
-func TestGrafana(r ReleaseInfo) error {
-	created := map[string]struct{}{}
-	dir, err := os.ReadDir(path.Join(r.release, "grafana"))
+// loadImage loads an image, including its variant, into the local docker context, and returns the reference to run
+// it with. Images are pulled from the registry if that is the image source, and otherwise the image of
+// runArchitecture is loaded from the release, unless the build already wrote the images there.
+func loadImage(r ReleaseInfo, image string) (string, error) {
+	if r.imageSource == ImageSourceRegistry {
+		ref := dockerContextReference(r, image)
+		if err := dockerPull(ref); err != nil {
+			return "", fmt.Errorf("failed to pull %v, check docker is logged in to %v: %w", ref, r.expectedHub(), err)
+		}
+		return ref, nil
+	}
+	suffix, err := util.ImageArchSuffix(runArchitecture(r))
 	if err != nil {
-		return err
+		return "", err
 	}
-	for _, db := range dir {
-		created[strings.TrimSuffix(db.Name(), ".json")] = struct{}{}
+	ref := dockerContextReference(r, image) + suffix
+	if r.manifest.DockerOutput == model.DockerOutputContext {
+		return ref, nil
 	}
-	manifest := map[string]struct{}{}
-	for dashboard := range r.manifest.GrafanaDashboards {
-		manifest[dashboard] = struct{}{}
+	archive := filepath.Join(r.artifactDir(model.DockerArtifacts), r.manifest.ShippedImage(image)+suffix+".tar.gz")
+	if !util.FileExists(archive) {
+		return "", &ErrMissingArtifact{Path: archive}
 	}
-	if !reflect.DeepEqual(created, manifest) {
-		return fmt.Errorf("dashboards out of sync, release contains %+v, manifest contains %+v", created, manifest)
+	cmd := util.VerboseCommand("docker", "load", "-i", archive)
+	if err := withDocker(func() error { return util.RunSummarized(cmd) }); err != nil {
+		return "", commandFailed(cmd, err)
 	}
-	return nil
+	return ref, nil
 }
 
-func TestLicenses(r ReleaseInfo) error {
-	l, err := os.ReadDir(filepath.Join(r.release, "licenses"))
+// runArchitecture returns the docker architecture of the images validation runs: the host architecture if the
+// release has images for it, and otherwise the first one, which docker runs under emulation
+func runArchitecture(r ReleaseInfo) string {
+	host := "linux/" + runtime.GOARCH
+	archs := r.manifest.GetDockerArchitectures()
+	switch {
+	case slices.Contains(archs, host):
+		return host
+	case len(archs) > 0:
+		return archs[0]
+	default:
+		// The default architecture of input manifests
+		return "linux/amd64"
+	}
+}
+
+// operatorVersion returns the version reported by the operator binary in the release's operator image
+var operatorVersion = func(r ReleaseInfo) (string, error) {
+	image, err := loadImage(r, "operator-debug")
 	if err != nil {
-		return err
+		return "", err
 	}
-	// Expect to find license folders for these repos
-	expect := map[string]struct{}{
-		"istio.tar.gz":           {},
-		"client-go.tar.gz":       {},
-		"tools.tar.gz":           {},
-		"test-infra.tar.gz":      {},
-		"release-builder.tar.gz": {},
+	buf := bytes.Buffer{}
+	cmd := util.VerboseCommand("docker", "run", "--rm", image, "version", "--short")
+	cmd.Stdout = &buf
+	if err := withDocker(func() error { return util.RunSummarized(cmd) }); err != nil {
+		return "", commandFailed(cmd, err)
 	}
+	return strings.TrimSpace(buf.String()), nil
+}
 
-	for _, repo := range l {
-		delete(expect, repo.Name())
+// TestOperator checks the operator image reports the release version, if the manifest built it
+func TestOperator(r ReleaseInfo) error {
+	if !r.manifest.BuildOperator {
+		return nil
 	}
-
-	if len(expect) > 0 {
-		return fmt.Errorf("failed to find licenses for: %v", expect)
+	got, err := operatorVersion(r)
+	if err != nil {
+		return err
+	}
+	if got != r.manifest.Version {
+		return &ErrVersionMismatch{Expected: r.manifest.Version, Got: got, Where: "operator version"}
 	}
 	return nil
 }
 
-func TestCompletionFiles(r ReleaseInfo) error {
-	for _, file := range []string{"istioctl.bash", "_istioctl"} {
-		path := filepath.Join(r.archive, "tools", file)
-		if !util.FileExists(path) {
-			return fmt.Errorf("file not found %s", path)
+func TestHelmChartVersions(r ReleaseInfo) error {
+	if !util.IsValidSemver(r.manifest.Version) {
+		log.Infof("Skipping TestHelmChartVersions; not a valid semver")
+		return nil
+	}
+	expected := map[string]string{
+		"cni":     "_internal_defaults_do_not_set.global",
+		"ztunnel": "_internal_defaults_do_not_set",
+		"istiod":  "_internal_defaults_do_not_set.global",
+		"base":    "none",
+		"gateway": "none",
+	}
+	for chart, path := range expected {
+		buf := bytes.Buffer{}
+		c := util.VerboseCommand("helm", "show", "values",
+			filepath.Join(r.artifactDir(model.HelmArtifacts), fmt.Sprintf("%s-%s.tgz", chart, r.manifest.Version)))
+		c.Stdout = &buf
+		if err := util.RunSummarized(c); err != nil {
+			return commandFailed(c, err)
+		}
+		if path == "none" {
+			// Chart no hub/tag
+			continue
+		}
+		if err := validateHubTag(r, buf.Bytes(), path); err != nil {
+			return fmt.Errorf("%s: %w", chart, err)
 		}
 	}
 	return nil
 }
 
-func TestDebian(info ReleaseInfo) error {
-	if !fileExists(filepath.Join(info.release, "deb", "istio-sidecar.deb")) {
-		return fmt.Errorf("debian package not found")
-	}
-	return nil
-}
+var (
+	// helmCharts are the charts packaged in the helm directory of the release
+	helmCharts = []string{"base", "cni", "gateway", "istiod", "ztunnel"}
+	// helmSampleCharts are the charts packaged in the helm/samples directory of the release
+	helmSampleCharts = []string{"ambient"}
+)
 
-func TestRpm(info ReleaseInfo) error {
-	if !fileExists(filepath.Join(info.release, "rpm", "istio-sidecar.rpm")) {
-		return fmt.Errorf("rpm package not found")
+// TestHelmChartSet checks the helm directory contains exactly the expected charts at the release version. Charts left
+// over from an earlier build in the same output directory would otherwise make the release ambiguous.
+func TestHelmChartSet(r ReleaseInfo) error {
+	if !util.IsValidSemver(r.manifest.Version) {
+		log.Infof("Skipping TestHelmChartSet; not a valid semver")
+		return nil
+	}
+	dir := r.artifactDir(model.HelmArtifacts)
+	expected := map[string]struct{}{}
+	for _, chart := range helmCharts {
+		expected[fmt.Sprintf("%s-%s.tgz", chart, r.manifest.Version)] = struct{}{}
+	}
+	for _, chart := range helmSampleCharts {
+		expected[path.Join("samples", fmt.Sprintf("%s-%s.tgz", chart, r.manifest.Version))] = struct{}{}
+	}
+	if r.manifest.HelmRepoIndex {
+		expected[model.HelmRepoIndexFile] = struct{}{}
+	}
+	extra := []string{}
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		name, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if _, f := expected[filepath.ToSlash(name)]; f {
+			delete(expected, filepath.ToSlash(name))
+		} else {
+			extra = append(extra, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return missingArtifact(dir, err)
+	}
+	missing := make([]string, 0, len(expected))
+	for name := range expected {
+		missing = append(missing, name)
+	}
+	sort.Strings(missing)
+	if len(extra) > 0 {
+		return fmt.Errorf("unexpected files in %v: %v (missing: %v)", dir, extra, missing)
+	}
+	if len(missing) > 0 {
+		return &ErrMissingArtifact{Path: filepath.Join(dir, "{"+strings.Join(missing, ",")+"}")}
+	}
+	return nil
+}
+
+// helmRepoIndex is the part of a helm repo index.yaml checked by TestHelmRepoIndex
+type helmRepoIndex struct {
+	Entries map[string][]struct {
+		Name    string   `json:"name"`
+		Version string   `json:"version"`
+		URLs    []string `json:"urls"`
+		Digest  string   `json:"digest"`
+	} `json:"entries"`
+}
+
+// TestHelmRepoIndex checks the helm repo index, if the manifest requested it, has exactly one entry for each packaged
+// chart, with the name and version of the chart and the digest of its package
+func TestHelmRepoIndex(r ReleaseInfo) error {
+	if !r.manifest.HelmRepoIndex {
+		return nil
+	}
+	dir := r.artifactDir(model.HelmArtifacts)
+	file := filepath.Join(dir, model.HelmRepoIndexFile)
+	by, err := os.ReadFile(file)
+	if err != nil {
+		return missingArtifact(file, err)
+	}
+	var index helmRepoIndex
+	if err := yaml.Unmarshal(by, &index); err != nil {
+		return fmt.Errorf("failed to unmarshal %v: %v", file, err)
+	}
+	type entry struct{ name, version, digest string }
+	indexed := map[string]entry{}
+	var problems []string
+	for name, versions := range index.Entries {
+		for _, v := range versions {
+			if len(v.URLs) != 1 {
+				problems = append(problems, fmt.Sprintf("%v %v has urls %v, expected one", name, v.Version, v.URLs))
+				continue
+			}
+			if _, f := indexed[v.URLs[0]]; f {
+				problems = append(problems, fmt.Sprintf("%v is indexed more than once", v.URLs[0]))
+			}
+			indexed[v.URLs[0]] = entry{name: name, version: v.Version, digest: v.Digest}
+		}
+	}
+	var charts []string
+	for _, pattern := range []string{"*.tgz", "*/*.tgz"} {
+		m, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return err
+		}
+		charts = append(charts, m...)
+	}
+	for _, c := range charts {
+		rel, err := filepath.Rel(dir, c)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		got, f := indexed[rel]
+		if !f {
+			problems = append(problems, fmt.Sprintf("%v is not in the index", rel))
+			continue
+		}
+		delete(indexed, rel)
+		var chart struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		}
+		err = walkArchive(c, func(name string, _ os.FileMode, rd io.Reader) error {
+			if strings.Count(name, "/") != 1 || path.Base(name) != "Chart.yaml" {
+				return nil
+			}
+			by, err := io.ReadAll(rd)
+			if err != nil {
+				return err
+			}
+			return yaml.Unmarshal(by, &chart)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to read chart %v: %v", rel, err)
+		}
+		pkg, err := os.ReadFile(c)
+		if err != nil {
+			return err
+		}
+		digest, _ := util.ShaSum(util.Sha256, pkg)
+		if want := (entry{name: chart.Name, version: chart.Version, digest: digest}); got != want {
+			problems = append(problems, fmt.Sprintf("%v is indexed as %v %v with digest %v, expected %v %v with digest %v",
+				rel, got.name, got.version, got.digest, want.name, want.version, want.digest))
+		}
+	}
+	for url := range indexed {
+		problems = append(problems, fmt.Sprintf("%v is in the index, but not the release", url))
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("helm repo index does not match the charts: %v", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// TestArtifactSbom checks the artifact SBOM, if the release has one, describes every shipped chart and archive. Each
+// must be named exactly by a package or file of the SBOM, so a chart of another version does not count.
+func TestArtifactSbom(r ReleaseInfo) error {
+	if !r.manifest.ArtifactBillOfMaterials {
+		log.Infof("Skipping TestArtifactSbom; artifact SBOM not enabled")
+		return nil
+	}
+	sbomPath := filepath.Join(r.release, "istio-artifacts.spdx")
+	sbom, err := os.ReadFile(sbomPath)
+	if err != nil {
+		return missingArtifact(sbomPath, err)
+	}
+	expected := []string{}
+	for _, chart := range append(append([]string{}, helmCharts...), helmSampleCharts...) {
+		expected = append(expected, fmt.Sprintf("%s-%s", chart, r.manifest.Version))
+	}
+	for _, arch := range r.manifest.GetArchiveArchitectures() {
+		expected = append(expected, filepath.Base(releaseArchive(r.release, r.manifest.Version, arch)))
+	}
+	names, err := spdxNames(sbom)
+	if err != nil {
+		return fmt.Errorf("failed to parse istio-artifacts.spdx: %v", err)
+	}
+	missing := []string{}
+	for _, e := range expected {
+		if _, f := names[e]; !f {
+			missing = append(missing, e)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("istio-artifacts.spdx does not describe %v", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// helmTemplateProfiles are the profiles each chart is rendered with. The empty profile uses the chart defaults.
+var helmTemplateProfiles = []string{"", "demo", "ambient"}
+
+// TestHelmTemplate renders each packaged chart with every profile in helmTemplateProfiles, checking the templates
+// render and every Deployment and DaemonSet image uses the release hub and tag.
+func TestHelmTemplate(r ReleaseInfo) error {
+	if !util.IsValidSemver(r.manifest.Version) {
+		log.Infof("Skipping TestHelmTemplate; not a valid semver")
+		return nil
+	}
+	for _, chart := range helmCharts {
+		src := filepath.Join(r.artifactDir(model.HelmArtifacts), fmt.Sprintf("%s-%s.tgz", chart, r.manifest.Version))
+		if !util.FileExists(src) {
+			return &ErrMissingArtifact{Path: src}
+		}
+		for _, profile := range helmTemplateProfiles {
+			args := []string{"template", chart, src, "--namespace", "istio-system"}
+			if profile != "" {
+				args = append(args, "--set", "profile="+profile)
+			}
+			buf := &bytes.Buffer{}
+			errBuf := &bytes.Buffer{}
+			cmd := util.VerboseCommand("helm", args...)
+			cmd.Stdout = buf
+			cmd.Stderr = errBuf
+			if err := util.RunSummarized(cmd); err != nil {
+				return fmt.Errorf("%v (profile %q): %w", chart, profile,
+					commandFailed(cmd, fmt.Errorf("%v: %v", err, strings.TrimSpace(errBuf.String()))))
+			}
+			images, err := workloadImages(buf.Bytes())
+			if err != nil {
+				return fmt.Errorf("%v (profile %q): %v", chart, profile, err)
+			}
+			for _, image := range images {
+				if err := checkImage(r, image); err != nil {
+					return fmt.Errorf("%v (profile %q): %w", chart, profile, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// workloadImages returns the container images of each Deployment and DaemonSet in rendered manifests
+func workloadImages(rendered []byte) ([]string, error) {
+	var images []string
+	for _, doc := range strings.Split(string(rendered), "\n---") {
+		values, err := getValues([]byte(doc))
+		if err != nil {
+			return nil, fmt.Errorf("rendered invalid yaml: %v", err)
+		}
+		if kind := values["kind"]; kind != "Deployment" && kind != "DaemonSet" {
+			continue
+		}
+		for _, field := range []string{"initContainers", "containers"} {
+			containers, _ := lookupValue(values, []string{"spec", "template", "spec", field})
+			list, _ := containers.([]interface{})
+			for _, c := range list {
+				container, _ := c.(map[string]interface{})
+				if image, ok := container["image"].(string); ok {
+					images = append(images, image)
+				}
+			}
+		}
+	}
+	return images, nil
+}
+
+// checkImage checks an image uses the release hub and tag. Gateway images of `auto` are injected at runtime, so are
+// not checked.
+func checkImage(r ReleaseInfo, image string) error {
+	if image == "auto" {
+		return nil
+	}
+	repo, tag, _ := strings.Cut(image[strings.LastIndex(image, "/")+1:], ":")
+	hub := image[:max(strings.LastIndex(image, "/"), 0)]
+	if hub != r.expectedHub() {
+		return &ErrVersionMismatch{Expected: r.expectedHub(), Got: hub, Where: "hub of image " + repo}
+	}
+	if tag != r.expectedTag() {
+		return &ErrVersionMismatch{Expected: r.expectedTag(), Got: tag, Where: "tag of image " + repo}
+	}
+	return nil
+}
+
+// TestHelmVersionsIstio checks the chart values in the archive of every architecture have the release hub and tag
+func TestHelmVersionsIstio(r ReleaseInfo) error {
+	manifestValues := []string{
+		path.Join(model.ArchiveChartsDir, "gateways/istio-egress/values.yaml"),
+		path.Join(model.ArchiveChartsDir, "gateways/istio-ingress/values.yaml"),
+		path.Join(model.ArchiveChartsDir, "istio-cni/values.yaml"),
+		path.Join(model.ArchiveChartsDir, "istio-control/istio-discovery/values.yaml"),
+	}
+	topLevel := []string{path.Join(model.ArchiveChartsDir, "ztunnel/values.yaml")}
+	for _, arch := range r.manifest.GetArchiveArchitectures() {
+		archive, err := extractArchive(r, arch)
+		if err != nil {
+			return err
+		}
+		for _, file := range manifestValues {
+			err := validateHubTagFromFile(r, archive, file, "_internal_defaults_do_not_set.global")
+			if err != nil {
+				return fmt.Errorf("%v %v: %w", arch, file, err)
+			}
+		}
+		for _, file := range topLevel {
+			err := validateHubTagFromFile(r, archive, file, "_internal_defaults_do_not_set")
+			if err != nil {
+				return fmt.Errorf("%v %v: %w", arch, file, err)
+			}
+		}
+	}
+	return nil
+}
+
+// archiveManifestPaths are the chart directories and profiles every release archive must contain
+var archiveManifestPaths = []string{
+	path.Join(model.ArchiveChartsDir, "base"),
+	path.Join(model.ArchiveChartsDir, "gateways"),
+	path.Join(model.ArchiveChartsDir, "istio-cni"),
+	path.Join(model.ArchiveChartsDir, "istio-control"),
+	path.Join(model.ArchiveChartsDir, "ztunnel"),
+	model.ArchiveDefaultProfile,
+}
+
+// TestArchiveCharts checks the archive of every architecture contains all the charts and the default profile, so a
+// chart dropped while copying the manifests into the archive is caught.
+func TestArchiveCharts(r ReleaseInfo) error {
+	for _, arch := range r.manifest.GetArchiveArchitectures() {
+		archive, err := extractArchive(r, arch)
+		if err != nil {
+			return err
+		}
+		missing := []string{}
+		for _, p := range archiveManifestPaths {
+			if !util.FileExists(filepath.Join(archive, p)) {
+				missing = append(missing, p)
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("%v: archive is missing %v: %w", arch, strings.Join(missing, ", "),
+				&ErrMissingArtifact{Path: filepath.Join(archive, missing[0])})
+		}
+	}
+	return nil
+}
+
+// extractArchive unpacks the release archive for an architecture, returning the istio directory within it.
+// Archives are only unpacked again if they changed; the model.ValidatedArchiveArchitecture archive is already unpacked
+// by NewReleaseInfo.
+func extractArchive(r ReleaseInfo, arch string) (string, error) {
+	if arch == model.ValidatedArchiveArchitecture {
+		return r.archive, nil
+	}
+	dir := filepath.Join(r.tmpDir, "archives", arch)
+	archive := filepath.Join(dir, "istio-"+r.manifest.Version)
+	src := releaseArchive(r.release, r.manifest.Version, arch)
+	if !util.FileExists(src) {
+		return "", &ErrMissingArtifact{Path: src}
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", err
+	}
+	err := extractUnlessUnchanged(src, dir, archive, nil, func() error {
+		if strings.HasSuffix(src, ".zip") {
+			return util.Unzip(src, dir)
+		}
+		cmd := util.VerboseCommand("tar", "xf", src, "-C", dir)
+		if err := util.RunSummarized(cmd); err != nil {
+			return commandFailed(cmd, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return archive, nil
+}
+
+func validateHubTagFromFile(r ReleaseInfo, archive string, file string, paths string) error {
+	values, err := os.ReadFile(filepath.Join(archive, file))
+	if err != nil {
+		return missingArtifact(filepath.Join(archive, file), err)
+	}
+	return validateHubTag(r, values, paths)
+}
+
+func validateHubTag(r ReleaseInfo, valuesBytes []byte, paths string) error {
+	values, err := getValues(valuesBytes)
+	if err != nil {
+		return err
+	}
+	tagPath := append(strings.Split(paths, "."), "tag")
+	if paths == "" {
+		tagPath = []string{"tag"}
+	}
+	tag, err := GenericMap{values}.Path(tagPath)
+	if err != nil {
+		return fmt.Errorf("invalid path: %v", err)
+	}
+	if tag != r.expectedTag() {
+		return &ErrVersionMismatch{Expected: r.expectedTag(), Got: fmt.Sprint(tag), Where: "tag"}
+	}
+	hubPath := append(strings.Split(paths, "."), "hub")
+	if paths == "" {
+		hubPath = []string{"hub"}
+	}
+	hub, err := GenericMap{values}.Path(hubPath)
+	if err != nil {
+		return fmt.Errorf("invalid path: %v", err)
+	}
+	if hub != r.expectedHub() {
+		return &ErrVersionMismatch{Expected: r.expectedHub(), Got: fmt.Sprint(hub), Where: "hub"}
+	}
+	return nil
+}
+
+func TestIstioctlProfiles(r ReleaseInfo) error {
+	operatorChecks := []string{
+		model.ArchiveDefaultProfile,
+	}
+	for _, f := range operatorChecks {
+		by, err := os.ReadFile(filepath.Join(r.archive, f))
+		if err != nil {
+			return missingArtifact(filepath.Join(r.archive, f), err)
+		}
+		values, err := getValues(by)
+		if err != nil {
+			return err
+		}
+		tag, err := GenericMap{values}.Path([]string{"spec", "tag"})
+		if err != nil {
+			return fmt.Errorf("invalid path: %v", err)
+		}
+		if tag != r.expectedTag() {
+			return &ErrVersionMismatch{Expected: r.expectedTag(), Got: fmt.Sprint(tag), Where: f + " tag"}
+		}
+		hub, err := GenericMap{values}.Path([]string{"spec", "hub"})
+		if err != nil {
+			return fmt.Errorf("invalid path: %v", err)
+		}
+		if hub != r.expectedHub() {
+			return &ErrVersionMismatch{Expected: r.expectedHub(), Got: fmt.Sprint(hub), Where: f + " hub"}
+		}
+	}
+	return nil
+}
+
+// TestProfileComponents checks the default profile enables exactly the components the manifest intends to ship, such
+// as pilot, and no others it lists, such as ztunnel if ambient is disabled. Every mismatched component is reported.
+func TestProfileComponents(r ReleaseInfo) error {
+	f := filepath.Join(r.archive, model.ArchiveDefaultProfile)
+	by, err := os.ReadFile(f)
+	if err != nil {
+		return missingArtifact(f, err)
+	}
+	values, err := getValues(by)
+	if err != nil {
+		return err
+	}
+	expected := expectedProfileComponents(r.manifest)
+	names := make([]string, 0, len(expected))
+	for name := range expected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	mismatched := []string{}
+	for _, name := range names {
+		if enabled := componentEnabled(values, name); enabled != expected[name] {
+			mismatched = append(mismatched, fmt.Sprintf("%v (enabled: %v, expected %v)", name, enabled, expected[name]))
+		}
+	}
+	if len(mismatched) > 0 {
+		return fmt.Errorf("default profile components do not match the manifest: %v", strings.Join(mismatched, ", "))
+	}
+	return nil
+}
+
+// expectedProfileComponents returns whether the default profile must enable each component. Ambient components are
+// never expected if ambient is disabled.
+func expectedProfileComponents(manifest model.Manifest) map[string]bool {
+	components := manifest.ProfileComponents
+	if components == nil {
+		components = model.DefaultProfileComponents
+	}
+	expected := maps.Clone(components)
+	if manifest.SkipAmbient {
+		expected["ztunnel"] = false
+	}
+	return expected
+}
+
+// componentEnabled returns if spec.components.<name>.enabled is set in a profile. Unset components are disabled.
+func componentEnabled(values map[string]interface{}, name string) bool {
+	spec, _ := values["spec"].(map[string]interface{})
+	components, _ := spec["components"].(map[string]interface{})
+	switch c := components[name].(type) {
+	case map[string]interface{}:
+		enabled, _ := GenericMap{c}.Path([]string{"enabled"})
+		return enabled == true
+	case []interface{}:
+		// A list of components, such as ingressGateways, is enabled if any of its entries is
+		for i := range c {
+			if enabled, _ := (GenericMap{components}).Path([]string{name, strconv.Itoa(i), "enabled"}); enabled == true {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// componentCharts are the charts, relative to the manifests directory of the archive, istioctl may install each
+// component of a profile from. Components whose chart moved between versions, such as istiodRemote, list every
+// location; any of them satisfies the component.
+var componentCharts = map[string][]string{
+	"base":            {"charts/base"},
+	"pilot":           {"charts/istio-control/istio-discovery"},
+	"istiodRemote":    {"charts/istiod-remote", "charts/istio-control/istio-discovery"},
+	"cni":             {"charts/istio-cni"},
+	"ztunnel":         {"charts/ztunnel"},
+	"ingressGateways": {"charts/gateways/istio-ingress"},
+	"egressGateways":  {"charts/gateways/istio-egress"},
+}
+
+// enabledComponents returns the components a profile enables under spec.components, sorted
+func enabledComponents(values map[string]interface{}) []string {
+	spec, _ := values["spec"].(map[string]interface{})
+	components, _ := spec["components"].(map[string]interface{})
+	names := []string{}
+	for name := range components {
+		if componentEnabled(values, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TestProfileCharts checks the chart of every component each profile in the archive enables is shipped in the
+// archive, as istioctl install fails at runtime on a profile referencing a missing chart. The components are read from
+// the profiles, so a component added upstream without a known chart fails the check rather than going unchecked.
+// Every missing chart is reported.
+func TestProfileCharts(r ReleaseInfo) error {
+	profiles, err := filepath.Glob(filepath.Join(r.archive, model.ArchiveProfilesDir, "*.yaml"))
+	if err != nil {
+		return err
+	}
+	if len(profiles) == 0 {
+		return &ErrMissingArtifact{Path: filepath.Join(r.archive, model.ArchiveProfilesDir)}
+	}
+	missing := []string{}
+	for _, profile := range profiles {
+		by, err := os.ReadFile(profile)
+		if err != nil {
+			return err
+		}
+		values, err := getValues(by)
+		if err != nil {
+			return fmt.Errorf("%v: %v", filepath.Base(profile), err)
+		}
+		for _, name := range enabledComponents(values) {
+			charts, f := componentCharts[name]
+			if !f {
+				missing = append(missing, fmt.Sprintf("%v component %v has no known chart", filepath.Base(profile), name))
+				continue
+			}
+			found := false
+			for _, chart := range charts {
+				if util.FileExists(filepath.Join(r.archive, model.ArchiveManifestsDir, chart, "Chart.yaml")) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				missing = append(missing, fmt.Sprintf("%v component %v references %v", filepath.Base(profile), name,
+					filepath.Join(model.ArchiveManifestsDir, charts[0])))
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("profiles reference charts missing from the archive: %v", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// forbiddenSetting is a profile setting that must not have a value matching Pattern
+type forbiddenSetting struct {
+	// Path is the dot separated path of the setting in the profile
+	Path    string
+	Pattern *regexp.Regexp
+}
+
+// forbiddenProfileSettings are development and debugging settings, which must not leak into the default profile
+var forbiddenProfileSettings = []forbiddenSetting{
+	{"spec.values.global.logging.level", regexp.MustCompile(`debug`)},
+	{"spec.values.global.proxy.logLevel", regexp.MustCompile(`^(debug|trace)$`)},
+	{"spec.values.global.proxy.componentLogLevel", regexp.MustCompile(`debug|trace`)},
+	{"spec.values.global.variant", regexp.MustCompile(`^debug$`)},
+	{"spec.values.pilot.traceSampling", regexp.MustCompile(`^100(\.0*)?$`)},
+}
+
+// TestProfileSettings checks the default profile does not enable any forbiddenProfileSettings
+func TestProfileSettings(r ReleaseInfo) error {
+	file := filepath.Join(r.archive, model.ArchiveDefaultProfile)
+	by, err := os.ReadFile(file)
+	if err != nil {
+		return missingArtifact(file, err)
+	}
+	values, err := getValues(by)
+	if err != nil {
+		return err
+	}
+	var bad []string
+	for _, setting := range forbiddenProfileSettings {
+		v, f := lookupValue(values, strings.Split(setting.Path, "."))
+		if f && setting.Pattern.MatchString(fmt.Sprint(v)) {
+			bad = append(bad, fmt.Sprintf("%v=%v", setting.Path, v))
+		}
+	}
+	if len(bad) > 0 {
+		return fmt.Errorf("default profile has development settings: %v", strings.Join(bad, ", "))
+	}
+	return nil
+}
+
+// lookupValue returns the value of any type at a path of nested maps
+func lookupValue(values map[string]interface{}, path []string) (interface{}, bool) {
+	var current interface{} = values
+	for _, p := range path {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[p]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func TestManifest(r ReleaseInfo) error {
+	for _, repo := range []string{"api", "client-go", "istio", "proxy"} {
+		d, f := r.manifest.Dependencies.Get()[repo]
+		if d == nil {
+			return fmt.Errorf("missing dependency: %v", repo)
+		}
+		if !f || d.Sha == "" {
+			return fmt.Errorf("got empty SHA for %v", repo)
+		}
+	}
+	// All dependencies in a release must be pinned to an exact commit
+	for repo, d := range r.manifest.Dependencies.Get() {
+		if d != nil && d.Sha == "" {
+			return fmt.Errorf("dependency %v is not pinned to a SHA", repo)
+		}
+	}
+	if r.manifest.Directory != "" {
+		return fmt.Errorf("expected manifest directory to be hidden, got %v", r.manifest.Directory)
+	}
+	for repo, d := range r.manifest.Dependencies.Get() {
+		if d != nil && d.LocalPath != "" {
+			return fmt.Errorf("expected local path of dependency %v to be hidden, got %v", repo, d.LocalPath)
+		}
+	}
+	return nil
+}
+
+func TestGrafana(r ReleaseInfo) error {
+	created := map[string]struct{}{}
+	dir, err := os.ReadDir(r.artifactDir(model.GrafanaArtifacts))
+	if err != nil {
+		return missingArtifact(r.artifactDir(model.GrafanaArtifacts), err)
+	}
+	for _, db := range dir {
+		created[strings.TrimSuffix(db.Name(), ".json")] = struct{}{}
+	}
+	manifest := map[string]struct{}{}
+	for dashboard := range r.manifest.GrafanaDashboards {
+		manifest[dashboard] = struct{}{}
+	}
+	if !reflect.DeepEqual(created, manifest) {
+		return fmt.Errorf("dashboards out of sync, release contains %+v, manifest contains %+v", created, manifest)
+	}
+	return nil
+}
+
+func TestLicenses(r ReleaseInfo) error {
+	l, err := os.ReadDir(r.artifactDir(model.LicenseArtifacts))
+	if err != nil {
+		return missingArtifact(r.artifactDir(model.LicenseArtifacts), err)
+	}
+	repos := r.manifest.LicenseRepos
+	if len(repos) == 0 {
+		// Releases built before the license repos were recorded in the manifest
+		repos = model.DefaultLicenseRepos
+	}
+	// Expect to find license folders for these repos
+	expect := map[string]struct{}{}
+	for _, repo := range repos {
+		expect[repo+".tar.gz"] = struct{}{}
+	}
+
+	for _, repo := range l {
+		delete(expect, repo.Name())
+	}
+
+	if len(expect) > 0 {
+		missing := make([]string, 0, len(expect))
+		for f := range expect {
+			missing = append(missing, f)
+		}
+		sort.Strings(missing)
+		return &ErrMissingArtifact{Path: filepath.Join(r.artifactDir(model.LicenseArtifacts), "{"+strings.Join(missing, ",")+"}")}
+	}
+	return nil
+}
+
+// TestCompletionFiles checks the istioctl completion files are present, non-empty, and parse as shell scripts.
+// Each completion is only parsed if its shell is installed. Powershell has no syntax-only mode, so is never parsed.
+func TestCompletionFiles(r ReleaseInfo) error {
+	shells := map[string]string{
+		"istioctl.bash": "bash",
+		"_istioctl":     "zsh",
+	}
+	if r.manifest.AdditionalCompletions {
+		shells["istioctl.fish"] = "fish"
+		shells["istioctl.ps1"] = ""
+	}
+	for file, shell := range shells {
+		path := filepath.Join(r.archive, "tools", file)
+		info, err := os.Stat(path)
+		if err != nil {
+			return missingArtifact(path, err)
+		}
+		if info.Size() == 0 {
+			return fmt.Errorf("completion file %v is empty", path)
+		}
+		if shell == "" {
+			continue
+		}
+		if _, err := exec.LookPath(shell); err != nil {
+			log.Warnf("Skipping syntax check of %v; %v is not installed", file, shell)
+			continue
+		}
+		buf := &bytes.Buffer{}
+		cmd := util.VerboseCommand(shell, "-n", path)
+		cmd.Stderr = buf
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("completion file %v is not valid %v: %w", file, shell,
+				commandFailed(cmd, fmt.Errorf("%v: %v", err, strings.TrimSpace(buf.String()))))
+		}
+	}
+	return nil
+}
+
+// DefaultLineEndingFiles are the files in the release archive that must have LF line endings, as CRLF breaks sourcing
+// them on linux. A "**/" segment matches any number of directories.
+var DefaultLineEndingFiles = []string{"tools/istioctl.bash", "tools/_istioctl", "samples/**/*.sh"}
+
+// TestLineEndings checks the shell scripts and completion files in the release archive do not have CRLF line endings
+func TestLineEndings(r ReleaseInfo) error {
+	patterns := r.lineEndingFiles
+	if len(patterns) == 0 {
+		patterns = DefaultLineEndingFiles
+	}
+	var crlf []string
+	err := filepath.WalkDir(r.archive, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(r.archive, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !slices.ContainsFunc(patterns, func(pattern string) bool { return matchFilePattern(pattern, rel) }) {
+			return nil
+		}
+		by, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if bytes.Contains(by, []byte("\r\n")) {
+			crlf = append(crlf, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return missingArtifact(r.archive, err)
+	}
+	if len(crlf) > 0 {
+		return fmt.Errorf("found files with CRLF line endings: %v", strings.Join(crlf, ", "))
+	}
+	return nil
+}
+
+// DefaultSamplesDir is the directory of the samples in the release archive
+const DefaultSamplesDir = "samples"
+
+// yamlDocumentSeparator matches the lines separating the documents of a multi-document YAML file
+var yamlDocumentSeparator = regexp.MustCompile(`(?m)^---(?:[ \t].*)?$`)
+
+// TestSamplesYaml checks every YAML file in the samples of the release archive parses. The samples are copied into
+// the archive without being read, so this catches corrupted samples and template leftovers.
+func TestSamplesYaml(r ReleaseInfo) error {
+	samples := r.samplesDir
+	if samples == "" {
+		samples = DefaultSamplesDir
+	}
+	dir := filepath.Join(r.archive, samples)
+	var invalid []string
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || (filepath.Ext(p) != ".yaml" && filepath.Ext(p) != ".yml") {
+			return nil
+		}
+		by, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(r.archive, p)
+		if err != nil {
+			return err
+		}
+		for i, doc := range yamlDocumentSeparator.Split(string(by), -1) {
+			var out interface{}
+			if err := yaml.Unmarshal([]byte(doc), &out); err != nil {
+				invalid = append(invalid, fmt.Sprintf("%v document %d: %v", filepath.ToSlash(rel), i+1, err))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return missingArtifact(dir, err)
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("found invalid sample YAML: %v", strings.Join(invalid, "; "))
+	}
+	return nil
+}
+
+// TestGzipLevel checks the .tar.gz archives compressed by the builder, in the release root and the license directory,
+// were compressed at the gzip level of the manifest. Each archive is decompressed and compressed again at that level,
+// and must come out the same size, so archives compressed by a different gzip, or at a different level, are flagged.
+func TestGzipLevel(r ReleaseInfo) error {
+	if r.manifest.GzipLevel == 0 {
+		// Releases built before the gzip level was recorded were compressed by the host gzip
+		return nil
+	}
+	var archives []string
+	for _, dir := range []string{r.release, r.artifactDir(model.LicenseArtifacts)} {
+		matches, err := filepath.Glob(filepath.Join(dir, "*.tar.gz"))
+		if err != nil {
+			return err
+		}
+		archives = append(archives, matches...)
+	}
+	if len(archives) == 0 {
+		return &ErrMissingArtifact{Path: filepath.Join(r.release, "*.tar.gz")}
+	}
+	var drifted []string
+	for _, archive := range archives {
+		got, expected, err := recompressedSize(archive, r.manifest.GzipLevel)
+		if err != nil {
+			return fmt.Errorf("%v: %v", archive, err)
+		}
+		if got != expected {
+			rel, _ := filepath.Rel(r.release, archive)
+			drifted = append(drifted, fmt.Sprintf("%v is %d bytes, expected %d", rel, got, expected))
+		}
+	}
+	if len(drifted) > 0 {
+		return fmt.Errorf("archives were not compressed at gzip level %d: %v", r.manifest.GzipLevel, strings.Join(drifted, "; "))
+	}
+	return nil
+}
+
+// recompressedSize returns the size of a gzip file, and its size when its content is compressed again at level
+func recompressedSize(file string, level int) (int64, int64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	in, err := gzip.NewReader(f)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer in.Close()
+	counter := &countingWriter{}
+	out, err := gzip.NewWriterLevel(counter, level)
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		return 0, 0, err
+	}
+	if err := out.Close(); err != nil {
+		return 0, 0, err
+	}
+	return info.Size(), counter.n, nil
+}
+
+// countingWriter discards what is written to it, counting the bytes
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// noticeDependencies are major dependencies of istio that THIRD_PARTY_NOTICES.txt must list. Their absence means the
+// notices were generated from an incomplete SBOM.
+var noticeDependencies = []string{"google.golang.org/grpc", "k8s.io/client-go", "github.com/envoyproxy/go-control-plane"}
+
+// TestThirdPartyNotices checks the release archive has third party notices listing the major dependencies, if the
+// manifest enabled them
+func TestThirdPartyNotices(r ReleaseInfo) error {
+	if !r.manifest.ThirdPartyNotices {
+		return nil
+	}
+	file := filepath.Join(r.archive, "THIRD_PARTY_NOTICES.txt")
+	by, err := os.ReadFile(file)
+	if err != nil {
+		return missingArtifact(file, err)
+	}
+	var missing []string
+	for _, dep := range noticeDependencies {
+		if !bytes.Contains(by, []byte(dep+" ")) {
+			missing = append(missing, dep)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("THIRD_PARTY_NOTICES.txt does not list %v", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// matchFilePattern reports whether a slash separated path matches the pattern. A "**/" segment in the pattern matches
+// any number of directories, and otherwise the pattern is matched with path.Match.
+func matchFilePattern(pattern, name string) bool {
+	prefix, rest, f := strings.Cut(pattern, "**/")
+	if !f {
+		m, _ := path.Match(pattern, name)
+		return m
+	}
+	if !strings.HasPrefix(name, prefix) {
+		return false
+	}
+	name = strings.TrimPrefix(name, prefix)
+	for {
+		if m, _ := path.Match(rest, name); m {
+			return true
+		}
+		_, next, f := strings.Cut(name, "/")
+		if !f {
+			return false
+		}
+		name = next
+	}
+}
+
+func TestDebian(info ReleaseInfo) error {
+	return checkSidecarPackages(info, model.DebianArtifacts, "deb")
+}
+
+func TestRpm(info ReleaseInfo) error {
+	return checkSidecarPackages(info, model.RpmArtifacts, "rpm")
+}
+
+// checkSidecarPackages ensures the release has a sidecar package of a format for every architecture, and that each
+// package declares its architecture. The versions of the packages are checked by TestVersionConsistency.
+func checkSidecarPackages(info ReleaseInfo, kind model.ArtifactCategory, format string) error {
+	for _, plat := range info.manifest.Architectures {
+		name, err := util.SidecarPackageName(plat, format)
+		if err != nil {
+			return err
+		}
+		pkg := filepath.Join(info.artifactDir(kind), name)
+		if !fileExists(pkg) {
+			return &ErrMissingArtifact{Path: pkg}
+		}
+		want, err := util.PackageArch(plat, format)
+		if err != nil {
+			return err
+		}
+		got, err := packageArch(kind, pkg)
+		if err != nil {
+			return err
+		}
+		if got != "" && got != want {
+			return fmt.Errorf("%v has architecture %v, expected %v", name, got, want)
+		}
+	}
+	return nil
+}
+
+// packageInstall is a distro a package of the release is installed in by TestPackageInstall
+type packageInstall struct {
+	Distro string
+	// Image is the container image of the distro
+	Image string
+	// Category locates the packages in the release
+	Category model.ArtifactCategory
+	// Format is the package format, deb or rpm
+	Format string
+	// Install is the shell command installing the package, mounted at /release. %s is the file name of the package.
+	Install string
+}
+
+// packageInstalls are the distros the deb and rpm packages are installed in
+var packageInstalls = []packageInstall{
+	{
+		Distro:   "debian",
+		Image:    "debian:bookworm-slim",
+		Category: model.DebianArtifacts,
+		Format:   "deb",
+		Install:  "apt-get update -qq && DEBIAN_FRONTEND=noninteractive apt-get install -y -qq /release/%s",
+	},
+	{
+		Distro:   "rhel",
+		Image:    "registry.access.redhat.com/ubi9/ubi",
+		Category: model.RpmArtifacts,
+		Format:   "rpm",
+		Install:  "dnf install -y -q /release/%s",
+	},
+}
+
+// sidecarFiles are the files the sidecar packages must install
+var sidecarFiles = []string{
+	"/usr/local/bin/envoy",
+	"/usr/local/bin/pilot-agent",
+	"/usr/local/bin/istio-start.sh",
+	"/lib/systemd/system/istio.service",
+}
+
+// runPackageInstall runs a script in a container of image for a docker platform, such as linux/arm64, with dir mounted
+// at /release, returning its output
+var runPackageInstall = func(platform, image, dir, script string) (string, error) {
+	buf := &bytes.Buffer{}
+	cmd := util.VerboseCommand("docker", "run", "--rm", "--platform", platform, "-v", dir+":/release:ro", image, "sh", "-c", script)
+	cmd.Stdout = buf
+	cmd.Stderr = buf
+	err := withDocker(cmd.Run)
+	return buf.String(), err
+}
+
+// TestPackageInstall installs the deb package of each architecture in a debian container of that platform, and the rpm
+// package in a rhel container, checking each installs without error and installs the sidecar files. This catches packaging metadata errors, such as missing
+// dependencies, that TestDebian and TestRpm miss. It needs docker, so only runs if package installs are enabled.
+func TestPackageInstall(r ReleaseInfo) error {
+	if !r.installPackages {
+		log.Infof("Skipping TestPackageInstall; package installs are not enabled")
+		return nil
+	}
+	checks := make([]string, 0, len(sidecarFiles))
+	for _, f := range sidecarFiles {
+		checks = append(checks, fmt.Sprintf("test -e %[1]s || { echo missing %[1]s; exit 1; }", f))
+	}
+	for _, plat := range r.manifest.Architectures {
+		for _, p := range packageInstalls {
+			name, err := util.SidecarPackageName(plat, p.Format)
+			if err != nil {
+				return err
+			}
+			dir := r.artifactDir(p.Category)
+			if pkg := filepath.Join(dir, name); !fileExists(pkg) {
+				return &ErrMissingArtifact{Path: pkg}
+			}
+			abs, err := filepath.Abs(dir)
+			if err != nil {
+				return err
+			}
+			script := strings.Join(append([]string{"set -e", fmt.Sprintf(p.Install, name)}, checks...), "\n")
+			if out, err := runPackageInstall(plat, p.Image, abs, script); err != nil {
+				return fmt.Errorf("%v failed to install in %v (%v, %v): %v: %v", name, p.Distro, p.Image, plat, err, strings.TrimSpace(out))
+			}
+		}
+	}
+	return nil
+}
+
+func TestReleaseNotes(r ReleaseInfo) error {
+	if !r.manifest.HasBuildStep(model.StepMetadata) {
+		log.Infof("Skipping TestReleaseNotes; the release was built without the metadata step")
+		return nil
+	}
+	notes, err := os.ReadFile(filepath.Join(r.release, "release-notes.md"))
+	if err != nil {
+		return missingArtifact(filepath.Join(r.release, "release-notes.md"), err)
+	}
+	if !strings.Contains(string(notes), r.manifest.Version) {
+		return fmt.Errorf("release notes do not reference version %v", r.manifest.Version)
+	}
+	return nil
+}
+
+// TestDownloadScript checks the istioctl download script is present, non-empty and executable, is pinned to the release
+// version, and parses as a shell script
+func TestDownloadScript(r ReleaseInfo) error {
+	if !r.manifest.HasBuildStep(model.StepMetadata) {
+		log.Infof("Skipping TestDownloadScript; the release was built without the metadata step")
+		return nil
+	}
+	path := filepath.Join(r.release, model.DownloadScriptFile)
+	info, err := os.Stat(path)
+	if err != nil {
+		return missingArtifact(path, err)
+	}
+	if info.Size() == 0 {
+		return fmt.Errorf("%v is empty", model.DownloadScriptFile)
+	}
+	if info.Mode()&0o111 == 0 {
+		return fmt.Errorf("%v is not executable", model.DownloadScriptFile)
+	}
+	script, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(string(script), fmt.Sprintf("VERSION=%q", r.manifest.Version)) {
+		return fmt.Errorf("%v does not download version %v", model.DownloadScriptFile, r.manifest.Version)
+	}
+	buf := &bytes.Buffer{}
+	cmd := util.VerboseCommand("sh", "-n", path)
+	cmd.Stderr = buf
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%v is not a valid shell script: %w", model.DownloadScriptFile,
+			commandFailed(cmd, fmt.Errorf("%v: %v", err, strings.TrimSpace(buf.String()))))
+	}
+	return nil
+}
+
+// TestBuildInfo checks the build-info.json in the archive, if the manifest requested one, matches the manifest
+func TestBuildInfo(r ReleaseInfo) error {
+	if !r.manifest.EmbedBuildInfo {
+		return nil
+	}
+	by, err := os.ReadFile(filepath.Join(r.archive, "build-info.json"))
+	if err != nil {
+		return missingArtifact(filepath.Join(r.archive, "build-info.json"), err)
+	}
+	var info model.BuildInfo
+	if err := json.Unmarshal(by, &info); err != nil {
+		return fmt.Errorf("failed to unmarshal build info: %v", err)
+	}
+	if info.Timestamp != "" {
+		if r.manifest.SkipBuildTimestamp {
+			return fmt.Errorf("build info has timestamp %v, but skipBuildTimestamp is set", info.Timestamp)
+		}
+		if _, err := time.Parse(time.RFC3339, info.Timestamp); err != nil {
+			return fmt.Errorf("invalid build timestamp: %v", err)
+		}
+	}
+	var errs []string
+	for repo, dep := range r.manifest.Dependencies.Get() {
+		if dep == nil {
+			continue
+		}
+		if got := info.Dependencies[repo]; got != dep.Sha {
+			errs = append(errs, fmt.Sprintf("%v: expected %v, got %v", repo, dep.Sha, got))
+		}
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return fmt.Errorf("build info dependencies do not match manifest: %v", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// TestReleaseIndex checks release-index.json lists exactly the files in the release, with the correct sizes and digests
+func TestReleaseIndex(r ReleaseInfo) error {
+	if !r.manifest.HasBuildStep(model.StepIndex) {
+		log.Infof("Skipping TestReleaseIndex; the release was built without the index step")
+		return nil
+	}
+	file := filepath.Join(r.release, "release-index.json")
+	by, err := os.ReadFile(file)
+	if err != nil {
+		return missingArtifact(file, err)
+	}
+	var index model.ReleaseIndex
+	if err := json.Unmarshal(by, &index); err != nil {
+		return fmt.Errorf("failed to unmarshal release index: %v", err)
+	}
+	if index.SchemaVersion != model.ReleaseIndexSchemaVersion {
+		return fmt.Errorf("unsupported release index schema version %v", index.SchemaVersion)
+	}
+	if index.Manifest.Version != r.manifest.Version {
+		return &ErrVersionMismatch{Expected: r.manifest.Version, Got: index.Manifest.Version, Where: "release index version"}
+	}
+	actual, err := util.ListArtifacts(r.release, "release-index.json")
+	if err != nil {
+		return fmt.Errorf("failed to list release artifacts: %v", err)
+	}
+	indexed := map[string]model.ReleaseArtifact{}
+	for _, a := range index.Artifacts {
+		indexed[a.Name] = a
+	}
+	var problems []string
+	for _, a := range actual {
+		want, f := indexed[a.Name]
+		if !f {
+			problems = append(problems, fmt.Sprintf("%v is not in the index", a.Name))
+			continue
+		}
+		delete(indexed, a.Name)
+		if want != a {
+			problems = append(problems, fmt.Sprintf("%v has size %v and sha256 %v, index has size %v and sha256 %v",
+				a.Name, a.Size, a.Sha256, want.Size, want.Sha256))
+		}
+	}
+	for name := range indexed {
+		problems = append(problems, fmt.Sprintf("%v is in the index, but not the release", name))
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("release index does not match release: %v", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// TestFilePermissions checks no file in any release archive is world-writable, setuid, or setgid.
+// Modes are read from the archive headers, as extracting the archive would apply the umask and hide them.
+func TestFilePermissions(r ReleaseInfo) error {
+	var bad []string
+	for _, arch := range r.manifest.GetArchiveArchitectures() {
+		src := releaseArchive(r.release, r.manifest.Version, arch)
+		modes, err := archiveModes(src)
+		if err != nil {
+			return missingArtifact(src, err)
+		}
+		for name, mode := range modes {
+			// Symlink permissions are not used, and are always 0777
+			if mode&os.ModeSymlink != 0 {
+				continue
+			}
+			if mode&0o002 != 0 || mode&(os.ModeSetuid|os.ModeSetgid) != 0 {
+				bad = append(bad, fmt.Sprintf("%v/%v (%v)", arch, name, mode))
+			}
+		}
+	}
+	if len(bad) > 0 {
+		sort.Strings(bad)
+		return fmt.Errorf("found files with unsafe permissions: %v", strings.Join(bad, ", "))
+	}
+	return nil
+}
+
+// emptyArtifactAllowlist are patterns, matched against the file name, of release files that may be empty
+var emptyArtifactAllowlist = []string{".gitkeep"}
+
+// TestNonEmptyArtifacts checks no file in the release is empty. A failed step, such as a truncated archive or failed
+// helm package, can leave an empty file that still passes checks for the file existing.
+func TestNonEmptyArtifacts(r ReleaseInfo) error {
+	var empty []string
+	err := filepath.WalkDir(r.release, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		for _, pattern := range emptyArtifactAllowlist {
+			if m, _ := filepath.Match(pattern, d.Name()); m {
+				return nil
+			}
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() == 0 {
+			rel, err := filepath.Rel(r.release, p)
+			if err != nil {
+				return err
+			}
+			empty = append(empty, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return missingArtifact(r.release, err)
+	}
+	if len(empty) > 0 {
+		return fmt.Errorf("found empty files: %v", strings.Join(empty, ", "))
+	}
+	return nil
+}
+
+// TestArchiveSafety checks every entry of every archive in the release is a relative path, so extracting an archive
+// can never write outside of the directory it is extracted to. Entries of the istio and istio-tools archives must also
+// be confined to the istio-<version> directory. Archives are read without being extracted.
+func TestArchiveSafety(r ReleaseInfo) error {
+	var archives []string
+	for _, ext := range []string{"tar.gz", "tar", "zip"} {
+		m, err := filepath.Glob(filepath.Join(r.release, "*."+ext))
+		if err != nil {
+			return err
+		}
+		archives = append(archives, m...)
+	}
+	if len(archives) == 0 {
+		return &ErrMissingArtifact{Path: filepath.Join(r.release, fmt.Sprintf("istio-%s-*", r.manifest.Version))}
+	}
+	var bad []string
+	for _, archive := range archives {
+		prefix := archiveEntryPrefix(filepath.Base(archive), r.manifest.Version)
+		entries, err := archiveModes(archive)
+		if err != nil {
+			return fmt.Errorf("failed to read %v: %v", archive, err)
+		}
+		for name := range entries {
+			if !safeArchiveEntry(name, prefix) {
+				bad = append(bad, fmt.Sprintf("%v: %q", filepath.Base(archive), name))
+			}
+		}
+	}
+	if len(bad) > 0 {
+		sort.Strings(bad)
+		return fmt.Errorf("found unsafe archive entries: %v", strings.Join(bad, ", "))
+	}
+	return nil
+}
+
+// archiveEntryPrefix returns the directory every entry of an archive in the release must be in: istio-<version>/ for
+// the istio and istio-tools archives, and otherwise none, such as for the istioctl archives
+func archiveEntryPrefix(archive, version string) string {
+	for _, name := range []string{"istio", "istio-tools"} {
+		if strings.HasPrefix(archive, fmt.Sprintf("%s-%s-", name, version)) {
+			return "istio-" + version + "/"
+		}
+	}
+	return ""
+}
+
+// safeArchiveEntry checks an archive entry name is relative and stays within prefix once cleaned
+func safeArchiveEntry(name, prefix string) bool {
+	if strings.Contains(name, "\\") || path.IsAbs(name) {
+		return false
+	}
+	for _, elem := range strings.Split(name, "/") {
+		if elem == ".." {
+			return false
+		}
+	}
+	return strings.HasPrefix(path.Clean(name)+"/", prefix)
+}
+
+// TestUncompressedArchives checks each .tar.gz archive has an uncompressed .tar with valid checksums, if the manifest
+// requested them
+func TestUncompressedArchives(r ReleaseInfo) error {
+	if !r.manifest.UncompressedArchives {
+		return nil
+	}
+	for _, arch := range r.manifest.GetArchiveArchitectures() {
+		if strings.HasPrefix(arch, "win") {
+			continue
+		}
+		for _, name := range []string{"istio", "istioctl"} {
+			tar := filepath.Join(r.release, fmt.Sprintf("%s-%s-%s.tar", name, r.manifest.Version, arch))
+			if err := verifyChecksums(tar, requiredShaAlgorithms(r.manifest)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// releaseArchive returns the path of the release archive for an architecture. Windows archives are zip files; for
+// other architectures the .tar.gz is preferred, falling back to the uncompressed .tar if it is the only one present.
+func releaseArchive(release, version, arch string) string {
+	name := fmt.Sprintf("istio-%s-%s", version, arch)
+	if strings.HasPrefix(arch, "win") {
+		return filepath.Join(release, name+".zip")
+	}
+	return releaseTarball(release, name)
+}
+
+// releaseTarball returns the path of name.tar.gz in the release, or name.tar if only the uncompressed archive exists
+func releaseTarball(release, name string) string {
+	gz := filepath.Join(release, name+".tar.gz")
+	if tar := filepath.Join(release, name+".tar"); !util.FileExists(gz) && util.FileExists(tar) {
+		return tar
+	}
+	return gz
+}
+
+// archiveModes returns the mode of each entry in a .tar.gz, .tar, or .zip archive
+func archiveModes(src string) (map[string]os.FileMode, error) {
+	modes := map[string]os.FileMode{}
+	err := walkArchive(src, func(name string, mode os.FileMode, _ io.Reader) error {
+		modes[name] = mode
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return modes, nil
+}
+
+// archiveFileSha returns the sha256 of a file within a .tar.gz, .tar, or .zip archive
+func archiveFileSha(src, file string) (string, error) {
+	sum := ""
+	err := walkArchive(src, func(name string, _ os.FileMode, r io.Reader) error {
+		if name != file {
+			return nil
+		}
+		var err error
+		sum, err = util.ReaderSha256(r)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if sum == "" {
+		return "", &ErrMissingArtifact{Path: src + ":" + file}
+	}
+	return sum, nil
+}
+
+// walkArchive calls fn for each entry of a .tar.gz, .tar, or .zip archive, without extracting it
+func walkArchive(src string, fn func(name string, mode os.FileMode, r io.Reader) error) error {
+	if strings.HasSuffix(src, ".zip") {
+		z, err := zip.OpenReader(src)
+		if err != nil {
+			return err
+		}
+		defer z.Close()
+		for _, f := range z.File {
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			err = fn(f.Name, f.Mode(), rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var in io.Reader = f
+	if strings.HasSuffix(src, ".gz") || strings.HasSuffix(src, ".tgz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		in = gz
+	}
+	tr := tar.NewReader(in)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(hdr.Name, hdr.FileInfo().Mode(), tr); err != nil {
+			return err
+		}
+	}
+}
+
+// TestStandaloneIstioctlMatchesArchive checks the standalone istioctl of each architecture is the same binary as the
+// istioctl in the release archive
+func TestStandaloneIstioctlMatchesArchive(r ReleaseInfo) error {
+	for _, arch := range r.manifest.GetArchiveArchitectures() {
+		binary := "istioctl"
+		standalone := releaseTarball(r.release, fmt.Sprintf("istioctl-%s-%s", r.manifest.Version, arch))
+		if strings.HasPrefix(arch, "win") {
+			binary = "istioctl.exe"
+			standalone = filepath.Join(r.release, fmt.Sprintf("istioctl-%s-%s.zip", r.manifest.Version, arch))
+		}
+		archiveSha, err := archiveFileSha(releaseArchive(r.release, r.manifest.Version, arch),
+			fmt.Sprintf("istio-%s/bin/%s", r.manifest.Version, binary))
+		if err != nil {
+			return fmt.Errorf("%v: %w", arch, missingArtifact(releaseArchive(r.release, r.manifest.Version, arch), err))
+		}
+		standaloneSha, err := archiveFileSha(standalone, binary)
+		if err != nil {
+			return fmt.Errorf("%v: %w", arch, missingArtifact(standalone, err))
+		}
+		if archiveSha != standaloneSha {
+			return &ErrChecksumMismatch{Algorithm: "sha256", Expected: archiveSha, Got: standaloneSha, Where: arch + " standalone istioctl"}
+		}
+	}
+	return nil
+}
+
+// TestToolsArchive checks the tools archive of each architecture, if the manifest requested them, contains only the
+// model.ToolsArchiveDirs, and the same istioctl binary as the release archive
+func TestToolsArchive(r ReleaseInfo) error {
+	if !r.manifest.ToolsArchive {
+		return nil
+	}
+	prefix := "istio-" + r.manifest.Version + "/"
+	for _, arch := range r.manifest.GetArchiveArchitectures() {
+		binary := "istioctl"
+		tools := releaseTarball(r.release, fmt.Sprintf("istio-tools-%s-%s", r.manifest.Version, arch))
+		if strings.HasPrefix(arch, "win") {
+			binary = "istioctl.exe"
+			tools = filepath.Join(r.release, fmt.Sprintf("istio-tools-%s-%s.zip", r.manifest.Version, arch))
+		}
+		entries, err := archiveModes(tools)
+		if err != nil {
+			return missingArtifact(tools, err)
+		}
+		var unexpected []string
+		for name := range entries {
+			rel := strings.TrimPrefix(name, prefix)
+			if rel == "" {
+				continue
+			}
+			if dir, _, _ := strings.Cut(rel, "/"); !slices.Contains(model.ToolsArchiveDirs, dir) {
+				unexpected = append(unexpected, name)
+			}
+		}
+		if len(unexpected) > 0 {
+			sort.Strings(unexpected)
+			return fmt.Errorf("%v contains files outside of %v: %v", filepath.Base(tools),
+				strings.Join(model.ToolsArchiveDirs, ", "), strings.Join(unexpected, ", "))
+		}
+		archiveSha, err := archiveFileSha(releaseArchive(r.release, r.manifest.Version, arch), prefix+"bin/"+binary)
+		if err != nil {
+			return fmt.Errorf("%v: %w", arch, missingArtifact(releaseArchive(r.release, r.manifest.Version, arch), err))
+		}
+		toolsSha, err := archiveFileSha(tools, prefix+"bin/"+binary)
+		if err != nil {
+			return fmt.Errorf("%v: %w", arch, missingArtifact(tools, err))
+		}
+		if archiveSha != toolsSha {
+			return &ErrChecksumMismatch{Algorithm: "sha256", Expected: archiveSha, Got: toolsSha, Where: arch + " tools archive istioctl"}
+		}
 	}
 	return nil
 }
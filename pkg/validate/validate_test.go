@@ -0,0 +1,2475 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+	"github.com/alauda-mesh/release-builder/pkg/testutil"
+	"github.com/alauda-mesh/release-builder/pkg/util"
+)
+
+func TestLicensesRepos(t *testing.T) {
+	cases := []struct {
+		name         string
+		licenseRepos []string
+		files        []string
+		expectErr    bool
+	}{
+		{
+			"default set",
+			nil,
+			[]string{"istio", "client-go", "tools", "test-infra", "release-builder"},
+			false,
+		},
+		{
+			"default set missing",
+			nil,
+			[]string{"istio", "client-go"},
+			true,
+		},
+		{
+			"extended set",
+			[]string{"istio", "client-go", "tools", "test-infra", "release-builder", "proxy", "ztunnel"},
+			[]string{"istio", "client-go", "tools", "test-infra", "release-builder", "proxy", "ztunnel"},
+			false,
+		},
+		{
+			"extended set missing",
+			[]string{"istio", "client-go", "tools", "test-infra", "release-builder", "proxy", "ztunnel"},
+			[]string{"istio", "client-go", "tools", "test-infra", "release-builder"},
+			true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			release := t.TempDir()
+			if err := os.MkdirAll(filepath.Join(release, "licenses"), 0o750); err != nil {
+				t.Fatal(err)
+			}
+			for _, f := range tc.files {
+				if err := os.WriteFile(filepath.Join(release, "licenses", f+".tar.gz"), []byte("test"), 0o640); err != nil {
+					t.Fatal(err)
+				}
+			}
+			r := ReleaseInfo{
+				release:  release,
+				manifest: model.Manifest{LicenseRepos: tc.licenseRepos},
+			}
+			err := TestLicenses(r)
+			if tc.expectErr && err == nil {
+				t.Fatalf("expected error, got none")
+			}
+			if !tc.expectErr && err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+// writeTestDockerImage writes an image tarball fixture named after the file, tagged with the docker.io/istio hub and
+// version 1.20.0 the docker tests use
+func writeTestDockerImage(t *testing.T, file string) {
+	name := strings.TrimSuffix(filepath.Base(file), ".tar.gz")
+	testutil.WriteImage(t, file, `{"config":{}}`, []string{"docker.io/istio/" + name + ":1.20.0"})
+}
+
+func TestDockerOutputModes(t *testing.T) {
+	images := []string{"pilot-distroless", "proxyv2-debug"}
+
+	t.Run("tar", func(t *testing.T) {
+		release := t.TempDir()
+		if err := os.MkdirAll(filepath.Join(release, "docker"), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		r := ReleaseInfo{
+			release: release,
+			manifest: model.Manifest{
+				Version:       "1.20.0",
+				Docker:        "docker.io/istio",
+				DockerOutput:  model.DockerOutputTar,
+				DockerImages:  images,
+				Architectures: []string{"linux/amd64", "linux/arm64"},
+			},
+		}
+		if err := TestDocker(r); err == nil {
+			t.Fatalf("expected error with no images")
+		}
+		for _, f := range []string{"pilot-distroless", "proxyv2-debug", "pilot-distroless-arm64", "proxyv2-debug-arm64"} {
+			writeTestDockerImage(t, filepath.Join(release, "docker", f+".tar.gz"))
+		}
+		if err := TestDocker(r); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("tar with docker architecture subset", func(t *testing.T) {
+		release := t.TempDir()
+		if err := os.MkdirAll(filepath.Join(release, "docker"), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		r := ReleaseInfo{
+			release: release,
+			manifest: model.Manifest{
+				Version:             "1.20.0",
+				Docker:              "docker.io/istio",
+				DockerOutput:        model.DockerOutputTar,
+				DockerImages:        images,
+				Architectures:       []string{"linux/amd64", "linux/arm64"},
+				DockerArchitectures: []string{"linux/amd64"},
+			},
+		}
+		for _, f := range []string{"pilot-distroless", "proxyv2-debug"} {
+			writeTestDockerImage(t, filepath.Join(release, "docker", f+".tar.gz"))
+		}
+		// Images for linux/arm64 are not built, so are not expected
+		if err := TestDocker(r); err != nil {
+			t.Fatal(err)
+		}
+		r.manifest.DockerArchitectures = []string{"linux/arm64"}
+		if err := TestDocker(r); err == nil {
+			t.Fatalf("expected error with no arm64 images")
+		}
+	})
+
+	t.Run("context", func(t *testing.T) {
+		loaded := map[string]bool{}
+		orig := dockerImageExists
+		dockerImageExists = func(image string) bool { return loaded[image] }
+		t.Cleanup(func() { dockerImageExists = orig })
+
+		r := ReleaseInfo{
+			// No docker directory exists in the release for context mode
+			release: t.TempDir(),
+			manifest: model.Manifest{
+				Version:       "1.20.0",
+				Docker:        "docker.io/istio",
+				DockerOutput:  model.DockerOutputContext,
+				DockerImages:  images,
+				Architectures: []string{"linux/amd64"},
+			},
+		}
+		if err := TestDocker(r); err == nil {
+			t.Fatalf("expected error with no images")
+		}
+		loaded["docker.io/istio/pilot:1.20.0-distroless"] = true
+		loaded["docker.io/istio/proxyv2:1.20.0"] = true
+		if err := TestDocker(r); err != nil {
+			t.Fatal(err)
+		}
+
+		r.manifest.DockerVariants = []string{"debug", "distroless", "ubi"}
+		r.manifest.DockerImages = append(images, "pilot-ubi")
+		if err := TestDocker(r); err == nil {
+			t.Fatalf("expected error with no ubi image")
+		}
+		loaded["docker.io/istio/pilot:1.20.0-ubi"] = true
+		if err := TestDocker(r); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestBuildInfoCheck(t *testing.T) {
+	manifest := model.Manifest{
+		EmbedBuildInfo: true,
+		Dependencies: model.IstioDependencies{
+			Istio: &model.Dependency{Sha: "1111"},
+			Api:   &model.Dependency{Sha: "2222"},
+		},
+	}
+	cases := []struct {
+		name      string
+		info      string
+		skipTime  bool
+		expectErr bool
+	}{
+		{"matching", `{"timestamp":"2024-01-01T00:00:00Z","dependencies":{"istio":"1111","api":"2222"}}`, false, false},
+		{"no timestamp", `{"dependencies":{"istio":"1111","api":"2222"}}`, true, false},
+		{"unexpected timestamp", `{"timestamp":"2024-01-01T00:00:00Z","dependencies":{"istio":"1111","api":"2222"}}`, true, true},
+		{"invalid timestamp", `{"timestamp":"yesterday","dependencies":{"istio":"1111","api":"2222"}}`, false, true},
+		{"mismatched sha", `{"dependencies":{"istio":"1111","api":"3333"}}`, false, true},
+		{"missing dependency", `{"dependencies":{"istio":"1111"}}`, false, true},
+		{"invalid json", `{`, false, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			archive := t.TempDir()
+			if err := os.WriteFile(filepath.Join(archive, "build-info.json"), []byte(tc.info), 0o640); err != nil {
+				t.Fatal(err)
+			}
+			m := manifest
+			m.SkipBuildTimestamp = tc.skipTime
+			err := TestBuildInfo(ReleaseInfo{archive: archive, manifest: m})
+			if tc.expectErr && err == nil {
+				t.Fatalf("expected error, got none")
+			}
+			if !tc.expectErr && err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCompletionFilesContent(t *testing.T) {
+	cases := []struct {
+		name      string
+		bash      string
+		expectErr bool
+	}{
+		{"valid", "complete -F _istioctl istioctl\n", false},
+		{"empty", "", true},
+		{"truncated", "__istioctl_debug() {\n  if [[ -n ${BASH_COMP_DEBUG_FILE} ]]; then\n", true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			archive := t.TempDir()
+			if err := os.MkdirAll(filepath.Join(archive, "tools"), 0o750); err != nil {
+				t.Fatal(err)
+			}
+			files := map[string]string{
+				"istioctl.bash": tc.bash,
+				"_istioctl":     "#compdef istioctl\ncompdef _istioctl istioctl\n",
+			}
+			for f, content := range files {
+				if err := os.WriteFile(filepath.Join(archive, "tools", f), []byte(content), 0o640); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := TestCompletionFiles(ReleaseInfo{archive: archive})
+			if tc.expectErr && err == nil {
+				t.Fatalf("expected error, got none")
+			}
+			if !tc.expectErr && err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			// The additional completions are required once enabled
+			r := ReleaseInfo{archive: archive, manifest: model.Manifest{AdditionalCompletions: true}}
+			if err := TestCompletionFiles(r); err == nil {
+				t.Fatalf("expected error for missing fish and powershell completions")
+			}
+		})
+	}
+}
+
+func TestFilePermissionsCheck(t *testing.T) {
+	cases := []struct {
+		name      string
+		mode      int64
+		typeflag  byte
+		expectErr bool
+	}{
+		{"regular", 0o644, tar.TypeReg, false},
+		{"executable", 0o755, tar.TypeReg, false},
+		{"symlink", 0o777, tar.TypeSymlink, false},
+		{"world writable", 0o666, tar.TypeReg, true},
+		{"setuid", 0o4755, tar.TypeReg, true},
+		{"setgid", 0o2755, tar.TypeReg, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			release := t.TempDir()
+			for _, arch := range model.ArchiveArchitectures {
+				entry := testutil.Entry{Name: "istio-1.20.0/bin/istioctl", Mode: tc.mode, Typeflag: tc.typeflag}
+				file := fmt.Sprintf("istio-1.20.0-%s.tar.gz", arch)
+				if arch == "win-amd64" {
+					entry = testutil.Entry{Name: "istio-1.20.0/bin/istioctl.exe", Mode: 0o755}
+					file = fmt.Sprintf("istio-1.20.0-%s.zip", arch)
+				}
+				if tc.typeflag == tar.TypeSymlink {
+					entry.Linkname = "istioctl-real"
+				}
+				testutil.WriteArchive(t, filepath.Join(release, file), entry)
+			}
+			err := TestFilePermissions(ReleaseInfo{release: release, manifest: model.Manifest{Version: "1.20.0"}})
+			if tc.expectErr && err == nil {
+				t.Fatalf("expected error, got none")
+			}
+			if !tc.expectErr && err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSafeArchiveEntry(t *testing.T) {
+	cases := map[string]bool{
+		"istio-1.20.0/":                     true,
+		"istio-1.20.0/bin/istioctl":         true,
+		"istio-1.20.0/samples/../README.md": false,
+		"../istio-1.20.0/bin/istioctl":      false,
+		"/etc/passwd":                       false,
+		"istio-1.20.0":                      true,
+		"istio-1.20.0-extra/bin/istioctl":   false,
+		"istio-1.20.0\\..\\evil":            false,
+		"bin/istioctl":                      false,
+	}
+	for name, want := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := safeArchiveEntry(name, "istio-1.20.0/"); got != want {
+				t.Fatalf("expected %v, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestArchiveSafetyCheck(t *testing.T) {
+	cases := []struct {
+		name    string
+		archive string
+		entries []string
+		wantErr string
+	}{
+		{"release archive", "istio-1.20.0-linux-amd64.tar.gz", []string{"istio-1.20.0/bin/istioctl"}, ""},
+		{"release archive outside prefix", "istio-1.20.0-linux-amd64.tar.gz", []string{"bin/istioctl"}, `istio-1.20.0-linux-amd64.tar.gz: "bin/istioctl"`},
+		{"tools archive outside prefix", "istio-tools-1.20.0-linux-amd64.tar.gz", []string{"tools/x"}, `istio-tools-1.20.0-linux-amd64.tar.gz: "tools/x"`},
+		{"istioctl archive", "istioctl-1.20.0-linux-amd64.tar.gz", []string{"istioctl"}, ""},
+		{"istioctl archive parent path", "istioctl-1.20.0-win-amd64.zip", []string{"../istioctl.exe"}, `istioctl-1.20.0-win-amd64.zip: "../istioctl.exe"`},
+		{"other archive absolute path", "sources.tar.gz", []string{"/etc/passwd"}, `sources.tar.gz: "/etc/passwd"`},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			release := t.TempDir()
+			testutil.WriteArchive(t, filepath.Join(release, tt.archive), testutil.Empty(tt.entries...)...)
+			err := TestArchiveSafety(ReleaseInfo{release: release, manifest: model.Manifest{Version: "1.20.0"}})
+			testutil.AssertError(t, err, tt.wantErr)
+		})
+	}
+}
+
+// writeTestArchives writes a release archive for every architecture, each containing files under istio-1.20.0/
+func writeTestArchives(t *testing.T, release string, files []string) {
+	names := make([]string, 0, len(files))
+	for _, name := range files {
+		names = append(names, "istio-1.20.0/"+name)
+	}
+	for _, arch := range model.ArchiveArchitectures {
+		if arch == "win-amd64" {
+			testutil.WriteArchive(t, filepath.Join(release, fmt.Sprintf("istio-1.20.0-%s.zip", arch)), testutil.Empty(names...)...)
+			continue
+		}
+		entries := append([]testutil.Entry{{Name: "istio-1.20.0/", Typeflag: tar.TypeDir}}, testutil.Empty(names...)...)
+		testutil.WriteArchive(t, filepath.Join(release, fmt.Sprintf("istio-1.20.0-%s.tar.gz", arch)), entries...)
+	}
+}
+
+func TestArchiveAllowlistCheck(t *testing.T) {
+	base := []string{"LICENSE", "bin/istioctl", "samples/bookinfo/README.md"}
+	cases := []struct {
+		name      string
+		files     []string
+		expectErr bool
+	}{
+		{"unchanged", base, false},
+		{"added file", append([]string{"samples/bookinfo/secret.key"}, base...), true},
+		{"removed file", base[:2], false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			golden := t.TempDir()
+			writeTestArchives(t, golden, base)
+			r := ReleaseInfo{release: golden, manifest: model.Manifest{Version: "1.20.0"}}
+			files, err := archiveFiles(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			allowlist := filepath.Join(t.TempDir(), "archive-files.txt")
+			if err := os.WriteFile(allowlist, []byte(strings.Join(files, "\n")), 0o640); err != nil {
+				t.Fatal(err)
+			}
+
+			release := t.TempDir()
+			writeTestArchives(t, release, tc.files)
+			err = TestArchiveAllowlist(ReleaseInfo{release: release, manifest: r.manifest, allowlist: allowlist})
+			if tc.expectErr && err == nil {
+				t.Fatalf("expected error, got none")
+			}
+			if !tc.expectErr && err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCompareAllowlist(t *testing.T) {
+	unexpected, missing := compareAllowlist(
+		[]string{"linux-amd64 bin/istioctl", "linux-amd64 extra"},
+		[]string{"linux-amd64 bin/istioctl", "linux-amd64 LICENSE"})
+	if len(unexpected) != 1 || unexpected[0] != "linux-amd64 extra" {
+		t.Fatalf("unexpected files: %v", unexpected)
+	}
+	if len(missing) != 1 || missing[0] != "linux-amd64 LICENSE" {
+		t.Fatalf("missing files: %v", missing)
+	}
+}
+
+func TestProfileSettingsCheck(t *testing.T) {
+	cases := []struct {
+		name      string
+		profile   string
+		expectErr bool
+	}{
+		{"clean", "spec:\n  hub: docker.io/istio\n  values:\n    global:\n      logging:\n        level: default:info\n    pilot:\n      traceSampling: 1.0\n", false},
+		{"debug logging", "spec:\n  values:\n    global:\n      logging:\n        level: default:debug\n", true},
+		{"proxy trace", "spec:\n  values:\n    global:\n      proxy:\n        logLevel: trace\n", true},
+		{"full sampling", "spec:\n  values:\n    pilot:\n      traceSampling: 100\n", true},
+		{"debug variant", "spec:\n  values:\n    global:\n      variant: debug\n", true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			archive := t.TempDir()
+			if err := os.MkdirAll(filepath.Join(archive, "manifests", "profiles"), 0o750); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(archive, "manifests", "profiles", "default.yaml"), []byte(tc.profile), 0o640); err != nil {
+				t.Fatal(err)
+			}
+			err := TestProfileSettings(ReleaseInfo{archive: archive})
+			if tc.expectErr && err == nil {
+				t.Fatalf("expected error, got none")
+			}
+			if !tc.expectErr && err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestProfileChartsCheck(t *testing.T) {
+	defaultProfile := "spec:\n  components:\n    base:\n      enabled: true\n    pilot:\n      enabled: true\n" +
+		"    ingressGateways:\n    - name: istio-ingressgateway\n      enabled: true\n"
+	cases := []struct {
+		name     string
+		profiles map[string]string
+		charts   []string
+		wantErr  string
+	}{
+		{
+			"shipped", map[string]string{"default.yaml": defaultProfile},
+			[]string{"base", "istio-control/istio-discovery", "gateways/istio-ingress"}, "",
+		},
+		{
+			"disabled components are not needed", map[string]string{"default.yaml": defaultProfile + "    cni:\n      enabled: false\n"},
+			[]string{"base", "istio-control/istio-discovery", "gateways/istio-ingress"}, "",
+		},
+		{
+			"missing gateway chart", map[string]string{"default.yaml": defaultProfile},
+			[]string{"base", "istio-control/istio-discovery"},
+			"default.yaml component ingressGateways references manifests/charts/gateways/istio-ingress",
+		},
+		{
+			"missing chart of other profile", map[string]string{
+				"default.yaml": defaultProfile,
+				"ambient.yaml": "spec:\n  components:\n    cni:\n      enabled: true\n    ztunnel:\n      enabled: true\n",
+			},
+			[]string{"base", "istio-control/istio-discovery", "gateways/istio-ingress", "istio-cni"},
+			"ambient.yaml component ztunnel references manifests/charts/ztunnel",
+		},
+		{
+			"remote chart of older versions", map[string]string{"remote.yaml": "spec:\n  components:\n    istiodRemote:\n      enabled: true\n"},
+			[]string{"istiod-remote"}, "",
+		},
+		{
+			"unknown component", map[string]string{"default.yaml": defaultProfile + "    waypoint:\n      enabled: true\n"},
+			[]string{"base", "istio-control/istio-discovery", "gateways/istio-ingress"},
+			"default.yaml component waypoint has no known chart",
+		},
+		{"no profiles", nil, nil, "profiles"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := t.TempDir()
+			for name, profile := range tt.profiles {
+				if err := os.MkdirAll(filepath.Join(archive, "manifests", "profiles"), 0o750); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(archive, "manifests", "profiles", name), []byte(profile), 0o640); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, chart := range tt.charts {
+				dir := filepath.Join(archive, "manifests", "charts", chart)
+				if err := os.MkdirAll(dir, 0o750); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte("name: "+filepath.Base(chart)), 0o640); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := TestProfileCharts(ReleaseInfo{archive: archive})
+			testutil.AssertError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestProfileComponentsCheck(t *testing.T) {
+	profile := "spec:\n  components:\n    base:\n      enabled: true\n    pilot:\n      enabled: true\n" +
+		"    ingressGateways:\n    - name: istio-ingressgateway\n      enabled: true\n"
+	cases := []struct {
+		name     string
+		profile  string
+		manifest model.Manifest
+		wantErr  string
+	}{
+		{"default", profile, model.Manifest{}, ""},
+		{"pilot disabled", strings.Replace(profile, "pilot:\n      enabled: true", "pilot:\n      enabled: false", 1), model.Manifest{}, "pilot (enabled: false, expected true)"},
+		{"cni enabled", profile + "    cni:\n      enabled: true\n", model.Manifest{}, "cni (enabled: true, expected false)"},
+		{
+			"intended cni and gateway", profile + "    cni:\n      enabled: true\n",
+			model.Manifest{ProfileComponents: map[string]bool{"cni": true, "ingressGateways": true}}, "",
+		},
+		{
+			"ambient disabled", profile + "    ztunnel:\n      enabled: true\n",
+			model.Manifest{SkipAmbient: true, ProfileComponents: map[string]bool{"pilot": true}}, "ztunnel (enabled: true, expected false)",
+		},
+		{
+			"every mismatch reported", "spec: {}\n", model.Manifest{},
+			"base (enabled: false, expected true), pilot (enabled: false, expected true)",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := t.TempDir()
+			if err := os.MkdirAll(filepath.Join(archive, "manifests", "profiles"), 0o750); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(archive, "manifests", "profiles", "default.yaml"), []byte(tt.profile), 0o640); err != nil {
+				t.Fatal(err)
+			}
+			err := TestProfileComponents(ReleaseInfo{archive: archive, manifest: tt.manifest})
+			testutil.AssertError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestParseEnvoyVersion(t *testing.T) {
+	sha := "0123456789abcdef0123456789abcdef01234567"
+	got, err := parseEnvoyVersion("\nenvoy  version: " + sha + "/1.30.0-dev/Clean/RELEASE/BoringSSL\n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != sha {
+		t.Fatalf("expected %v, got %v", sha, got)
+	}
+	if _, err := parseEnvoyVersion("envoy  version: unknown"); err == nil {
+		t.Fatalf("expected error for missing SHA")
+	}
+}
+
+func TestProxyExtensionsCheck(t *testing.T) {
+	const stats, metadata = "/etc/istio/extensions/stats.wasm", "/etc/istio/extensions/metadata.wasm"
+	complete := []string{"usr/local/bin/envoy", "etc/istio/extensions/stats.wasm", "etc/istio/extensions/metadata.wasm"}
+	cases := []struct {
+		name       string
+		extensions []string
+		// images maps the image archives to the files in them
+		images  map[string][]string
+		context bool
+		wantErr string
+	}{
+		{
+			name:   "no extensions",
+			images: map[string][]string{},
+		},
+		{
+			name:       "all present",
+			extensions: []string{stats, metadata},
+			images: map[string][]string{
+				"proxyv2-debug.tar.gz":            complete,
+				"proxyv2-distroless.tar.gz":       complete,
+				"proxyv2-debug-arm64.tar.gz":      complete,
+				"proxyv2-distroless-arm64.tar.gz": complete,
+			},
+		},
+		{
+			name:       "missing in one variant",
+			extensions: []string{stats, metadata},
+			images: map[string][]string{
+				"proxyv2-debug.tar.gz":            complete,
+				"proxyv2-distroless.tar.gz":       complete,
+				"proxyv2-debug-arm64.tar.gz":      complete,
+				"proxyv2-distroless-arm64.tar.gz": {"usr/local/bin/envoy", "etc/istio/extensions/stats.wasm"},
+			},
+			wantErr: metadata + " in proxyv2-distroless-arm64",
+		},
+		{
+			name:       "missing image",
+			extensions: []string{stats},
+			images: map[string][]string{
+				"proxyv2-debug.tar.gz":       complete,
+				"proxyv2-distroless.tar.gz":  complete,
+				"proxyv2-debug-arm64.tar.gz": complete,
+			},
+			wantErr: "proxyv2-distroless-arm64.tar.gz",
+		},
+		{
+			name:       "docker context",
+			extensions: []string{stats, metadata},
+			context:    true,
+			wantErr:    metadata + " in proxyv2-distroless-arm64",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			release := t.TempDir()
+			for image, files := range tt.images {
+				testutil.WriteImage(t, filepath.Join(release, "docker", image), `{"config":{}}`, []string{"docker.io/istio/proxyv2:1.20.0"}, testutil.Empty(files...))
+			}
+			orig := containerFiles
+			t.Cleanup(func() { containerFiles = orig })
+			containerFiles = func(ref string) (map[string]struct{}, error) {
+				files := map[string]struct{}{stats: {}}
+				if ref != "docker.io/istio/proxyv2:1.20.0-distroless-arm64" {
+					files[metadata] = struct{}{}
+				}
+				return files, nil
+			}
+			manifest := model.Manifest{
+				Version:             "1.20.0",
+				Docker:              "docker.io/istio",
+				DockerImages:        []string{"pilot-distroless", "proxyv2-debug", "proxyv2-distroless"},
+				DockerArchitectures: []string{"linux/amd64", "linux/arm64"},
+				ProxyExtensions:     tt.extensions,
+			}
+			if tt.context {
+				manifest.DockerOutput = model.DockerOutputContext
+			}
+			err := TestProxyExtensions(ReleaseInfo{release: release, manifest: manifest})
+			testutil.AssertError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestReleaseIndexCheck(t *testing.T) {
+	cases := []struct {
+		name      string
+		modify    func(release string) error
+		expectErr bool
+	}{
+		{"unchanged", func(string) error { return nil }, false},
+		{"extra file", func(release string) error {
+			return os.WriteFile(filepath.Join(release, "extra.txt"), []byte("extra"), 0o640)
+		}, true},
+		{"missing file", func(release string) error {
+			return os.Remove(filepath.Join(release, "deb", "istio-sidecar.deb"))
+		}, true},
+		{"modified file", func(release string) error {
+			return os.WriteFile(filepath.Join(release, "manifest.yaml"), []byte("version: 1.20.1"), 0o640)
+		}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			release := t.TempDir()
+			files := map[string]string{
+				"manifest.yaml":         "version: 1.20.0",
+				"deb/istio-sidecar.deb": "deb",
+			}
+			for name, content := range files {
+				if err := os.MkdirAll(filepath.Dir(filepath.Join(release, name)), 0o750); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(release, name), []byte(content), 0o640); err != nil {
+					t.Fatal(err)
+				}
+			}
+			manifest := model.Manifest{Version: "1.20.0"}
+			artifacts, err := util.ListArtifacts(release)
+			if err != nil {
+				t.Fatal(err)
+			}
+			js, err := json.Marshal(model.ReleaseIndex{
+				SchemaVersion: model.ReleaseIndexSchemaVersion,
+				Manifest:      manifest,
+				Artifacts:     artifacts,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(release, "release-index.json"), js, 0o640); err != nil {
+				t.Fatal(err)
+			}
+			if err := tc.modify(release); err != nil {
+				t.Fatal(err)
+			}
+			err = TestReleaseIndex(ReleaseInfo{release: release, manifest: manifest})
+			if tc.expectErr && err == nil {
+				t.Fatalf("expected error, got none")
+			}
+			if !tc.expectErr && err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestUncompressedArchivesCheck(t *testing.T) {
+	release := t.TempDir()
+	r := ReleaseInfo{release: release, manifest: model.Manifest{Version: "1.20.0", UncompressedArchives: true}}
+	if err := TestUncompressedArchives(r); err == nil {
+		t.Fatalf("expected error with no uncompressed archives")
+	}
+	for _, arch := range model.ArchiveArchitectures {
+		for _, name := range []string{"istio", "istioctl"} {
+			tar := filepath.Join(release, fmt.Sprintf("%s-1.20.0-%s.tar", name, arch))
+			if err := os.WriteFile(tar, []byte(arch), 0o640); err != nil {
+				t.Fatal(err)
+			}
+			if err := util.CreateSha(tar); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := TestUncompressedArchives(r); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(release, "istio-1.20.0-linux-arm64.tar"), []byte("modified"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := TestUncompressedArchives(r); err == nil {
+		t.Fatalf("expected checksum mismatch")
+	}
+
+	// Only the uncompressed archive exists, so it is used instead
+	if got, want := releaseArchive(release, "1.20.0", "linux-amd64"), filepath.Join(release, "istio-1.20.0-linux-amd64.tar"); got != want {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestArtifactChecksumsCheck(t *testing.T) {
+	cases := []struct {
+		name    string
+		algos   []string
+		modify  func(t *testing.T, release string)
+		wantErr string
+	}{
+		{"sha256", nil, nil, ""},
+		{"sha256 and sha512", []string{"sha256", "sha512"}, nil, ""},
+		{
+			"modified archive", []string{"sha256", "sha512"},
+			func(t *testing.T, release string) {
+				testutil.WriteFile(t, filepath.Join(release, "istioctl-1.20.0-linux-arm64.tar.gz"), "modified")
+			},
+			"istioctl-1.20.0-linux-arm64.tar.gz sha256 checksum",
+		},
+		{
+			"modified sha512", []string{"sha256", "sha512"},
+			func(t *testing.T, release string) {
+				testutil.WriteFile(t, filepath.Join(release, "deb", "istio-sidecar.deb.sha512"), "0 istio-sidecar.deb\n")
+			},
+			"istio-sidecar.deb sha512 checksum",
+		},
+		{
+			"missing sha512", []string{"sha256", "sha512"},
+			func(t *testing.T, release string) {
+				if err := os.Remove(filepath.Join(release, "istio-1.20.0-win-amd64.zip.sha512")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			"istio-1.20.0-win-amd64.zip.sha512",
+		},
+		{
+			"missing archive checksums", nil,
+			func(t *testing.T, release string) {
+				testutil.WriteFile(t, filepath.Join(release, "istio-1.20.0-linux-s390x.tar.gz"), "s390x")
+			},
+			"istio-1.20.0-linux-s390x.tar.gz.sha256",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			release := t.TempDir()
+			algos := tt.algos
+			if algos == nil {
+				algos = []string{"sha256"}
+			}
+			for _, f := range []string{"istio-1.20.0-linux-amd64.tar.gz", "istioctl-1.20.0-linux-arm64.tar.gz", "istio-1.20.0-win-amd64.zip", "deb/istio-sidecar.deb"} {
+				testutil.WriteFile(t, filepath.Join(release, f), f)
+				for _, algo := range algos {
+					if err := util.CreateShaAlgo(filepath.Join(release, f), util.ShaAlgorithm(algo)); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if tt.modify != nil {
+				tt.modify(t, release)
+			}
+			err := TestArtifactChecksums(ReleaseInfo{release: release, manifest: model.Manifest{Version: "1.20.0", ShaAlgorithms: tt.algos}})
+			testutil.AssertError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestToolsArchiveCheck(t *testing.T) {
+	tools := map[string]string{
+		"istio-1.20.0/bin/istioctl":             "istioctl",
+		"istio-1.20.0/tools/certs/Makefile":     "certs",
+		"istio-1.20.0/samples/hello/hello.yaml": "kind: Service",
+	}
+	with := func(name, content string) map[string]string {
+		entries := maps.Clone(tools)
+		entries[name] = content
+		return entries
+	}
+	cases := []struct {
+		name    string
+		tools   map[string]string
+		wantErr string
+	}{
+		{name: "valid", tools: tools},
+		{name: "extra files", tools: with("istio-1.20.0/manifests/profiles/default.yaml", ""), wantErr: "manifests/profiles/default.yaml"},
+		{name: "different istioctl", tools: with("istio-1.20.0/bin/istioctl", "other"), wantErr: "tools archive istioctl sha256"},
+		{name: "missing", wantErr: "istio-tools-1.20.0-linux-amd64.tar.gz"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			release := t.TempDir()
+			testutil.WriteArchive(t, filepath.Join(release, "istio-1.20.0-linux-amd64.tar.gz"), testutil.Files(with("istio-1.20.0/manifest.yaml", ""))...)
+			if tt.tools != nil {
+				testutil.WriteArchive(t, filepath.Join(release, "istio-tools-1.20.0-linux-amd64.tar.gz"), testutil.Files(tt.tools)...)
+			}
+			err := TestToolsArchive(ReleaseInfo{release: release, manifest: model.Manifest{
+				Version:              "1.20.0",
+				ArchiveArchitectures: []string{"linux-amd64"},
+				ToolsArchive:         true,
+			}})
+			testutil.AssertError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestStandaloneIstioctlCheck(t *testing.T) {
+	cases := []struct {
+		name      string
+		mismatch  string
+		expectErr bool
+	}{
+		{"identical", "", false},
+		{"linux mismatch", "linux-arm64", true},
+		{"windows mismatch", "win-amd64", true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			release := t.TempDir()
+			for _, arch := range model.ArchiveArchitectures {
+				binary, ext := "istioctl", "tar.gz"
+				if arch == "win-amd64" {
+					binary, ext = "istioctl.exe", "zip"
+				}
+				standalone := "istioctl for " + arch
+				if arch == tc.mismatch {
+					standalone = "stale istioctl"
+				}
+				testutil.WriteArchive(t, filepath.Join(release, fmt.Sprintf("istio-1.20.0-%s.%s", arch, ext)),
+					testutil.Entry{Name: "istio-1.20.0/bin/" + binary, Content: "istioctl for " + arch})
+				testutil.WriteArchive(t, filepath.Join(release, fmt.Sprintf("istioctl-1.20.0-%s.%s", arch, ext)),
+					testutil.Entry{Name: binary, Content: standalone})
+			}
+			err := TestStandaloneIstioctlMatchesArchive(ReleaseInfo{release: release, manifest: model.Manifest{Version: "1.20.0"}})
+			if tc.expectErr && err == nil {
+				t.Fatalf("expected error, got none")
+			}
+			if !tc.expectErr && err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if tc.expectErr && !strings.Contains(err.Error(), tc.mismatch) {
+				t.Fatalf("expected error to report %v, got %v", tc.mismatch, err)
+			}
+		})
+	}
+}
+
+func TestDockerSemaphore(t *testing.T) {
+	orig := dockerSemaphore
+	dockerSemaphore = make(chan struct{}, 2)
+	t.Cleanup(func() { dockerSemaphore = orig })
+
+	var mu sync.Mutex
+	running, peak := 0, 0
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = withDocker(func() error {
+				mu.Lock()
+				running++
+				if running > peak {
+					peak = running
+				}
+				mu.Unlock()
+				time.Sleep(10 * time.Millisecond)
+				mu.Lock()
+				running--
+				mu.Unlock()
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	if peak > 2 {
+		t.Fatalf("expected at most 2 concurrent docker commands, got %d", peak)
+	}
+	if peak == 0 {
+		t.Fatalf("expected docker commands to run")
+	}
+}
+
+func TestWorkloadImages(t *testing.T) {
+	rendered := `apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: istiod
+---
+apiVersion: apps/v1
+kind: Deployment
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: gcr.io/istio/proxyv2:1.0.0
+      containers:
+      - name: discovery
+        image: gcr.io/istio/pilot:1.0.0
+---
+apiVersion: apps/v1
+kind: DaemonSet
+spec:
+  template:
+    spec:
+      containers:
+      - name: install-cni
+        image: gcr.io/istio/install-cni:1.0.0
+`
+	images, err := workloadImages([]byte(rendered))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"gcr.io/istio/proxyv2:1.0.0", "gcr.io/istio/pilot:1.0.0", "gcr.io/istio/install-cni:1.0.0"}
+	if !reflect.DeepEqual(images, want) {
+		t.Fatalf("got %v, want %v", images, want)
+	}
+}
+
+func TestCheckImage(t *testing.T) {
+	r := ReleaseInfo{manifest: model.Manifest{Docker: "gcr.io/istio", Version: "1.0.0"}}
+	cases := []struct {
+		image   string
+		wantErr bool
+	}{
+		{"gcr.io/istio/pilot:1.0.0", false},
+		{"auto", false},
+		{"gcr.io/istio/pilot:1.0.1", true},
+		{"docker.io/istio/pilot:1.0.0", true},
+		{"pilot", true},
+	}
+	for _, tt := range cases {
+		t.Run(tt.image, func(t *testing.T) {
+			err := checkImage(r, tt.image)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got err %v, want error %v", err, tt.wantErr)
+			}
+			var mismatch *ErrVersionMismatch
+			if err != nil && !errors.As(err, &mismatch) {
+				t.Fatalf("expected ErrVersionMismatch, got %T", err)
+			}
+		})
+	}
+}
+
+func TestOperatorCheck(t *testing.T) {
+	cases := []struct {
+		name    string
+		enabled bool
+		version string
+		wantErr bool
+	}{
+		{"disabled", false, "", false},
+		{"enabled", true, "1.0.0", false},
+		{"enabled mismatch", true, "0.9.0", true},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			orig := operatorVersion
+			operatorVersion = func(ReleaseInfo) (string, error) {
+				called = true
+				return tt.version, nil
+			}
+			t.Cleanup(func() { operatorVersion = orig })
+			r := ReleaseInfo{manifest: model.Manifest{Version: "1.0.0", BuildOperator: tt.enabled}}
+			err := TestOperator(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got err %v, want error %v", err, tt.wantErr)
+			}
+			if called != tt.enabled {
+				t.Fatalf("operator version called: %v, expected %v", called, tt.enabled)
+			}
+		})
+	}
+}
+
+func TestImageEntrypointCheck(t *testing.T) {
+	config := func(entrypoint string, env ...string) string {
+		js, err := json.Marshal(DockerConfig{Config: DockerConfigConfig{Entrypoint: []string{entrypoint}, Env: env}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(js)
+	}
+	agent := "/usr/local/bin/pilot-agent"
+	cases := []struct {
+		name    string
+		image   string
+		config  string
+		wantErr string
+	}{
+		{"valid", "proxyv2-distroless", config(agent, "PATH=/usr/bin", "ISTIO_META_ISTIO_PROXY_SHA=abc"), ""},
+		{"missing env", "proxyv2-distroless", config(agent, "PATH=/usr/bin"), "missing env ISTIO_META_ISTIO_PROXY_SHA"},
+		{"forbidden env", "proxyv2-distroless", config(agent, "ISTIO_META_ISTIO_PROXY_SHA=abc", "ENVOY_UID=0"), "forbidden env ENVOY_UID=0"},
+		{"env allowed for debug variant", "proxyv2-debug", config(agent, "ISTIO_META_ISTIO_PROXY_SHA=abc", "ENVOY_UID=0"), ""},
+		{"wrong entrypoint", "proxyv2-debug", config("/bin/sh", "ISTIO_META_ISTIO_PROXY_SHA=abc"), "expected entrypoint"},
+		{"image without rule", "pilot-debug", config("/bin/sh"), ""},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			release := t.TempDir()
+			if err := os.MkdirAll(filepath.Join(release, "docker"), 0o750); err != nil {
+				t.Fatal(err)
+			}
+			testutil.WriteImage(t, filepath.Join(release, "docker", tt.image+".tar.gz"), tt.config, nil)
+			r := ReleaseInfo{release: release, manifest: model.Manifest{DockerImages: []string{tt.image}, Architectures: []string{"linux/amd64"}}}
+			err := TestImageEntrypoint(r)
+			testutil.AssertError(t, err, tt.wantErr)
+		})
+	}
+
+	t.Run("architectures", func(t *testing.T) {
+		release := t.TempDir()
+		if err := os.MkdirAll(filepath.Join(release, "docker"), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		testutil.WriteImage(t, filepath.Join(release, "docker", "proxyv2-distroless-arm64.tar.gz"), config(agent, "ISTIO_META_ISTIO_PROXY_SHA=abc", "ENVOY_UID=0"), nil)
+		r := ReleaseInfo{release: release, manifest: model.Manifest{DockerImages: []string{"proxyv2-distroless"}, Architectures: []string{"linux/arm64"}}}
+		testutil.AssertError(t, TestImageEntrypoint(r), "proxyv2-distroless-arm64: forbidden env ENVOY_UID=0")
+	})
+
+	t.Run("missing image", func(t *testing.T) {
+		r := ReleaseInfo{release: t.TempDir(), manifest: model.Manifest{DockerImages: []string{"proxyv2-debug"}, Architectures: []string{"linux/amd64"}}}
+		var missing *ErrMissingArtifact
+		if err := TestImageEntrypoint(r); !errors.As(err, &missing) {
+			t.Fatalf("expected missing artifact, got %v", err)
+		}
+	})
+}
+
+func TestImageUserCheck(t *testing.T) {
+	writeImage := func(t *testing.T, release, image, user string) {
+		config, err := json.Marshal(DockerConfig{Config: DockerConfigConfig{User: user}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		testutil.WriteImage(t, filepath.Join(release, "docker", image+".tar.gz"), string(config), nil)
+	}
+	defaultUsers := func(debugUser string) map[string]string {
+		users := map[string]string{}
+		for _, image := range model.DefaultDockerImages {
+			users[image] = "1337"
+			if strings.HasSuffix(image, "-debug") {
+				users[image] = debugUser
+			}
+		}
+		// install-cni and ztunnel run as root
+		users["install-cni-debug"] = "root"
+		users["ztunnel-debug"] = "root"
+		users["ztunnel-distroless"] = "0"
+		return users
+	}
+	cases := []struct {
+		name         string
+		users        map[string]string
+		nonRootDebug bool
+		rootImages   []string
+		wantErr      string
+	}{
+		{
+			name:  "default images",
+			users: defaultUsers("root"),
+		},
+		{
+			name:         "default images with non-root debug",
+			users:        defaultUsers("1337"),
+			nonRootDebug: true,
+		},
+		{
+			name:       "root images configured",
+			users:      map[string]string{"pilot-distroless": "0", "ztunnel-distroless": "0"},
+			rootImages: []string{"pilot"},
+			wantErr:    `ztunnel-distroless (user "0")`,
+		},
+		{
+			name:  "non-root",
+			users: map[string]string{"pilot-distroless": "1337", "pilot-debug": "root"},
+		},
+		{
+			name:  "named user and group",
+			users: map[string]string{"pilot-distroless": "nonroot:nonroot", "pilot-debug": ""},
+		},
+		{
+			name:    "root",
+			users:   map[string]string{"pilot-distroless": "0:0", "pilot-debug": "1337"},
+			wantErr: `pilot-distroless (user "0:0")`,
+		},
+		{
+			name:    "unset user",
+			users:   map[string]string{"pilot-distroless": "", "pilot-debug": "1337"},
+			wantErr: `pilot-distroless (user "")`,
+		},
+		{
+			name:         "root debug",
+			users:        map[string]string{"pilot-distroless": "1337", "pilot-debug": "root"},
+			nonRootDebug: true,
+			wantErr:      `pilot-debug (user "root")`,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			release := t.TempDir()
+			if err := os.MkdirAll(filepath.Join(release, "docker"), 0o750); err != nil {
+				t.Fatal(err)
+			}
+			images := []string{}
+			for image, user := range tt.users {
+				writeImage(t, release, image, user)
+				images = append(images, image)
+			}
+			r := ReleaseInfo{
+				release:      release,
+				nonRootDebug: tt.nonRootDebug,
+				rootImages:   tt.rootImages,
+				manifest: model.Manifest{
+					Architectures: []string{"linux/amd64"},
+					DockerImages:  images,
+				},
+			}
+			err := TestImageUser(r)
+			testutil.AssertError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestImageLockCheck(t *testing.T) {
+	id := "sha256:" + strings.Repeat("ab", 32)
+	lock := `{"images":[
+{"image":"docker.io/istio/pilot:1.20.0-distroless","imageID":"` + id + `"},
+{"image":"docker.io/istio/pilot:1.20.0-distroless-arm64","imageID":"` + id + `"}]}`
+	cases := []struct {
+		name     string
+		lock     string
+		hub      string
+		rewrites []MirrorRewrite
+		wantErr  string
+	}{
+		{name: "complete", lock: lock},
+		{name: "mirrored", lock: lock, hub: "mirror.example.com/istio"},
+		{name: "mirror rewrite", lock: lock, rewrites: []MirrorRewrite{{From: "docker.io", To: "mirror.example.com"}}},
+		{
+			name:    "missing arch",
+			lock:    `{"images":[{"image":"docker.io/istio/pilot:1.20.0-distroless","imageID":"` + id + `"}]}`,
+			wantErr: "does not pin images: docker.io/istio/pilot:1.20.0-distroless-arm64",
+		},
+		{
+			name:    "malformed image ID",
+			lock:    strings.Replace(lock, id, "sha256:abc", 1),
+			wantErr: `got "sha256:abc"`,
+		},
+		{name: "digest reference", lock: "docker.io/istio/pilot:1.20.0-distroless@" + id + "\n", wantErr: "failed to parse"},
+		{name: "missing lock", wantErr: model.ImageLockFile},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			release := t.TempDir()
+			if tt.lock != "" {
+				if err := os.WriteFile(filepath.Join(release, model.ImageLockFile), []byte(tt.lock), 0o640); err != nil {
+					t.Fatal(err)
+				}
+			}
+			r := ReleaseInfo{
+				release:        release,
+				hub:            tt.hub,
+				mirrorRewrites: tt.rewrites,
+				manifest: model.Manifest{
+					Version:       "1.20.0",
+					Docker:        "docker.io/istio",
+					ImageLock:     true,
+					Architectures: []string{"linux/amd64", "linux/arm64"},
+					DockerImages:  []string{"pilot-distroless"},
+				},
+			}
+			err := TestImageLock(r)
+			testutil.AssertError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestArtifactLayout(t *testing.T) {
+	release := t.TempDir()
+	manifest := model.Manifest{
+		Version:       "1.20.0",
+		Docker:        "docker.io/istio",
+		Architectures: []string{"linux/amd64"},
+		DockerImages:  []string{"pilot-debug"},
+		LicenseRepos:  []string{"istio"},
+		Layout: map[model.ArtifactCategory]string{
+			model.DockerArtifacts:  "images/docker",
+			model.LicenseArtifacts: "meta/licenses",
+		},
+	}
+	writeTestDockerImage(t, filepath.Join(release, "images/docker/pilot-debug.tar.gz"))
+	if err := os.MkdirAll(filepath.Join(release, "meta/licenses"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(release, "meta/licenses/istio.tar.gz"), []byte("test"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	r := ReleaseInfo{release: release, manifest: manifest}
+	if err := TestDocker(r); err != nil {
+		t.Fatal(err)
+	}
+	if err := TestLicenses(r); err != nil {
+		t.Fatal(err)
+	}
+
+	// The default layout does not find the artifacts
+	r.manifest.Layout = nil
+	if err := TestDocker(r); err == nil {
+		t.Fatalf("expected docker images to be missing from the default layout")
+	}
+	if err := TestLicenses(r); err == nil {
+		t.Fatalf("expected licenses to be missing from the default layout")
+	}
+}
+
+func TestHelmChartSetCheck(t *testing.T) {
+	expected := []string{
+		"base-1.20.0.tgz", "cni-1.20.0.tgz", "gateway-1.20.0.tgz", "istiod-1.20.0.tgz", "ztunnel-1.20.0.tgz",
+		"samples/ambient-1.20.0.tgz",
+	}
+	cases := []struct {
+		name    string
+		files   []string
+		wantErr string
+	}{
+		{"exact", expected, ""},
+		{"stray version", append([]string{"istiod-1.19.0.tgz"}, expected...), "unexpected files"},
+		{"missing", expected[1:], "base-1.20.0.tgz"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			release := t.TempDir()
+			for _, f := range tt.files {
+				if err := os.MkdirAll(filepath.Dir(filepath.Join(release, "helm", f)), 0o750); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(release, "helm", f), []byte("chart"), 0o640); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := TestHelmChartSet(ReleaseInfo{release: release, manifest: model.Manifest{Version: "1.20.0"}})
+			testutil.AssertError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestHelmRepoIndexCheck(t *testing.T) {
+	charts := map[string]string{"base-1.20.0.tgz": "base", "samples/ambient-1.20.0.tgz": "ambient"}
+	cases := []struct {
+		name    string
+		mutate  func(entries map[string]string)
+		wantErr string
+	}{
+		{name: "valid", mutate: func(map[string]string) {}},
+		{
+			name:    "wrong digest",
+			mutate:  func(e map[string]string) { e["base"] = strings.Replace(e["base"], "digest: ", "digest: 00", 1) },
+			wantErr: "base-1.20.0.tgz is indexed as base 1.20.0 with digest 00",
+		},
+		{
+			name: "wrong version",
+			mutate: func(e map[string]string) {
+				e["base"] = strings.Replace(e["base"], "version: 1.20.0", "version: 1.19.0", 1)
+			},
+			wantErr: "expected base 1.20.0",
+		},
+		{
+			name:    "missing chart",
+			mutate:  func(e map[string]string) { delete(e, "ambient") },
+			wantErr: "samples/ambient-1.20.0.tgz is not in the index",
+		},
+		{
+			name: "stale chart",
+			mutate: func(e map[string]string) {
+				e["cni"] = "  cni:\n  - name: cni\n    version: 1.19.0\n    urls: [cni-1.19.0.tgz]\n"
+			},
+			wantErr: "cni-1.19.0.tgz is in the index, but not the release",
+		},
+		{name: "missing index", mutate: nil, wantErr: model.HelmRepoIndexFile},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			release := t.TempDir()
+			if err := os.MkdirAll(filepath.Join(release, "helm", "samples"), 0o750); err != nil {
+				t.Fatal(err)
+			}
+			entries := map[string]string{}
+			for file, name := range charts {
+				archive := filepath.Join(release, "helm", file)
+				testutil.WriteArchive(t, archive, testutil.Files(map[string]string{
+					name + "/Chart.yaml":            "name: " + name + "\nversion: 1.20.0\n",
+					name + "/charts/sub/Chart.yaml": "name: sub\nversion: 0.0.1\n",
+				})...)
+				by, err := os.ReadFile(archive)
+				if err != nil {
+					t.Fatal(err)
+				}
+				digest, _ := util.ShaSum(util.Sha256, by)
+				entries[name] = fmt.Sprintf("  %s:\n  - name: %s\n    version: 1.20.0\n    urls: [%s]\n    digest: %s\n", name, name, file, digest)
+			}
+			if tt.mutate != nil {
+				tt.mutate(entries)
+				index := "apiVersion: v1\nentries:\n"
+				for _, e := range entries {
+					index += e
+				}
+				if err := os.WriteFile(filepath.Join(release, "helm", model.HelmRepoIndexFile), []byte(index), 0o640); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := TestHelmRepoIndex(ReleaseInfo{release: release, manifest: model.Manifest{Version: "1.20.0", HelmRepoIndex: true}})
+			testutil.AssertError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestArtifactSbomCheck(t *testing.T) {
+	all := "SPDXVersion: SPDX-2.3\n"
+	for _, chart := range []string{"base", "cni", "gateway", "istiod", "ztunnel", "ambient"} {
+		all += "PackageName: " + chart + "-1.20.0\nFileName: ./templates/" + chart + ".yaml\n"
+	}
+	all += "FileName: /work/out/istio-1.20.0-linux-amd64.tar.gz\n"
+	cases := []struct {
+		name    string
+		enabled bool
+		sbom    string
+		wantErr string
+	}{
+		{"disabled", false, "", ""},
+		{"complete", true, all, ""},
+		{"missing chart", true, strings.Replace(all, "PackageName: cni-1.20.0\n", "", 1), "does not describe cni-1.20.0"},
+		{"other chart version", true, strings.Replace(all, "cni-1.20.0", "cni-1.20.0-rc.1", 1), "does not describe cni-1.20.0"},
+		{"referenced only", true, strings.Replace(all, "PackageName: cni-1.20.0", "PackageComment: replaces cni-1.20.0", 1), "cni-1.20.0"},
+		{
+			"missing archive", true, strings.Replace(all, "FileName: /work/out/istio-1.20.0-linux-amd64.tar.gz\n", "", 1),
+			"istio-1.20.0-linux-amd64.tar.gz",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			release := t.TempDir()
+			if tt.sbom != "" {
+				if err := os.WriteFile(filepath.Join(release, "istio-artifacts.spdx"), []byte(tt.sbom), 0o640); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := TestArtifactSbom(ReleaseInfo{release: release, manifest: model.Manifest{
+				Version:                 "1.20.0",
+				ArchiveArchitectures:    []string{"linux-amd64"},
+				ArtifactBillOfMaterials: tt.enabled,
+			}})
+			testutil.AssertError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestImageSizeCheck(t *testing.T) {
+	release := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(release, "docker"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	sizes := map[string]int64{
+		"pilot-debug.tar.gz":            3 << 20,
+		"pilot-distroless.tar.gz":       1 << 20,
+		"pilot-distroless-arm64.tar.gz": 2 << 20,
+		"pilot-debug-arm64.tar.gz":      3 << 20,
+	}
+	for name, size := range sizes {
+		if err := os.WriteFile(filepath.Join(release, "docker", name), make([]byte, size), 0o640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cases := []struct {
+		name    string
+		limits  map[string]int
+		wantErr string
+	}{
+		{"no limits", nil, ""},
+		{"within limits", map[string]int{"*-distroless": 2, "pilot-debug": 3}, ""},
+		{"distroless over", map[string]int{"*-distroless": 1}, "image pilot-distroless-arm64 is 2.0 MiB, exceeding its limit of 1 MiB"},
+		{"lowest limit", map[string]int{"pilot-*": 4, "*-debug": 2}, "image pilot-debug is 3.0 MiB"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			r := ReleaseInfo{release: release, manifest: model.Manifest{
+				Architectures:   []string{"linux/amd64", "linux/arm64"},
+				DockerImages:    []string{"pilot-debug", "pilot-distroless"},
+				ImageSizeLimits: tt.limits,
+			}}
+			err := TestImageSize(r)
+			testutil.AssertError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestDockerAmbient(t *testing.T) {
+	cases := []struct {
+		name        string
+		skipAmbient bool
+		images      []string
+		files       []string
+		wantErr     string
+	}{
+		{"ambient", false, []string{"pilot-debug", "ztunnel-debug"}, []string{"pilot-debug", "ztunnel-debug"}, ""},
+		{"ambient missing ztunnel", false, []string{"pilot-debug", "ztunnel-debug"}, []string{"pilot-debug"}, "ambient is enabled, so ztunnel-debug is expected"},
+		{"no ambient", true, []string{"pilot-debug"}, []string{"pilot-debug"}, ""},
+		{"no ambient with ztunnel", true, []string{"pilot-debug"}, []string{"pilot-debug", "ztunnel-debug"}, "ambient is disabled, but found ambient image ztunnel-debug.tar.gz"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			release := t.TempDir()
+			if err := os.MkdirAll(filepath.Join(release, "docker"), 0o750); err != nil {
+				t.Fatal(err)
+			}
+			for _, f := range tt.files {
+				writeTestDockerImage(t, filepath.Join(release, "docker", f+".tar.gz"))
+			}
+			err := TestDocker(ReleaseInfo{release: release, manifest: model.Manifest{
+				Version:       "1.20.0",
+				Docker:        "docker.io/istio",
+				DockerImages:  tt.images,
+				Architectures: []string{"linux/amd64"},
+				SkipAmbient:   tt.skipAmbient,
+			}})
+			testutil.AssertError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestDockerRenamedImages(t *testing.T) {
+	manifest := model.Manifest{
+		Version:       "1.20.0",
+		Docker:        "docker.io/istio",
+		DockerImages:  []string{"pilot-distroless", "proxyv2-debug"},
+		Architectures: []string{"linux/amd64"},
+		ImageRenames:  map[string]string{"pilot": "istiod"},
+	}
+	for _, files := range [][]string{{"pilot-distroless", "proxyv2-debug"}, {"istiod-distroless", "proxyv2-debug"}} {
+		release := t.TempDir()
+		if err := os.MkdirAll(filepath.Join(release, "docker"), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range files {
+			writeTestDockerImage(t, filepath.Join(release, "docker", f+".tar.gz"))
+		}
+		err := TestDocker(ReleaseInfo{release: release, manifest: manifest})
+		if renamed := files[0] == "istiod-distroless"; renamed != (err == nil) {
+			t.Fatalf("%v: unexpected result %v", files, err)
+		}
+	}
+	r := ReleaseInfo{manifest: manifest}
+	if got := dockerContextReference(r, "pilot-distroless"); got != "docker.io/istio/istiod:1.20.0-distroless" {
+		t.Fatalf("expected renamed reference, got %v", got)
+	}
+}
+
+// TestChecksRegistered ensures every check function in the package is registered in Checks, as an unregistered check
+// silently never runs.
+func TestChecksRegistered(t *testing.T) {
+	registered := map[string]struct{}{}
+	for _, check := range Checks {
+		name := runtime.FuncForPC(reflect.ValueOf(check).Pointer()).Name()
+		registered[name[strings.LastIndex(name, ".")+1:]] = struct{}{}
+	}
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	found := 0
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv != nil || !strings.HasPrefix(fn.Name.Name, "Test") || !fn.Name.IsExported() {
+				continue
+			}
+			params := fn.Type.Params.List
+			if len(params) != 1 || len(params[0].Names) > 1 {
+				continue
+			}
+			if ident, ok := params[0].Type.(*ast.Ident); !ok || ident.Name != "ReleaseInfo" {
+				continue
+			}
+			found++
+			if _, f := registered[fn.Name.Name]; !f {
+				t.Errorf("%v in %v is not registered in Checks", fn.Name.Name, file)
+			}
+		}
+	}
+	if found != len(registered) {
+		t.Errorf("found %d check functions, but %d are registered", found, len(registered))
+	}
+}
+
+func TestHubTagOverride(t *testing.T) {
+	manifest := model.Manifest{Version: "1.20.0", Docker: "docker.io/istio"}
+	mirrored := []byte("global:\n  hub: mirror.example.com/istio\n  tag: 1.20.0\n")
+	retagged := []byte("global:\n  hub: mirror.example.com/istio\n  tag: 1.20.0-mirror\n")
+	cases := []struct {
+		name    string
+		hub     string
+		tag     string
+		values  []byte
+		wantErr bool
+	}{
+		{"manifest hub", "", "", mirrored, true},
+		{"hub override", "mirror.example.com/istio", "", mirrored, false},
+		{"hub override wrong tag", "mirror.example.com/istio", "", retagged, true},
+		{"hub and tag override", "mirror.example.com/istio", "1.20.0-mirror", retagged, false},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			r := ReleaseInfo{manifest: manifest, hub: tt.hub, tag: tt.tag}
+			if err := validateHubTag(r, tt.values, "global"); (err != nil) != tt.wantErr {
+				t.Fatalf("got err %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	r := ReleaseInfo{manifest: manifest, hub: "mirror.example.com/istio", tag: "1.20.0-mirror"}
+	if err := checkImage(r, "mirror.example.com/istio/pilot:1.20.0-mirror"); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkImage(r, "docker.io/istio/pilot:1.20.0"); err == nil {
+		t.Fatalf("expected error for image with the manifest hub")
+	}
+	if got, want := dockerContextReference(r, "pilot-distroless"), "mirror.example.com/istio/pilot:1.20.0-mirror-distroless"; got != want {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestMirrorRewrite(t *testing.T) {
+	manifest := model.Manifest{Version: "1.20.0", Docker: "docker.io/istio"}
+	mirrored := []byte("global:\n  hub: mirror.example.com/docker.io/istio\n  tag: 1.20.0\n")
+	cases := []struct {
+		name     string
+		rewrites []string
+		hub      string
+		want     string
+	}{
+		{"none", nil, "", "docker.io/istio"},
+		{"registry prefix", []string{"docker.io=mirror.example.com/docker.io"}, "", "mirror.example.com/docker.io/istio"},
+		{"whole hub", []string{"docker.io/istio=mirror.example.com/istio/"}, "", "mirror.example.com/istio"},
+		{"partial segment", []string{"docker.io/ist=mirror.example.com"}, "", "docker.io/istio"},
+		{"first match", []string{"gcr.io=other.example.com", "docker.io=mirror.example.com/docker.io", "docker.io=unused.example.com"}, "", "mirror.example.com/docker.io/istio"},
+		{"hub override wins", []string{"docker.io=mirror.example.com/docker.io"}, "override.example.com/istio", "override.example.com/istio"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			r := ReleaseInfo{manifest: manifest, hub: tt.hub}
+			for _, rw := range tt.rewrites {
+				parsed, err := ParseMirrorRewrite(rw)
+				if err != nil {
+					t.Fatal(err)
+				}
+				r.mirrorRewrites = append(r.mirrorRewrites, parsed)
+			}
+			if got := r.expectedHub(); got != tt.want {
+				t.Fatalf("expected hub %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"docker.io", "=mirror.example.com", "docker.io="} {
+		if _, err := ParseMirrorRewrite(invalid); err == nil {
+			t.Fatalf("expected error for %q", invalid)
+		}
+	}
+
+	r := ReleaseInfo{manifest: manifest, mirrorRewrites: []MirrorRewrite{{From: "docker.io", To: "mirror.example.com/docker.io"}}}
+	if err := validateHubTag(r, mirrored, "global"); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkImage(r, "docker.io/istio/pilot:1.20.0"); err == nil {
+		t.Fatalf("expected error for image with the manifest hub")
+	}
+	if got, want := dockerContextReference(r, "pilot-distroless"), "mirror.example.com/docker.io/istio/pilot:1.20.0-distroless"; got != want {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestArchiveChartsCheck(t *testing.T) {
+	cases := []struct {
+		name    string
+		skip    string
+		wantErr string
+	}{
+		{"complete", "", ""},
+		{"missing chart", "manifests/charts/istio-cni", "manifests/charts/istio-cni"},
+		{"missing profile", "manifests/profiles/default.yaml", "manifests/profiles/default.yaml"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := t.TempDir()
+			for _, p := range archiveManifestPaths {
+				if p == tt.skip {
+					continue
+				}
+				if err := os.MkdirAll(filepath.Dir(filepath.Join(archive, p)), 0o750); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(archive, p), []byte("test"), 0o640); err != nil {
+					t.Fatal(err)
+				}
+			}
+			r := ReleaseInfo{archive: archive, manifest: model.Manifest{ArchiveArchitectures: []string{"linux-amd64"}}}
+			err := TestArchiveCharts(r)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+			if Classify(err) != FailureMissingArtifact {
+				t.Fatalf("expected missing artifact, got %v", Classify(err))
+			}
+		})
+	}
+}
+
+func TestNonEmptyArtifactsCheck(t *testing.T) {
+	release := t.TempDir()
+	files := map[string]string{
+		"istio-1.20.0-linux-amd64.tar.gz": "archive",
+		"helm/base-1.20.0.tgz":            "",
+		"docker/pilot-distroless.tar.gz":  "",
+		"licenses/.gitkeep":               "",
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(release, name)), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(release, name), []byte(content), 0o640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := TestNonEmptyArtifacts(ReleaseInfo{release: release})
+	if err == nil {
+		t.Fatalf("expected error for empty files")
+	}
+	for _, want := range []string{"helm/base-1.20.0.tgz", "docker/pilot-distroless.tar.gz"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected error to list %v, got %v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), ".gitkeep") {
+		t.Fatalf("expected allowlisted file to be ignored, got %v", err)
+	}
+
+	for _, name := range []string{"helm/base-1.20.0.tgz", "docker/pilot-distroless.tar.gz"} {
+		if err := os.WriteFile(filepath.Join(release, name), []byte("fixed"), 0o640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := TestNonEmptyArtifacts(ReleaseInfo{release: release}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadImageFromRegistry(t *testing.T) {
+	var pulled []string
+	pullErr := error(nil)
+	orig := dockerPull
+	dockerPull = func(image string) error {
+		pulled = append(pulled, image)
+		return pullErr
+	}
+	t.Cleanup(func() { dockerPull = orig })
+
+	r := ReleaseInfo{
+		// No docker archives in the release; images must come from the registry
+		release:     t.TempDir(),
+		imageSource: ImageSourceRegistry,
+		manifest:    model.Manifest{Version: "1.20.0", Docker: "docker.io/istio"},
+	}
+	for _, image := range []string{"proxyv2-debug", "pilot-distroless"} {
+		ref, err := loadImage(r, image)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ref != pulled[len(pulled)-1] {
+			t.Fatalf("expected to run the pulled image %v, got %v", pulled[len(pulled)-1], ref)
+		}
+	}
+	expected := []string{"docker.io/istio/proxyv2:1.20.0", "docker.io/istio/pilot:1.20.0-distroless"}
+	if !reflect.DeepEqual(pulled, expected) {
+		t.Fatalf("expected pulls %v, got %v", expected, pulled)
+	}
+
+	pullErr = &ErrCommandFailed{Command: "docker pull", Err: errors.New("unauthorized")}
+	_, err := loadImage(r, "proxyv2-debug")
+	if err == nil || !strings.Contains(err.Error(), "logged in to docker.io/istio") {
+		t.Fatalf("expected pull error with login hint, got %v", err)
+	}
+	if Classify(err) != FailureCommandFailed {
+		t.Fatalf("expected command failure, got %v", Classify(err))
+	}
+
+	r.imageSource = ImageSourceRelease
+	pulled = nil
+	if _, err := loadImage(r, "proxyv2-debug"); Classify(err) != FailureMissingArtifact {
+		t.Fatalf("expected missing archive from release, got %v", err)
+	}
+	if len(pulled) != 0 {
+		t.Fatalf("expected no pulls loading from the release, got %v", pulled)
+	}
+
+	// Releases without amd64 images load the image of another architecture
+	r.manifest.Architectures = []string{"linux/s390x"}
+	var missing *ErrMissingArtifact
+	if _, err := loadImage(r, "proxyv2-debug"); !errors.As(err, &missing) || !strings.HasSuffix(missing.Path, "proxyv2-debug-s390x.tar.gz") {
+		t.Fatalf("expected missing s390x archive, got %v", err)
+	}
+	r.manifest.DockerOutput = model.DockerOutputContext
+	if ref, err := loadImage(r, "proxyv2-debug"); err != nil || ref != "docker.io/istio/proxyv2:1.20.0-s390x" {
+		t.Fatalf("expected s390x image from the docker context, got %v, %v", ref, err)
+	}
+}
+
+// writeElfHeader writes a file with only an ELF header, for the class and machine
+func writeElfHeader(t *testing.T, file string, class elf.Class, machine elf.Machine) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(file), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	ident := [elf.EI_NIDENT]byte{0x7f, 'E', 'L', 'F', byte(class), byte(elf.ELFDATA2LSB), byte(elf.EV_CURRENT)}
+	buf := &bytes.Buffer{}
+	var header any = &elf.Header64{Ident: ident, Type: uint16(elf.ET_EXEC), Machine: uint16(machine), Version: uint32(elf.EV_CURRENT)}
+	if class == elf.ELFCLASS32 {
+		header = &elf.Header32{Ident: ident, Type: uint16(elf.ET_EXEC), Machine: uint16(machine), Version: uint32(elf.EV_CURRENT)}
+	}
+	if err := binary.Write(buf, binary.LittleEndian, header); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, buf.Bytes(), 0o750); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIstioctlGitTagCheck(t *testing.T) {
+	cases := []struct {
+		name    string
+		version string
+		output  string
+		wantErr bool
+	}{
+		{"ga", "1.20.0", `{"clientVersion":{"version":"1.20.0","tag":"1.20.0"}}`, false},
+		{"ga without tag", "1.20.0", `{"clientVersion":{"version":"1.20.0","tag":""}}`, true},
+		{"ga with wrong tag", "1.20.0", `{"clientVersion":{"version":"1.20.0","tag":"1.19.0"}}`, true},
+		{"prerelease without tag", "1.20.0-beta.1", `{"clientVersion":{"version":"1.20.0-beta.1"}}`, false},
+		{"prerelease", "1.20.0-beta.1", `{"clientVersion":{"version":"1.20.0-beta.1","tag":"1.20.0-beta.1"}}`, false},
+		{"dev without tag", "master", `{"clientVersion":{"version":"master","tag":""}}`, false},
+		{"dev with wrong tag", "master", `{"clientVersion":{"version":"master","tag":"1.19.0"}}`, true},
+		{"no client version", "1.20.0", `{}`, true},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := clientVersion(util.RunOptions{}, "echo", tt.output)
+			if err == nil {
+				err = checkGitTag(tt.version, v.GitTag)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got err %v, want error %v", err, tt.wantErr)
+			}
+			var e *ErrVersionMismatch
+			if err != nil && v != nil && (!errors.As(err, &e) || e.Expected != tt.version || e.Got != v.GitTag) {
+				t.Fatalf("expected version mismatch reporting the expected and actual git tag, got %v", err)
+			}
+		})
+	}
+}
+
+func TestIstioctlCommandsCheck(t *testing.T) {
+	help := `case "$*" in
+"--help") echo "Available Commands:"; echo "  analyze"; echo "  install"; echo "  proxy-config"; echo "  uninstall"; echo "  version" ;;
+"install --help") echo "  -f, --filename strings"; echo "  -s, --set stringArray" ;;
+"version --remote=false") echo "1.20.0" ;;
+*) exit 1 ;;
+esac
+`
+	cases := []struct {
+		name    string
+		script  string
+		wantErr string
+	}{
+		{"complete", help, ""},
+		{"missing subcommand", strings.Replace(help, `echo "  proxy-config"; `, "", 1), "istioctl --help output is missing proxy-config"},
+		{"broken subcommand", strings.Replace(help, `"install --help") echo "  -f, --filename strings"; echo "  -s, --set stringArray" ;;`, "", 1), "istioctl install --help failed"},
+		{"wrong version", strings.Replace(help, `echo "1.20.0"`, `echo "1.19.0"`, 1), "istioctl version --remote=false output is missing 1.20.0"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := t.TempDir()
+			if err := os.MkdirAll(filepath.Join(archive, "bin"), 0o750); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(archive, "bin", "istioctl"), []byte("#!/bin/sh\n"+tt.script), 0o750); err != nil {
+				t.Fatal(err)
+			}
+			err := TestIstioctlCommands(ReleaseInfo{archive: archive, manifest: model.Manifest{Version: "1.20.0"}})
+			testutil.AssertError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestIstioctlElfCheck(t *testing.T) {
+	cases := []struct {
+		name    string
+		class   elf.Class
+		machine elf.Machine
+		wantErr string
+	}{
+		{"armv7", elf.ELFCLASS32, elf.EM_ARM, ""},
+		{"64-bit armv7", elf.ELFCLASS64, elf.EM_AARCH64, "got EM_AARCH64 ELFCLASS64 expected EM_ARM ELFCLASS32"},
+		{"wrong machine", elf.ELFCLASS32, elf.EM_386, "got EM_386 ELFCLASS32 expected EM_ARM ELFCLASS32"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			r := ReleaseInfo{
+				release:  t.TempDir(),
+				tmpDir:   t.TempDir(),
+				archive:  t.TempDir(),
+				manifest: model.Manifest{Version: "1.20.0", ArchiveArchitectures: []string{"linux-amd64", "linux-armv7", "osx-amd64"}},
+			}
+			writeElfHeader(t, filepath.Join(r.archive, "bin", "istioctl"), elf.ELFCLASS64, elf.EM_X86_64)
+			src := t.TempDir()
+			writeElfHeader(t, filepath.Join(src, "istio-1.20.0", "bin", "istioctl"), tt.class, tt.machine)
+			if err := util.TarGz(src, filepath.Join(r.release, "istio-1.20.0-linux-armv7.tar.gz"), gzip.DefaultCompression, "istio-1.20.0"); err != nil {
+				t.Fatal(err)
+			}
+			err := TestIstioctlElf(r)
+			testutil.AssertError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestLineEndingsCheck(t *testing.T) {
+	files := map[string]string{
+		"tools/istioctl.bash":              "complete -F _istioctl istioctl\n",
+		"tools/_istioctl":                  "#compdef istioctl\r\n",
+		"samples/bookinfo/platform/run.sh": "#!/bin/bash\r\necho\r\n",
+		"samples/certs/generate.sh":        "#!/bin/bash\n",
+		"samples/README.md":                "windows\r\n",
+	}
+	archive := t.TempDir()
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(archive, name)), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(archive, name), []byte(content), 0o640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cases := []struct {
+		name     string
+		patterns []string
+		wantErr  []string
+	}{
+		{"default", nil, []string{"tools/_istioctl", "samples/bookinfo/platform/run.sh"}},
+		{"configured", []string{"tools/*"}, []string{"tools/_istioctl"}},
+		{"clean", []string{"tools/istioctl.bash", "samples/certs/*.sh"}, nil},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := TestLineEndings(ReleaseInfo{archive: archive, lineEndingFiles: tt.patterns})
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected error listing %v", tt.wantErr)
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Fatalf("expected error to list %v, got %v", want, err)
+				}
+			}
+			if strings.Contains(err.Error(), "README.md") {
+				t.Fatalf("expected files not matching the patterns to be ignored, got %v", err)
+			}
+		})
+	}
+}
+
+func TestGzipLevelCheck(t *testing.T) {
+	var content strings.Builder
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&content, "line %d of %d\n", i*i%997, i)
+	}
+	cases := []struct {
+		name     string
+		level    int
+		written  map[string]int
+		wantErr  []string
+		noErrFor []string
+	}{
+		{
+			name:    "matching",
+			level:   gzip.BestCompression,
+			written: map[string]int{"istio-1.2.3-linux-amd64.tar.gz": gzip.BestCompression, "licenses/istio.tar.gz": gzip.BestCompression},
+		},
+		{
+			name:     "drifted",
+			level:    gzip.BestCompression,
+			written:  map[string]int{"istio-1.2.3-linux-amd64.tar.gz": gzip.BestCompression, "licenses/istio.tar.gz": gzip.BestSpeed},
+			wantErr:  []string{"gzip level 9", "licenses/istio.tar.gz"},
+			noErrFor: []string{"istio-1.2.3-linux-amd64.tar.gz"},
+		},
+		{
+			name:    "not recorded",
+			written: map[string]int{"istio-1.2.3-linux-amd64.tar.gz": gzip.BestSpeed},
+		},
+		{name: "missing", level: gzip.BestCompression, wantErr: []string{"*.tar.gz"}},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			release := t.TempDir()
+			src := filepath.Join(t.TempDir(), "archive.tar")
+			if err := os.WriteFile(src, []byte(content.String()), 0o640); err != nil {
+				t.Fatal(err)
+			}
+			for name, level := range tt.written {
+				if err := os.MkdirAll(filepath.Dir(filepath.Join(release, name)), 0o750); err != nil {
+					t.Fatal(err)
+				}
+				if err := util.GzipFile(src, filepath.Join(release, name), level); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := TestGzipLevel(ReleaseInfo{release: release, manifest: model.Manifest{GzipLevel: tt.level}})
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected error listing %v", tt.wantErr)
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Fatalf("expected error to list %v, got %v", want, err)
+				}
+			}
+			for _, unwanted := range tt.noErrFor {
+				if strings.Contains(err.Error(), unwanted) {
+					t.Fatalf("expected %v to be accepted, got %v", unwanted, err)
+				}
+			}
+		})
+	}
+}
+
+func TestSamplesYamlCheck(t *testing.T) {
+	cases := []struct {
+		name       string
+		samplesDir string
+		files      map[string]string
+		wantErr    []string
+	}{
+		{
+			name: "valid",
+			files: map[string]string{
+				"samples/hello/hello.yaml":  "kind: Service\n---\nkind: Deployment\n--- # trailing comment\n",
+				"samples/hello/README.md":   "not: [yaml",
+				"manifests/broken.yaml":     "not: [yaml",
+				"samples/hello/empty.yaml":  "",
+				"samples/certs/config.yaml": "---\nkind: Secret\n",
+			},
+		},
+		{
+			name: "invalid",
+			files: map[string]string{
+				"samples/hello/hello.yaml":    "kind: Service\n---\nkind: [Deployment\n",
+				"samples/addons/grafana.yaml": "metadata:\n\tname: grafana\n",
+				"samples/addons/kiali.yaml":   "kind: ConfigMap\n",
+			},
+			wantErr: []string{"samples/hello/hello.yaml document 2", "samples/addons/grafana.yaml document 1"},
+		},
+		{
+			name:       "relocated",
+			samplesDir: "share/samples",
+			files:      map[string]string{"share/samples/hello.yaml": "kind: {Service\n"},
+			wantErr:    []string{"share/samples/hello.yaml"},
+		},
+		{name: "missing", wantErr: []string{"samples"}},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := t.TempDir()
+			for name, content := range tt.files {
+				if err := os.MkdirAll(filepath.Dir(filepath.Join(archive, name)), 0o750); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(archive, name), []byte(content), 0o640); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := TestSamplesYaml(ReleaseInfo{archive: archive, samplesDir: tt.samplesDir})
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected error listing %v", tt.wantErr)
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Fatalf("expected error to list %v, got %v", want, err)
+				}
+			}
+			if strings.Contains(err.Error(), "kiali.yaml") {
+				t.Fatalf("expected valid files to be accepted, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMatchFilePattern(t *testing.T) {
+	cases := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"tools/_istioctl", "tools/_istioctl", true},
+		{"samples/**/*.sh", "samples/run.sh", true},
+		{"samples/**/*.sh", "samples/a/b/run.sh", true},
+		{"samples/**/*.sh", "tools/run.sh", false},
+		{"samples/**/*.sh", "samples/a/run.bash", false},
+		{"samples/*.sh", "samples/a/run.sh", false},
+	}
+	for _, tt := range cases {
+		if got := matchFilePattern(tt.pattern, tt.name); got != tt.match {
+			t.Errorf("matchFilePattern(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.match)
+		}
+	}
+}
+
+func TestThirdPartyNoticesCheck(t *testing.T) {
+	complete := "k8s.io/client-go v0.28.3\n\tLicense: Apache-2.0\n" +
+		"google.golang.org/grpc v1.59.0\n\tLicense: Apache-2.0\n" +
+		"github.com/envoyproxy/go-control-plane v0.11.2\n\tLicense: Apache-2.0\n"
+	cases := []struct {
+		name    string
+		enabled bool
+		notices string
+		wantErr string
+	}{
+		{"disabled", false, "", ""},
+		{"complete", true, complete, ""},
+		{"missing file", true, "", "THIRD_PARTY_NOTICES.txt"},
+		{"missing dependency", true, strings.Replace(complete, "k8s.io/client-go", "k8s.io/api", 1), "does not list k8s.io/client-go"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := t.TempDir()
+			if tt.notices != "" {
+				if err := os.WriteFile(filepath.Join(archive, "THIRD_PARTY_NOTICES.txt"), []byte(tt.notices), 0o640); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := TestThirdPartyNotices(ReleaseInfo{archive: archive, manifest: model.Manifest{ThirdPartyNotices: tt.enabled}})
+			testutil.AssertError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestVersionConsistencyCheck(t *testing.T) {
+	orig := packageVersion
+	t.Cleanup(func() { packageVersion = orig })
+
+	// writeRelease writes a release with each artifact embedding its version from versions, defaulting to 1.20.0
+	writeRelease := func(t *testing.T, versions map[string]string) string {
+		v := func(kind string) string {
+			if version, f := versions[kind]; f {
+				return version
+			}
+			return "1.20.0"
+		}
+		release := t.TempDir()
+		for _, dir := range []string{"helm", "docker", "deb", "istio-1.20.0/manifests/profiles"} {
+			if err := os.MkdirAll(filepath.Join(release, dir), 0o750); err != nil {
+				t.Fatal(err)
+			}
+		}
+		files := map[string]string{
+			"istio-1.20.0/manifests/profiles/default.yaml": "spec:\n  tag: " + v("profile") + "\n",
+			"istio-sources.spdx":                           "SPDXVersion: SPDX-2.3\nDocumentName: Istio Source " + v("sbom") + "\n",
+			"deb/istio-sidecar.deb":                        "deb",
+		}
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(release, name), []byte(content), 0o640); err != nil {
+				t.Fatal(err)
+			}
+		}
+		testutil.WriteArchive(t, filepath.Join(release, "istio-"+v("archive")+"-linux-amd64.tar.gz"), testutil.Empty("istio/README.md")...)
+		testutil.WriteArchive(t, filepath.Join(release, "helm", "istiod-1.20.0.tgz"), testutil.Files(map[string]string{
+			"istiod/Chart.yaml":             "name: istiod\nversion: " + v("chart") + "\n",
+			"istiod/values.yaml":            "_internal_defaults_do_not_set:\n  global:\n    tag: " + v("values") + "\n",
+			"istiod/charts/sub/Chart.yaml":  "name: sub\nversion: 0.0.1\n",
+			"istiod/charts/sub/values.yaml": "global:\n  tag: 0.0.1\n",
+		})...)
+		for _, suffix := range []string{"", "-arm64"} {
+			testutil.WriteImage(t, filepath.Join(release, "docker", "pilot-distroless"+suffix+".tar.gz"), `{"config":{}}`,
+				[]string{"docker.io/istio/pilot:" + v("image") + "-distroless" + suffix})
+		}
+		packageVersion = func(model.ArtifactCategory, string) (string, error) {
+			return v("deb") + "-1", nil
+		}
+		return release
+	}
+
+	cases := []struct {
+		name     string
+		versions map[string]string
+		wantErr  []string
+	}{
+		{name: "consistent"},
+		{
+			name:     "partial bump",
+			versions: map[string]string{"chart": "1.20.1", "image": "1.20.1", "deb": "1.20.1"},
+			wantErr: []string{
+				`chart version of istiod-1.20.0.tgz is "1.20.1"`,
+				`image tag of pilot-distroless.tar.gz is "1.20.1"`,
+				`image tag of pilot-distroless-arm64.tar.gz is "1.20.1"`,
+				`deb package version of istio-sidecar.deb is "1.20.1-1"`,
+			},
+		},
+		{
+			name:     "stale",
+			versions: map[string]string{"archive": "1.19.0", "values": "1.19.0", "profile": "1.19.0", "sbom": "1.19.0"},
+			wantErr: []string{
+				`archive name of istio-1.19.0-linux-amd64.tar.gz is "1.19.0"`,
+				`chart values tag of istiod-1.20.0.tgz is "1.19.0"`,
+				`profile tag of manifests/profiles/default.yaml is "1.19.0"`,
+				`SBOM name of istio-sources.spdx is "1.19.0"`,
+			},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			release := writeRelease(t, tt.versions)
+			r := ReleaseInfo{
+				release: release,
+				archive: filepath.Join(release, "istio-1.20.0"),
+				hub:     "mirror.example.com/istio",
+				manifest: model.Manifest{
+					Version:       "1.20.0",
+					Docker:        "docker.io/istio",
+					DockerOutput:  model.DockerOutputTar,
+					Architectures: []string{"linux/amd64", "linux/arm64"},
+					DockerImages:  []string{"pilot-distroless"},
+				},
+			}
+			err := TestVersionConsistency(r)
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected error")
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected error containing %q, got %v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestPackageInstallCheck(t *testing.T) {
+	release := t.TempDir()
+	manifest := model.Manifest{Architectures: []string{"linux/amd64", "linux/arm64"}}
+	r := ReleaseInfo{release: release, manifest: manifest, installPackages: true}
+	installed := map[string]string{}
+	failing := ""
+	orig := runPackageInstall
+	runPackageInstall = func(platform, image, dir, script string) (string, error) {
+		installed[platform+" "+image] = script
+		if dir != r.artifactDir(model.DebianArtifacts) && dir != r.artifactDir(model.RpmArtifacts) {
+			t.Fatalf("unexpected package directory %v", dir)
+		}
+		if platform+" "+image == failing {
+			return "E: Unmet dependencies. istio-sidecar : Depends: iptables", errors.New("exit status 100")
+		}
+		return "", nil
+	}
+	t.Cleanup(func() { runPackageInstall = orig })
+
+	if err := TestPackageInstall(ReleaseInfo{release: release, manifest: manifest}); err != nil || len(installed) > 0 {
+		t.Fatalf("expected check to be skipped unless enabled, got %v", err)
+	}
+	if err := TestPackageInstall(r); err == nil || !strings.Contains(err.Error(), "istio-sidecar.deb") {
+		t.Fatalf("expected missing deb, got %v", err)
+	}
+	for _, f := range []string{"deb/istio-sidecar.deb", "rpm/istio-sidecar.rpm", "deb/istio-sidecar-arm64.deb"} {
+		testutil.WriteFile(t, filepath.Join(release, f), "package")
+	}
+	if err := TestPackageInstall(r); err == nil || !strings.Contains(err.Error(), "istio-sidecar-arm64.rpm") {
+		t.Fatalf("expected missing arm64 rpm, got %v", err)
+	}
+	testutil.WriteFile(t, filepath.Join(release, "rpm", "istio-sidecar-arm64.rpm"), "package")
+	if err := TestPackageInstall(r); err != nil {
+		t.Fatal(err)
+	}
+	deb := installed["linux/amd64 debian:bookworm-slim"]
+	if !strings.Contains(deb, "apt-get install -y -qq /release/istio-sidecar.deb") || !strings.Contains(deb, "test -e /usr/local/bin/pilot-agent") {
+		t.Fatalf("expected deb install and sidecar file checks, got %q", deb)
+	}
+	if deb := installed["linux/arm64 debian:bookworm-slim"]; !strings.Contains(deb, "apt-get install -y -qq /release/istio-sidecar-arm64.deb") {
+		t.Fatalf("expected arm64 deb install, got %q", deb)
+	}
+	if rpm := installed["linux/amd64 registry.access.redhat.com/ubi9/ubi"]; !strings.Contains(rpm, "dnf install -y -q /release/istio-sidecar.rpm") {
+		t.Fatalf("expected rpm install, got %q", rpm)
+	}
+	if rpm := installed["linux/arm64 registry.access.redhat.com/ubi9/ubi"]; !strings.Contains(rpm, "dnf install -y -q /release/istio-sidecar-arm64.rpm") {
+		t.Fatalf("expected arm64 rpm install, got %q", rpm)
+	}
+
+	failing = "linux/arm64 debian:bookworm-slim"
+	err := TestPackageInstall(r)
+	if err == nil || !strings.Contains(err.Error(), "in debian") || !strings.Contains(err.Error(), "linux/arm64") ||
+		!strings.Contains(err.Error(), "Unmet dependencies") {
+		t.Fatalf("expected install error reporting the distro, platform and output, got %v", err)
+	}
+}
+
+func TestSidecarPackagesCheck(t *testing.T) {
+	orig := packageArch
+	t.Cleanup(func() { packageArch = orig })
+	arches := map[string]string{
+		"deb/istio-sidecar.deb":       "amd64",
+		"deb/istio-sidecar-arm64.deb": "arm64",
+		"rpm/istio-sidecar.rpm":       "x86_64",
+		"rpm/istio-sidecar-arm64.rpm": "aarch64",
+	}
+	cases := []struct {
+		name   string
+		modify func(release string)
+		err    string
+	}{
+		{"multi-arch", func(string) {}, ""},
+		{"missing arch", func(release string) {
+			if err := os.Remove(filepath.Join(release, "rpm", "istio-sidecar-arm64.rpm")); err != nil {
+				t.Fatal(err)
+			}
+		}, "istio-sidecar-arm64.rpm"},
+		{"wrong arch", func(string) {
+			arches["deb/istio-sidecar-arm64.deb"] = "amd64"
+		}, "istio-sidecar-arm64.deb has architecture amd64, expected arm64"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			release := t.TempDir()
+			for f := range arches {
+				if err := os.MkdirAll(filepath.Dir(filepath.Join(release, f)), 0o750); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(release, f), []byte("package"), 0o640); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tt.modify(release)
+			packageArch = func(_ model.ArtifactCategory, file string) (string, error) {
+				rel, err := filepath.Rel(release, file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return arches[filepath.ToSlash(rel)], nil
+			}
+			r := ReleaseInfo{release: release, manifest: model.Manifest{Architectures: []string{"linux/amd64", "linux/arm64"}}}
+			err := errors.Join(TestDebian(r), TestRpm(r))
+			if tt.err == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestDownloadScriptCheck(t *testing.T) {
+	script := "#!/bin/sh\nVERSION=\"1.20.0\"\necho \"${VERSION}\"\n"
+	cases := []struct {
+		name    string
+		script  string
+		mode    os.FileMode
+		wantErr string
+	}{
+		{"valid", script, 0o755, ""},
+		{"missing", "", 0, model.DownloadScriptFile},
+		{"empty", "", 0o755, "is empty"},
+		{"not executable", script, 0o644, "is not executable"},
+		{"wrong version", strings.Replace(script, "1.20.0", "1.19.0", 1), 0o755, "does not download version 1.20.0"},
+		{"invalid syntax", script + "if then\n", 0o755, "is not a valid shell script"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			release := t.TempDir()
+			if tt.mode != 0 {
+				if err := os.WriteFile(filepath.Join(release, model.DownloadScriptFile), []byte(tt.script), tt.mode); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := TestDownloadScript(ReleaseInfo{release: release, manifest: model.Manifest{Version: "1.20.0"}})
+			testutil.AssertError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestBuildStepChecks(t *testing.T) {
+	checks := map[string]func(ReleaseInfo) error{
+		"ReleaseNotes":   TestReleaseNotes,
+		"DownloadScript": TestDownloadScript,
+		"ReleaseIndex":   TestReleaseIndex,
+	}
+	for name, check := range checks {
+		t.Run(name, func(t *testing.T) {
+			r := ReleaseInfo{release: t.TempDir(), manifest: model.Manifest{Version: "1.20.0", BuildSteps: []model.BuildStep{model.StepDocker}}}
+			if err := check(r); err != nil {
+				t.Fatalf("expected the check to be skipped without its step, got %v", err)
+			}
+			r.manifest.BuildSteps = []model.BuildStep{model.StepMetadata, model.StepIndex}
+			if err := check(r); Classify(err) != FailureMissingArtifact {
+				t.Fatalf("expected missing artifact with its step, got %v", err)
+			}
+		})
+	}
+}
+
+func TestIstioctlStrippedCheck(t *testing.T) {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("building the linux-amd64 istioctl requires a linux amd64 host")
+	}
+	src := t.TempDir()
+	main := `package main
+
+import "fmt"
+
+var version = "unknown"
+
+func main() {
+	fmt.Printf("{\"clientVersion\":{\"version\":%q}}\n", version)
+}
+`
+	if err := os.WriteFile(filepath.Join(src, "main.go"), []byte(main), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name    string
+		ldflags string
+		wantErr string
+	}{
+		{"stripped", "-s -w", ""},
+		{"unstripped", "", "linux-amd64 istioctl is not stripped"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := t.TempDir()
+			istioctl := filepath.Join(archive, "bin", "istioctl")
+			build := exec.Command("go", "build", "-o", istioctl, "-ldflags", tt.ldflags+" -X main.version=1.20.0", "main.go")
+			build.Dir = src
+			build.Env = append(os.Environ(), "CGO_ENABLED=0", "GO111MODULE=off")
+			if out, err := build.CombinedOutput(); err != nil {
+				t.Fatalf("failed to build istioctl: %v: %s", err, out)
+			}
+			r := ReleaseInfo{archive: archive, manifest: model.Manifest{
+				Version:              "1.20.0",
+				StripIstioctl:        true,
+				ArchiveArchitectures: []string{"linux-amd64"},
+			}}
+			// The version is stamped whether or not the binary is stripped
+			if err := TestIstioctlArchive(r); err != nil {
+				t.Fatal(err)
+			}
+			err := TestIstioctlStripped(r)
+			testutil.AssertError(t, err, tt.wantErr)
+		})
+	}
+
+	r := ReleaseInfo{archive: t.TempDir(), manifest: model.Manifest{ArchiveArchitectures: []string{"linux-amd64"}}}
+	if err := TestIstioctlStripped(r); err != nil {
+		t.Fatalf("expected check to be skipped unless the manifest strips istioctl, got %v", err)
+	}
+}
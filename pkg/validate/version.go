@@ -0,0 +1,312 @@
+// Copyright Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"istio.io/istio/pkg/log"
+	"sigs.k8s.io/yaml"
+
+	"github.com/alauda-mesh/release-builder/pkg/model"
+	"github.com/alauda-mesh/release-builder/pkg/util"
+)
+
+// artifactVersion is a version embedded in an artifact
+type artifactVersion struct {
+	// Kind is where the version was found, such as "chart values tag"
+	Kind     string
+	Artifact string
+	Version  string
+}
+
+// versionExtractors find the versions embedded in each type of artifact in a release
+var versionExtractors = []func(r ReleaseInfo) ([]artifactVersion, error){
+	archiveVersions,
+	chartVersions,
+	profileVersions,
+	imageVersions,
+	packageVersions,
+	sbomVersions,
+}
+
+// TestVersionConsistency checks the version embedded in every artifact, such as archive names, chart versions and
+// tags, image tags, packages and SBOMs, is the manifest version. This catches a partial version bump. Every
+// divergent artifact is reported. Missing artifacts are left to the checks for each artifact.
+func TestVersionConsistency(r ReleaseInfo) error {
+	divergent := []string{}
+	for _, extract := range versionExtractors {
+		versions, err := extract(r)
+		if err != nil {
+			return err
+		}
+		for _, v := range versions {
+			if v.Version != r.manifest.Version {
+				divergent = append(divergent, fmt.Sprintf("%v of %v is %q", v.Kind, v.Artifact, v.Version))
+			}
+		}
+	}
+	if len(divergent) > 0 {
+		return fmt.Errorf("artifacts do not have version %v: %v", r.manifest.Version, strings.Join(divergent, ", "))
+	}
+	return nil
+}
+
+// releaseArchiveRegex matches the name of an istio, istio-tools or istioctl archive, capturing the version
+var releaseArchiveRegex = regexp.MustCompile(`^istio(?:ctl|-tools)?-(.+)-(?:(?:linux|osx|win)-[a-z0-9]+|osx|win)\.(?:tar\.gz|tar|zip)$`)
+
+// archiveVersions returns the versions in the names of the istio, istio-tools and istioctl archives
+func archiveVersions(r ReleaseInfo) ([]artifactVersion, error) {
+	entries, err := os.ReadDir(r.release)
+	if err != nil {
+		return nil, missingArtifact(r.release, err)
+	}
+	versions := []artifactVersion{}
+	for _, e := range entries {
+		if m := releaseArchiveRegex.FindStringSubmatch(e.Name()); m != nil && !e.IsDir() {
+			versions = append(versions, artifactVersion{Kind: "archive name", Artifact: e.Name(), Version: m[1]})
+		}
+	}
+	return versions, nil
+}
+
+// chartTagPaths are the paths of the image tag in the values of the charts setting one
+var chartTagPaths = [][]string{
+	{"global", "tag"},
+	{"_internal_defaults_do_not_set", "global", "tag"},
+	{"_internal_defaults_do_not_set", "tag"},
+}
+
+// chartVersions returns the version in the name, Chart.yaml and values tag of each helm chart
+func chartVersions(r ReleaseInfo) ([]artifactVersion, error) {
+	dir := r.artifactDir(model.HelmArtifacts)
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	versions := []artifactVersion{}
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".tgz") {
+			continue
+		}
+		var chart struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		}
+		var values map[string]interface{}
+		err := walkArchive(filepath.Join(dir, e.Name()), func(name string, _ os.FileMode, rd io.Reader) error {
+			// Only the files of the chart itself, not its subcharts, are read
+			if strings.Count(name, "/") != 1 {
+				return nil
+			}
+			var err error
+			switch filepath.Base(name) {
+			case "Chart.yaml":
+				var by []byte
+				if by, err = io.ReadAll(rd); err == nil {
+					err = yaml.Unmarshal(by, &chart)
+				}
+			case "values.yaml":
+				var by []byte
+				if by, err = io.ReadAll(rd); err == nil {
+					values, err = getValues(by)
+				}
+			}
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read chart %v: %v", e.Name(), err)
+		}
+		versions = append(versions,
+			artifactVersion{Kind: "chart file name", Artifact: e.Name(), Version: strings.TrimPrefix(strings.TrimSuffix(e.Name(), ".tgz"), chart.Name+"-")},
+			artifactVersion{Kind: "chart version", Artifact: e.Name(), Version: chart.Version})
+		for _, p := range chartTagPaths {
+			if tag, err := (GenericMap{values}).Path(p); err == nil && tag != nil {
+				versions = append(versions, artifactVersion{Kind: "chart values tag", Artifact: e.Name(), Version: fmt.Sprint(tag)})
+				break
+			}
+		}
+	}
+	return versions, nil
+}
+
+// profileVersions returns the tag of the default profile in the archive
+func profileVersions(r ReleaseInfo) ([]artifactVersion, error) {
+	f := filepath.Join(r.archive, model.ArchiveDefaultProfile)
+	by, err := os.ReadFile(f)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	values, err := getValues(by)
+	if err != nil {
+		return nil, err
+	}
+	tag, err := GenericMap{values}.Path([]string{"spec", "tag"})
+	if err != nil || tag == nil {
+		return nil, nil
+	}
+	return []artifactVersion{{Kind: "profile tag", Artifact: model.ArchiveDefaultProfile, Version: fmt.Sprint(tag)}}, nil
+}
+
+// imageVersions returns the version in the tags of each docker image saved to the release. The variant and
+// architecture suffixes are not part of the version.
+func imageVersions(r ReleaseInfo) ([]artifactVersion, error) {
+	if r.manifest.DockerOutput == model.DockerOutputContext {
+		return nil, nil
+	}
+	// The suffix following the version in the tag of each image archive, such as -distroless-arm64
+	built := r
+	built.hub, built.tag = "", ""
+	tagSuffixes := map[string]string{}
+	for _, plat := range r.manifest.GetDockerArchitectures() {
+		suffix, err := util.ImageArchSuffix(plat)
+		if err != nil {
+			return nil, err
+		}
+		for _, image := range r.manifest.DockerImages {
+			ref := dockerContextReference(built, image) + suffix
+			tag := ref[strings.LastIndex(ref, ":")+1:]
+			tagSuffixes[r.manifest.ShippedImage(image)+suffix+".tar.gz"] = strings.TrimPrefix(tag, r.manifest.Version)
+		}
+	}
+	versions := []artifactVersion{}
+	for name, suffix := range tagSuffixes {
+		archive := filepath.Join(r.artifactDir(model.DockerArtifacts), name)
+		if !util.FileExists(archive) {
+			continue
+		}
+		tags, err := util.ImageRepoTags(archive)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", name, err)
+		}
+		for _, ref := range tags {
+			tag := ref[strings.LastIndex(ref, ":")+1:]
+			versions = append(versions, artifactVersion{Kind: "image tag", Artifact: name, Version: strings.TrimSuffix(tag, suffix)})
+		}
+	}
+	return versions, nil
+}
+
+// packageVersion returns the version of a deb or rpm package, using the package tools
+var packageVersion = func(kind model.ArtifactCategory, file string) (string, error) {
+	return queryPackage(kind, file, "Version", "VERSION")
+}
+
+// packageArch returns the architecture of a deb or rpm package, using the package tools
+var packageArch = func(kind model.ArtifactCategory, file string) (string, error) {
+	return queryPackage(kind, file, "Architecture", "ARCH")
+}
+
+// queryPackage returns a control field of a deb package, or a tag of an rpm package. If the package tool is not
+// installed, it returns an empty string.
+func queryPackage(kind model.ArtifactCategory, file, field, tag string) (string, error) {
+	cmd := exec.Command("dpkg-deb", "-f", file, field)
+	if kind == model.RpmArtifacts {
+		cmd = exec.Command("rpm", "-qp", "--queryformat", "%{"+tag+"}", file)
+	}
+	if _, err := exec.LookPath(cmd.Path); err != nil {
+		log.Infof("Skipping %v of %v; %v is not installed", field, file, cmd.Args[0])
+		return "", nil
+	}
+	buf := bytes.Buffer{}
+	cmd.Stdout = &buf
+	if err := cmd.Run(); err != nil {
+		return "", commandFailed(cmd, err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// packageVersions returns the version of each deb and rpm package
+func packageVersions(r ReleaseInfo) ([]artifactVersion, error) {
+	versions := []artifactVersion{}
+	for _, kind := range []model.ArtifactCategory{model.DebianArtifacts, model.RpmArtifacts} {
+		dir := r.artifactDir(kind)
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			ext := filepath.Ext(e.Name())
+			if ext != ".deb" && ext != ".rpm" {
+				continue
+			}
+			v, err := packageVersion(kind, filepath.Join(dir, e.Name()))
+			if err != nil {
+				return nil, err
+			}
+			if v == "" {
+				continue
+			}
+			if ext == ".deb" && strings.HasPrefix(v, r.manifest.Version+"-") {
+				// The Debian revision, such as -1, follows the version
+				v = r.manifest.Version
+			}
+			if ext == ".rpm" {
+				// rpm versions cannot contain -, so it is replaced with _
+				v = strings.ReplaceAll(v, "_", "-")
+			}
+			versions = append(versions, artifactVersion{Kind: strings.TrimPrefix(ext, ".") + " package version", Artifact: e.Name(), Version: v})
+		}
+	}
+	return versions, nil
+}
+
+// sbomVersions returns the version in the document name, such as "Istio Source 1.2.3", of each SBOM
+func sbomVersions(r ReleaseInfo) ([]artifactVersion, error) {
+	sboms, err := filepath.Glob(filepath.Join(r.release, "*.spdx"))
+	if err != nil {
+		return nil, err
+	}
+	versions := []artifactVersion{}
+	for _, sbom := range sboms {
+		f, err := os.Open(sbom)
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if name, found := strings.CutPrefix(scanner.Text(), "DocumentName: "); found {
+				fields := strings.Fields(name)
+				if len(fields) > 0 {
+					versions = append(versions, artifactVersion{Kind: "SBOM name", Artifact: filepath.Base(sbom), Version: fields[len(fields)-1]})
+				}
+				break
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %v: %v", sbom, err)
+		}
+	}
+	return versions, nil
+}